@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"octochan/core"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var authCmd = &cobra.Command{
+	Use:   "auth [token]",
+	Short: "Сохранить токен RLM API в зашифрованном хранилище",
+	Long: `Токен шифруется парольной фразой и сохраняется в ~/.octochan/vault.json
+для экземпляра из --rlm-instance. Парольная фраза берётся из
+OCHAN_VAULT_PASSPHRASE или запрашивается один раз за сессию.
+
+Срок действия JWT-токена определяется автоматически, для остальных его можно
+указать через --ttl. Токен, на который RLM ответил 401, помечается как
+истёкший: см. auth status.`,
+	Example: `auth
+auth token 0123abcd --ttl 8h
+auth --rlm-instance test
+auth status
+auth logout`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var token string
+		if len(args) == 0 {
+			fmt.Print("Введите токен: ")
+			line, _ := core.ReadStdinLine(context.Background())
+			token = strings.TrimSpace(line)
+		} else if len(args) == 2 && strings.EqualFold(args[0], "token") {
+			token = strings.TrimSpace(args[1])
+		} else {
+			token = strings.TrimSpace(args[0])
+		}
+		if token == "" {
+			fmt.Println("❌ Пустой токен")
+			return
+		}
+
+		expiresAt := core.TokenExpiry(token)
+		if ttl, _ := cmd.Flags().GetDuration("ttl"); ttl > 0 {
+			expiresAt = time.Now().Add(ttl)
+		}
+		if err := saveVaultToken(authInstance(), token, expiresAt); err != nil {
+			fmt.Printf("❌ Ошибка сохранения токена: %v\n", err)
+			return
+		}
+
+		fmt.Printf("✅ Токен для RLM %s сохранён в зашифрованном хранилище\n", authInstance())
+		if !expiresAt.IsZero() {
+			fmt.Printf("Действителен до: %s\n", expiresAt.Format("2006-01-02 15:04:05"))
+		}
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Показать токены: источник, срок действия, последнее использование",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := core.LoadTokenVault()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		now := time.Now()
+		fmt.Printf("%-12s %-14s %-20s %-19s %-19s %s\n", "RLM", "ИСТОЧНИК", "СОСТОЯНИЕ", "ИСТЕКАЕТ", "ИСПОЛЬЗОВАН", "СОХРАНЁН")
+		for _, name := range core.RLMInstances() {
+			source, state, expires, used, saved := "нет", "-", "-", "-", "-"
+			if viper.GetString(instanceConfigPrefix(name)+"api_token") != "" {
+				source, state = "config.yaml", "⚠️ открытым текстом"
+			} else if entry, ok := vault.Entries[name]; ok {
+				source, state = "хранилище", entry.State(now)
+				expires = "неизвестно"
+				if !entry.ExpiresAt.IsZero() {
+					expires = entry.ExpiresAt.Format("2006-01-02 15:04:05")
+				}
+				if !entry.LastUsed.IsZero() {
+					used = entry.LastUsed.Format("2006-01-02 15:04:05")
+				}
+				saved = entry.SavedAt.Format("2006-01-02 15:04:05")
+			} else if name == core.DefaultRLMInstance && core.LegacyEnvToken() != "" {
+				source, state = ".env", "⚠️ открытым текстом"
+			}
+			fmt.Printf("%-12s %-14s %-20s %-19s %-19s %s\n", name, source, state, expires, used, saved)
+		}
+
+		for name, entry := range vault.Entries {
+			if entry.Rejected() {
+				hint := "auth"
+				if name != core.DefaultRLMInstance {
+					hint += " --rlm-instance " + name
+				}
+				fmt.Printf("\n⚠️ RLM %s ответил 401 в %s: обновите токен командой %s\n",
+					name, entry.RejectedAt.Format("2006-01-02 15:04:05"), hint)
+			}
+		}
+		if core.LegacyEnvToken() != "" {
+			fmt.Println("\n⚠️ Токен хранится открытым текстом в ~/.octochan/.env, перенесите его: auth migrate")
+		}
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Удалить сохранённый токен",
+	Long: `Удаляет токен экземпляра из --rlm-instance из хранилища (пароль не нужен).
+С --all удаляется всё хранилище и старый ~/.octochan/.env.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		vault, err := core.LoadTokenVault()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		removed := 0
+		if all {
+			for name := range vault.Entries {
+				vault.Remove(name)
+				removed++
+			}
+		} else if vault.Remove(authInstance()) {
+			removed++
+		}
+		if err := vault.Save(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if all || authInstance() == core.DefaultRLMInstance {
+			if removeLegacyEnvToken() {
+				removed++
+			}
+		}
+		core.ForgetVaultSecrets()
+
+		if removed == 0 {
+			fmt.Printf("Сохранённого токена для RLM %s нет\n", authInstance())
+			return
+		}
+		fmt.Println("✅ Токен удалён")
+		if viper.GetString(instanceConfigPrefix(authInstance())+"api_token") != "" {
+			fmt.Printf("⚠️ В config.yaml остался api_token для RLM %s\n", authInstance())
+		}
+	},
+}
+
+var authMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Перенести токены из ~/.octochan/.env и config.yaml в хранилище",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		migrated := 0
+		for _, name := range core.RLMInstances() {
+			token := viper.GetString(instanceConfigPrefix(name) + "api_token")
+			if token == "" && name == core.DefaultRLMInstance {
+				token = core.LegacyEnvToken()
+			}
+			if token == "" {
+				continue
+			}
+			if err := saveVaultToken(name, token, core.TokenExpiry(token)); err != nil {
+				fmt.Printf("❌ RLM %s: %v\n", name, err)
+				return
+			}
+			fmt.Printf("🔒 RLM %s: токен перенесён в хранилище\n", name)
+			migrated++
+		}
+		if migrated == 0 {
+			fmt.Println("Токенов открытым текстом не найдено")
+		}
+	},
+}
+
+// saveVaultToken шифрует токен экземпляра и убирает его открытые копии:
+// api_token из config.yaml и ~/.octochan/.env.
+func saveVaultToken(name, token string, expiresAt time.Time) error {
+	if !containsString(core.RLMInstances(), name) {
+		return fmt.Errorf("экземпляр RLM '%s' не описан в конфиге. Доступные: %s",
+			name, strings.Join(core.RLMInstances(), ", "))
+	}
+	vault, err := core.UnlockTokenVault()
+	if err != nil {
+		return err
+	}
+	if err := vault.Put(name, token, expiresAt); err != nil {
+		return err
+	}
+	if err := vault.Save(); err != nil {
+		return err
+	}
+
+	key := instanceConfigPrefix(name) + "api_token"
+	if viper.GetString(key) != "" {
+		viper.Set(key, "")
+		if err := viper.WriteConfig(); err != nil {
+			fmt.Printf("⚠️ Не удалось убрать api_token из конфига: %v\n", err)
+		}
+	}
+	if name == core.DefaultRLMInstance {
+		removeLegacyEnvToken()
+	}
+	return nil
+}
+
+func removeLegacyEnvToken() bool {
+	path, err := core.LegacyEnvTokenPath()
+	if err != nil {
+		return false
+	}
+	return os.Remove(path) == nil
+}
+
+func instanceConfigPrefix(name string) string {
+	if name == "" || name == core.DefaultRLMInstance {
+		return "defaults."
+	}
+	return "rlm." + name + "."
+}
+
+func authInstance() string {
+	if rlmInstance == "" {
+		return core.DefaultRLMInstance
+	}
+	return rlmInstance
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	authCmd.Flags().Duration("ttl", 0, "Срок действия токена, если RLM его не сообщает (например 8h)")
+	authLogoutCmd.Flags().Bool("all", false, "Удалить токены всех экземпляров")
+	authCmd.AddCommand(authStatusCmd, authLogoutCmd, authMigrateCmd)
+	rootCmd.AddCommand(authCmd)
+}
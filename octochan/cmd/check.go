@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"octochan/core"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [script.och]",
+	Short: "Выполнить скрипт проверок конфигов",
+	Long: `Скрипт .och - последовательность операторов, по одному на строку:
+
+  name = выражение              переменная
+  if усл { ... } else if усл { ... } else { ... }
+  for f in glob("*.conf") { ... }
+  print a, b / warn msg / fail msg
+  assert условие[, сообщение]
+  exit [код]
+
+Выражения поддерживают and/or/not, сравнения с учётом единиц (16GB > 512MB),
+списки [a, b] и оператор in. Функции: get(file, key[, default]), has(file, key),
+keys(file), glob(pattern), len, min, max, lower, contains, startsWith, endsWith,
+matches.
+
+Код выхода: 0 - все проверки прошли, 1 - есть fail или проваленные assert
+(или значение exit), 2 - ошибка в скрипте.`,
+	Example: `check checks.och
+check checks.och --var env=prod
+check -e 'assert get("postgresql.conf", "shared_buffers") >= 1GB'`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		inline, _ := cmd.Flags().GetStringArray("eval")
+		rawVars, _ := cmd.Flags().GetStringArray("var")
+
+		var name, src string
+		switch {
+		case len(inline) > 0:
+			name, src = "-e", strings.Join(inline, "\n")
+		case len(args) == 1:
+			content, err := readConfigInput(args[0])
+			if err != nil {
+				fmt.Printf("❌ Ошибка чтения скрипта: %v\n", err)
+				os.Exit(2)
+			}
+			name, src = args[0], content
+		default:
+			cmd.Help()
+			return
+		}
+
+		vars := make(map[string]string)
+		for _, raw := range rawVars {
+			key, value, ok := strings.Cut(raw, "=")
+			if !ok || !core.IsOchIdent(key) {
+				fmt.Printf("❌ Неверная переменная '%s', ожидается name=value\n", raw)
+				os.Exit(2)
+			}
+			vars[key] = value
+		}
+
+		script, err := core.ParseOchScript(src, name)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+
+		result, err := script.Run(os.Stdout, vars)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+
+		if result.Failures > 0 || result.Warnings > 0 {
+			fmt.Printf("\nПроверок не пройдено: %d, предупреждений: %d\n", result.Failures, result.Warnings)
+		}
+		if result.ExitCode != 0 {
+			os.Exit(result.ExitCode)
+		}
+	},
+}
+
+func init() {
+	checkCmd.Flags().StringArray("var", nil, "Переменная скрипта name=value (можно повторять)")
+	checkCmd.Flags().StringArrayP("eval", "e", nil, "Выполнить строку скрипта вместо файла")
+	rootCmd.AddCommand(checkCmd)
+}
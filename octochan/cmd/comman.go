@@ -1,17 +1,19 @@
 package cmd
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"octochan/core"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -23,9 +25,14 @@ import (
 )
 
 var (
-	cfgFile  string
-	fastMode bool
-	watcher  *fsnotify.Watcher
+	cfgFile      string
+	rlmInstance  string
+	fastMode     bool
+	configFormat string
+	diffFormat   string
+	diffOutput   string
+	noIncludes   bool
+	watcher      *fsnotify.Watcher
 )
 
 var diffCmd = &cobra.Command{
@@ -33,19 +40,21 @@ var diffCmd = &cobra.Command{
 	Short: "Сравнить два конфигурационных файла",
 	Args:  cobra.RangeArgs(1, 2), // Теперь 1-2 аргумента вместо строго 2
 	Run: func(cmd *cobra.Command, args []string) {
+		// pg_hba.conf - упорядоченный список правил, а не набор параметров
+		if len(args) == 2 && isPgHbaFile(args[0]) && isPgHbaFile(args[1]) {
+			runHbaDiff(args[0], args[1])
+			return
+		}
+
 		scriptDir, err := core.GetScriptDir()
 		if err != nil {
 			fmt.Printf("Ошибка получения директории скрипта: %v\n", err)
 			return
 		}
 		reportsDir := filepath.Join(scriptDir, "reports")
-		snapshotsDir := filepath.Join(scriptDir, "snapshots")
-
-		for _, dir := range []string{reportsDir, snapshotsDir} {
-			if err := os.MkdirAll(dir, 0755); err != nil {
-				fmt.Printf("Ошибка создания директории %s: %v\n", dir, err)
-				return
-			}
+		if err := os.MkdirAll(reportsDir, 0755); err != nil {
+			fmt.Printf("Ошибка создания директории %s: %v\n", reportsDir, err)
+			return
 		}
 
 		var content1, content2 string
@@ -105,13 +114,13 @@ var diffCmd = &cobra.Command{
 			file2 = "empty"
 		}
 
-		cfg1, err := core.ParseConfig(content1)
+		cfg1, err := parseConfigInput(content1, file1)
 		if err != nil {
 			fmt.Printf("❌ Ошибка парсинга первого конфига: %v\n", err)
 			return
 		}
 
-		cfg2, err := core.ParseConfig(content2)
+		cfg2, err := parseConfigInput(content2, file2)
 		if err != nil {
 			fmt.Printf("❌ Ошибка парсинга второго конфига: %v\n", err)
 			return
@@ -119,6 +128,22 @@ var diffCmd = &cobra.Command{
 
 		diff := core.CompareConfigs(cfg1, cfg2, file1, file2)
 
+		exporter, err := core.GetDiffExporter(diffFormat)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		report := core.NewDiffReport(diff, file1, file2)
+		report.AttachSources(traceConfigInput(content1, file1), traceConfigInput(content2, file2))
+
+		// В pipe явно заданный формат отчёта уходит в stdout, как с -o -.
+		if diffOutput == "-" || (IsPipeMode() && diffOutput == "" && cmd.Flags().Changed("format")) {
+			if err := exporter.Export(os.Stdout, report); err != nil {
+				fmt.Printf("❌ Ошибка формирования отчета: %v\n", err)
+			}
+			return
+		}
+
 		if len(diff) == 0 {
 			fmt.Println("Файлы идентичны!")
 			return
@@ -133,22 +158,39 @@ var diffCmd = &cobra.Command{
 		}
 
 		fmt.Println("Найдены различия:")
-		for param, vals := range diff {
-			fmt.Printf("%s:\n  %s -> %s\n", param, vals[file1], vals[file2])
+		for _, e := range report.Entries {
+			fmt.Printf("%s:\n  %s -> %s\n", e.Param, e.Left, e.Right)
+			if e.LeftSource != "" || e.RightSource != "" {
+				fmt.Printf("  (%s -> %s)\n", sourceOrNA(e.LeftSource), sourceOrNA(e.RightSource))
+			}
+			for _, old := range e.LeftOverridden() {
+				fmt.Printf("    %s: переопределяет %s\n", file1, old)
+			}
+			for _, old := range e.RightOverridden() {
+				fmt.Printf("    %s: переопределяет %s\n", file2, old)
+			}
 		}
-		if !IsPipeMode() {
-			reportNum, _ := core.GetNextReportNumber(reportsDir)
-			outputFile := filepath.Join(reportsDir, fmt.Sprintf("diff_report_%d.txt", reportNum))
-			core.SaveDiffToFile(diff, outputFile, file1, file2)
+		if !IsPipeMode() || diffOutput != "" {
+			outputFile := diffOutput
+			if outputFile == "" {
+				reportNum, _ := core.GetNextReportNumber(reportsDir)
+				outputFile = filepath.Join(reportsDir, fmt.Sprintf("diff_report_%d%s", reportNum, exporter.Extension()))
+			}
+			if err := core.SaveDiffReport(report, outputFile, exporter.Name()); err != nil {
+				fmt.Printf("❌ Ошибка сохранения отчета: %v\n", err)
+				return
+			}
 			fmt.Printf("\nОтчет сохранен в: %s\n", outputFile)
 
-			snapshot, err := core.CreateSnapshot(nil, cfg1, cfg2, "system", "autogenerated")
+			store, err := core.DefaultSnapshotStore()
 			if err != nil {
-				fmt.Printf("Ошибка создания снапшота: %v\n", err)
+				fmt.Printf("Ошибка открытия хранилища снапшотов: %v\n", err)
 				return
 			}
-			if err := core.SaveSnapshot(snapshot, snapshotsDir); err != nil {
-				fmt.Printf("Ошибка сохранения снапшота: %v\n", err)
+			message := fmt.Sprintf("diff %s -> %s", file1, file2)
+			snapshot, err := store.RecordDiff(cfg1, cfg2, snapshotAuthor(), message)
+			if err != nil {
+				fmt.Printf("Ошибка создания снапшота: %v\n", err)
 				return
 			}
 			fmt.Printf("Снапшот создан: %s\n", snapshot.ID)
@@ -220,8 +262,27 @@ var findCmd = &cobra.Command{
 	Use:   "find <file> <parameter>",
 	Short: "Найти параметр в конфиге",
 	Run: func(cmd *cobra.Command, args []string) {
-		content, _ := os.ReadFile(args[0])
-		cfg, _ := core.ParseConfig(string(content))
+		content, err := readConfigInput(args[0])
+		if err != nil {
+			fmt.Printf("Ошибка чтения файла: %v\n", err)
+			return
+		}
+		cfg, err := parseConfigInput(content, args[0])
+		if err != nil {
+			fmt.Printf("Ошибка парсинга: %v\n", err)
+			return
+		}
+
+		if prov := traceConfigInput(content, args[0]); prov != nil {
+			for _, p := range prov.Lookup(args[1]) {
+				def := p.Effective()
+				fmt.Printf("[%s] %s = %v  (%s)\n", def.Section, def.Key, def.Value, def.Location())
+				for _, old := range p.Overridden() {
+					fmt.Printf("    переопределяет %s: %s\n", old.Location(), old.Raw)
+				}
+			}
+			return
+		}
 
 		for section, params := range cfg {
 			if val, ok := params[args[1]]; ok {
@@ -231,6 +292,81 @@ var findCmd = &cobra.Command{
 	},
 }
 
+var explainCmd = &cobra.Command{
+	Use:   "explain <file> <parameter>",
+	Short: "Показать, откуда взято значение параметра и что оно переопределило",
+	Example: `explain postgresql.conf shared_buffers
+explain pgbouncer.ini pgbouncer.pool_mode`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := readConfigInput(args[0])
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
+			return
+		}
+		if !isConfDocument(args[0], content) {
+			fmt.Println("❌ explain поддерживает только postgresql.conf/INI файлы")
+			return
+		}
+
+		prov, err := core.ParseConfigWithProvenance(content, args[0])
+		if err != nil {
+			fmt.Printf("❌ Ошибка парсинга: %v\n", err)
+			return
+		}
+
+		found := prov.Lookup(args[1])
+		if len(found) == 0 {
+			fmt.Printf("Параметр %s не задан в %s (действует значение по умолчанию)\n", args[1], args[0])
+			os.Exit(1)
+		}
+
+		for _, p := range found {
+			def := p.Effective()
+			fmt.Printf("%-12s %s\n", "name:", strings.TrimPrefix(p.Param, "."))
+			fmt.Printf("%-12s %s\n", "setting:", def.Value)
+			if normalized := core.NormalizeParamValue(def.Key, def.Value); normalized != nil && fmt.Sprint(normalized) != def.Value {
+				fmt.Printf("%-12s %v\n", "normalized:", normalized)
+			}
+			fmt.Printf("%-12s %s\n", "sourcefile:", def.File)
+			fmt.Printf("%-12s %d\n", "sourceline:", def.Line)
+
+			fmt.Println("\nЦепочка определений:")
+			for i, d := range p.Definitions {
+				marker := "переопределено"
+				if i == len(p.Definitions)-1 {
+					marker = "действует"
+				}
+				fmt.Printf("  %d. %-30s %-40s [%s]\n", i+1, d.Location(), d.Raw, marker)
+			}
+			fmt.Println()
+		}
+	},
+}
+
+// traceConfigInput возвращает происхождение параметров для postgresql.conf/INI
+// или nil для остальных форматов.
+func traceConfigInput(content, fileName string) core.ConfigProvenance {
+	if fileName == "empty" || !isConfDocument(fileName, content) {
+		return nil
+	}
+	if noIncludes && core.HasConfIncludes(content) {
+		return nil
+	}
+	prov, err := core.ParseConfigWithProvenance(content, fileName)
+	if err != nil {
+		return nil
+	}
+	return prov
+}
+
+func sourceOrNA(source string) string {
+	if source == "" {
+		return "N/A"
+	}
+	return source
+}
+
 var installCmd = &cobra.Command{
 	Use:   "!install <module_file>",
 	Short: "Установить новый модуль команд",
@@ -296,6 +432,7 @@ var helpCmd = &cobra.Command{
 var patchCmd = &cobra.Command{
 	Use:   "patch <base_file> <changes_file>",
 	Short: "Применить изменения к основному конфигу",
+	Args:  cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		content1, err := core.ReadFile(args[0])
 		if err != nil {
@@ -309,175 +446,321 @@ var patchCmd = &cobra.Command{
 			return
 		}
 
-		base, err := core.ParseConfig(content1)
+		base, err := parseConfigInput(content1, args[0])
 		if err != nil {
 			fmt.Printf("Ошибка парсинга: %v\n", err)
 			return
 		}
 
-		changes, err := core.ParseConfig(content2)
+		changes, err := parseConfigInput(content2, args[1])
 		if err != nil {
 			fmt.Printf("Ошибка парсинга: %v\n", err)
 			return
 		}
 
-		for section, params := range changes {
-			if _, exists := base[section]; !exists {
-				base[section] = make(map[string]string)
+		inPlace, _ := cmd.Flags().GetBool("in-place")
+		backup, _ := cmd.Flags().GetBool("backup")
+		outputFile, _ := cmd.Flags().GetString("output")
+		if inPlace {
+			outputFile = args[0]
+		}
+
+		if !isConfDocument(args[0], content1) {
+			merged := make(map[string]map[string]string, len(base))
+			for _, cfg := range []map[string]map[string]string{base, changes} {
+				for section, params := range cfg {
+					if _, exists := merged[section]; !exists {
+						merged[section] = make(map[string]string)
+					}
+					for k, v := range params {
+						merged[section][k] = v
+					}
+				}
 			}
-			for k, v := range params {
-				base[section][k] = v
+
+			if _, err := writeConfigOutput(base, merged, args[0], content1, outputFile, backup && inPlace); err != nil {
+				fmt.Printf("Ошибка сохранения: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Изменения успешно применены и сохранены в %s\n", outputFile)
+			return
+		}
+
+		doc := core.ParseConfDocument(content1)
+		var edits []core.ConfEdit
+		for _, section := range sortedKeys(changes) {
+			for _, key := range sortedKeys(changes[section]) {
+				if current, ok := doc.Get(section, key); ok && current == changes[section][key] {
+					continue
+				}
+				edits = append(edits, doc.Set(section, key, changes[section][key]))
 			}
 		}
 
-		if err := core.SaveConfig(base, "patched.conf"); err != nil {
+		if err := core.SaveConfDocument(doc, outputFile, backup && inPlace); err != nil {
 			fmt.Printf("Ошибка сохранения: %v\n", err)
 			return
 		}
-		fmt.Println("Изменения успешно применены и сохранены в patched.conf")
+		printConfEdits(edits)
+		if backup && inPlace {
+			fmt.Printf("Резервная копия: %s.bak\n", outputFile)
+		}
+		fmt.Printf("Изменения успешно применены и сохранены в %s\n", outputFile)
 	},
 }
 
-var authCmd = &cobra.Command{
-	Use:   "auth [token]",
-	Short: "Установить токен для доступа к RLM API",
-	Args:  cobra.MaximumNArgs(2), // Изменили на 2
+var setCmd = &cobra.Command{
+	Use:   "set <file> key=value [key=value...]",
+	Short: "Изменить параметры конфига с сохранением комментариев и порядка строк",
+	Example: `set postgresql.conf shared_buffers=4GB work_mem=64MB
+set pgbouncer.ini --section pgbouncer pool_mode=transaction`,
+	Args: cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		initConfig()
-
-		var token string
-		if len(args) == 0 {
-			fmt.Print("Введите токен: ")
-			scanner := bufio.NewScanner(os.Stdin)
-			scanner.Scan()
-			token = strings.TrimSpace(scanner.Text())
-		} else if len(args) == 2 && strings.EqualFold(args[0], "token") {
-			token = strings.TrimSpace(args[1])
-		} else {
-			token = strings.TrimSpace(args[0])
-		}
+		section, _ := cmd.Flags().GetString("section")
+		backup, _ := cmd.Flags().GetBool("backup")
 
-		home, err := os.UserHomeDir()
+		doc, err := core.LoadConfDocument(args[0])
 		if err != nil {
-			fmt.Printf("❌ Ошибка определения домашней директории: %v\n", err)
+			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
 			return
 		}
 
-		envPath := filepath.Join(home, ".octochan", ".env")
-		envContent := fmt.Sprintf("API_TOKEN=%s\n", token)
-
-		if err := os.WriteFile(envPath, []byte(envContent), 0600); err != nil {
-			fmt.Printf("❌ Ошибка сохранения токена: %v\n", err)
-			return
+		var edits []core.ConfEdit
+		for _, pair := range args[1:] {
+			eqIndex := strings.Index(pair, "=")
+			if eqIndex <= 0 {
+				fmt.Printf("❌ Неверный формат '%s', ожидается key=value\n", pair)
+				return
+			}
+			key := strings.TrimSpace(pair[:eqIndex])
+			value := strings.TrimSpace(pair[eqIndex+1:])
+			edits = append(edits, doc.Set(section, key, value))
 		}
 
-		if viper.GetBool("defaults.token_timer_enabled") {
-			go startTokenTimer()
+		if err := core.SaveConfDocument(doc, args[0], backup); err != nil {
+			fmt.Printf("❌ Ошибка сохранения: %v\n", err)
+			return
 		}
-
-		fmt.Println("✅ Токен успешно сохранен")
+		printConfEdits(edits)
 	},
 }
-var statusCmd = &cobra.Command{
-	Use:   "status <task_id>",
-	Short: "Проверить статус выполнения задачи",
-	Args:  cobra.ExactArgs(1),
+
+var unsetCmd = &cobra.Command{
+	Use:   "unset <file> key [key...]",
+	Short: "Удалить параметры из конфига с сохранением остальных строк",
+	Args:  cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		taskID := args[0]
-		if err := core.PrintTaskStatus(taskID); err != nil {
-			fmt.Printf("❌ Ошибка: %v\n", err)
+		section, _ := cmd.Flags().GetString("section")
+		backup, _ := cmd.Flags().GetBool("backup")
+
+		doc, err := core.LoadConfDocument(args[0])
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
+			return
+		}
+
+		var edits []core.ConfEdit
+		for _, key := range args[1:] {
+			removed := doc.Unset(section, key)
+			if len(removed) == 0 {
+				fmt.Printf("⚠️ Параметр %s не найден\n", key)
+			}
+			edits = append(edits, removed...)
+		}
+		if len(edits) == 0 {
+			return
+		}
+
+		if err := core.SaveConfDocument(doc, args[0], backup); err != nil {
+			fmt.Printf("❌ Ошибка сохранения: %v\n", err)
 			return
 		}
+		printConfEdits(edits)
 	},
 }
 
-func loadEnv() {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return
+// isConfDocument сообщает, можно ли редактировать файл построчно
+// (postgresql.conf/INI), а не пересобирать его из карты параметров.
+func isConfDocument(path, content string) bool {
+	format := configFormat
+	if format == "" || format == "auto" {
+		format = core.DetectConfigFormat(path, content)
 	}
+	return format == "ini"
+}
 
-	envPath := filepath.Join(home, ".octochan", ".env")
-	if _, err := os.Stat(envPath); os.IsNotExist(err) {
-		return
+// writeConfigOutput записывает переход before -> after конфига input
+// (content - его содержимое) в output. Конфиг key = value правится
+// построчно через ConfDocument: комментарии и порядок строк сохраняются.
+// YAML, JSON, TOML и ENV в этот вид не переводятся: перезаписать такой
+// файл нельзя, результат можно сохранить только в отдельный .conf.
+func writeConfigOutput(before, after map[string]map[string]string, input, content, output string, backup bool) ([]core.ConfEdit, error) {
+	if !isConfDocument(input, content) {
+		if output == input || core.DetectConfigFormat(output, "") != "ini" {
+			return nil, fmt.Errorf("запись в формате %s не поддерживается, сохраните результат в .conf через -o", core.DetectConfigFormat(input, content))
+		}
+		return nil, core.SaveConfig(after, output)
 	}
 
-	envFile, err := os.ReadFile(envPath)
+	doc := core.ParseConfDocument(content)
+	edits := doc.ApplyDiff(before, after)
+	return edits, core.SaveConfDocument(doc, output, backup && output == input)
+}
+
+// writeConfigState записывает полное состояние config в path. Существующий
+// файл key = value правится построчно, новый создаётся.
+func writeConfigState(config map[string]map[string]string, path string) ([]core.ConfEdit, error) {
+	content, err := readConfigTarget(path)
 	if err != nil {
-		return
+		return nil, err
 	}
+	before := core.ParseConfDocument(content).Config()
+	return writeConfigOutput(before, config, path, content, path, false)
+}
 
-	lines := strings.Split(string(envFile), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "API_TOKEN=") {
-			token := strings.TrimPrefix(line, "API_TOKEN=")
-			viper.Set("defaults.api_token", token)
+// readConfigTarget читает файл, в который будет записано состояние конфига
+// ("" для нового), и проверяет, что он в формате key = value.
+func readConfigTarget(path string) (string, error) {
+	content := ""
+	if core.FileExists(path) {
+		data, err := core.ReadFile(path)
+		if err != nil {
+			return "", err
 		}
+		content = data
+	}
+	if !isConfDocument(path, content) {
+		return "", fmt.Errorf("запись в формате %s не поддерживается, укажите файл .conf", core.DetectConfigFormat(path, content))
 	}
+	return content, nil
 }
 
-var timerCmd = &cobra.Command{
-	Use:   "timer [on|off]",
-	Short: "Управление таймером смены токена",
-	Args:  cobra.MaximumNArgs(1),
+func printConfEdits(edits []core.ConfEdit) {
+	for _, e := range edits {
+		fmt.Printf("@@ строка %d @@\n", e.Line)
+		if e.Old != "" {
+			fmt.Printf("- %s\n", e.Old)
+		}
+		if e.New != "" {
+			fmt.Printf("+ %s\n", e.New)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <base> <ours> <theirs>",
+	Short: "Трёхстороннее слияние конфигов с поиском конфликтов",
+	Example: `merge postgresql.conf dba.conf automation.conf -o merged.conf
+merge base.conf ours.conf theirs.conf --prefer theirs --report conflicts.json`,
+	Args: cobra.ExactArgs(3),
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 {
-			status := "выключен"
-			if viper.GetBool("defaults.token_timer_enabled") {
-				status = "включен"
+		prefer, _ := cmd.Flags().GetString("prefer")
+		outputFile, _ := cmd.Flags().GetString("output")
+		reportFile, _ := cmd.Flags().GetString("report")
+
+		var configs []map[string]map[string]string
+		for _, path := range args {
+			content, err := readConfigInput(path)
+			if err != nil {
+				fmt.Printf("❌ Ошибка чтения файла %s: %v\n", path, err)
+				return
 			}
-			fmt.Printf("Таймер смены токена: %s\n", status)
+			cfg, err := parseConfigInput(content, path)
+			if err != nil {
+				fmt.Printf("❌ Ошибка парсинга %s: %v\n", path, err)
+				return
+			}
+			configs = append(configs, cfg)
+		}
+
+		result, err := core.MergeConfigs(configs[0], configs[1], configs[2], prefer)
+		if err != nil {
+			fmt.Printf("❌ Ошибка слияния: %v\n", err)
 			return
 		}
 
-		switch args[0] {
-		case "on":
-			viper.Set("defaults.token_timer_enabled", true)
-			fmt.Println("Таймер смены токена включен")
-			go startTokenTimer()
-		case "off":
-			viper.Set("defaults.token_timer_enabled", false)
-			fmt.Println("Таймер смены токена выключен")
-		default:
-			fmt.Println("Используйте: timer on или timer off")
+		for _, change := range result.Applied {
+			fmt.Printf("✅ %s: %s -> %s (%s)\n", change.Param, mergeValueString(change.Base), mergeValueString(change.Result), change.Source)
+		}
+		for _, c := range result.Conflicts {
+			if c.ResolvedBy != "" {
+				fmt.Printf("⚠️ Конфликт %s разрешён в пользу %s: ours=%s theirs=%s\n", c.Param, c.ResolvedBy, mergeValueString(c.Ours), mergeValueString(c.Theirs))
+			} else {
+				fmt.Printf("❌ Конфликт %s: base=%s ours=%s theirs=%s\n", c.Param, mergeValueString(c.Base), mergeValueString(c.Ours), mergeValueString(c.Theirs))
+			}
 		}
 
-		if err := viper.WriteConfig(); err != nil {
-			fmt.Printf("❌ Ошибка сохранения настроек: %v\n", err)
+		if err := os.WriteFile(outputFile, []byte(core.RenderMergedConfig(result)), 0644); err != nil {
+			fmt.Printf("❌ Ошибка сохранения: %v\n", err)
+			return
+		}
+		fmt.Printf("Результат слияния сохранен в %s\n", outputFile)
+
+		if reportFile != "" {
+			if err := core.SaveMergeReport(result, reportFile); err != nil {
+				fmt.Printf("❌ Ошибка сохранения отчета о конфликтах: %v\n", err)
+				return
+			}
+			fmt.Printf("Отчет о конфликтах сохранен в %s\n", reportFile)
+		}
+
+		if unresolved := result.UnresolvedConflicts(); len(unresolved) > 0 {
+			fmt.Printf("\n❌ Неразрешённых конфликтов: %d. Исправьте маркеры в %s или используйте --prefer ours|theirs\n", len(unresolved), outputFile)
+			os.Exit(1)
 		}
 	},
 }
 
-var tokenTimer *time.Timer
-
-func startTokenTimer() {
-	if tokenTimer != nil {
-		tokenTimer.Stop()
+func mergeValueString(v core.MergeValue) string {
+	if !v.Exists {
+		return "N/A"
 	}
+	return v.Value
+}
 
-	tokenTimer = time.AfterFunc(15*time.Minute, func() {
-		fmt.Println("\n⚠️ ВНИМАНИЕ: Токен будет недействителен через 5 минут!")
-		fmt.Println("Пожалуйста, обновите токен с помощью команды 'auth'")
-
-		time.Sleep(10 * time.Minute)
-		fmt.Println("\n Токен больше не действителен!")
-		fmt.Println("Для продолжения работы обновите токен с помощью команды 'auth'")
+var statusCmd = &cobra.Command{
+	Use:   "status <task_id>",
+	Short: "Проверить статус выполнения задачи",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		taskID := args[0]
+		client, err := rlmClient()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if err := core.PrintTaskStatus(client, taskID); err != nil {
+			fmt.Printf("❌ Ошибка: %v\n", err)
+			return
+		}
+	},
+}
 
-		viper.Set("defaults.api_token", "")
-	})
+// rlmClient - клиент экземпляра RLM, выбранного --rlm-instance.
+func rlmClient() (*core.RLMClient, error) {
+	return core.NewRLMClientFromConfig(rlmInstance)
 }
 
 var statsCmd = &cobra.Command{
 	Use:   "stats <file>",
 	Short: "Показать статистику конфига",
 	Run: func(cmd *cobra.Command, args []string) {
-		content, err := core.ReadFile(args[0])
+		content, err := readConfigInput(args[0])
 		if err != nil {
 			fmt.Printf("Ошибка чтения файла: %v\n", err)
 			return
 		}
 
-		cfg, err := core.ParseConfig(content)
+		cfg, err := parseConfigInput(content, args[0])
 		if err != nil {
 			fmt.Printf("Ошибка парсинга: %v\n", err)
 			return
@@ -496,13 +779,64 @@ var validateCmd = &cobra.Command{
 	Use:   "validate <file>",
 	Short: "Проверить конфиг на ошибки",
 	Run: func(cmd *cobra.Command, args []string) {
-		content, _ := os.ReadFile(args[0])
-		_, err := core.ParseConfig(string(content))
+		content, err := readConfigInput(args[0])
+		if err != nil {
+			fmt.Printf("Ошибка чтения файла: %v\n", err)
+			return
+		}
+		rulesFile, _ := cmd.Flags().GetString("rules")
+		failOn, _ := cmd.Flags().GetString("fail-on")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		if failOn, err = core.ParseSeverity(failOn); err != nil {
+			fmt.Printf("❌ --fail-on: %v\n", err)
+			os.Exit(2)
+		}
+
+		cfg, err := parseConfigInput(content, args[0])
 		if err != nil {
 			fmt.Printf("Ошибка: %v\n", err)
+			if rulesFile != "" {
+				os.Exit(2)
+			}
+			return
+		}
+		if rulesFile == "" {
+			fmt.Println("Конфиг валиден")
 			return
 		}
-		fmt.Println("Конфиг валиден")
+
+		policy, err := core.LoadPolicy(rulesFile)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+		violations := policy.Evaluate(cfg)
+
+		if asJSON {
+			if violations == nil {
+				violations = []core.PolicyViolation{}
+			}
+			data, _ := json.MarshalIndent(violations, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			icons := map[string]string{core.SeverityError: "❌", core.SeverityWarning: "⚠️", core.SeverityInfo: "ℹ️"}
+			for _, v := range violations {
+				if v.Param != "" {
+					fmt.Printf("%s [%s] %s: %s\n", icons[v.Severity], v.Rule, v.Param, v.Message)
+				} else {
+					fmt.Printf("%s [%s] %s\n", icons[v.Severity], v.Rule, v.Message)
+				}
+			}
+			if len(violations) == 0 {
+				fmt.Printf("✅ Конфиг соответствует правилам (%d)\n", len(policy.Rules))
+			} else {
+				fmt.Printf("\nНарушений: %d\n", len(violations))
+			}
+		}
+
+		if core.HasFailures(violations, failOn) {
+			os.Exit(1)
+		}
 	},
 }
 
@@ -528,6 +862,30 @@ func resolveInputPath(inputPath, scriptDir, reportsDir string) string {
 	return inputPath
 }
 
+func readConfigInput(path string) (string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return core.ReadFile(path)
+}
+
+// parseConfigInput разбирает конфиг в выбранном формате. Конфиг key = value
+// разбирается как postgresql.conf: имена параметров без учёта регистра, а
+// при include-директивах возвращается итоговый конфиг со всеми включениями.
+func parseConfigInput(content, fileName string) (map[string]map[string]string, error) {
+	if isConfDocument(fileName, content) {
+		if !noIncludes && core.HasConfIncludes(content) {
+			return core.ParseEffectiveConfig(content, fileName)
+		}
+		return core.ParseConfDocument(content).Config(), nil
+	}
+	return core.ParseConfigAs(content, fileName, configFormat)
+}
+
 func initConfig() {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -554,17 +912,22 @@ func initConfig() {
 	cfgPath := filepath.Join(home, "octochan", "config.yaml")
 	viper.SetConfigFile(cfgPath)
 
-	loadEnv()
-
 	if _, err := os.Stat(cfgPath); os.IsNotExist(err) {
 		viper.Set("defaults.api_url", "https://rlm.sigma.sbrf.ru/api/tasks.json")
 		viper.Set("defaults.scenario_path", filepath.Join(home, ".octochan", "scenarios"))
 		viper.Set("defaults.auto_check_status", false)
 		viper.Set("defaults.max_parallel_tasks", 5)
+		viper.Set("defaults.task_timeout", "30m")
+		viper.Set("defaults.poll_interval", "20s")
+		viper.Set("defaults.retry.max_attempts", 3)
+		viper.Set("defaults.retry.initial_delay", "1s")
+		viper.Set("defaults.retry.max_delay", "30s")
+		viper.Set("defaults.retry.multiplier", 2)
+		viper.Set("defaults.retry.jitter", 0.2)
+		viper.Set("defaults.retry.idempotency_check", true)
 		viper.Set("defaults.log_path", filepath.Join(home, ".octochan", "logs"))
 		viper.Set("defaults.log_max_size", 10)
 		viper.Set("defaults.log_max_backups", 5)
-		viper.Set("defaults.token_timer_enabled", true)
 		if err := viper.WriteConfig(); err != nil {
 			fmt.Printf("❌ Ошибка создания конфига: %v\n", err)
 		}
@@ -574,9 +937,6 @@ func initConfig() {
 		fmt.Println("⚙️ Используется конфиг:", viper.ConfigFileUsed())
 	}
 
-	if viper.GetBool("defaults.token_timer_enabled") && viper.GetString("defaults.api_token") != "" {
-		go startTokenTimer()
-	}
 }
 func showLogs(tail int) {
 	logPath := viper.GetString("defaults.log_path")
@@ -689,12 +1049,27 @@ func watchModules() {
 	}
 }
 
-var lastIfResult *bool
+var ifOperators = map[string]string{
+	"==": "current == expected",
+	"!=": "current != expected",
+	">":  "current > expected",
+	"<":  "current < expected",
+	">=": "current >= expected",
+	"<=": "current <= expected",
+
+	"contains":   "contains(current, expected)",
+	"startsWith": "startsWith(current, expected)",
+	"endsWith":   "endsWith(current, expected)",
+}
+
 var ifCmd = &cobra.Command{
-	Use:   "if [файл] [секция.параметр] [оператор] [значение] [результат]",
+	Use:   "if [файл] [параметр] [оператор] [значение] [результат]",
 	Short: "Условный оператор для проверки значений в конфиге",
+	Long: `Проверяет одно условие. Числа сравниваются с учётом единиц (16GB > 512MB),
+параметр можно указать как section.param или без секции (shared_buffers).
+Для нескольких условий, else и циклов используйте скрипт: ochan check script.och`,
 	Example: `if config.conf server.port == 8080 "Порт корректен"
-if config.conf database.enabled != false "Включите базу данных"`,
+if postgresql.conf shared_buffers ">=" 4GB "shared_buffers достаточно"`,
 	Args: cobra.ExactArgs(5),
 	Run: func(cmd *cobra.Command, args []string) {
 		filePath := args[0]
@@ -703,96 +1078,58 @@ if config.conf database.enabled != false "Включите базу данных
 		expectedValue := args[3]
 		resultMessage := args[4]
 
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
+		source, ok := ifOperators[operator]
+		if !ok {
+			fmt.Printf("❌ Неподдерживаемый оператор: %s\n", operator)
+			fmt.Println("Доступные операторы: ==, !=, >, <, >=, <=, contains, startsWith, endsWith")
 			return
 		}
 
-		cfg, err := core.ParseConfig(string(content))
+		content, err := readConfigInput(filePath)
 		if err != nil {
-			fmt.Printf("❌ Ошибка парсинга конфига: %v\n", err)
+			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
 			return
 		}
 
-		parts := strings.Split(paramPath, ".")
-		if len(parts) != 2 {
-			fmt.Printf("❌ Неверный формат параметра. Используйте: section.param\n")
+		cfg, err := parseConfigInput(content, filePath)
+		if err != nil {
+			fmt.Printf("❌ Ошибка парсинга конфига: %v\n", err)
 			return
 		}
 
-		section, param := parts[0], parts[1]
-
-		currentValue, exists := cfg[section][param]
+		currentValue, exists := core.LookupConfigParam(cfg, paramPath)
 		if !exists {
-			fmt.Printf("❌ Параметр %s не найден в секции %s\n", param, section)
+			fmt.Printf("❌ Параметр %s не найден\n", paramPath)
 			return
 		}
 
-		isConditionMet := false
-
-		switch operator {
-		case "==":
-			isConditionMet = (currentValue == expectedValue)
-		case "!=":
-			isConditionMet = (currentValue != expectedValue)
-		case ">":
-
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum > expectedNum)
-			} else {
-				isConditionMet = (currentValue > expectedValue)
-			}
-		case "<":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum < expectedNum)
-			} else {
-				isConditionMet = (currentValue < expectedValue)
-			}
-		case ">=":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum >= expectedNum)
-			} else {
-				isConditionMet = (currentValue >= expectedValue)
-			}
-		case "<=":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum <= expectedNum)
-			} else {
-				isConditionMet = (currentValue <= expectedValue)
-			}
-		case "contains":
-			isConditionMet = strings.Contains(currentValue, expectedValue)
-		case "startsWith":
-			isConditionMet = strings.HasPrefix(currentValue, expectedValue)
-		case "endsWith":
-			isConditionMet = strings.HasSuffix(currentValue, expectedValue)
-		default:
-			fmt.Printf(" Неподдерживаемый оператор: %s\n", operator)
-			fmt.Println("Доступные операторы: ==, !=, >, <, >=, <=, contains, startsWith, endsWith")
+		vars := map[string]core.ExprValue{
+			"current":  core.ParamExprValue(paramPath, currentValue),
+			"expected": core.ParamExprValue(paramPath, expectedValue),
+		}
+		env := &core.ExprEnv{
+			Resolve: func(name string) (core.ExprValue, bool) {
+				v, ok := vars[name]
+				return v, ok
+			},
+		}
+		result, err := core.EvalExpr(source, env)
+		if err != nil {
+			fmt.Printf("❌ Ошибка сравнения: %v\n", err)
 			return
 		}
 
-		lastIfResult = &isConditionMet
-		if isConditionMet {
-			fmt.Printf(" %s\n", resultMessage)
+		if result.Truthy() {
+			fmt.Printf("✅ %s\n", resultMessage)
 			fmt.Printf("   %s = %s %s %s\n", paramPath, currentValue, operator, expectedValue)
 		} else {
-			fmt.Printf(" Условие не выполнено: %s %s %s\n",
+			fmt.Printf("❌ Условие не выполнено: %s %s %s\n",
 				currentValue, operator, expectedValue)
 		}
 	},
 }
 var applyCmd = &cobra.Command{
-	Use:   "apply [-rlm] [file] [custom_params...]",
+	Use:   "apply [-rlm] [--dry-run] [--wait] [--env name] [--var key=value] [file] [custom_params...]",
 	Short: "Применить сценарий или конфигурацию",
 	Args:  cobra.MinimumNArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
@@ -857,27 +1194,102 @@ var applyCmd = &cobra.Command{
 				}
 			}
 
-			token := viper.GetString("defaults.api_token")
-			if token == "" {
+			scenarioPath := "-"
+			if len(args) > 0 {
+				scenarioPath = args[0]
+			}
+			scenarioData, err := renderScenarioFromFlags(cmd, scenarioPath, scenarioData)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+
+			client, err := rlmClient()
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+
+			if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+				showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+				asJSON, _ := cmd.Flags().GetBool("json")
+				runApplyDryRun(client, scenarioData, customParams, rolloutFromFlags(cmd, scenarioData), showSecrets, asJSON)
+				return
+			}
+
+			if !client.HasToken() {
 				fmt.Println("❌ Токен не установлен. Используйте команду 'auth' для установки токена")
 				return
 			}
+			if err := client.UnlockToken(); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+
+			opts := core.DefaultExecOptions()
+			opts.Wait, _ = cmd.Flags().GetBool("wait")
+			if cmd.Flags().Changed("timeout") {
+				opts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+			}
+			if cmd.Flags().Changed("task-timeout") {
+				opts.TaskTimeout, _ = cmd.Flags().GetDuration("task-timeout")
+			}
+			if cmd.Flags().Changed("poll-interval") {
+				opts.PollInterval, _ = cmd.Flags().GetDuration("poll-interval")
+			}
+			// Раскатка волнами решает, продолжать ли, по итогам задач, поэтому
+			// всегда ждёт их завершения.
+			if opts.Rollout = rolloutFromFlags(cmd, scenarioData); opts.Rollout != nil {
+				opts.Wait = true
+				opts.Confirm = confirmFromTerminal
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
 
-			taskIDs, err := core.ExecuteScenarioData(scenarioData, customParams)
+			result, err := core.ExecuteModularScenarioContext(ctx, client, scenarioData, customParams, opts)
 			if err != nil {
 				fmt.Printf("❌ Ошибка выполнения сценария: %v\n", err)
-				return
+				if result == nil || len(result.Outcomes) == 0 {
+					if ctx.Err() != nil {
+						os.Exit(130)
+					}
+					if opts.Wait {
+						os.Exit(1)
+					}
+					return
+				}
 			}
 
 			fmt.Println("✅ Созданные задачи:")
-			for _, taskID := range taskIDs {
+			for _, taskID := range result.TaskIDs() {
 				fmt.Printf("- %s\n", taskID)
 			}
 
+			if opts.Wait {
+				printExecutionSummary(result)
+				printRolloutReport(result)
+				switch {
+				case ctx.Err() != nil:
+					fmt.Println("\n⏹ Выполнение прервано, созданные задачи продолжают выполняться в RLM")
+					fmt.Println("   Продолжить ожидание: ochan tasks watch")
+					os.Exit(130)
+				case result.Failed() > 0:
+					fmt.Printf("\n❌ Завершились с ошибкой: %d из %d\n", result.Failed(), len(result.Outcomes))
+					os.Exit(1)
+				case err != nil:
+					fmt.Printf("\n❌ %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("\n✅ Все задачи завершены успешно: %d\n", len(result.Outcomes))
+				return
+			}
+			fmt.Println("   Отслеживать статус: ochan tasks watch")
+
 			if viper.GetBool("defaults.auto_check_status") {
 				fmt.Println("\n🔄 Проверка статусов задач...")
-				for _, taskID := range taskIDs {
-					status, err := core.GetTaskStatus(taskID)
+				for _, taskID := range result.TaskIDs() {
+					status, err := client.TaskStatus(ctx, taskID)
 					if err != nil {
 						fmt.Printf("⚠️ Не удалось проверить статус задачи %s: %v\n", taskID, err)
 					} else {
@@ -1096,115 +1508,6 @@ var printCmd = &cobra.Command{
 		}
 	},
 }
-var elseCmd = &cobra.Command{
-	Use:   "else [файл] [секция.параметр] [оператор] [значение] [результат]",
-	Short: "Альтернативное условие (выполняется если предыдущий if не сработал)",
-	Example: `if config.conf server.port == 8080 "Порт корректен"
-else config.conf server.port != 8080 "Исправьте порт на 8080"`,
-	Args: cobra.ExactArgs(5),
-	Run: func(cmd *cobra.Command, args []string) {
-
-		if lastIfResult == nil {
-			fmt.Println("❌ Команда else должна использоваться после команды if")
-			return
-		}
-		if *lastIfResult {
-			fmt.Println("ℹ️ Предыдущее условие if выполнено, else пропускается")
-			return
-		}
-
-		filePath := args[0]
-		paramPath := args[1]
-		operator := args[2]
-		expectedValue := args[3]
-		resultMessage := args[4]
-
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			fmt.Printf("❌ Ошибка чтения файла: %v\n", err)
-			return
-		}
-
-		cfg, err := core.ParseConfig(string(content))
-		if err != nil {
-			fmt.Printf("❌ Ошибка парсинга конфига: %v\n", err)
-			return
-		}
-
-		parts := strings.Split(paramPath, ".")
-		if len(parts) != 2 {
-			fmt.Printf("❌ Неверный формат параметра. Используйте: section.param\n")
-			return
-		}
-
-		section, param := parts[0], parts[1]
-
-		currentValue, exists := cfg[section][param]
-		if !exists {
-			fmt.Printf("❌ Параметр %s не найден в секции %s\n", param, section)
-			return
-		}
-
-		isConditionMet := false
-
-		switch operator {
-		case "==":
-			isConditionMet = (currentValue == expectedValue)
-		case "!=":
-			isConditionMet = (currentValue != expectedValue)
-		case ">":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum > expectedNum)
-			} else {
-				isConditionMet = (currentValue > expectedValue)
-			}
-		case "<":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum < expectedNum)
-			} else {
-				isConditionMet = (currentValue < expectedValue)
-			}
-		case ">=":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum >= expectedNum)
-			} else {
-				isConditionMet = (currentValue >= expectedValue)
-			}
-		case "<=":
-			currentNum, err1 := strconv.Atoi(currentValue)
-			expectedNum, err2 := strconv.Atoi(expectedValue)
-			if err1 == nil && err2 == nil {
-				isConditionMet = (currentNum <= expectedNum)
-			} else {
-				isConditionMet = (currentValue <= expectedValue)
-			}
-		case "contains":
-			isConditionMet = strings.Contains(currentValue, expectedValue)
-		case "startsWith":
-			isConditionMet = strings.HasPrefix(currentValue, expectedValue)
-		case "endsWith":
-			isConditionMet = strings.HasSuffix(currentValue, expectedValue)
-		default:
-			fmt.Printf("❌ Неподдерживаемый оператор: %s\n", operator)
-			return
-		}
-
-		if isConditionMet {
-			fmt.Printf("✅ %s\n", resultMessage)
-			fmt.Printf("   %s = %s %s %s\n", paramPath, currentValue, operator, expectedValue)
-		} else {
-			fmt.Printf("❌ Условие else не выполнено: %s %s %s\n",
-				currentValue, operator, expectedValue)
-		}
-	},
-}
-
 var teeCmd = &cobra.Command{
 	Use:   "tee [file]",
 	Short: "Read stdin and write to stdout and file",
@@ -1220,11 +1523,47 @@ var teeCmd = &cobra.Command{
 	},
 }
 
+// addInputFormatFlag регистрирует формат входного конфига. У diff --format
+// задаёт формат отчёта, поэтому там только --input-format; остальные
+// команды принимают и прежний --format.
+func addInputFormatFlag(c *cobra.Command) {
+	const usage = "Формат конфига: auto, ini, yaml, json, env, toml"
+	c.Flags().StringVar(&configFormat, "input-format", "auto", usage)
+	if c.Flags().Lookup("format") == nil {
+		c.Flags().StringVar(&configFormat, "format", "auto", usage)
+	}
+}
+
 func init() {
 	rootCmd.SilenceErrors = true
 	rootCmd.SilenceUsage = true
 	cobra.OnInitialize(initConfig, initLogger, loadModules)
 	diffCmd.Flags().BoolVarP(&fastMode, "fast", "f", false, "Только вывод в консоль без генерации файлов")
+	diffCmd.Flags().StringVar(&diffFormat, "format", "text", "Формат отчета: text, json, csv, markdown, html, unified")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "Файл отчета ('-' - stdout, по умолчанию директория reports)")
+	mergeCmd.Flags().String("prefer", "", "Автоматически разрешать конфликты в пользу ours или theirs")
+	mergeCmd.Flags().StringP("output", "o", "merged.conf", "Файл для результата слияния")
+	mergeCmd.Flags().String("report", "", "Сохранить структурированный отчет о слиянии (JSON)")
+	rootCmd.AddCommand(mergeCmd)
+	validateCmd.Flags().String("rules", "", "YAML-файл с правилами проверки")
+	validateCmd.Flags().String("fail-on", core.SeverityError, "Минимальная severity для ненулевого кода выхода: error, warning, info")
+	validateCmd.Flags().Bool("json", false, "Вывести нарушения в JSON")
+	addInputFormatFlag(explainCmd)
+	rootCmd.AddCommand(explainCmd)
+	patchCmd.Flags().StringP("output", "o", "patched.conf", "Файл для результата")
+	patchCmd.Flags().BoolP("in-place", "i", false, "Изменить базовый файл на месте (только конфиги key = value)")
+	patchCmd.Flags().Bool("backup", false, "При --in-place сохранить исходный файл как <file>.bak")
+	for _, c := range []*cobra.Command{setCmd, unsetCmd} {
+		c.Flags().String("section", "", "Секция INI (для postgresql.conf не нужна)")
+		c.Flags().Bool("backup", false, "Сохранить исходный файл как <file>.bak")
+		rootCmd.AddCommand(c)
+	}
+	for _, c := range []*cobra.Command{diffCmd, validateCmd, findCmd, patchCmd, statsCmd, mergeCmd} {
+		addInputFormatFlag(c)
+	}
+	for _, c := range []*cobra.Command{diffCmd, findCmd, statsCmd, validateCmd} {
+		c.Flags().BoolVar(&noIncludes, "no-includes", false, "Не раскрывать include/include_dir, сравнивать только указанный файл")
+	}
 	rootCmd.AddCommand(PipeWrapper(diffCmd))
 	rootCmd.AddCommand(PipeWrapper(validateCmd))
 	rootCmd.AddCommand(PipeWrapper(findCmd))
@@ -1235,17 +1574,25 @@ func init() {
 	rootCmd.AddCommand(PipeWrapper(printCmd))
 	rootCmd.AddCommand(PipeWrapper(teeCmd))
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Конфиг (default: ~/.rlm-cli/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&rlmInstance, "rlm-instance", "", "Экземпляр RLM из секции rlm конфига (по умолчанию defaults)")
 	rootCmd.AddCommand(PipeWrapper(saveScenarioCmd))
 	rootCmd.AddCommand(PipeWrapper(ifCmd))
-	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(statusCmd)
 	applyCmd.Flags().BoolP("rlm", "r", false, "Использовать RLM сценарий")
+	applyCmd.Flags().Bool("dry-run", false, "Проверить сценарий и показать запросы без обращений к RLM")
+	applyCmd.Flags().Bool("show-secrets", false, "В --dry-run не скрывать токен в заголовке Authorization")
+	applyCmd.Flags().Bool("json", false, "В --dry-run вывести план в JSON")
+	applyCmd.Flags().Bool("wait", false, "Дождаться завершения задач, вывести итог и вернуть код ошибки при неудаче")
+	applyCmd.Flags().Duration("timeout", 0, "Общее время выполнения сценария (по умолчанию defaults.execution_timeout)")
+	applyCmd.Flags().Duration("task-timeout", 0, "Время ожидания одной задачи (по умолчанию defaults.task_timeout, 30m)")
+	applyCmd.Flags().Duration("poll-interval", 0, "Интервал опроса статуса (по умолчанию defaults.poll_interval, 20s)")
+	addRolloutFlags(applyCmd)
+	addScenarioVarFlags(applyCmd)
 	rootCmd.AddCommand(PipeWrapper(applyCmd))
 	logsCmd.Flags().Int("tail", 0, "Показать последние N строк логов (0 - все логи)")
 	rootCmd.AddCommand(logsCmd)
 	rootCmd.AddCommand(listModulesCmd)
 	rootCmd.AddCommand(installCmd)
-	rootCmd.AddCommand(timerCmd)
 	rootCmd.AddCommand(inspectCmd)
 
 	loadModuleCommands()
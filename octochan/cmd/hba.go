@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"octochan/core"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var hbaCmd = &cobra.Command{
+	Use:   "hba",
+	Short: "Работа с pg_hba.conf: разбор, сравнение и проверка правил",
+}
+
+var hbaShowCmd = &cobra.Command{
+	Use:   "show <pg_hba.conf>",
+	Short: "Показать правила pg_hba.conf с раскрытыми include",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		hba, err := core.LoadPgHba(args[0])
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		if asJSON {
+			data, _ := json.MarshalIndent(hba, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		for i, rule := range hba.Rules {
+			fmt.Printf("%3d  %-28s %s\n", i+1, rule.Location(), rule.Raw)
+		}
+		for _, e := range hba.Errors {
+			fmt.Printf("❌ %v\n", e)
+		}
+	},
+}
+
+var hbaDiffCmd = &cobra.Command{
+	Use:   "diff <old_pg_hba.conf> <new_pg_hba.conf>",
+	Short: "Сравнить pg_hba.conf с учётом порядка правил",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !runHbaDiff(args[0], args[1]) {
+			os.Exit(1)
+		}
+	},
+}
+
+var hbaLintCmd = &cobra.Command{
+	Use:   "lint <pg_hba.conf>",
+	Short: "Найти перекрытые правила, trust и слишком широкие сети",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		hba, err := core.LoadPgHba(args[0])
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения %s: %v\n", args[0], err)
+			os.Exit(1)
+		}
+
+		issues := core.LintPgHba(hba)
+		errorsCount := 0
+		for _, issue := range issues {
+			icon := "⚠️"
+			if issue.Severity == core.HbaIssueError {
+				icon = "❌"
+				errorsCount++
+			}
+			if issue.Rule != nil {
+				fmt.Printf("%s %s [%s] %s\n    %s\n", icon, issue.Rule.Location(), issue.Code, issue.Message, issue.Rule.Raw)
+			} else {
+				fmt.Printf("%s [%s] %s\n", icon, issue.Code, issue.Message)
+			}
+		}
+
+		if len(issues) == 0 {
+			fmt.Printf("✅ %s: проблем не найдено (%d правил)\n", args[0], len(hba.Rules))
+			return
+		}
+		fmt.Printf("\nОшибок: %d, предупреждений: %d\n", errorsCount, len(issues)-errorsCount)
+		if errorsCount > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// runHbaDiff выводит различия правил и возвращает false при ошибке чтения.
+func runHbaDiff(oldPath, newPath string) bool {
+	oldHba, err := core.LoadPgHba(oldPath)
+	if err != nil {
+		fmt.Printf("❌ Ошибка чтения %s: %v\n", oldPath, err)
+		return false
+	}
+	newHba, err := core.LoadPgHba(newPath)
+	if err != nil {
+		fmt.Printf("❌ Ошибка чтения %s: %v\n", newPath, err)
+		return false
+	}
+
+	entries := core.DiffPgHba(oldHba.Rules, newHba.Rules)
+	if len(entries) == 0 {
+		fmt.Println("Правила pg_hba идентичны.")
+		return true
+	}
+
+	for _, e := range entries {
+		switch e.Status {
+		case core.HbaDiffAdded:
+			fmt.Printf("+ [%s] %s\n", e.New.Location(), e.New.Raw)
+		case core.HbaDiffRemoved:
+			fmt.Printf("- [%s] %s\n", e.Old.Location(), e.Old.Raw)
+		case core.HbaDiffModified:
+			fmt.Printf("~ [%s -> %s]\n  - %s\n  + %s\n", e.Old.Location(), e.New.Location(), e.Old.Raw, e.New.Raw)
+		case core.HbaDiffMoved:
+			fmt.Printf("↕ [%s -> %s] %s\n", e.Old.Location(), e.New.Location(), e.New.Raw)
+		}
+	}
+	fmt.Printf("\nИзменений: %d\n", len(entries))
+	return true
+}
+
+func isPgHbaFile(path string) bool {
+	return strings.Contains(strings.ToLower(filepath.Base(path)), "pg_hba")
+}
+
+func init() {
+	hbaShowCmd.Flags().Bool("json", false, "Вывести правила в JSON")
+	hbaCmd.AddCommand(hbaShowCmd, hbaDiffCmd, hbaLintCmd)
+	rootCmd.AddCommand(hbaCmd)
+}
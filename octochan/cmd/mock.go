@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"octochan/core"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var mockRLMCmd = &cobra.Command{
+	Use:   "mock-rlm [--listen 127.0.0.1] [--port 8089] [--lifecycle mock.yaml]",
+	Short: "Запустить локальный фейковый RLM API для отладки модулей",
+	Long: `Поднимает HTTP-сервер с API задач RLM: POST tasks.json, GET /{id}/ и
+GET /{id}/events/. Статусы задач меняются по lifecycle, сбои задаются долей
+задач (fail_rate), ответов с ошибкой (http_error_rate) и потерянных ответов
+(lost_response_rate). Повтор POST с тем же Idempotency-Key возвращает уже
+созданную задачу. Все запросы
+записываются и доступны на GET /_mock/requests и в файле --record.
+
+Чтобы модули отправляли запросы в mock, укажите в config.yaml:
+  defaults:
+    api_url: http://127.0.0.1:8089/api/tasks.json`,
+	Example: `mock-rlm --port 8089
+mock-rlm --lifecycle mock.yaml --record requests.jsonl
+mock-rlm --fail-rate 0.3 --latency 200ms`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, _ := cmd.Flags().GetInt("port")
+		listen, _ := cmd.Flags().GetString("listen")
+		lifecyclePath, _ := cmd.Flags().GetString("lifecycle")
+		recordPath, _ := cmd.Flags().GetString("record")
+
+		config := &core.MockRLMConfig{}
+		if lifecyclePath != "" {
+			loaded, err := core.LoadMockRLMConfig(lifecyclePath)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(2)
+			}
+			config = loaded
+		}
+		if cmd.Flags().Changed("fail-rate") {
+			rate, _ := cmd.Flags().GetFloat64("fail-rate")
+			config.Default.FailRate = &rate
+		}
+		if cmd.Flags().Changed("http-error-rate") {
+			rate, _ := cmd.Flags().GetFloat64("http-error-rate")
+			config.Default.HTTPErrorRate = &rate
+		}
+		if cmd.Flags().Changed("latency") {
+			config.Latency, _ = cmd.Flags().GetString("latency")
+		}
+		if cmd.Flags().Changed("token") {
+			config.Token, _ = cmd.Flags().GetString("token")
+		}
+		if cmd.Flags().Changed("seed") {
+			config.Seed, _ = cmd.Flags().GetInt64("seed")
+		}
+
+		var record io.Writer
+		if recordPath != "" {
+			file, err := os.OpenFile(recordPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				fmt.Printf("❌ Ошибка открытия файла записи: %v\n", err)
+				os.Exit(2)
+			}
+			defer file.Close()
+			record = file
+		}
+
+		mock, err := core.NewMockRLM(*config, record)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+
+		addr := net.JoinHostPort(listen, strconv.Itoa(port))
+		server := &http.Server{Addr: addr, Handler: mock}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		host := listen
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+			fmt.Println("⚠️ mock-rlm доступен со всех интерфейсов, а записывает тела запросов и токены")
+		}
+		fmt.Printf("🧪 mock-rlm слушает %s\n", addr)
+		fmt.Printf("   api_url: http://%s/api/tasks.json\n", net.JoinHostPort(host, strconv.Itoa(port)))
+		fmt.Println("   Ctrl+C для остановки")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("❌ Ошибка сервера: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n✅ mock-rlm остановлен, получено запросов: %d\n", len(mock.Requests()))
+	},
+}
+
+func init() {
+	mockRLMCmd.Flags().Int("port", 8089, "Порт HTTP-сервера")
+	mockRLMCmd.Flags().String("listen", "127.0.0.1", "Адрес для прослушивания (0.0.0.0 - все интерфейсы)")
+	mockRLMCmd.Flags().String("lifecycle", "", "YAML с жизненными циклами задач и сбоями по сервисам")
+	mockRLMCmd.Flags().String("record", "", "Дописывать полученные запросы в файл (JSON Lines)")
+	mockRLMCmd.Flags().Float64("fail-rate", 0, "Доля задач, завершающихся статусом failed (для сервисов без своего fail_rate)")
+	mockRLMCmd.Flags().Float64("http-error-rate", 0, "Доля POST-запросов с ответом 500 (для сервисов без своего http_error_rate)")
+	mockRLMCmd.Flags().String("latency", "", "Задержка каждого ответа, например 200ms")
+	mockRLMCmd.Flags().String("token", "", "Требовать заголовок Authorization: Token <token>")
+	mockRLMCmd.Flags().Int64("seed", 0, "Seed генератора сбоев для воспроизводимости")
+	rootCmd.AddCommand(mockRLMCmd)
+}
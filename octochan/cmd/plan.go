@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"octochan/core"
+	"os"
+	"strings"
+)
+
+// runApplyDryRun выполняет apply --rlm --dry-run: валидирует сценарий и
+// выводит запросы, которые были бы отправлены. Код выхода 1 - сценарий
+// не прошёл проверку.
+func runApplyDryRun(client *core.RLMClient, scenarioData []byte, customParams map[string]string, rollout *core.RolloutConfig, showSecrets, asJSON bool) {
+	plan, err := core.PlanModularScenario(client, scenarioData, customParams)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	if rollout != nil {
+		plan.Rollout = rollout
+		for _, wave := range rollout.PlanWaves(plan.Requests) {
+			plan.Waves = append(plan.Waves, wave.Targets)
+		}
+	}
+
+	if !showSecrets {
+		for _, req := range plan.Requests {
+			req.Headers = maskedHeaders(req.Headers)
+		}
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("🔍 Dry-run: сценарий %s проверен, запросы не отправляются\n\n", plan.Service)
+	fmt.Printf("Целевые CI (%d): %s\n", len(plan.Targets), strings.Join(plan.Targets, ", "))
+
+	if len(plan.Steps) > 0 {
+		fmt.Println("\nШаги модуля:")
+		for _, step := range plan.Steps {
+			marker := "⚠️ побочные эффекты, пропущен"
+			if step.SideEffectFree {
+				marker = "✅ без побочных эффектов"
+			}
+			fmt.Printf("  %-12s %s (%s)\n", step.Name, step.Description, marker)
+		}
+	}
+
+	for i, req := range plan.Requests {
+		body, _ := json.MarshalIndent(req.Body, "", "  ")
+		curl, err := req.Curl()
+		if err != nil {
+			fmt.Printf("❌ Запрос #%d: %v\n", i+1, err)
+			continue
+		}
+		fmt.Printf("\n--- Запрос #%d: %s %s\n", i+1, req.Method, req.URL)
+		fmt.Println(string(body))
+		fmt.Printf("\n%s\n", curl)
+	}
+
+	if plan.Rollout != nil {
+		fmt.Printf("\n🌊 Раскатка (%s):\n", plan.Rollout)
+		for i, targets := range plan.Waves {
+			fmt.Printf("  волна %d: %s\n", i+1, strings.Join(targets, ", "))
+		}
+	}
+
+	for _, note := range plan.Notes {
+		fmt.Printf("\n⚠️ %s\n", note)
+	}
+	fmt.Printf("\n✅ Будет создано задач: %d\n", len(plan.Requests))
+}
+
+func maskedHeaders(headers map[string]string) map[string]string {
+	masked := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if strings.EqualFold(name, "Authorization") {
+			value = core.MaskAuthorization(value)
+		}
+		masked[name] = value
+	}
+	return masked
+}
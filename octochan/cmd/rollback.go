@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"octochan/core"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <task-id|snapshot>...",
+	Short: "Вернуть значения параметров, сохранённые перед изменением",
+	Long: `Перед изменением параметров psql_tuning_params_se сохраняет их текущие
+значения в снапшот в ~/.octochan/backups (parameters.backup, по умолчанию
+включено) и привязывает к нему созданные задачи. rollback формирует и отправляет обратный сценарий,
+возвращающий эти значения:
+
+  ochan rollback 12345       - только CI задачи 12345
+  ochan rollback 3f9a1c2b7d  - все CI снапшота (ID или префикс)
+
+Параметры, не заданные явно до изменения, возвращаются к значению PostgreSQL
+по умолчанию (справочник дополняется секцией pg_defaults конфига). Сам откат
+тоже сохраняет значения перед изменением, поэтому его можно откатить.`,
+	Example: `rollback 12345 --dry-run
+rollback 12345 12346 --wait
+rollback 3f9a1c2b7d --no-backup`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.BackupSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			os.Exit(1)
+		}
+
+		var targets []*core.RollbackTarget
+		for _, ref := range args {
+			target, err := core.ResolveRollback(store, ref)
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("🔍 %s: снапшот %s, CI: %s\n", ref, target.Snapshot.ID[:12], strings.Join(target.CIs, ", "))
+			targets = append(targets, target)
+		}
+
+		scenarios, err := core.RollbackScenarios(targets)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		noBackup, _ := cmd.Flags().GetBool("no-backup")
+		var documents [][]byte
+		for _, scenario := range scenarios {
+			if params, ok := scenario["parameters"].(map[string]interface{}); ok && noBackup {
+				params["backup"] = false
+			}
+			data, err := yaml.Marshal(scenario)
+			if err != nil {
+				fmt.Printf("❌ Ошибка формирования сценария отката: %v\n", err)
+				os.Exit(1)
+			}
+			documents = append(documents, data)
+		}
+
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("🔍 Dry-run: сценариев отката - %d, запросы не отправляются\n", len(documents))
+			for i, data := range documents {
+				fmt.Printf("\n--- Сценарий #%d\n%s", i+1, data)
+			}
+			return
+		}
+
+		client, err := rlmClient()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if !client.HasToken() {
+			fmt.Println("❌ Токен не установлен. Используйте команду 'auth' для установки токена")
+			os.Exit(1)
+		}
+		if err := client.UnlockToken(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := core.DefaultExecOptions()
+		opts.Wait, _ = cmd.Flags().GetBool("wait")
+		if cmd.Flags().Changed("task-timeout") {
+			opts.TaskTimeout, _ = cmd.Flags().GetDuration("task-timeout")
+		}
+		if cmd.Flags().Changed("poll-interval") {
+			opts.PollInterval, _ = cmd.Flags().GetDuration("poll-interval")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		combined := &core.ExecutionResult{}
+		var failures []error
+		for i, data := range documents {
+			fmt.Printf("\n🔄 Сценарий отката %d из %d\n", i+1, len(documents))
+			result, err := core.ExecuteModularScenarioContext(ctx, client, data, nil, opts)
+			if result != nil {
+				combined.Outcomes = append(combined.Outcomes, result.Outcomes...)
+			}
+			if err != nil {
+				fmt.Printf("❌ Ошибка выполнения сценария отката: %v\n", err)
+				failures = append(failures, err)
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if len(combined.Outcomes) > 0 {
+			fmt.Println("\n✅ Созданные задачи отката:")
+			for _, taskID := range combined.TaskIDs() {
+				fmt.Printf("- %s\n", taskID)
+			}
+		}
+		if opts.Wait {
+			printExecutionSummary(combined)
+		}
+		switch {
+		case ctx.Err() != nil:
+			fmt.Println("\n⏹ Откат прерван, созданные задачи продолжают выполняться в RLM")
+			os.Exit(130)
+		case opts.Wait && combined.Failed() > 0:
+			fmt.Printf("\n❌ Завершились с ошибкой: %d из %d\n", combined.Failed(), len(combined.Outcomes))
+			os.Exit(1)
+		case len(failures) > 0:
+			os.Exit(1)
+		}
+		if opts.Wait {
+			fmt.Printf("\n✅ Откат выполнен: задач - %d\n", len(combined.Outcomes))
+			return
+		}
+		fmt.Println("   Отслеживать статус: ochan tasks watch")
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().Bool("dry-run", false, "Показать сценарии отката без отправки")
+	rollbackCmd.Flags().Bool("wait", false, "Дождаться завершения задач отката")
+	rollbackCmd.Flags().Bool("no-backup", false, "Не сохранять значения перед откатом")
+	rollbackCmd.Flags().Duration("task-timeout", 0, "Время ожидания одной задачи (по умолчанию defaults.task_timeout)")
+	rollbackCmd.Flags().Duration("poll-interval", 0, "Интервал опроса статуса задач (по умолчанию defaults.poll_interval)")
+	rootCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"octochan/core"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func addRolloutFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("canary", 0, "Раскатка: сначала только первые N целей")
+	cmd.Flags().Int("wave-size", 0, "Раскатка: число целей в волне (0 - остальные одной волной)")
+	cmd.Flags().Duration("pause", 0, "Раскатка: пауза между волнами")
+	cmd.Flags().String("confirm", "", "Раскатка: подтверждение продолжения - canary (после канарейки), waves (после каждой волны), none")
+	cmd.Flags().Float64("max-failure-ratio", 0, "Раскатка: остановиться, если доля неуспешных задач больше (0-1, по умолчанию 0 - любая ошибка)")
+}
+
+// rolloutFromFlags - стратегия раскатки сценария с заменой полей, заданных
+// флагами. nil - сценарий выполняется без раскатки.
+func rolloutFromFlags(cmd *cobra.Command, scenarioData []byte) *core.RolloutConfig {
+	var rollout *core.RolloutConfig
+	if scenario, err := core.ParseScenarioData(scenarioData); err == nil && scenario.Rollout != nil {
+		copied := *scenario.Rollout
+		rollout = &copied
+	}
+
+	flags := cmd.Flags()
+	for _, name := range []string{"canary", "wave-size", "pause", "confirm", "max-failure-ratio"} {
+		if flags.Changed(name) && rollout == nil {
+			rollout = &core.RolloutConfig{}
+		}
+	}
+	if rollout == nil {
+		return nil
+	}
+	if flags.Changed("canary") {
+		rollout.Canary, _ = flags.GetInt("canary")
+	}
+	if flags.Changed("wave-size") {
+		rollout.WaveSize, _ = flags.GetInt("wave-size")
+	}
+	if flags.Changed("pause") {
+		rollout.Pause, _ = flags.GetDuration("pause")
+	}
+	if flags.Changed("confirm") {
+		rollout.Confirm, _ = flags.GetString("confirm")
+	}
+	if flags.Changed("max-failure-ratio") {
+		rollout.MaxFailureRatio, _ = flags.GetFloat64("max-failure-ratio")
+	}
+	return rollout
+}
+
+// confirmFromTerminal спрашивает да/нет у оператора. Ответ читается из stdin,
+// а если stdin уже прочитан (сценарий пришёл через apply -) - с терминала.
+// Отмена ctx прерывает ожидание ответа.
+func confirmFromTerminal(ctx context.Context, prompt string) bool {
+	fmt.Printf("\n❓ %s [y/N]: ", prompt)
+	line, err := core.ReadStdinLine(ctx)
+	if err != nil && line == "" && ctx.Err() == nil {
+		tty, ttyErr := os.Open("/dev/tty")
+		if ttyErr != nil {
+			return false
+		}
+		defer tty.Close()
+		stop := context.AfterFunc(ctx, func() { tty.Close() })
+		defer stop()
+		line, _ = bufio.NewReader(tty).ReadString('\n')
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes", "д", "да":
+		return true
+	}
+	return false
+}
+
+func printRolloutReport(result *core.ExecutionResult) {
+	if len(result.Waves) == 0 {
+		return
+	}
+	fmt.Println("\n📋 Итог по целям:")
+	fmt.Printf("%-24s %-6s %-14s %s\n", "ЦЕЛЬ", "ВОЛНА", "СТАТУС", "ЗАДАЧИ")
+	for _, item := range result.TargetReport() {
+		mark := "✅"
+		switch {
+		case item.Status == "not_started":
+			mark = "⏭"
+		case item.Err != nil || !core.IsSuccessfulTaskStatus(item.Status):
+			mark = "❌"
+		}
+		fmt.Printf("%-24s %-6d %-14s %s %s\n", item.Target, item.Wave, item.Status, strings.Join(item.Tasks, ","), mark)
+		if item.Err != nil {
+			fmt.Printf("%-24s %v\n", "", item.Err)
+		}
+	}
+}
@@ -10,7 +10,7 @@ var rootCmd = &cobra.Command{
 	Use:   "ochan",
 	Short: "Инструмент для детекта изменений в конфигурациях",
 	Long: `Octo-chan — утилита для сравнения и анализа конфигурационных файлов.
-Поддерживает YAML, JSON, ENV и другие форматы.
+Поддерживает YAML, JSON, ENV, TOML и INI (postgresql.conf) форматы.
 Находит различия, проверяет валидность и умеет применять патчи.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Welcome to octo-chan! Use 'help' for usage.")
@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"octochan/core"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario",
+	Short: "Работа со сценариями RLM",
+}
+
+var scenarioRenderCmd = &cobra.Command{
+	Use:   "render <file|->",
+	Short: "Показать сценарий с подставленными переменными",
+	Long: `Подставляет в сценарий переменные окружения и --var так же, как apply --rlm,
+и печатает результат. Переменные доступны в шаблоне как {{ .env.<имя> }},
+имя окружения - {{ .environment }}, таблица по умолчанию - {{ .table_id }}.
+
+Функции шаблона: json (список или словарь), quote (строка в кавычках),
+default (значение, если переменная не задана), required (ошибка, если не
+задана), table "<имя>" (таблица из environments.tables):
+
+  port: {{ default 5432 .env.port }}
+  svm_ip: {{ quote (required "svm_ip" .env.svm_ip) }}
+
+Переменная, не заданная и подставленная без default, - ошибка.`,
+	Example: `scenario render tune.yaml --env production
+scenario render tune.yaml --env test --var port=5433 --var 'ip_replics=[10.0.0.2, 10.0.0.3]'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := readScenarioArg(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		rendered, err := renderScenarioFromFlags(cmd, args[0], data)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(string(rendered))
+		if !strings.HasSuffix(string(rendered), "\n") {
+			fmt.Println()
+		}
+	},
+}
+
+var scenarioValidateCmd = &cobra.Command{
+	Use:   "validate <file|->...",
+	Short: "Проверить сценарий по схеме модуля и вывести все ошибки",
+	Long: `Выполняет те же проверки, что apply --rlm: подстановку переменных, разбор,
+схему параметров модуля (обязательные поля, типы, допустимые значения) и
+Validate модуля. В RLM ничего не отправляется. Код выхода 1 - есть ошибки.`,
+	Example: `scenario validate tune.yaml
+scenario validate tune.yaml --env production
+scenario validate scenarios/*.yaml`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := rlmClient()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		failed := 0
+		for _, path := range args {
+			if err := validateScenarioFile(cmd, client, path); err != nil {
+				failed++
+				var validationErr *core.ScenarioValidationError
+				if errors.As(err, &validationErr) {
+					fmt.Printf("❌ %s: ошибок - %d\n", path, len(validationErr.Errors))
+					for _, msg := range validationErr.Errors {
+						fmt.Printf("   - %s\n", msg)
+					}
+				} else {
+					fmt.Printf("❌ %s: %v\n", path, err)
+				}
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func validateScenarioFile(cmd *cobra.Command, client *core.RLMClient, path string) error {
+	data, err := readScenarioArg(path)
+	if err != nil {
+		return err
+	}
+	if data, err = renderScenarioFromFlags(cmd, path, data); err != nil {
+		return err
+	}
+	scenario, err := core.ValidateScenario(client, data)
+	if err != nil {
+		return err
+	}
+	targets := 0
+	for _, target := range scenario.Targets {
+		targets += len(target.GetCIs())
+	}
+	fmt.Printf("✅ %s: сценарий %s корректен, целей: %d, items: %d\n", path, scenario.Service, targets, len(scenario.Items))
+	return nil
+}
+
+var scenarioInitCmd = &cobra.Command{
+	Use:   "init <service>",
+	Short: "Создать заготовку сценария с комментариями по схеме модуля",
+	Example: `scenario init psql_tuning_params_se
+scenario init pangolin_restart -o restart.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, err := scenarioSchemaArg(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		skeleton := scenarioSkeleton(schema)
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			fmt.Print(skeleton)
+			return
+		}
+		if force, _ := cmd.Flags().GetBool("force"); !force {
+			if _, err := os.Stat(output); err == nil {
+				fmt.Printf("❌ Файл %s уже существует, используйте --force\n", output)
+				os.Exit(1)
+			}
+		}
+		if err := os.WriteFile(output, []byte(skeleton), 0644); err != nil {
+			fmt.Printf("❌ Ошибка записи файла: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Заготовка сценария %s сохранена в %s\n", schema.Service, output)
+	},
+}
+
+var scenarioDescribeCmd = &cobra.Command{
+	Use:   "describe [service]",
+	Short: "Показать параметры модуля или список модулей",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		if len(args) == 0 {
+			fmt.Printf("%-32s %s\n", "СЕРВИС", "ОПИСАНИЕ")
+			for _, service := range core.ScenarioServices() {
+				description := "схема не опубликована"
+				if schema := core.ScenarioSchema(service); schema != nil {
+					description = schema.Description
+				}
+				fmt.Printf("%-32s %s\n", service, description)
+			}
+			return
+		}
+
+		schema, err := scenarioSchemaArg(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if asJSON {
+			data, _ := json.MarshalIndent(schema, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		fmt.Printf("%s - %s\n", schema.Service, schema.Description)
+		if schema.TargetsRequired {
+			fmt.Println("Цели: targets (обязательно)")
+		} else {
+			fmt.Println("Цели: targets или items")
+		}
+		if schema.AllowExtra {
+			fmt.Println("Параметры вне схемы передаются в RLM как есть")
+		}
+		fmt.Printf("\n%-24s %-8s %-6s %-14s %s\n", "ПАРАМЕТР", "ТИП", "ОБЯЗ.", "ПО УМОЛЧАНИЮ", "ОПИСАНИЕ")
+		describeParams("", schema.Parameters)
+	},
+}
+
+func describeParams(prefix string, params []*core.ParamSchema) {
+	for _, param := range params {
+		name := prefix + param.Name
+		required := "нет"
+		if param.Required {
+			required = "да"
+		}
+		def := "-"
+		if param.Default != nil {
+			def = formatDefault(param.Default)
+		}
+		description := param.Description
+		if len(param.Enum) > 0 {
+			description += " (" + strings.Join(param.Enum, ", ") + ")"
+		}
+		fmt.Printf("%-24s %-8s %-6s %-14s %s\n", name, param.Type, required, def, description)
+
+		switch {
+		case param.Type == core.ParamList && param.Items != nil:
+			describeParams(name+"[].", param.Items.Fields)
+		case param.Type == core.ParamObject:
+			describeParams(name+".", param.Fields)
+		}
+	}
+}
+
+func formatDefault(value interface{}) string {
+	if value == "" {
+		return `""`
+	}
+	return fmt.Sprint(value)
+}
+
+func scenarioSchemaArg(service string) (*core.ModuleSchema, error) {
+	schema := core.ScenarioSchema(service)
+	if schema == nil {
+		return nil, fmt.Errorf("схема для сервиса '%s' не опубликована. Доступные: %s",
+			service, strings.Join(core.ScenarioServices(), ", "))
+	}
+	return schema, nil
+}
+
+// scenarioSkeleton - YAML-заготовка сценария: значения по умолчанию или
+// примеры из схемы, над каждым параметром - комментарий с описанием.
+func scenarioSkeleton(schema *core.ModuleSchema) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s: %s\n", schema.Service, schema.Description)
+	fmt.Fprintf(&b, "# Проверка: ochan scenario validate <файл>\n")
+	fmt.Fprintf(&b, "service: %s\n", schema.Service)
+	b.WriteString("parameters:\n")
+	writeSkeletonFields(&b, "  ", "  ", schema.Parameters)
+	b.WriteString("targets:\n  - svm_ci: CI00000000\n")
+	if !schema.TargetsRequired {
+		b.WriteString("# Вместо targets можно указать items:\n# items:\n#   - invsvm_ci_svm: CI00000000\n")
+	}
+	return b.String()
+}
+
+// writeSkeletonFields пишет поля объекта. Первое поле начинается с
+// firstIndent (для элемента списка - "- "), остальные - с indent.
+func writeSkeletonFields(b *strings.Builder, firstIndent, indent string, params []*core.ParamSchema) {
+	for i, param := range params {
+		keyIndent := indent
+		if i == 0 {
+			keyIndent = firstIndent
+		}
+		fmt.Fprintf(b, "%s# %s\n", strings.TrimSuffix(keyIndent, "- "), skeletonComment(param))
+
+		switch {
+		case param.Type == core.ParamList && param.Items != nil && param.Items.Type == core.ParamObject:
+			fmt.Fprintf(b, "%s%s:\n", keyIndent, param.Name)
+			writeSkeletonFields(b, indent+"  - ", indent+"    ", param.Items.Fields)
+		case param.Type == core.ParamObject:
+			fmt.Fprintf(b, "%s%s:\n", keyIndent, param.Name)
+			writeSkeletonFields(b, indent+"  ", indent+"  ", param.Fields)
+		default:
+			fmt.Fprintf(b, "%s%s: %s\n", keyIndent, param.Name, skeletonValue(param))
+		}
+	}
+}
+
+func skeletonComment(param *core.ParamSchema) string {
+	var notes []string
+	if param.Required {
+		notes = append(notes, "обязательный")
+	}
+	notes = append(notes, param.Type)
+	if param.Default != nil {
+		notes = append(notes, "по умолчанию "+formatDefault(param.Default))
+	}
+	if len(param.Enum) > 0 {
+		notes = append(notes, "варианты: "+strings.Join(param.Enum, ", "))
+	}
+	comment := param.Description
+	if comment == "" {
+		comment = param.Name
+	}
+	return fmt.Sprintf("%s (%s)", comment, strings.Join(notes, ", "))
+}
+
+func skeletonValue(param *core.ParamSchema) string {
+	value := param.Default
+	if value == nil {
+		value = param.Example
+	}
+	if value == nil && len(param.Enum) > 0 {
+		value = param.Enum[0]
+	}
+	if value == nil {
+		switch param.Type {
+		case core.ParamInt, core.ParamNumber:
+			value = 0
+		case core.ParamBool:
+			value = false
+		case core.ParamList:
+			return "[]"
+		default:
+			value = ""
+		}
+	}
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func readScenarioArg(path string) ([]byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	return data, nil
+}
+
+// addScenarioVarFlags добавляет --env и --var командам, которые читают сценарий.
+func addScenarioVarFlags(cmd *cobra.Command) {
+	cmd.Flags().String("env", "", "Окружение: имя файла переменных в env/ (production, test) или путь к нему")
+	cmd.Flags().StringArray("var", nil, "Переменная шаблона key=value, значение типизируется как в YAML (можно несколько)")
+}
+
+// renderScenarioFromFlags подставляет в сценарий переменные из --env и --var.
+// path - файл сценария, рядом с ним ищется каталог env; для stdin - "-".
+func renderScenarioFromFlags(cmd *cobra.Command, path string, data []byte) ([]byte, error) {
+	env, _ := cmd.Flags().GetString("env")
+	assignments, _ := cmd.Flags().GetStringArray("var")
+
+	if !core.HasScenarioTemplate(data) {
+		if env != "" || len(assignments) > 0 {
+			fmt.Fprintln(os.Stderr, "⚠️ В сценарии нет подстановок {{ }}, --env и --var не применены")
+		}
+		return data, nil
+	}
+
+	vars, err := scenarioVarsFromFlags(cmd, path)
+	if err != nil {
+		return nil, err
+	}
+	return core.RenderScenario(data, vars)
+}
+
+// scenarioVarsFromFlags собирает переменные шаблона из --env и --var.
+// Файлы окружения ищутся рядом с path.
+func scenarioVarsFromFlags(cmd *cobra.Command, path string) (core.ScenarioVars, error) {
+	env, _ := cmd.Flags().GetString("env")
+	assignments, _ := cmd.Flags().GetStringArray("var")
+
+	if path == "-" {
+		path = ""
+	}
+	files, err := core.FindEnvironmentFiles(path, env)
+	if err != nil {
+		return core.ScenarioVars{}, err
+	}
+	vars, err := core.LoadScenarioVars(files)
+	if err != nil {
+		return core.ScenarioVars{}, err
+	}
+	for _, assignment := range assignments {
+		if err := core.SetScenarioVar(vars, assignment); err != nil {
+			return core.ScenarioVars{}, fmt.Errorf("--var: %w", err)
+		}
+	}
+	if env != "" && len(files) == 1 && files[0] == env {
+		// Окружение задано путём к файлу: имя окружения - имя файла.
+		env = strings.TrimSuffix(filepath.Base(env), filepath.Ext(env))
+	}
+	return core.ScenarioVars{Environment: env, Vars: vars}, nil
+}
+
+func init() {
+	addScenarioVarFlags(scenarioRenderCmd)
+	addScenarioVarFlags(scenarioValidateCmd)
+	scenarioInitCmd.Flags().StringP("output", "o", "", "Записать заготовку в файл вместо вывода")
+	scenarioInitCmd.Flags().Bool("force", false, "Перезаписать существующий файл")
+	scenarioDescribeCmd.Flags().Bool("json", false, "Вывести схему в JSON")
+	scenarioCmd.AddCommand(scenarioRenderCmd, scenarioValidateCmd, scenarioInitCmd, scenarioDescribeCmd)
+	rootCmd.AddCommand(scenarioCmd)
+}
@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"octochan/core"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "История снапшотов конфигурации",
+	Long: `Снапшоты образуют DAG: каждый снапшот ссылается на родителя, а его ID -
+SHA-256 от родителя и содержимого конфига. Снапшоты создаются командой diff
+и хранятся в ~/.octochan/snapshots.`,
+}
+
+var snapshotLogCmd = &cobra.Command{
+	Use:   "log [id]",
+	Short: "Показать цепочку снапшотов от HEAD (или id) до корня",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+		head, _ := store.Head()
+
+		all, _ := cmd.Flags().GetBool("all")
+		var snapshots []*core.Snapshot
+		if all {
+			snapshots, err = store.List()
+		} else {
+			start := head
+			if len(args) > 0 {
+				start = args[0]
+			}
+			if start == "" {
+				fmt.Println("История снапшотов пуста")
+				return
+			}
+			snapshots, err = store.Log(start)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			if len(snapshots) == 0 {
+				return
+			}
+		}
+
+		for _, s := range snapshots {
+			marker := ""
+			if s.ID == head {
+				marker = " (HEAD)"
+			}
+			fmt.Printf("snapshot %s%s\n", s.ID, marker)
+			if s.ParentID != nil {
+				fmt.Printf("Parent:  %s\n", *s.ParentID)
+			}
+			fmt.Printf("Author:  %s\n", s.Author)
+			fmt.Printf("Date:    %s\n", s.Timestamp.Format("2006-01-02 15:04:05"))
+			if len(s.Tasks) > 0 {
+				fmt.Printf("Tasks:   %s\n", snapshotTasks(s))
+			}
+			if s.Message != "" {
+				fmt.Printf("\n    %s\n", s.Message)
+			}
+			fmt.Println()
+		}
+	},
+}
+
+var snapshotShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Показать снапшот и изменения относительно родителя",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+		s, err := store.Load(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		fmt.Printf("snapshot %s\n", s.ID)
+		if s.ParentID != nil {
+			fmt.Printf("Parent:  %s\n", *s.ParentID)
+		}
+		if s.Tree != "" {
+			fmt.Printf("Tree:    %s\n", s.Tree)
+		}
+		fmt.Printf("Author:  %s\n", s.Author)
+		fmt.Printf("Date:    %s\n", s.Timestamp.Format("2006-01-02 15:04:05"))
+		if s.Message != "" {
+			fmt.Printf("\n    %s\n", s.Message)
+		}
+		fmt.Println()
+
+		ops, err := core.ParseSnapshotPatch(s.Patch)
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения патча: %v\n", err)
+			return
+		}
+		if len(ops) == 0 {
+			fmt.Println("Изменений нет")
+			return
+		}
+		printPatch(ops)
+	},
+}
+
+var snapshotPatchCmd = &cobra.Command{
+	Use:   "patch <id>",
+	Short: "Вывести патч снапшота в формате JSON Patch (RFC 6902)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		reverse, _ := cmd.Flags().GetBool("reverse")
+
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+		s, err := store.Load(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		var ops []core.PatchOp
+		if reverse {
+			ops, err = core.InverseSnapshotPatch(s)
+		} else {
+			ops, err = core.ParseSnapshotPatch(s.Patch)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		if ops == nil {
+			ops = []core.PatchOp{}
+		}
+
+		data, _ := json.MarshalIndent(ops, "", "  ")
+		fmt.Println(string(data))
+	},
+}
+
+var snapshotApplyCmd = &cobra.Command{
+	Use:   "apply <id> <file>",
+	Short: "Применить патч снапшота к конфигу (или откатить его с --reverse)",
+	Example: `snapshot apply 3f2a9c postgresql.conf
+snapshot apply 3f2a9c postgresql.conf --reverse -o rolled_back.conf`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		reverse, _ := cmd.Flags().GetBool("reverse")
+		outputFile, _ := cmd.Flags().GetString("output")
+		if outputFile == "" {
+			outputFile = args[1]
+		}
+
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+		s, err := store.Load(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		content, err := readConfigInput(args[1])
+		if err != nil {
+			fmt.Printf("❌ Ошибка чтения файла %s: %v\n", args[1], err)
+			return
+		}
+		config, err := parseConfigInput(content, args[1])
+		if err != nil {
+			fmt.Printf("❌ Ошибка парсинга %s: %v\n", args[1], err)
+			return
+		}
+
+		var result map[string]map[string]string
+		if reverse {
+			result, err = core.RevertSnapshot(config, s)
+		} else {
+			result, err = core.ApplySnapshot(config, s)
+		}
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		if outputFile != args[1] {
+			// -o в другой файл: правки переносятся в копию исходного документа
+			if _, err := readConfigTarget(outputFile); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+		edits, err := writeConfigOutput(config, result, args[1], content, outputFile, false)
+		if err != nil {
+			fmt.Printf("❌ Ошибка сохранения: %v\n", err)
+			os.Exit(1)
+		}
+		printConfEdits(edits)
+		if reverse {
+			fmt.Printf("✅ Снапшот %s откачен, результат сохранен в %s\n", s.ID, outputFile)
+		} else {
+			fmt.Printf("✅ Снапшот %s применен, результат сохранен в %s\n", s.ID, outputFile)
+		}
+	},
+}
+
+var snapshotCheckoutCmd = &cobra.Command{
+	Use:   "checkout <id> <file>",
+	Short: "Восстановить конфиг на момент снапшота в файл",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+		s, config, err := store.Checkout(args[0])
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		if _, err := writeConfigState(config, args[1]); err != nil {
+			fmt.Printf("❌ Ошибка сохранения: %v\n", err)
+			os.Exit(1)
+		}
+		if err := store.SetHead(s.ID); err != nil {
+			fmt.Printf("❌ Ошибка обновления HEAD: %v\n", err)
+			return
+		}
+		fmt.Printf("✅ Снапшот %s восстановлен в %s\n", s.ID, args[1])
+	},
+}
+
+var snapshotRevertCmd = &cobra.Command{
+	Use:   "revert <id>",
+	Short: "Создать снапшот, отменяющий изменения указанного",
+	Example: `snapshot revert 3f2a9c
+snapshot revert 3f2a9c --prefer ours -o postgresql.conf`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		prefer, _ := cmd.Flags().GetString("prefer")
+		outputFile, _ := cmd.Flags().GetString("output")
+
+		if outputFile != "" {
+			if _, err := readConfigTarget(outputFile); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		store, err := core.DefaultSnapshotStore()
+		if err != nil {
+			fmt.Printf("❌ Ошибка открытия хранилища снапшотов: %v\n", err)
+			return
+		}
+
+		s, result, err := store.Revert(args[0], snapshotAuthor(), prefer)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			if result != nil {
+				for _, c := range result.UnresolvedConflicts() {
+					fmt.Printf("❌ Конфликт %s: base=%s ours=%s theirs=%s\n", c.Param, mergeValueString(c.Base), mergeValueString(c.Ours), mergeValueString(c.Theirs))
+				}
+				fmt.Println("Используйте --prefer ours|theirs для автоматического разрешения")
+			}
+			os.Exit(1)
+		}
+
+		for _, change := range result.Applied {
+			if change.Source == "ours" {
+				continue
+			}
+			fmt.Printf("↩️ %s: %s -> %s\n", change.Param, mergeValueString(change.Base), mergeValueString(change.Result))
+		}
+		fmt.Printf("✅ Создан снапшот %s: %s\n", s.ID, s.Message)
+
+		if outputFile != "" {
+			if _, err := writeConfigState(result.Merged, outputFile); err != nil {
+				fmt.Printf("❌ Ошибка сохранения: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Конфиг сохранен в %s\n", outputFile)
+		}
+	},
+}
+
+func printPatch(ops []core.PatchOp) {
+	expected := make(map[string]string)
+	for _, op := range ops {
+		switch op.Op {
+		case core.PatchOpTest:
+			expected[op.Path] = *op.Value
+		case core.PatchOpAdd:
+			fmt.Printf("+ %s = %s\n", op.Path, *op.Value)
+		case core.PatchOpReplace:
+			fmt.Printf("~ %s: %s -> %s\n", op.Path, expected[op.Path], *op.Value)
+		case core.PatchOpRemove:
+			fmt.Printf("- %s (было %s)\n", op.Path, expected[op.Path])
+		}
+	}
+}
+
+// snapshotTasks - задачи снапшота в виде "id (CI)" по возрастанию ID.
+func snapshotTasks(s *core.Snapshot) string {
+	ids := make([]string, 0, len(s.Tasks))
+	for id := range s.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for i, id := range ids {
+		ids[i] = fmt.Sprintf("%s (%s)", id, s.Tasks[id])
+	}
+	return strings.Join(ids, ", ")
+}
+
+func snapshotAuthor() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "system"
+}
+
+func init() {
+	snapshotLogCmd.Flags().Bool("all", false, "Показать все снапшоты, а не только цепочку HEAD")
+	snapshotRevertCmd.Flags().String("prefer", "", "Разрешать конфликты в пользу ours (HEAD) или theirs (отмена)")
+	snapshotRevertCmd.Flags().StringP("output", "o", "", "Записать получившийся конфиг в файл")
+	snapshotPatchCmd.Flags().Bool("reverse", false, "Вывести обратный патч")
+	snapshotApplyCmd.Flags().Bool("reverse", false, "Откатить снапшот обратным патчем")
+	snapshotApplyCmd.Flags().StringP("output", "o", "", "Файл для результата (по умолчанию перезаписывается исходный)")
+	addInputFormatFlag(snapshotApplyCmd)
+	snapshotCmd.AddCommand(snapshotLogCmd, snapshotShowCmd, snapshotPatchCmd, snapshotApplyCmd, snapshotCheckoutCmd, snapshotRevertCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
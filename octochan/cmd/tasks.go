@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"octochan/core"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "Локальный реестр задач RLM: список, статус, ожидание и отмена",
+	Long: `Каждая задача, созданная apply --rlm, сохраняется в ~/.octochan/tasks:
+сервис, цели, хеш сценария, время создания, последний статус и события.
+Реестр доступен между сессиями.`,
+}
+
+var tasksListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Показать задачи из реестра",
+	Example: `tasks list
+tasks list --active
+tasks list --service psql_tuning_params_se --since 24h
+tasks list --target CI08453376 --status failed`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultTaskStore()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		filter := core.TaskFilter{}
+		filter.Service, _ = cmd.Flags().GetString("service")
+		filter.Status, _ = cmd.Flags().GetString("status")
+		filter.Target, _ = cmd.Flags().GetString("target")
+		filter.Active, _ = cmd.Flags().GetBool("active")
+		filter.RLM = rlmInstance
+		if since, _ := cmd.Flags().GetDuration("since"); since > 0 {
+			filter.Since = time.Now().Add(-since)
+		}
+
+		records, err := store.List(filter)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			data, _ := json.MarshalIndent(records, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		if len(records) == 0 {
+			fmt.Println("Задач не найдено")
+			return
+		}
+
+		fmt.Printf("%-10s %-12s %-32s %-19s %s\n", "ID", "СТАТУС", "СЕРВИС", "СОЗДАНА", "ЦЕЛИ")
+		for _, rec := range records {
+			fmt.Printf("%-10s %-12s %-32s %-19s %s\n",
+				rec.Key(), rec.Status, rec.Service, rec.CreatedAt.Format("2006-01-02 15:04:05"), strings.Join(rec.Targets, ","))
+		}
+	},
+}
+
+var tasksShowCmd = &cobra.Command{
+	Use:   "show <task_id>",
+	Short: "Показать задачу: обновить статус и события из RLM",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultTaskStore()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+
+		offline, _ := cmd.Flags().GetBool("offline")
+		rec, err := store.Load(taskKeyArg(args[0]))
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if !offline {
+			if fresh, err := refreshTask(context.Background(), store, rec.Key()); err != nil {
+				fmt.Printf("⚠️ Не удалось обновить статус из RLM, показана сохранённая версия: %v\n", err)
+			} else {
+				rec = fresh
+			}
+		}
+
+		fmt.Printf("Задача:   %s\n", rec.ID)
+		if rec.RLM != "" {
+			fmt.Printf("RLM:      %s\n", rec.RLM)
+		}
+		fmt.Printf("Сервис:   %s\n", rec.Service)
+		fmt.Printf("Статус:   %s\n", rec.Status)
+		fmt.Printf("Цели:     %s\n", strings.Join(rec.Targets, ", "))
+		fmt.Printf("Создана:  %s\n", rec.CreatedAt.Format(time.RFC3339))
+		fmt.Printf("Обновлена: %s\n", rec.UpdatedAt.Format(time.RFC3339))
+		fmt.Printf("Сценарий: %s\n", rec.ScenarioHash)
+		printTaskEvents(rec.Events)
+	},
+}
+
+var tasksWatchCmd = &cobra.Command{
+	Use:   "watch [task_id...]",
+	Short: "Ожидать завершения задач (по умолчанию - всех незавершённых)",
+	Args:  cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := core.DefaultTaskStore()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			return
+		}
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			fmt.Printf("❌ --interval должен быть больше нуля: %s\n", interval)
+			os.Exit(2)
+		}
+
+		var ids []string
+		for _, arg := range args {
+			ids = append(ids, taskKeyArg(arg))
+		}
+		if len(ids) == 0 {
+			active, err := store.List(core.TaskFilter{Active: true, RLM: rlmInstance})
+			if err != nil {
+				fmt.Printf("❌ %v\n", err)
+				return
+			}
+			for _, rec := range active {
+				ids = append(ids, rec.Key())
+			}
+		}
+		if len(ids) == 0 {
+			fmt.Println("Незавершённых задач нет")
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		statuses := make(map[string]string)
+		lost := make(map[string]bool)
+		for {
+			pending := 0
+			for _, id := range ids {
+				if lost[id] || core.IsTerminalTaskStatus(statuses[id]) {
+					continue
+				}
+				rec, err := refreshTask(ctx, store, id)
+				if err != nil {
+					if ctx.Err() != nil {
+						break
+					}
+					// Неверный ID, удалённая задача или неизвестный экземпляр
+					// RLM не исправятся сами - ждать такую задачу бессмысленно.
+					if !core.IsRetryableError(err) {
+						fmt.Printf("❌ %s: %v\n", id, err)
+						lost[id] = true
+						continue
+					}
+					fmt.Printf("⚠️ %s: %v\n", id, err)
+					pending++
+					continue
+				}
+				if rec.Status != statuses[id] {
+					fmt.Printf("[%s] %s: %s\n", time.Now().Format("15:04:05"), id, rec.Status)
+					statuses[id] = rec.Status
+				}
+				if !core.IsTerminalTaskStatus(rec.Status) {
+					pending++
+				}
+			}
+			if pending == 0 && ctx.Err() == nil {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				fmt.Println("\n⏹ Ожидание прервано, задачи продолжают выполняться в RLM")
+				return
+			case <-time.After(interval):
+			}
+		}
+
+		failed := 0
+		for _, id := range ids {
+			if !core.IsSuccessfulTaskStatus(statuses[id]) {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("❌ Завершились с ошибкой: %d из %d\n", failed, len(ids))
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Все задачи завершены успешно: %d\n", len(ids))
+	},
+}
+
+var tasksCancelCmd = &cobra.Command{
+	Use:   "cancel <task_id>",
+	Short: "Отменить задачу в RLM (если API это поддерживает)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := taskKeyArg(args[0])
+		taskID, instance := core.ParseTaskKey(key)
+		client, err := core.NewRLMClientFromConfig(instance)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		if err := client.CancelTask(context.Background(), taskID); err != nil {
+			if errors.Is(err, core.ErrCancelUnsupported) {
+				fmt.Printf("⚠️ %v: %s\n", err, key)
+			} else {
+				fmt.Printf("❌ Ошибка отмены задачи %s: %v\n", key, err)
+			}
+			os.Exit(1)
+		}
+
+		if store, err := core.DefaultTaskStore(); err == nil {
+			store.Update(key, func(rec *core.TaskRecord) {
+				rec.Status = "canceled"
+			})
+		}
+		fmt.Printf("✅ Задача %s отменена\n", key)
+	},
+}
+
+// taskKeyArg - ключ реестра для аргумента команды: "1234@test" передаётся
+// как есть, к "1234" добавляется --rlm-instance.
+func taskKeyArg(arg string) string {
+	if strings.Contains(arg, "@") {
+		return arg
+	}
+	return core.TaskKey(rlmInstance, arg)
+}
+
+// refreshTask запрашивает статус и события задачи в её экземпляре RLM и
+// обновляет реестр. Задача, созданная не через ochan, добавляется в реестр
+// без сервиса и целей.
+func refreshTask(ctx context.Context, store *core.TaskStore, key string) (*core.TaskRecord, error) {
+	taskID, instance := core.ParseTaskKey(key)
+	client, err := core.NewRLMClientFromConfig(instance)
+	if err != nil {
+		return nil, err
+	}
+	status, err := client.TaskStatusWithEvents(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.Load(key); err != nil {
+		now := time.Now()
+		service, _ := status["service"].(string)
+		rec := &core.TaskRecord{ID: taskID, RLM: client.Name(), Service: service, CreatedAt: now, UpdatedAt: now}
+		if err := store.Save(rec); err != nil {
+			return nil, err
+		}
+	}
+	return store.UpdateFromAPI(key, status)
+}
+
+// printExecutionSummary печатает итог apply --wait по каждой задаче.
+func printExecutionSummary(result *core.ExecutionResult) {
+	fmt.Println("\n📊 Итог выполнения:")
+	fmt.Printf("%-10s %-14s %-32s %-10s %s\n", "ID", "СТАТУС", "СЕРВИС", "ВРЕМЯ", "ЦЕЛИ")
+	for _, outcome := range result.Outcomes {
+		status := outcome.Status
+		if status == "" {
+			status = "unknown"
+		}
+		mark := "✅"
+		if !outcome.Succeeded() {
+			mark = "❌"
+		}
+		id := outcome.ID
+		if id == "" {
+			id = "-"
+		}
+		fmt.Printf("%-10s %-14s %-32s %-10s %s %s\n", id, status, outcome.Service,
+			outcome.Duration().Round(time.Second), strings.Join(outcome.Targets, ","), mark)
+		if outcome.Err != nil {
+			fmt.Printf("%-10s %v\n", "", outcome.Err)
+		}
+	}
+}
+
+func printTaskEvents(events []map[string]interface{}) {
+	if len(events) == 0 {
+		return
+	}
+	fmt.Println("\n📝 События:")
+	for _, event := range events {
+		fmt.Printf("[%v] %v - %v\n", event["timestamp"], event["level"], event["message"])
+	}
+}
+
+func init() {
+	tasksListCmd.Flags().String("service", "", "Только задачи сервиса")
+	tasksListCmd.Flags().String("status", "", "Только задачи с этим статусом")
+	tasksListCmd.Flags().String("target", "", "Только задачи для CI")
+	tasksListCmd.Flags().Duration("since", 0, "Только задачи за последний период, например 24h")
+	tasksListCmd.Flags().Bool("active", false, "Только незавершённые задачи")
+	tasksListCmd.Flags().Bool("json", false, "Вывести в JSON")
+	tasksShowCmd.Flags().Bool("offline", false, "Не обращаться к RLM, показать сохранённое состояние")
+	tasksWatchCmd.Flags().Duration("interval", 10*time.Second, "Интервал опроса статуса")
+	tasksCmd.AddCommand(tasksListCmd, tasksShowCmd, tasksWatchCmd, tasksCancelCmd)
+	rootCmd.AddCommand(tasksCmd)
+}
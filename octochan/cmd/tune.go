@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"octochan/core"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var tuneCmd = &cobra.Command{
+	Use:   "tune --ram <объём> [--cpus N] [--storage ssd|hdd|san] [--workload oltp|olap|web|mixed|desktop] [--connections N]",
+	Short: "Рассчитать параметры PostgreSQL и сформировать сценарий psql_tuning_params_se",
+	Long: `Рассчитывает shared_buffers, effective_cache_size, work_mem, параметры WAL,
+параллелизма и autovacuum по характеристикам сервера и объясняет каждое значение.
+
+С --output записывает сценарий в формате conf_pgg.json (YAML или JSON по
+расширению), который принимает apply --rlm. Для сценария нужны --ci и --svm-ip.`,
+	Example: `tune --ram 64GB --cpus 16 --storage ssd --workload oltp --connections 800
+tune --ram 64GB --cpus 16 --ci CI08453376 --svm-ip 10.28.199.120 -o tuning.yaml
+apply --rlm tuning.yaml`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ramFlag, _ := cmd.Flags().GetString("ram")
+		cpus, _ := cmd.Flags().GetInt("cpus")
+		storage, _ := cmd.Flags().GetString("storage")
+		workload, _ := cmd.Flags().GetString("workload")
+		connections, _ := cmd.Flags().GetInt("connections")
+		output, _ := cmd.Flags().GetString("output")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		if ramFlag == "" {
+			fmt.Println("❌ Укажите объём памяти сервера: --ram 64GB")
+			os.Exit(2)
+		}
+		ram, err := core.ParseTuneRAM(ramFlag)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+
+		result, err := core.RecommendPgTuning(core.TuneProfile{
+			RAM:         ram,
+			CPUs:        cpus,
+			Storage:     strings.ToLower(storage),
+			Workload:    strings.ToLower(workload),
+			Connections: connections,
+		})
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(2)
+		}
+
+		if asJSON {
+			data, _ := json.MarshalIndent(result.Recommendations, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			printTuneResult(result)
+		}
+
+		if output == "" {
+			return
+		}
+
+		cis, _ := cmd.Flags().GetStringSlice("ci")
+		svmIP, _ := cmd.Flags().GetString("svm-ip")
+		if len(cis) == 0 || svmIP == "" {
+			fmt.Println("❌ Для сценария укажите целевые серверы --ci и --svm-ip")
+			os.Exit(2)
+		}
+
+		params := core.TuneScenarioParams{SvmIP: svmIP, Restart: result.NeedsRestart()}
+		params.Port, _ = cmd.Flags().GetInt("port")
+		params.Role, _ = cmd.Flags().GetString("role")
+		params.IPReplics, _ = cmd.Flags().GetString("ip-replics")
+		params.SkipSMConflicts, _ = cmd.Flags().GetBool("skip-sm-conflicts")
+		if params.IPReplics == "" {
+			params.IPReplics = svmIP
+		}
+		if cmd.Flags().Changed("restart") {
+			params.Restart, _ = cmd.Flags().GetBool("restart")
+		}
+		if !params.Restart && result.NeedsRestart() {
+			fmt.Println("⚠️ Часть параметров применится только после перезапуска, а restart выключен")
+		}
+
+		scenario := result.Scenario(params, cis)
+		var buf bytes.Buffer
+		if strings.EqualFold(filepath.Ext(output), ".json") {
+			encoder := json.NewEncoder(&buf)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(scenario)
+		} else {
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			err = encoder.Encode(scenario)
+		}
+		if err != nil {
+			fmt.Printf("❌ Ошибка формирования сценария: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+			fmt.Printf("❌ Ошибка записи сценария: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\n✅ Сценарий сохранён в %s\n", output)
+		fmt.Printf("   Применить: ochan apply --rlm %s\n", output)
+	},
+}
+
+func printTuneResult(result *core.TuneResult) {
+	p := result.Profile
+	fmt.Printf("Профиль: RAM %s, CPU %d, хранилище %s, нагрузка %s, соединений %d\n\n",
+		core.FormatPgMemory(p.RAM), p.CPUs, p.Storage, p.Workload, p.Connections)
+
+	width := 0
+	for _, rec := range result.Recommendations {
+		if len(rec.Name) > width {
+			width = len(rec.Name)
+		}
+	}
+	for _, rec := range result.Recommendations {
+		restart := ""
+		if rec.Restart {
+			restart = " (требует перезапуска)"
+		}
+		fmt.Printf("%-*s = %s%s\n", width, rec.Name, rec.Value(), restart)
+		fmt.Printf("%-*s   %s\n", width, "", rec.Reason)
+	}
+
+	if len(result.Notes) > 0 {
+		fmt.Println()
+		for _, note := range result.Notes {
+			fmt.Printf("⚠️ %s\n", note)
+		}
+	}
+}
+
+func init() {
+	tuneCmd.Flags().String("ram", "", "Объём памяти сервера, например 64GB")
+	tuneCmd.Flags().Int("cpus", 4, "Число CPU")
+	tuneCmd.Flags().String("storage", core.StorageSSD, "Тип хранилища: ssd, hdd, san")
+	tuneCmd.Flags().String("workload", core.WorkloadMixed, "Тип нагрузки: oltp, olap, web, mixed, desktop")
+	tuneCmd.Flags().Int("connections", 100, "Ожидаемое число соединений (max_connections)")
+	tuneCmd.Flags().Bool("json", false, "Вывести рекомендации в JSON")
+	tuneCmd.Flags().StringP("output", "o", "", "Записать сценарий psql_tuning_params_se (.yaml или .json)")
+	tuneCmd.Flags().StringSlice("ci", nil, "CI целевых серверов (можно через запятую)")
+	tuneCmd.Flags().String("svm-ip", "", "IP сервера (svm_ip)")
+	tuneCmd.Flags().String("ip-replics", "", "IP реплик через запятую (по умолчанию svm-ip)")
+	tuneCmd.Flags().Int("port", 5433, "Порт PostgreSQL")
+	tuneCmd.Flags().String("role", "standalone", "Роль сервера: standalone, master, replica")
+	tuneCmd.Flags().Bool("restart", false, "Перезапустить PostgreSQL после применения (без флага - только если параметры требуют перезапуска)")
+	tuneCmd.Flags().Bool("skip-sm-conflicts", false, "Пропускать конфликты SM")
+	rootCmd.AddCommand(tuneCmd)
+}
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"octochan/core"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Цепочки сценариев: шаги с зависимостями, условиями и передачей результатов",
+	Long: `Workflow описывает шаги, каждый из которых - сценарий зарегистрированного
+сервиса (файл scenario или service/parameters/targets прямо в шаге) либо
+сравнение результатов двух шагов (diff):
+
+  name: tune-and-restart
+  steps:
+    - name: before
+      service: postgresql_se_get_config_files
+      parameters: {port: 5432, config_list: [postgresql.conf], itemname: psql}
+      targets: [{svm_ci: CI01}]
+    - name: tune
+      scenario: tune.yaml
+    - name: restart
+      service: pangolin_restart
+      when: tune.succeeded && env.restart
+      parameters: {restart: rolling}
+      targets: [{svm_ci: CI01}]
+    - name: after
+      service: postgresql_se_get_config_files
+      when: always()
+      parameters: {port: 5432, config_list: [postgresql.conf], itemname: psql}
+      targets: [{svm_ci: CI01}]
+    - name: compare
+      diff: {from: before, to: after, output: diff.md, format: markdown}
+
+Без needs шаги выполняются по порядку, с needs - как граф, независимые шаги
+параллельно. Шаг ждёт завершения своих задач (wait: false - не ждать).
+
+Условие when - выражение как в policy: <шаг>.succeeded, <шаг>.failed,
+<шаг>.skipped, <шаг>.status, <шаг>.result.<поле>, env.<переменная> и функции
+success(), failure(), always() по шагам из needs. По умолчанию - success().
+Результаты задач шага доступны в шаблонах как {{ .steps.<шаг>.result.<поле> }}.`,
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run <file>",
+	Short: "Выполнить workflow",
+	Example: `workflow run tune-restart.yaml --env production
+workflow run tune-restart.yaml --var restart=false --poll-interval 5s`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		wf, vars, client := loadWorkflowArgs(cmd, args[0])
+		if !client.HasToken() {
+			fmt.Println("❌ Токен не установлен. Используйте команду 'auth' для установки токена")
+			os.Exit(1)
+		}
+		if err := client.UnlockToken(); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := core.DefaultExecOptions()
+		opts.Confirm = confirmFromTerminal
+		if cmd.Flags().Changed("task-timeout") {
+			opts.TaskTimeout, _ = cmd.Flags().GetDuration("task-timeout")
+		}
+		if cmd.Flags().Changed("poll-interval") {
+			opts.PollInterval, _ = cmd.Flags().GetDuration("poll-interval")
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if timeout, _ := cmd.Flags().GetDuration("timeout"); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeoutCause(ctx, timeout,
+				fmt.Errorf("превышено общее время выполнения workflow (%s)", timeout))
+			defer cancel()
+		}
+
+		fmt.Printf("🔄 Workflow %s: шагов - %d\n", wf.Name, len(wf.Steps))
+		result := core.RunWorkflow(ctx, client, wf, vars, opts)
+		printWorkflowSummary(result)
+
+		failed := result.Failed()
+		switch {
+		case ctx.Err() != nil:
+			fmt.Printf("\n⏹ Workflow прерван: %v\n", context.Cause(ctx))
+			fmt.Println("   Созданные задачи продолжают выполняться в RLM: ochan tasks watch")
+			os.Exit(130)
+		case len(failed) > 0:
+			fmt.Printf("\n❌ Шаги с ошибкой: %s\n", strings.Join(failed, ", "))
+			os.Exit(1)
+		}
+		fmt.Println("\n✅ Workflow выполнен")
+	},
+}
+
+var workflowValidateCmd = &cobra.Command{
+	Use:   "validate <file>",
+	Short: "Проверить workflow и показать порядок выполнения шагов",
+	Long: `Проверяет структуру workflow (имена, needs, циклы, условия when) и сценарии
+шагов по схемам модулей. Шаги, использующие результаты других шагов
+(.steps), проверяются только при выполнении. В RLM ничего не отправляется.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		wf, vars, client := loadWorkflowArgs(cmd, args[0])
+
+		deferred, err := core.ValidateWorkflow(client, wf, vars)
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("✅ Workflow %s корректен\n", wf.Name)
+		fmt.Println("\nПорядок выполнения:")
+		for i, stage := range wf.Stages() {
+			fmt.Printf("%d. %s\n", i+1, strings.Join(stage, ", "))
+		}
+		if len(deferred) > 0 {
+			fmt.Printf("\n⚠️ Проверяются при выполнении (зависят от результатов шагов): %s\n", strings.Join(deferred, ", "))
+		}
+	},
+}
+
+func loadWorkflowArgs(cmd *cobra.Command, path string) (*core.Workflow, core.ScenarioVars, *core.RLMClient) {
+	wf, err := core.LoadWorkflow(path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	vars, err := scenarioVarsFromFlags(cmd, path)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	client, err := rlmClient()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	return wf, vars, client
+}
+
+func printWorkflowSummary(result *core.WorkflowResult) {
+	fmt.Println("\n📊 Итог workflow:")
+	fmt.Printf("%-20s %-10s %-10s %s\n", "ШАГ", "СТАТУС", "ВРЕМЯ", "ЗАДАЧИ")
+	for _, step := range result.Steps {
+		mark := "✅"
+		switch step.Status {
+		case core.WorkflowStepFailed:
+			mark = "❌"
+		case core.WorkflowStepSkipped, core.WorkflowStepPending:
+			mark = "⏭"
+		}
+		var tasks []string
+		for _, outcome := range step.Outcomes {
+			if outcome.ID != "" {
+				tasks = append(tasks, outcome.ID)
+			}
+		}
+		fmt.Printf("%-20s %-10s %-10s %s %s\n", step.Name, step.Status,
+			step.Duration().Round(time.Second), strings.Join(tasks, ","), mark)
+		if step.Err != nil {
+			fmt.Printf("%-20s %v\n", "", step.Err)
+		} else if step.Reason != "" {
+			fmt.Printf("%-20s %s\n", "", step.Reason)
+		}
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{workflowRunCmd, workflowValidateCmd} {
+		addScenarioVarFlags(c)
+	}
+	workflowRunCmd.Flags().Duration("timeout", 0, "Общее время выполнения workflow (0 - без ограничения)")
+	workflowRunCmd.Flags().Duration("task-timeout", 0, "Время ожидания одной задачи (по умолчанию defaults.task_timeout)")
+	workflowRunCmd.Flags().Duration("poll-interval", 0, "Интервал опроса статуса задач (по умолчанию defaults.poll_interval)")
+	workflowCmd.AddCommand(workflowRunCmd, workflowValidateCmd)
+	rootCmd.AddCommand(workflowCmd)
+}
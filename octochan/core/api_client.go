@@ -1,17 +1,11 @@
 package core
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
 
-	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 )
 
@@ -26,10 +20,10 @@ type EnvironmentConfig struct {
 	DefaultTable string                 `mapstructure:"default_table" yaml:"default_table"`
 }
 type APIRequest struct {
-	Method  string
-	URL     string
-	Headers map[string]string
-	Body    map[string]interface{}
+	Method  string                 `json:"method"`
+	URL     string                 `json:"url"`
+	Headers map[string]string      `json:"headers"`
+	Body    map[string]interface{} `json:"body"`
 }
 
 type ScenarioModule interface {
@@ -44,6 +38,7 @@ type ScenarioData struct {
 	Environment string                   `mapstructure:"environment" yaml:"environment"`
 	TableID     string                   `mapstructure:"table_id" yaml:"table_id"`
 	Items       []map[string]interface{} `json:"items"`
+	Rollout     *RolloutConfig           `yaml:"rollout"`
 }
 
 type Target struct {
@@ -59,12 +54,23 @@ type Scenario struct {
 	Items      []map[string]string    `yaml:"items"`
 }
 
-type scenarioModuleCreator func(data *ScenarioData) (ScenarioModule, error)
+// scenarioModuleCreator создаёт модуль сервиса. client - экземпляр RLM, в
+// который модуль отправляет запросы (в том числе промежуточные, как разведка).
+type scenarioModuleCreator func(data *ScenarioData, client *RLMClient) (ScenarioModule, error)
 
 var scenarioModules = make(map[string]scenarioModuleCreator)
 
-func RegisterScenarioModule(serviceName string, creator scenarioModuleCreator) {
+// RegisterScenarioModule регистрирует модуль сервиса и его схему параметров.
+// По схеме работают scenario validate/init/describe, а перед Validate модуля
+// подставляются значения по умолчанию и проверяются типы. schema может быть nil.
+func RegisterScenarioModule(serviceName string, creator scenarioModuleCreator, schema *ModuleSchema) {
 	scenarioModules[serviceName] = creator
+	if schema != nil {
+		if schema.Service == "" {
+			schema.Service = serviceName
+		}
+		scenarioSchemas[serviceName] = schema
+	}
 }
 func (t *Target) GetCIs() []string {
 	if t.SVMCI != "" {
@@ -78,63 +84,15 @@ func (t *Target) GetCIs() []string {
 	return []string{}
 }
 func ExecuteRequest(req *APIRequest) (string, error) {
-	jsonData, err := json.Marshal(req.Body)
-	if err != nil {
-		return "", fmt.Errorf("ошибка формирования JSON: %w", err)
-	}
-
-	httpReq, err := http.NewRequest(req.Method, req.URL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	for k, v := range req.Headers {
-		httpReq.Header.Set(k, v)
-	}
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return "", fmt.Errorf("ошибка отправки запроса: %w", err)
-	}
-	defer resp.Body.Close()
+	return ExecuteRequestContext(context.Background(), req)
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func ExecuteRequestContext(ctx context.Context, req *APIRequest) (string, error) {
+	client, err := DefaultRLMClient()
 	if err != nil {
-		return "", fmt.Errorf("ошибка чтения ответа: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ошибка API (%d): %s", resp.StatusCode, string(body))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("ошибка парсинга ответа: %w", err)
-	}
-
-	switch v := result["id"].(type) {
-	case string:
-		return v, nil
-	case float64:
-		if v == float64(int64(v)) {
-			return strconv.FormatInt(int64(v), 10), nil
-		}
-		return strconv.FormatFloat(v, 'f', 0, 64), nil
-	case int:
-		return strconv.Itoa(v), nil
-	case int64:
-		return strconv.FormatInt(v, 10), nil
-	case nil:
-		return "", fmt.Errorf("ID задачи отсутствует в ответе сервера")
-	default:
-		if id, ok := result["id"].(string); ok {
-			return id, nil
-		} else if idNum, ok := result["id"].(float64); ok {
-			return fmt.Sprintf("%.0f", idNum), nil
-		}
-		return "", fmt.Errorf("неподдерживаемый формат ID: %T, полный ответ: %v", result["id"], result)
+		return "", err
 	}
+	return client.Submit(ctx, req)
 }
 
 func ParseScenarioData(data []byte) (*ScenarioData, error) {
@@ -143,10 +101,19 @@ func ParseScenarioData(data []byte) (*ScenarioData, error) {
 		Parameters map[string]interface{}   `json:"parameters"`
 		Targets    interface{}              `json:"targets"`
 		Items      []map[string]interface{} `json:"items"`
+		Rollout    json.RawMessage          `json:"rollout"`
 	}
 
 	if err := json.Unmarshal(data, &jsonData); err == nil {
-		return parseScenarioDataFromInterface(jsonData.Service, jsonData.Parameters, jsonData.Targets, jsonData.Items)
+		scenario, err := parseScenarioDataFromInterface(jsonData.Service, jsonData.Parameters, jsonData.Targets, jsonData.Items)
+		if err != nil || len(jsonData.Rollout) == 0 {
+			return scenario, err
+		}
+		// JSON - подмножество YAML: так pause: "2m" разбирается в Duration.
+		if err := yaml.Unmarshal(jsonData.Rollout, &scenario.Rollout); err != nil {
+			return nil, fmt.Errorf("некорректная секция rollout: %w", err)
+		}
+		return scenario, nil
 	}
 
 	var yamlData struct {
@@ -154,13 +121,19 @@ func ParseScenarioData(data []byte) (*ScenarioData, error) {
 		Parameters map[string]interface{}   `yaml:"parameters"`
 		Targets    interface{}              `yaml:"targets"`
 		Items      []map[string]interface{} `yaml:"items"`
+		Rollout    *RolloutConfig           `yaml:"rollout"`
 	}
 
 	if err := yaml.Unmarshal(data, &yamlData); err != nil {
 		return nil, fmt.Errorf("ошибка парсинга сценария (ни JSON, ни YAML): %w", err)
 	}
 
-	return parseScenarioDataFromInterface(yamlData.Service, yamlData.Parameters, yamlData.Targets, yamlData.Items)
+	scenario, err := parseScenarioDataFromInterface(yamlData.Service, yamlData.Parameters, yamlData.Targets, yamlData.Items)
+	if err != nil {
+		return nil, err
+	}
+	scenario.Rollout = yamlData.Rollout
+	return scenario, nil
 }
 
 func parseScenarioDataFromInterface(service string, parameters map[string]interface{}, targets interface{}, items []map[string]interface{}) (*ScenarioData, error) {
@@ -272,12 +245,16 @@ func ExecuteScenario(data []byte) ([]string, error) {
 		return nil, fmt.Errorf("модуль для сервиса '%s' не найден", scenario.Service)
 	}
 
-	module, err := creator(scenario)
+	client, err := DefaultRLMClient()
+	if err != nil {
+		return nil, err
+	}
+	module, err := creator(scenario, client)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка создания модуля: %w", err)
 	}
 
-	if err := module.Validate(); err != nil {
+	if err := ValidateScenarioData(scenario, module); err != nil {
 		return nil, fmt.Errorf("ошибка валидации: %w", err)
 	}
 
@@ -299,56 +276,23 @@ func ExecuteScenario(data []byte) ([]string, error) {
 }
 
 func CheckTaskStatus(taskID string) (string, error) {
-	apiURL := fmt.Sprintf("%s/%s/", viper.GetString("defaults.api_url"), taskID)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+viper.GetString("defaults.api_token"))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("ошибка запроса статуса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+	result, err := GetTaskStatus(taskID)
 	if err != nil {
-		return "", fmt.Errorf("ошибка чтения ответа: %w", err)
+		return "", err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("ошибка парсинга ответа: %w", err)
-	}
-
 	if status, ok := result["status"].(string); ok {
 		return status, nil
 	}
-
 	return "", fmt.Errorf("не удалось получить статус задачи")
 }
 
 func ExecuteRequestWithRetry(req *APIRequest, retries int) (string, error) {
-	var lastErr error
-
-	for i := 0; i < retries; i++ {
-		taskID, err := ExecuteRequest(req)
-		if err == nil {
-			return taskID, nil
-		}
-		lastErr = err
-		time.Sleep(time.Second * time.Duration(i+1))
+	client, err := DefaultRLMClient()
+	if err != nil {
+		return "", err
 	}
-	return "", fmt.Errorf("после %d попыток: %w", retries, lastErr)
+	client.Retry.MaxAttempts = retries
+	return client.SubmitWithRetry(context.Background(), req)
 }
 
 func ApplyScenario(path string, customParams map[string]string) ([]string, error) {
@@ -359,129 +303,19 @@ func ApplyScenario(path string, customParams map[string]string) ([]string, error
 	return ExecuteModularScenario(data, customParams)
 }
 
+// ExecuteModularScenario создаёт задачи сценария без ожидания их завершения.
 func ExecuteModularScenario(scenarioData []byte, customParams map[string]string) ([]string, error) {
-	if len(scenarioData) == 0 {
-		return nil, fmt.Errorf("пустые данные сценария")
-	}
-	data, err := ParseScenarioData(scenarioData)
+	client, err := DefaultRLMClient()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка парсинга сценария: %w", err)
-	}
-	if data.Parameters == nil {
-		data.Parameters = make(map[string]interface{})
-	}
-	for key, val := range customParams {
-		data.Parameters[key] = val
-	}
-
-	creator, exists := scenarioModules[data.Service]
-	if !exists {
-		availableModules := make([]string, 0, len(scenarioModules))
-		for moduleName := range scenarioModules {
-			availableModules = append(availableModules, moduleName)
-		}
-		return nil, fmt.Errorf(
-			"модуль для сервиса '%s' не зарегистрирован. Доступные модули: %v",
-			data.Service,
-			availableModules,
-		)
-	}
-
-	module, err := creator(data)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка создания модуля: %w", err)
-	}
-	if err := module.Validate(); err != nil {
-		return nil, fmt.Errorf("ошибка валидации: %w", err)
-	}
-	requests, err := module.GenerateRequests()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка подготовки запросов: %w", err)
-	}
-
-	maxParallel := viper.GetInt("defaults.max_parallel_tasks")
-	if maxParallel <= 0 {
-		maxParallel = 5
-	}
-
-	var wg sync.WaitGroup
-	taskIDs := make([]string, 0, len(requests))
-	taskErrors := make(chan error, len(requests))
-	results := make(chan string, len(requests))
-	semaphore := make(chan struct{}, maxParallel)
-
-	for _, req := range requests {
-		wg.Add(1)
-		semaphore <- struct{}{}
-
-		go func(r *APIRequest) {
-			defer func() {
-				<-semaphore
-				wg.Done()
-			}()
-
-			taskID, err := ExecuteRequestWithRetry(r, 3)
-			if err != nil {
-				taskErrors <- fmt.Errorf("ошибка выполнения запроса: %w", err)
-				return
-			}
-
-			results <- taskID
-			fmt.Printf("✅ Задача создана: %s\n", taskID)
-			go func(id string) {
-				if err := monitorTaskStatus(id); err != nil {
-					fmt.Printf("⚠️ Ошибка мониторинга задачи %s: %v\n", id, err)
-				}
-			}(taskID)
-		}(req)
-	}
-	go func() {
-		wg.Wait()
-		close(results)
-		close(taskErrors)
-	}()
-	for taskID := range results {
-		taskIDs = append(taskIDs, taskID)
-	}
-	select {
-	case err := <-taskErrors:
-		return taskIDs, err
-	default:
-		return taskIDs, nil
+		return nil, err
 	}
-}
-func monitorTaskStatus(taskID string) error {
-	fmt.Printf("\n🔄 Начинаем мониторинг задачи %s...\n", taskID)
-
-	ticker := time.NewTicker(20 * time.Second)
-	defer ticker.Stop()
-
-	var lastStatus string
-	for {
-		select {
-		case <-ticker.C:
-			status, err := GetTaskStatusWithEvents(taskID)
-			if err != nil {
-				return fmt.Errorf("ошибка получения статуса: %w", err)
-			}
-
-			if taskStatus, ok := status["status"].(string); ok {
-				if taskStatus != lastStatus {
-					fmt.Printf("Текущий статус: %s\n", taskStatus)
-					lastStatus = taskStatus
-				}
-
-				switch taskStatus {
-				case "completed", "failed", "canceled", "success":
-					fmt.Printf("Завершено с статусом: %s\n", taskStatus)
-					return nil
-				}
-			}
-
-		case <-time.After(30 * time.Minute):
-			return fmt.Errorf("превышено время ожидания выполнения задачи")
-		}
+	opts := DefaultExecOptions()
+	opts.Wait = false
+	result, err := ExecuteModularScenarioContext(context.Background(), client, scenarioData, customParams, opts)
+	if result == nil {
+		return nil, err
 	}
+	return result.TaskIDs(), err
 }
 func PrepareScenarioItems(targets []Target) ([]map[string]string, error) {
 	var items []map[string]string
@@ -507,90 +341,19 @@ func DeepCopyMap(m map[string]interface{}) map[string]interface{} {
 }
 
 func GetTaskStatusWithEvents(taskID string) (map[string]interface{}, error) {
-	baseURL := strings.TrimSuffix(viper.GetString("defaults.api_url"), ".json")
-	baseURL = strings.TrimSuffix(baseURL, "/")
-
-	statusURL := fmt.Sprintf("%s/%s/", baseURL, taskID)
-	eventsURL := fmt.Sprintf("%s/%s/events/", baseURL, taskID)
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	result, err := getTaskStatus(client, statusURL)
-	if err != nil {
-		return nil, err
-	}
-	if events, err := getTaskEvents(client, eventsURL); err == nil {
-		result["events"] = events
-	} else if !strings.Contains(err.Error(), "404") {
-		fmt.Printf("⚠️ Не удалось получить события: %v\n", err)
-	}
-
-	return result, nil
+	return GetTaskStatusWithEventsContext(context.Background(), taskID)
 }
 
-func getTaskStatus(client *http.Client, url string) (map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func GetTaskStatusWithEventsContext(ctx context.Context, taskID string) (map[string]interface{}, error) {
+	client, err := DefaultRLMClient()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+viper.GetString("defaults.api_token"))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка HTTP запроса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
-	}
-
-	return result, nil
-}
-
-func getTaskEvents(client *http.Client, url string) ([]map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+viper.GetString("defaults.api_token"))
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка HTTP запроса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var events []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+		return nil, err
 	}
-
-	return events, nil
+	return client.TaskStatusWithEvents(ctx, taskID)
 }
 
-func PrintTaskStatus(taskID string) error {
-	status, err := GetTaskStatusWithEvents(taskID)
+func PrintTaskStatus(client *RLMClient, taskID string) error {
+	status, err := client.TaskStatusWithEvents(context.Background(), taskID)
 	if err != nil {
 		return fmt.Errorf("ошибка получения статуса задачи %s: %w", taskID, err)
 	}
@@ -627,71 +390,17 @@ func PrintTaskStatus(taskID string) error {
 }
 
 func GetTaskStatus(taskID string) (map[string]interface{}, error) {
-	apiURL := fmt.Sprintf("%s/%s/", viper.GetString("defaults.api_url"), taskID)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+	client, err := DefaultRLMClient()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+viper.GetString("defaults.api_token"))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка запроса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга ответа: %w", err)
+		return nil, err
 	}
-
-	return result, nil
+	return client.TaskStatus(context.Background(), taskID)
 }
 
 func GetTaskLogs(taskID string) ([]map[string]interface{}, error) {
-	apiURL := fmt.Sprintf("%s/%s/events/", viper.GetString("defaults.api_url"), taskID)
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+viper.GetString("defaults.api_token"))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	client, err := DefaultRLMClient()
 	if err != nil {
-		return nil, fmt.Errorf("ошибка запроса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var logs []map[string]interface{}
-	if err := json.Unmarshal(body, &logs); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга логов: %w", err)
+		return nil, err
 	}
-
-	return logs, nil
+	return client.TaskEvents(context.Background(), taskID)
 }
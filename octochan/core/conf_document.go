@@ -0,0 +1,382 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	ConfLineBlank = iota
+	ConfLineComment
+	ConfLineSection
+	ConfLineParam
+	ConfLineOther
+)
+
+// ConfLine - строка postgresql.conf/INI. Для параметров строка разбита на
+// части так, чтобы замена значения не трогала отступ, разделитель и
+// комментарий: Indent + Key + Sep + RawValue + Comment == исходная строка.
+type ConfLine struct {
+	Kind     int
+	Raw      string
+	Section  string
+	Indent   string
+	Key      string
+	Sep      string
+	RawValue string
+	Comment  string
+}
+
+// Value возвращает значение параметра без кавычек.
+func (l *ConfLine) Value() string {
+	return unquoteConfValue(l.RawValue)
+}
+
+func (l *ConfLine) String() string {
+	if l.Kind == ConfLineParam {
+		return l.Indent + l.Key + l.Sep + l.RawValue + l.Comment
+	}
+	return l.Raw
+}
+
+// ConfDocument - построчная модель конфига, которая при сериализации
+// воспроизводит файл байт в байт, включая комментарии и порядок строк.
+type ConfDocument struct {
+	Lines []*ConfLine
+	// crlf и finalNewline сохраняют окончания строк исходного файла.
+	crlf         bool
+	finalNewline bool
+}
+
+// ConfEdit описывает изменение одной строки документа для вывода пользователю.
+type ConfEdit struct {
+	Line int
+	Old  string
+	New  string
+}
+
+var confParamRe = regexp.MustCompile(`^(\s*)([^\s=#;]+)(\s*=\s*)(.*)$`)
+
+// confBareParamRe - форма без '=' ("include 'file.conf'"), которую
+// PostgreSQL допускает для любых параметров.
+var confBareParamRe = regexp.MustCompile(`^(\s*)([A-Za-z_][A-Za-z0-9_.]*)(\s+)([^\s=#].*)$`)
+
+// commentedParamRe находит закомментированные значения по умолчанию вида
+// "#work_mem = 4MB", рядом с которыми set вставляет новый параметр.
+var commentedParamRe = regexp.MustCompile(`^\s*#\s*([A-Za-z_][A-Za-z0-9_.\-]*)\s*=`)
+
+func ParseConfDocument(content string) *ConfDocument {
+	doc := &ConfDocument{
+		crlf:         strings.Contains(content, "\r\n"),
+		finalNewline: strings.HasSuffix(content, "\n"),
+	}
+
+	if doc.crlf {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	content = strings.TrimSuffix(content, "\n")
+	if content == "" && !doc.finalNewline {
+		return doc
+	}
+
+	section := ""
+	for _, raw := range strings.Split(content, "\n") {
+		line := &ConfLine{Raw: raw, Section: section}
+		trimmed := strings.TrimSpace(raw)
+
+		switch {
+		case trimmed == "":
+			line.Kind = ConfLineBlank
+		case strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+			line.Kind = ConfLineComment
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(stripConfComment(trimmed), "]"):
+			header := strings.TrimSpace(stripConfComment(trimmed))
+			section = header[1 : len(header)-1]
+			line.Kind = ConfLineSection
+			line.Section = section
+		default:
+			m := confParamRe.FindStringSubmatch(raw)
+			if m == nil {
+				m = confBareParamRe.FindStringSubmatch(raw)
+			}
+			if m == nil {
+				line.Kind = ConfLineOther
+				break
+			}
+			line.Kind = ConfLineParam
+			line.Indent, line.Key, line.Sep = m[1], m[2], m[3]
+			line.RawValue, line.Comment = splitConfValue(m[4])
+		}
+		doc.Lines = append(doc.Lines, line)
+	}
+	return doc
+}
+
+func (d *ConfDocument) String() string {
+	parts := make([]string, len(d.Lines))
+	for i, line := range d.Lines {
+		parts[i] = line.String()
+	}
+	newline := "\n"
+	if d.crlf {
+		newline = "\r\n"
+	}
+	result := strings.Join(parts, newline)
+	if d.finalNewline {
+		result += newline
+	}
+	return result
+}
+
+// Config возвращает эффективные значения (последнее определение побеждает)
+// с именами параметров в ConfParamName.
+func (d *ConfDocument) Config() map[string]map[string]string {
+	config := make(map[string]map[string]string)
+	for _, line := range d.Lines {
+		switch line.Kind {
+		case ConfLineSection:
+			if _, exists := config[line.Section]; !exists {
+				config[line.Section] = make(map[string]string)
+			}
+		case ConfLineParam:
+			if _, exists := config[line.Section]; !exists {
+				config[line.Section] = make(map[string]string)
+			}
+			config[line.Section][ConfParamName(line.Key)] = line.Value()
+		}
+	}
+	return config
+}
+
+func (d *ConfDocument) Get(section, key string) (string, bool) {
+	if i := d.lastParam(section, key); i >= 0 {
+		return d.Lines[i].Value(), true
+	}
+	return "", false
+}
+
+// Set задаёт значение параметра, меняя минимально возможное число строк:
+// у существующего параметра заменяется только значение, новый вставляется
+// после закомментированного значения по умолчанию или в конец секции.
+func (d *ConfDocument) Set(section, key, value string) ConfEdit {
+	if i := d.lastParam(section, key); i >= 0 {
+		line := d.Lines[i]
+		old := line.String()
+		line.RawValue = quoteConfValue(value, line.RawValue)
+		return ConfEdit{Line: i + 1, Old: old, New: line.String()}
+	}
+
+	line := &ConfLine{
+		Kind:     ConfLineParam,
+		Section:  section,
+		Key:      key,
+		Sep:      " = ",
+		RawValue: quoteConfValue(value, ""),
+	}
+
+	pos := d.insertPosition(section, key)
+	if pos < 0 {
+		if len(d.Lines) > 0 && d.Lines[len(d.Lines)-1].Kind != ConfLineBlank {
+			d.Lines = append(d.Lines, &ConfLine{Kind: ConfLineBlank, Section: section})
+		}
+		d.Lines = append(d.Lines, &ConfLine{Kind: ConfLineSection, Raw: "[" + section + "]", Section: section})
+		pos = len(d.Lines)
+	}
+
+	d.Lines = append(d.Lines[:pos], append([]*ConfLine{line}, d.Lines[pos:]...)...)
+	if len(d.Lines) == 1 {
+		d.finalNewline = true
+	}
+	return ConfEdit{Line: pos + 1, New: line.String()}
+}
+
+// Unset удаляет все активные определения параметра, чтобы не "всплыло"
+// более раннее значение.
+func (d *ConfDocument) Unset(section, key string) []ConfEdit {
+	var edits []ConfEdit
+	kept := d.Lines[:0]
+	for i, line := range d.Lines {
+		if line.Kind == ConfLineParam && line.Section == section && strings.EqualFold(line.Key, key) {
+			edits = append(edits, ConfEdit{Line: i + 1, Old: line.String()})
+			continue
+		}
+		kept = append(kept, line)
+	}
+	d.Lines = kept
+	return edits
+}
+
+// ApplyDiff переносит в документ переход before -> after: изменённые и новые
+// параметры задаются через Set, исчезнувшие удаляются через Unset. Прочие
+// строки не трогаются, поэтому параметры из include-файлов, которые есть в
+// обоих состояниях, в документ не попадают.
+func (d *ConfDocument) ApplyDiff(before, after map[string]map[string]string) []ConfEdit {
+	var edits []ConfEdit
+	for _, section := range sortedConfKeys(after) {
+		for _, key := range sortedConfKeys(after[section]) {
+			value := after[section][key]
+			if old, ok := before[section][key]; ok && old == value {
+				continue
+			}
+			edits = append(edits, d.Set(section, key, value))
+		}
+	}
+	for _, section := range sortedConfKeys(before) {
+		for _, key := range sortedConfKeys(before[section]) {
+			if _, ok := after[section][key]; !ok {
+				edits = append(edits, d.Unset(section, key)...)
+			}
+		}
+	}
+	return edits
+}
+
+func sortedConfKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d *ConfDocument) lastParam(section, key string) int {
+	for i := len(d.Lines) - 1; i >= 0; i-- {
+		line := d.Lines[i]
+		if line.Kind == ConfLineParam && line.Section == section && strings.EqualFold(line.Key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertPosition возвращает индекс для вставки нового параметра или -1,
+// если секции нет и её нужно создать.
+func (d *ConfDocument) insertPosition(section, key string) int {
+	found := section == ""
+	last := -1
+	for i, line := range d.Lines {
+		if line.Section != section {
+			continue
+		}
+		if line.Kind == ConfLineSection {
+			found = true
+			last = i
+			continue
+		}
+		if m := commentedParamRe.FindStringSubmatch(line.Raw); m != nil && strings.EqualFold(m[1], key) {
+			return i + 1
+		}
+		if line.Kind == ConfLineParam {
+			last = i
+		}
+	}
+
+	if !found {
+		return -1
+	}
+	if last < 0 {
+		if section == "" {
+			for i, line := range d.Lines {
+				if line.Kind == ConfLineSection {
+					return i
+				}
+			}
+		}
+		return len(d.Lines)
+	}
+	return last + 1
+}
+
+func LoadConfDocument(path string) (*ConfDocument, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfDocument(string(content)), nil
+}
+
+// SaveConfDocument записывает документ, сохраняя права файла. При backup
+// исходное содержимое сначала копируется в <path>.bak.
+func SaveConfDocument(doc *ConfDocument, path string, backup bool) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+		if backup {
+			original, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s for backup: %v", path, err)
+			}
+			if err := os.WriteFile(path+".bak", original, mode); err != nil {
+				return fmt.Errorf("failed to write backup: %v", err)
+			}
+		}
+	}
+	return os.WriteFile(path, []byte(doc.String()), mode)
+}
+
+// splitConfValue отделяет значение от хвостового комментария, учитывая
+// кавычки: '#' внутри '...' комментарием не является.
+func splitConfValue(rest string) (string, string) {
+	end := len(rest)
+	if strings.HasPrefix(rest, "'") {
+		i := 1
+		for i < len(rest) {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i += 2
+				continue
+			}
+			if rest[i] == '\'' {
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					i += 2
+					continue
+				}
+				break
+			}
+			i++
+		}
+		if i < len(rest) {
+			i++
+		}
+		if idx := strings.Index(rest[i:], "#"); idx >= 0 {
+			end = i + idx
+		}
+	} else if idx := strings.Index(rest, "#"); idx >= 0 {
+		end = idx
+	}
+
+	value := strings.TrimRight(rest[:end], " \t")
+	return value, rest[len(value):]
+}
+
+func stripConfComment(s string) string {
+	if idx := strings.IndexAny(s, "#;"); idx >= 0 {
+		return strings.TrimSpace(s[:idx])
+	}
+	return s
+}
+
+func unquoteConfValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+		inner := raw[1 : len(raw)-1]
+		inner = strings.ReplaceAll(inner, "''", "'")
+		return strings.ReplaceAll(inner, `\'`, "'")
+	}
+	return strings.Trim(raw, "'\"")
+}
+
+var plainConfValueRe = regexp.MustCompile(`^[A-Za-z0-9_.\-+]+$`)
+
+// quoteConfValue оформляет значение как в postgresql.conf: простые значения
+// пишутся как есть (если прежнее значение не было в кавычках), остальные -
+// в одинарных кавычках с удвоением внутренних кавычек.
+func quoteConfValue(value, previous string) string {
+	if plainConfValueRe.MatchString(value) && !strings.HasPrefix(strings.TrimSpace(previous), "'") {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
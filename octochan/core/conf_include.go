@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var confIncludeDirectives = map[string]bool{
+	"include":           true,
+	"include_if_exists": true,
+	"include_dir":       true,
+}
+
+// LoadEffectiveConfig читает postgresql.conf вместе со всеми include-файлами
+// и возвращает итоговые значения параметров.
+func LoadEffectiveConfig(path string) (map[string]map[string]string, error) {
+	content, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEffectiveConfig(content, path)
+}
+
+// ParseEffectiveConfig разбирает содержимое fileName, раскрывая include,
+// include_if_exists и include_dir относительно директории включающего файла.
+// Как и в PostgreSQL, побеждает последнее определение параметра, а имена
+// параметров не зависят от регистра и приводятся к нижнему.
+func ParseEffectiveConfig(content, fileName string) (map[string]map[string]string, error) {
+	config := make(map[string]map[string]string)
+	err := walkConfIncludes(content, fileName, map[string]bool{}, func(file string, lineNum int, line *ConfLine) {
+		if _, exists := config[line.Section]; !exists {
+			config[line.Section] = make(map[string]string)
+		}
+		config[line.Section][ConfParamName(line.Key)] = line.Value()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ConfParamName - каноническое имя параметра: GUC PostgreSQL (как и ключи
+// pgbouncer.ini) нечувствительны к регистру.
+func ConfParamName(key string) string {
+	return strings.ToLower(key)
+}
+
+// HasConfIncludes сообщает, есть ли в содержимом include-директивы.
+func HasConfIncludes(content string) bool {
+	for _, line := range ParseConfDocument(content).Lines {
+		if isConfInclude(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkConfIncludes обходит параметры файла в порядке применения, заходя в
+// include-файлы на месте директивы. stack хранит файлы текущей цепочки
+// включений для обнаружения циклов.
+func walkConfIncludes(content, fileName string, stack map[string]bool, visit func(file string, lineNum int, line *ConfLine)) error {
+	key := fileName
+	if abs, err := filepath.Abs(fileName); err == nil {
+		key = abs
+	}
+	if stack[key] {
+		return fmt.Errorf("циклическое включение конфигурационного файла %s", fileName)
+	}
+	stack[key] = true
+	defer delete(stack, key)
+
+	baseDir := filepath.Dir(fileName)
+	for i, line := range ParseConfDocument(content).Lines {
+		if line.Kind != ConfLineParam {
+			continue
+		}
+		if !isConfInclude(line) {
+			visit(fileName, i+1, line)
+			continue
+		}
+
+		target := line.Value()
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(baseDir, target)
+		}
+
+		var files []string
+		switch strings.ToLower(line.Key) {
+		case "include":
+			files = []string{target}
+		case "include_if_exists":
+			if FileExists(target) {
+				files = []string{target}
+			}
+		case "include_dir":
+			entries, err := os.ReadDir(target)
+			if err != nil {
+				return fmt.Errorf("%s:%d: не удалось открыть директорию %s: %v", fileName, i+1, target, err)
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if !entry.IsDir() && strings.HasSuffix(name, ".conf") && !strings.HasPrefix(name, ".") {
+					files = append(files, filepath.Join(target, name))
+				}
+			}
+			sort.Strings(files)
+		}
+
+		for _, file := range files {
+			included, err := ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("%s:%d: не удалось открыть файл %s: %v", fileName, i+1, file, err)
+			}
+			if err := walkConfIncludes(included, file, stack, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isConfInclude(line *ConfLine) bool {
+	return line.Kind == ConfLineParam && line.Section == "" && confIncludeDirectives[strings.ToLower(line.Key)]
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ConfigDefinition - одно определение параметра в конкретном файле и строке.
+type ConfigDefinition struct {
+	Section string `json:"section"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	File    string `json:"sourcefile"`
+	Line    int    `json:"sourceline"`
+	Raw     string `json:"raw"`
+}
+
+func (d ConfigDefinition) Location() string {
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// ParamProvenance - все определения параметра в порядке применения.
+// Последнее действует, предыдущие переопределены.
+type ParamProvenance struct {
+	Param       string             `json:"param"`
+	Definitions []ConfigDefinition `json:"definitions"`
+}
+
+func (p *ParamProvenance) Effective() ConfigDefinition {
+	return p.Definitions[len(p.Definitions)-1]
+}
+
+func (p *ParamProvenance) Overridden() []ConfigDefinition {
+	return p.Definitions[:len(p.Definitions)-1]
+}
+
+// Chain описывает определения в порядке применения строками "файл:строка: текст".
+func (p *ParamProvenance) Chain() []string {
+	chain := make([]string, 0, len(p.Definitions))
+	for _, def := range p.Definitions {
+		chain = append(chain, def.Location()+": "+def.Raw)
+	}
+	return chain
+}
+
+// ConfigProvenance индексирует происхождение параметров по ключу
+// "section.param" - так же, как CompareConfigs.
+type ConfigProvenance map[string]*ParamProvenance
+
+// Config возвращает итоговые значения - то же, что ParseEffectiveConfig.
+func (p ConfigProvenance) Config() map[string]map[string]string {
+	config := make(map[string]map[string]string)
+	for _, prov := range p {
+		def := prov.Effective()
+		if _, exists := config[def.Section]; !exists {
+			config[def.Section] = make(map[string]string)
+		}
+		config[def.Section][def.Key] = def.Value
+	}
+	return config
+}
+
+// Lookup ищет параметр по "section.param" или по имени без секции.
+// Имена сравниваются без учёта регистра, как GUC в PostgreSQL.
+func (p ConfigProvenance) Lookup(name string) []*ParamProvenance {
+	if prov, ok := p[name]; ok {
+		return []*ParamProvenance{prov}
+	}
+
+	var found []*ParamProvenance
+	for _, param := range p.Params() {
+		prov := p[param]
+		def := prov.Effective()
+		if strings.EqualFold(def.Key, name) || strings.EqualFold(param, name) {
+			found = append(found, prov)
+		}
+	}
+	return found
+}
+
+func (p ConfigProvenance) Params() []string {
+	params := make([]string, 0, len(p))
+	for param := range p {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return params
+}
+
+// ParseConfigWithProvenance разбирает postgresql.conf/INI так же, как
+// ParseEffectiveConfig, но для каждого параметра запоминает файл и строку
+// действующего определения и всех переопределённых.
+func ParseConfigWithProvenance(content, fileName string) (ConfigProvenance, error) {
+	prov := make(ConfigProvenance)
+	err := walkConfIncludes(content, fileName, map[string]bool{}, func(file string, lineNum int, line *ConfLine) {
+		key := ConfParamName(line.Key)
+		param := line.Section + "." + key
+		if _, exists := prov[param]; !exists {
+			prov[param] = &ParamProvenance{Param: param}
+		}
+		prov[param].Definitions = append(prov[param].Definitions, ConfigDefinition{
+			Section: line.Section,
+			Key:     key,
+			Value:   line.Value(),
+			File:    file,
+			Line:    lineNum,
+			Raw:     strings.TrimSpace(line.String()),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prov, nil
+}
+
+// AttachSources дописывает в отчёт места определения значений. Если параметр
+// задан несколько раз, в отчёт попадает вся цепочка определений.
+func (r *DiffReport) AttachSources(left, right ConfigProvenance) {
+	for i := range r.Entries {
+		e := &r.Entries[i]
+		if prov, ok := left[e.Param]; ok && e.LeftExists {
+			e.LeftSource = prov.Effective().Location()
+			if len(prov.Definitions) > 1 {
+				e.LeftChain = prov.Chain()
+			}
+		}
+		if prov, ok := right[e.Param]; ok && e.RightExists {
+			e.RightSource = prov.Effective().Location()
+			if len(prov.Definitions) > 1 {
+				e.RightChain = prov.Chain()
+			}
+		}
+	}
+}
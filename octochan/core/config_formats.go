@@ -0,0 +1,352 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigParser разбирает конфиг определённого формата в плоскую карту
+// секция -> параметр -> значение, с которой работают CompareConfigs и команды.
+type ConfigParser interface {
+	Name() string
+	Extensions() []string
+	Detect(content string) bool
+	Parse(content string) (map[string]map[string]string, error)
+}
+
+var (
+	configParsers     = make(map[string]ConfigParser)
+	configParserOrder []string
+)
+
+func RegisterConfigParser(parser ConfigParser) {
+	name := parser.Name()
+	if _, exists := configParsers[name]; !exists {
+		configParserOrder = append(configParserOrder, name)
+	}
+	configParsers[name] = parser
+}
+
+func init() {
+	RegisterConfigParser(jsonConfigParser{})
+	RegisterConfigParser(envConfigParser{})
+	RegisterConfigParser(yamlConfigParser{})
+	RegisterConfigParser(tomlConfigParser{})
+	RegisterConfigParser(iniConfigParser{})
+}
+
+func GetConfigParser(format string) (ConfigParser, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "yml" {
+		format = "yaml"
+	}
+	parser, ok := configParsers[format]
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый формат конфига '%s'. Доступные форматы: %v", format, ConfigFormats())
+	}
+	return parser, nil
+}
+
+func ConfigFormats() []string {
+	formats := make([]string, 0, len(configParsers))
+	for name := range configParsers {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// DetectConfigFormat выбирает формат по расширению файла, а если оно
+// неизвестно (stdin, .txt) - по содержимому. По умолчанию используется ini.
+func DetectConfigFormat(fileName, content string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != "" {
+		for _, name := range configParserOrder {
+			for _, parserExt := range configParsers[name].Extensions() {
+				if ext == parserExt {
+					return name
+				}
+			}
+		}
+	}
+
+	for _, name := range configParserOrder {
+		if configParsers[name].Detect(content) {
+			return name
+		}
+	}
+	return "ini"
+}
+
+// ParseConfigAs разбирает конфиг в указанном формате. Пустой format или
+// "auto" означает автоопределение через DetectConfigFormat.
+func ParseConfigAs(content, fileName, format string) (map[string]map[string]string, error) {
+	if format == "" || format == "auto" {
+		format = DetectConfigFormat(fileName, content)
+	}
+
+	parser, err := GetConfigParser(format)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parser.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора %s: %w", parser.Name(), err)
+	}
+	return cfg, nil
+}
+
+// flattenDocument раскладывает вложенный документ по секциям: скалярные
+// ключи верхнего уровня попадают в секцию "", вложенные объекты становятся
+// секциями, а более глубокие уровни и списки склеиваются в имя параметра
+// через точку и [индекс].
+func flattenDocument(doc map[string]interface{}) map[string]map[string]string {
+	config := make(map[string]map[string]string)
+
+	for key, value := range doc {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			params := make(map[string]string)
+			for childKey, childValue := range v {
+				flattenValue(params, childKey, childValue)
+			}
+			config[key] = params
+		default:
+			if _, exists := config[""]; !exists {
+				config[""] = make(map[string]string)
+			}
+			flattenValue(config[""], key, v)
+		}
+	}
+
+	return config
+}
+
+func flattenValue(params map[string]string, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			params[prefix] = ""
+			return
+		}
+		for key, child := range v {
+			flattenValue(params, prefix+"."+key, child)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			params[prefix] = ""
+			return
+		}
+		for i, child := range v {
+			flattenValue(params, fmt.Sprintf("%s[%d]", prefix, i), child)
+		}
+	case nil:
+		params[prefix] = ""
+	default:
+		params[prefix] = fmt.Sprintf("%v", v)
+	}
+}
+
+type iniConfigParser struct{}
+
+func (iniConfigParser) Name() string { return "ini" }
+
+func (iniConfigParser) Extensions() []string { return []string{".ini", ".conf", ".cfg"} }
+
+func (iniConfigParser) Detect(content string) bool { return true }
+
+func (iniConfigParser) Parse(content string) (map[string]map[string]string, error) {
+	return ParseConfig(content)
+}
+
+type jsonConfigParser struct{}
+
+func (jsonConfigParser) Name() string { return "json" }
+
+func (jsonConfigParser) Extensions() []string { return []string{".json"} }
+
+func (jsonConfigParser) Detect(content string) bool {
+	trimmed := strings.TrimSpace(content)
+	return strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed))
+}
+
+func (jsonConfigParser) Parse(content string) (map[string]map[string]string, error) {
+	if strings.TrimSpace(content) == "" {
+		return make(map[string]map[string]string), nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return flattenDocument(doc), nil
+}
+
+type yamlConfigParser struct{}
+
+var (
+	yamlKeyLineRe = regexp.MustCompile(`^\s*(- )?[\w.\-"']+:(\s|$)`)
+	iniKeyLineRe  = regexp.MustCompile(`^\s*[\w.\-]+\s*=`)
+)
+
+func (yamlConfigParser) Name() string { return "yaml" }
+
+func (yamlConfigParser) Extensions() []string { return []string{".yaml", ".yml"} }
+
+func (yamlConfigParser) Detect(content string) bool {
+	hasYAMLKey := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if iniKeyLineRe.MatchString(line) || strings.HasPrefix(trimmed, "[") {
+			return false
+		}
+		if yamlKeyLineRe.MatchString(line) {
+			hasYAMLKey = true
+		}
+	}
+	if !hasYAMLKey {
+		return false
+	}
+
+	var doc map[string]interface{}
+	return yaml.Unmarshal([]byte(content), &doc) == nil
+}
+
+func (yamlConfigParser) Parse(content string) (map[string]map[string]string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return make(map[string]map[string]string), nil
+	}
+	return flattenDocument(normalizeYAMLValue(doc).(map[string]interface{})), nil
+}
+
+// normalizeYAMLValue приводит map[interface{}]interface{} из вложенных
+// YAML-узлов к map[string]interface{}, чтобы flattenDocument видел объекты.
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = normalizeYAMLValue(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			result[fmt.Sprintf("%v", key)] = normalizeYAMLValue(child)
+		}
+		return result
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalizeYAMLValue(child)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type tomlConfigParser struct{}
+
+func (tomlConfigParser) Name() string { return "toml" }
+
+func (tomlConfigParser) Extensions() []string { return []string{".toml"} }
+
+// Detect не пытается угадать TOML: простые `key = value` одинаково валидны
+// и для ini, а ini-разбор терпимее к значениям postgresql.conf без кавычек.
+func (tomlConfigParser) Detect(content string) bool { return false }
+
+func (tomlConfigParser) Parse(content string) (map[string]map[string]string, error) {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return make(map[string]map[string]string), nil
+	}
+	return flattenDocument(doc), nil
+}
+
+type envConfigParser struct{}
+
+var envLineRe = regexp.MustCompile(`^(export\s+)?([A-Za-z_][A-Za-z0-9_.]*)=(.*)$`)
+
+func (envConfigParser) Name() string { return "env" }
+
+func (envConfigParser) Extensions() []string { return []string{".env"} }
+
+func (envConfigParser) Detect(content string) bool {
+	found := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if !envLineRe.MatchString(trimmed) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func (envConfigParser) Parse(content string) (map[string]map[string]string, error) {
+	params := make(map[string]string)
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		matches := envLineRe.FindStringSubmatch(trimmed)
+		if matches == nil {
+			return nil, fmt.Errorf("строка %d: ожидается KEY=value", i+1)
+		}
+		params[matches[2]] = parseEnvValue(matches[3])
+	}
+
+	return map[string]map[string]string{"": params}, nil
+}
+
+func parseEnvValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	switch raw[0] {
+	case '"':
+		if end := strings.LastIndex(raw, "\""); end > 0 {
+			value := raw[1:end]
+			value = strings.ReplaceAll(value, `\n`, "\n")
+			value = strings.ReplaceAll(value, `\"`, `"`)
+			return value
+		}
+	case '\'':
+		if end := strings.LastIndex(raw, "'"); end > 0 {
+			return raw[1:end]
+		}
+	}
+
+	if idx := strings.Index(raw, " #"); idx >= 0 {
+		raw = raw[:idx]
+	}
+	return strings.TrimSpace(raw)
+}
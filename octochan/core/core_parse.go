@@ -9,7 +9,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 func Normalize_value(value interface{}) interface{} {
@@ -37,8 +36,6 @@ func Normalize_value(value interface{}) interface{} {
 		"no":      "off",
 		"true":    "on",
 		"false":   "off",
-		"1":       "on",
-		"0":       "off",
 		"enable":  "on",
 		"disable": "off",
 	}
@@ -224,8 +221,8 @@ func CompareConfigs(db1Config, db2Config map[string]map[string]string, db1Name,
 			}
 		}
 
-		normDb1 := Normalize_value(db1Val)
-		normDb2 := Normalize_value(db2Val)
+		normDb1 := NormalizeParamValue(param, db1Val)
+		normDb2 := NormalizeParamValue(param, db2Val)
 
 		if !equalValues(normDb1, normDb2) {
 			status := ""
@@ -250,99 +247,9 @@ func CompareConfigs(db1Config, db2Config map[string]map[string]string, db1Name,
 }
 
 func SaveDiffToFile(diff map[string]map[string]interface{}, outputFile, db1Name, db2Name string) error {
-	f, err := os.Create(outputFile)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
-	}
-	defer f.Close()
-
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
-	header := fmt.Sprintf("Comparison report: %s vs %s\n", db1Name, db2Name)
-	header += fmt.Sprintf("Generated at: %s\n\n", currentTime)
-
-	// Увеличиваем ширину колонок для длинных значений
-	header += fmt.Sprintf("%-50s | %-60s | %-60s | %-15s\n", "Parameter", db1Name, db2Name, "Status")
-	header += fmt.Sprintf("%s\n", strings.Repeat("-", 190))
-
-	if _, err := f.WriteString(header); err != nil {
-		return fmt.Errorf("failed to write header: %v", err)
-	}
-
-	type diffItem struct {
-		param string
-		data  map[string]interface{}
-	}
-	var items []diffItem
-
-	for param, data := range diff {
-		items = append(items, diffItem{param, data})
-	}
-
-	sort.Slice(items, func(i, j int) bool {
-		statusI := items[i].data["status"].(string)
-		statusJ := items[j].data["status"].(string)
-
-		if statusI == "Modified" && statusJ != "Modified" {
-			return true
-		}
-		if statusI != "Modified" && statusJ == "Modified" {
-			return false
-		}
-		if statusI == fmt.Sprintf("Only in %s", db1Name) && statusJ == fmt.Sprintf("Only in %s", db2Name) {
-			return true
-		}
-		return items[i].param < items[j].param
-	})
-
-	for _, item := range items {
-		param := item.param
-		data := item.data
-
-		// Правильно извлекаем значения для каждого файла
-		valDB1 := "N/A"
-		if db1Val, exists := data[db1Name]; exists {
-			if sectionMap, ok := db1Val.(map[string]string); ok {
-				// Если это секция, берем значение параметра
-				if paramVal, paramExists := sectionMap[param]; paramExists {
-					valDB1 = paramVal
-				}
-			} else if strVal, ok := db1Val.(string); ok {
-				valDB1 = strVal
-			}
-		}
-
-		valDB2 := "N/A"
-		if db2Val, exists := data[db2Name]; exists {
-			if sectionMap, ok := db2Val.(map[string]string); ok {
-				if paramVal, paramExists := sectionMap[param]; paramExists {
-					valDB2 = paramVal
-				}
-			} else if strVal, ok := db2Val.(string); ok {
-				valDB2 = strVal
-			}
-		}
-
-		status := data["status"].(string)
-
-		if len(valDB1) > 55 {
-			valDB1 = valDB1[:52] + "..."
-		}
-		if len(valDB2) > 55 {
-			valDB2 = valDB2[:52] + "..."
-		}
-		if len(param) > 48 {
-			param = param[:45] + "..."
-		}
-
-		line := fmt.Sprintf("%-50s | %-60s | %-60s | %-15s\n", param, valDB1, valDB2, status)
-
-		if _, err := f.WriteString(line); err != nil {
-			return fmt.Errorf("failed to write diff line: %v", err)
-		}
-	}
-
-	return nil
+	return SaveDiffReport(NewDiffReport(diff, db1Name, db2Name), outputFile, "text")
 }
+
 func GetNextReportNumber(reportDir string) (int, error) {
 	files, err := os.ReadDir(reportDir)
 	if err != nil {
@@ -351,7 +258,6 @@ func GetNextReportNumber(reportDir string) (int, error) {
 
 	var numbers []int
 	prefix := "diff_report_"
-	suffix := ".txt"
 
 	for _, file := range files {
 		if file.IsDir() {
@@ -359,7 +265,8 @@ func GetNextReportNumber(reportDir string) (int, error) {
 		}
 
 		name := file.Name()
-		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		suffix := filepath.Ext(name)
+		if !strings.HasPrefix(name, prefix) || suffix == "" {
 			continue
 		}
 
@@ -380,35 +287,6 @@ func GetNextReportNumber(reportDir string) (int, error) {
 	return numbers[len(numbers)-1] + 1, nil
 }
 
-func ParsePgHba(line string) map[string]string {
-
-	trimmed := strings.TrimSpace(line)
-	if trimmed == "" {
-		return nil
-	}
-
-	re := regexp.MustCompile(`\s+`)
-	parts := re.Split(trimmed, -1)
-
-	if len(parts) < 4 {
-		return nil
-	}
-
-	result := make(map[string]string)
-	result["type"] = parts[0]
-	result["database"] = parts[1]
-	result["user"] = parts[2]
-	result["address"] = parts[3]
-
-	if len(parts) > 4 {
-		result["method"] = parts[4]
-	} else {
-		result["method"] = ""
-	}
-
-	return result
-}
-
 func GetScriptDir() (string, error) {
 	exe, err := os.Executable()
 	if err != nil {
@@ -490,16 +368,32 @@ func ReadFile(filePath string) (string, error) {
 }
 
 func SaveConfig(config map[string]map[string]string, filePath string) error {
-	content := ""
-	for section, params := range config {
+	return os.WriteFile(filePath, []byte(RenderConfig(config)), 0644)
+}
+
+// RenderConfig выводит конфиг в формате key = value с отсортированными
+// секциями и ключами, чтобы одинаковое состояние давало одинаковый файл.
+func RenderConfig(config map[string]map[string]string) string {
+	sections := make([]string, 0, len(config))
+	for section := range config {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	var sb strings.Builder
+	for _, section := range sections {
 		if section != "" {
-			content += fmt.Sprintf("[%s]\n", section)
+			fmt.Fprintf(&sb, "[%s]\n", section)
+		}
+		keys := make([]string, 0, len(config[section]))
+		for key := range config[section] {
+			keys = append(keys, key)
 		}
-		for key, value := range params {
-			content += fmt.Sprintf("%s = %s\n", key, value)
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&sb, "%s = %s\n", key, config[section][key])
 		}
-		content += "\n"
+		sb.WriteString("\n")
 	}
-
-	return os.WriteFile(filePath, []byte(content), 0644)
+	return sb.String()
 }
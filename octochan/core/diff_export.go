@@ -0,0 +1,426 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DiffEntry struct {
+	Param       string `json:"param"`
+	Section     string `json:"section"`
+	Key         string `json:"key"`
+	Left        string `json:"left"`
+	Right       string `json:"right"`
+	LeftExists  bool   `json:"left_exists"`
+	RightExists bool   `json:"right_exists"`
+	Status      string `json:"status"`
+	LeftSource  string `json:"left_source,omitempty"`
+	RightSource string `json:"right_source,omitempty"`
+	// LeftChain/RightChain - все определения параметра, если он задан
+	// несколько раз; последнее действует, предыдущие переопределены.
+	LeftChain  []string `json:"left_chain,omitempty"`
+	RightChain []string `json:"right_chain,omitempty"`
+}
+
+// overridden возвращает переопределённые определения одной стороны отчёта.
+func overridden(chain []string) []string {
+	if len(chain) < 2 {
+		return nil
+	}
+	return chain[:len(chain)-1]
+}
+
+func (e DiffEntry) LeftOverridden() []string { return overridden(e.LeftChain) }
+
+func (e DiffEntry) RightOverridden() []string { return overridden(e.RightChain) }
+
+type DiffReport struct {
+	LeftName    string      `json:"left"`
+	RightName   string      `json:"right"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Entries     []DiffEntry `json:"entries"`
+}
+
+// DiffExporter сериализует отчёт о различиях в конкретный формат.
+type DiffExporter interface {
+	Name() string
+	Extension() string
+	Export(w io.Writer, report *DiffReport) error
+}
+
+var diffExporters = make(map[string]DiffExporter)
+
+func RegisterDiffExporter(exporter DiffExporter) {
+	diffExporters[exporter.Name()] = exporter
+}
+
+func init() {
+	RegisterDiffExporter(textDiffExporter{})
+	RegisterDiffExporter(jsonDiffExporter{})
+	RegisterDiffExporter(csvDiffExporter{})
+	RegisterDiffExporter(markdownDiffExporter{})
+	RegisterDiffExporter(htmlDiffExporter{})
+	RegisterDiffExporter(unifiedDiffExporter{})
+}
+
+func GetDiffExporter(format string) (DiffExporter, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "", "txt":
+		format = "text"
+	case "md":
+		format = "markdown"
+	case "diff", "patch":
+		format = "unified"
+	}
+
+	exporter, ok := diffExporters[format]
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый формат отчёта '%s'. Доступные форматы: %v", format, DiffFormats())
+	}
+	return exporter, nil
+}
+
+func DiffFormats() []string {
+	formats := make([]string, 0, len(diffExporters))
+	for name := range diffExporters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// NewDiffReport превращает результат CompareConfigs в упорядоченный отчёт:
+// сначала изменённые параметры, затем отсутствующие во втором и в первом файле.
+func NewDiffReport(diff map[string]map[string]interface{}, leftName, rightName string) *DiffReport {
+	report := &DiffReport{
+		LeftName:    leftName,
+		RightName:   rightName,
+		GeneratedAt: time.Now(),
+		Entries:     make([]DiffEntry, 0, len(diff)),
+	}
+
+	onlyLeft := fmt.Sprintf("Only in %s", leftName)
+	onlyRight := fmt.Sprintf("Only in %s", rightName)
+
+	for param, data := range diff {
+		status, _ := data["status"].(string)
+		section, key := splitParamPath(param)
+
+		report.Entries = append(report.Entries, DiffEntry{
+			Param:       param,
+			Section:     section,
+			Key:         key,
+			Left:        getValueOrNA(data[leftName]),
+			Right:       getValueOrNA(data[rightName]),
+			LeftExists:  status != onlyRight,
+			RightExists: status != onlyLeft,
+			Status:      status,
+		})
+	}
+
+	statusRank := func(status string) int {
+		switch status {
+		case "Modified":
+			return 0
+		case onlyLeft:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.Slice(report.Entries, func(i, j int) bool {
+		ri, rj := statusRank(report.Entries[i].Status), statusRank(report.Entries[j].Status)
+		if ri != rj {
+			return ri < rj
+		}
+		return report.Entries[i].Param < report.Entries[j].Param
+	})
+
+	return report
+}
+
+func ExportDiff(w io.Writer, report *DiffReport, format string) error {
+	exporter, err := GetDiffExporter(format)
+	if err != nil {
+		return err
+	}
+	return exporter.Export(w, report)
+}
+
+func SaveDiffReport(report *DiffReport, outputFile, format string) error {
+	exporter, err := GetDiffExporter(format)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+
+	if err := exporter.Export(f, report); err != nil {
+		return fmt.Errorf("failed to write %s report: %v", exporter.Name(), err)
+	}
+	return nil
+}
+
+func splitParamPath(param string) (string, string) {
+	parts := strings.SplitN(param, ".", 2)
+	if len(parts) < 2 {
+		return "", param
+	}
+	return parts[0], parts[1]
+}
+
+func displayValue(value string, exists bool) string {
+	if !exists {
+		return "N/A"
+	}
+	return value
+}
+
+type textDiffExporter struct{}
+
+func (textDiffExporter) Name() string { return "text" }
+
+func (textDiffExporter) Extension() string { return ".txt" }
+
+func (textDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	header := fmt.Sprintf("Comparison report: %s vs %s\n", report.LeftName, report.RightName)
+	header += fmt.Sprintf("Generated at: %s\n\n", report.GeneratedAt.Format("2006-01-02 15:04:05"))
+
+	// Увеличиваем ширину колонок для длинных значений
+	header += fmt.Sprintf("%-50s | %-60s | %-60s | %-15s\n", "Parameter", report.LeftName, report.RightName, "Status")
+	header += fmt.Sprintf("%s\n", strings.Repeat("-", 190))
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return fmt.Errorf("failed to write header: %v", err)
+	}
+
+	for _, entry := range report.Entries {
+		param := entry.Param
+		valDB1 := displayValue(entry.Left, entry.LeftExists)
+		valDB2 := displayValue(entry.Right, entry.RightExists)
+
+		if len(valDB1) > 55 {
+			valDB1 = valDB1[:52] + "..."
+		}
+		if len(valDB2) > 55 {
+			valDB2 = valDB2[:52] + "..."
+		}
+		if len(param) > 48 {
+			param = param[:45] + "..."
+		}
+
+		line := fmt.Sprintf("%-50s | %-60s | %-60s | %-15s\n", param, valDB1, valDB2, entry.Status)
+		for _, old := range entry.LeftOverridden() {
+			line += fmt.Sprintf("    %s overrides %s\n", report.LeftName, old)
+		}
+		for _, old := range entry.RightOverridden() {
+			line += fmt.Sprintf("    %s overrides %s\n", report.RightName, old)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return fmt.Errorf("failed to write diff line: %v", err)
+		}
+	}
+
+	return nil
+}
+
+type jsonDiffExporter struct{}
+
+func (jsonDiffExporter) Name() string { return "json" }
+
+func (jsonDiffExporter) Extension() string { return ".json" }
+
+func (jsonDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+type csvDiffExporter struct{}
+
+func (csvDiffExporter) Name() string { return "csv" }
+
+func (csvDiffExporter) Extension() string { return ".csv" }
+
+func (csvDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"section", "parameter", report.LeftName, report.RightName, "status"}); err != nil {
+		return err
+	}
+
+	for _, entry := range report.Entries {
+		record := []string{
+			entry.Section,
+			entry.Key,
+			displayValue(entry.Left, entry.LeftExists),
+			displayValue(entry.Right, entry.RightExists),
+			entry.Status,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type markdownDiffExporter struct{}
+
+func (markdownDiffExporter) Name() string { return "markdown" }
+
+func (markdownDiffExporter) Extension() string { return ".md" }
+
+func (markdownDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	escape := func(value string) string {
+		value = strings.ReplaceAll(value, "|", `\|`)
+		return strings.ReplaceAll(value, "\n", "<br>")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Comparison report: `%s` vs `%s`\n\n", report.LeftName, report.RightName)
+	fmt.Fprintf(&sb, "Generated at: %s\n\n", report.GeneratedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&sb, "| Section | Parameter | %s | %s | Status |\n", escape(report.LeftName), escape(report.RightName))
+	sb.WriteString("|---|---|---|---|---|\n")
+
+	withOverridden := func(value string, old []string) string {
+		value = escape(value)
+		for _, def := range old {
+			value += "<br>overrides `" + escape(def) + "`"
+		}
+		return value
+	}
+
+	for _, entry := range report.Entries {
+		fmt.Fprintf(&sb, "| %s | `%s` | %s | %s | %s |\n",
+			escape(entry.Section),
+			escape(entry.Key),
+			withOverridden(displayValue(entry.Left, entry.LeftExists), entry.LeftOverridden()),
+			withOverridden(displayValue(entry.Right, entry.RightExists), entry.RightOverridden()),
+			escape(entry.Status),
+		)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type htmlDiffExporter struct{}
+
+func (htmlDiffExporter) Name() string { return "html" }
+
+func (htmlDiffExporter) Extension() string { return ".html" }
+
+func (htmlDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	statusClass := func(entry DiffEntry) string {
+		switch {
+		case entry.LeftExists && entry.RightExists:
+			return "modified"
+		case entry.LeftExists:
+			return "removed"
+		default:
+			return "added"
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&sb, "<title>%s vs %s</title>\n", html.EscapeString(report.LeftName), html.EscapeString(report.RightName))
+	sb.WriteString("<style>\n")
+	sb.WriteString("table { border-collapse: collapse; font-family: monospace; }\n")
+	sb.WriteString("th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }\n")
+	sb.WriteString("tr.modified td { background: #fff8e1; }\n")
+	sb.WriteString("tr.removed td { background: #ffebee; }\n")
+	sb.WriteString("tr.added td { background: #e8f5e9; }\n")
+	sb.WriteString(".overridden { color: #888; font-size: smaller; }\n")
+	sb.WriteString("</style>\n</head>\n<body>\n")
+	fmt.Fprintf(&sb, "<h2>Comparison report: %s vs %s</h2>\n", html.EscapeString(report.LeftName), html.EscapeString(report.RightName))
+	fmt.Fprintf(&sb, "<p>Generated at: %s</p>\n", report.GeneratedAt.Format("2006-01-02 15:04:05"))
+	sb.WriteString("<table>\n")
+	fmt.Fprintf(&sb, "<tr><th>Section</th><th>Parameter</th><th>%s</th><th>%s</th><th>Status</th></tr>\n",
+		html.EscapeString(report.LeftName), html.EscapeString(report.RightName))
+
+	withOverridden := func(value string, old []string) string {
+		value = html.EscapeString(value)
+		for _, def := range old {
+			value += "<div class=\"overridden\">overrides " + html.EscapeString(def) + "</div>"
+		}
+		return value
+	}
+
+	for _, entry := range report.Entries {
+		fmt.Fprintf(&sb, "<tr class=\"%s\"><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			statusClass(entry),
+			html.EscapeString(entry.Section),
+			html.EscapeString(entry.Key),
+			withOverridden(displayValue(entry.Left, entry.LeftExists), entry.LeftOverridden()),
+			withOverridden(displayValue(entry.Right, entry.RightExists), entry.RightOverridden()),
+			html.EscapeString(entry.Status),
+		)
+	}
+
+	sb.WriteString("</table>\n</body>\n</html>\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type unifiedDiffExporter struct{}
+
+func (unifiedDiffExporter) Name() string { return "unified" }
+
+func (unifiedDiffExporter) Extension() string { return ".diff" }
+
+// Export выводит различия в стиле unified diff, сгруппированные по секциям,
+// чтобы отчёт можно было читать в ревью и подсвечивать как обычный патч.
+func (unifiedDiffExporter) Export(w io.Writer, report *DiffReport) error {
+	bySection := make(map[string][]DiffEntry)
+	var sections []string
+	for _, entry := range report.Entries {
+		if _, exists := bySection[entry.Section]; !exists {
+			sections = append(sections, entry.Section)
+		}
+		bySection[entry.Section] = append(bySection[entry.Section], entry)
+	}
+	sort.Strings(sections)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n", report.LeftName)
+	fmt.Fprintf(&sb, "+++ %s\n", report.RightName)
+
+	for _, section := range sections {
+		entries := bySection[section]
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+		if section == "" {
+			sb.WriteString("@@ @@\n")
+		} else {
+			fmt.Fprintf(&sb, "@@ [%s] @@\n", section)
+		}
+
+		for _, entry := range entries {
+			if entry.LeftExists {
+				fmt.Fprintf(&sb, "-%s = %s\n", entry.Key, entry.Left)
+			}
+			if entry.RightExists {
+				fmt.Fprintf(&sb, "+%s = %s\n", entry.Key, entry.Right)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
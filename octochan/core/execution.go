@@ -0,0 +1,346 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ExecOptions - параметры выполнения сценария. Нулевой Timeout или
+// TaskTimeout означает отсутствие ограничения.
+// Rollout заменяет стратегию раскатки из сценария; Confirm спрашивает
+// оператора, продолжать ли раскатку, и прекращает ожидание при отмене ctx.
+type ExecOptions struct {
+	Wait         bool
+	Timeout      time.Duration
+	TaskTimeout  time.Duration
+	PollInterval time.Duration
+	Rollout      *RolloutConfig
+	Confirm      func(ctx context.Context, prompt string) bool
+
+	taskCreated func(taskID string, req *APIRequest)
+}
+
+// DefaultExecOptions читает defaults.execution_timeout, defaults.task_timeout
+// и defaults.poll_interval из конфига.
+func DefaultExecOptions() ExecOptions {
+	opts := ExecOptions{
+		Timeout:      viper.GetDuration("defaults.execution_timeout"),
+		TaskTimeout:  30 * time.Minute,
+		PollInterval: 20 * time.Second,
+	}
+	if viper.IsSet("defaults.task_timeout") {
+		opts.TaskTimeout = viper.GetDuration("defaults.task_timeout")
+	}
+	if interval := viper.GetDuration("defaults.poll_interval"); interval > 0 {
+		opts.PollInterval = interval
+	}
+	return opts
+}
+
+// ContextRequestGenerator - необязательный интерфейс модуля, который долго
+// готовит запросы (например, ждёт разведку) и умеет прерваться по ctx.
+type ContextRequestGenerator interface {
+	GenerateRequestsContext(ctx context.Context) ([]*APIRequest, error)
+}
+
+// TaskObserver - необязательный интерфейс модуля, которому нужны ID
+// созданных задач (например, чтобы привязать их к снапшоту для отката).
+// TaskCreated может вызываться из нескольких горутин одновременно.
+type TaskObserver interface {
+	TaskCreated(taskID string, req *APIRequest)
+}
+
+// TaskOutcome - итог одной задачи сценария. Status пуст, если ожидание
+// не запрашивалось; Err - ошибка ожидания (таймаут, прерывание, API).
+// При раскатке запрос, который не удалось отправить, тоже даёт итог: без
+// ID, со статусом TaskSubmitFailed и ошибкой отправки.
+// Result - поля последнего статуса задачи, которые вернул сервис (см.
+// TaskResultFields).
+type TaskOutcome struct {
+	ID       string
+	Service  string
+	Targets  []string
+	Status   string
+	Result   map[string]interface{}
+	Err      error
+	Created  time.Time
+	Finished time.Time
+	// Wave - номер волны раскатки, 0 без раскатки.
+	Wave int
+
+	request *APIRequest
+}
+
+// TaskSubmitFailed - статус итога запроса, задача по которому не создана.
+const TaskSubmitFailed = "submit_failed"
+
+func (o *TaskOutcome) Succeeded() bool {
+	return o.Err == nil && IsSuccessfulTaskStatus(o.Status)
+}
+
+func (o *TaskOutcome) Duration() time.Duration {
+	if o.Finished.IsZero() {
+		return 0
+	}
+	return o.Finished.Sub(o.Created)
+}
+
+// ExecutionResult - итог выполнения сценария. Waves заполняется, если
+// сценарий раскатывался волнами (см. RolloutConfig).
+type ExecutionResult struct {
+	Outcomes []*TaskOutcome
+	Rollout  *RolloutConfig
+	Waves    []*RolloutWave
+}
+
+func (r *ExecutionResult) TaskIDs() []string {
+	ids := make([]string, 0, len(r.Outcomes))
+	for _, outcome := range r.Outcomes {
+		if outcome.ID != "" {
+			ids = append(ids, outcome.ID)
+		}
+	}
+	return ids
+}
+
+// Failed - число задач, которые не завершились успешно.
+func (r *ExecutionResult) Failed() int {
+	failed := 0
+	for _, outcome := range r.Outcomes {
+		if !outcome.Succeeded() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// IsSuccessfulTaskStatus сообщает, что задача завершилась успешно.
+func IsSuccessfulTaskStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "completed", "success", "finished":
+		return true
+	}
+	return false
+}
+
+// ExecuteModularScenarioContext создаёт задачи сценария и, если opts.Wait,
+// дожидается их завершения. Отмена ctx прекращает создание новых задач и
+// ожидание; уже созданные задачи продолжают выполняться в RLM. Если у
+// сценария (или в opts) задана стратегия rollout, задачи создаются волнами.
+func ExecuteModularScenarioContext(ctx context.Context, client *RLMClient, scenarioData []byte, customParams map[string]string, opts ExecOptions) (*ExecutionResult, error) {
+	data, module, err := prepareScenarioModule(client, scenarioData, customParams)
+	if err != nil {
+		return nil, err
+	}
+	rollout := data.Rollout
+	if opts.Rollout != nil {
+		if errs := opts.Rollout.check(); len(errs) > 0 {
+			return nil, fmt.Errorf("некорректная стратегия раскатки: %s", strings.Join(errs, "; "))
+		}
+		rollout = opts.Rollout
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.Timeout,
+			fmt.Errorf("превышено общее время выполнения сценария (%s)", opts.Timeout))
+		defer cancel()
+	}
+
+	var requests []*APIRequest
+	if generator, ok := module.(ContextRequestGenerator); ok {
+		requests, err = generator.GenerateRequestsContext(ctx)
+	} else {
+		requests, err = module.GenerateRequests()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подготовки запросов: %w", err)
+	}
+	scenarioHash := ScenarioHash(scenarioData)
+	if observer, ok := module.(TaskObserver); ok {
+		opts.taskCreated = observer.TaskCreated
+	}
+
+	result := &ExecutionResult{}
+	if rollout != nil {
+		return result, runRollout(ctx, client, rollout, requests, scenarioHash, opts, result)
+	}
+	return result, submitRequests(ctx, client, requests, scenarioHash, opts, result, 0)
+}
+
+// submitRequests создаёт задачи не более чем по defaults.max_parallel_tasks
+// одновременно и, если opts.Wait, дожидается их. Итоги добавляются в result.
+// Ошибка отправки прерывает обычное выполнение, а в волне раскатки (wave > 0)
+// становится неуспешным итогом, к которому применяется порог раскатки.
+func submitRequests(ctx context.Context, client *RLMClient, requests []*APIRequest, scenarioHash string, opts ExecOptions, result *ExecutionResult, wave int) error {
+	maxParallel := viper.GetInt("defaults.max_parallel_tasks")
+	if maxParallel <= 0 {
+		maxParallel = 5
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		created  int
+	)
+	semaphore := make(chan struct{}, maxParallel)
+
+submit:
+	for _, req := range requests {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			break submit
+		}
+		wg.Add(1)
+
+		go func(r *APIRequest) {
+			defer wg.Done()
+
+			taskID, err := client.SubmitWithRetry(ctx, r)
+			<-semaphore
+			service, _ := r.Body["service"].(string)
+			if err != nil && wave > 0 && ctx.Err() == nil {
+				fmt.Printf("❌ Задача для %s не создана: %v\n", strings.Join(RequestTargets(r.Body), ","), err)
+				now := time.Now()
+				mu.Lock()
+				result.Outcomes = append(result.Outcomes, &TaskOutcome{Service: service, Targets: RequestTargets(r.Body),
+					Status: TaskSubmitFailed, Err: err, Created: now, Finished: now, Wave: wave, request: r})
+				mu.Unlock()
+				return
+			}
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("ошибка выполнения запроса: %w", err)
+				}
+				mu.Unlock()
+				return
+			}
+
+			recordCreatedTask(client, taskID, scenarioHash, r)
+			if opts.taskCreated != nil {
+				opts.taskCreated(taskID, r)
+			}
+			fmt.Printf("✅ Задача создана: %s\n", taskID)
+
+			outcome := &TaskOutcome{ID: taskID, Service: service, Targets: RequestTargets(r.Body),
+				Created: time.Now(), Wave: wave, request: r}
+			mu.Lock()
+			result.Outcomes = append(result.Outcomes, outcome)
+			created++
+			mu.Unlock()
+
+			if opts.Wait {
+				var status map[string]interface{}
+				status, outcome.Err = WaitForTaskStatus(ctx, client, taskID, opts)
+				outcome.Status, _ = status["status"].(string)
+				outcome.Result = TaskResultFields(status)
+				outcome.Finished = time.Now()
+			}
+		}(req)
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil && created < len(requests) {
+		firstErr = fmt.Errorf("создано %d из %d задач: %w", created, len(requests), context.Cause(ctx))
+	}
+	return firstErr
+}
+
+// WaitForTask опрашивает статус задачи до терминального, отмены ctx или
+// истечения opts.TaskTimeout. Возвращает последний известный статус.
+func WaitForTask(ctx context.Context, client *RLMClient, taskID string, opts ExecOptions) (string, error) {
+	status, err := WaitForTaskStatus(ctx, client, taskID, opts)
+	taskStatus, _ := status["status"].(string)
+	return taskStatus, err
+}
+
+// WaitForTaskStatus - как WaitForTask, но возвращает весь последний ответ
+// статуса (nil, если статус так и не был получен), из которого результат
+// сервиса выделяет TaskResultFields.
+func WaitForTaskStatus(ctx context.Context, client *RLMClient, taskID string, opts ExecOptions) (map[string]interface{}, error) {
+	if opts.TaskTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.TaskTimeout,
+			fmt.Errorf("превышено время ожидания задачи (%s)", opts.TaskTimeout))
+		defer cancel()
+	}
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 20 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		last       map[string]interface{}
+		lastStatus string
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return last, context.Cause(ctx)
+		case <-ticker.C:
+		}
+
+		status, err := client.TaskStatusWithEvents(ctx, taskID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return last, context.Cause(ctx)
+			}
+			if IsRetryableError(err) {
+				fmt.Printf("⚠️ Задача %s: временная ошибка получения статуса: %v\n", taskID, err)
+				continue
+			}
+			return last, fmt.Errorf("ошибка получения статуса: %w", err)
+		}
+
+		taskStatus, ok := status["status"].(string)
+		if !ok {
+			continue
+		}
+		last = status
+		if taskStatus != lastStatus {
+			fmt.Printf("🔄 Задача %s: %s\n", taskID, taskStatus)
+			lastStatus = taskStatus
+			recordTaskStatus(client, taskID, status)
+		}
+		if IsTerminalTaskStatus(taskStatus) {
+			return status, nil
+		}
+	}
+}
+
+// Служебные поля ответа о статусе задачи, не относящиеся к результату.
+var taskStatusFields = map[string]bool{
+	"id": true, "service": true, "status": true, "progress": true, "events": true,
+	"created_at": true, "updated_at": true, "finished_at": true,
+}
+
+// TaskResultFields выделяет из ответа о статусе задачи результат сервиса:
+// содержимое поля result и все нестандартные поля верхнего уровня.
+func TaskResultFields(status map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for key, value := range status {
+		if taskStatusFields[key] || key == "result" {
+			continue
+		}
+		result[key] = value
+	}
+	if nested, ok := status["result"].(map[string]interface{}); ok {
+		for key, value := range nested {
+			result[key] = value
+		}
+	} else if value, ok := status["result"]; ok && value != nil {
+		result["result"] = value
+	}
+	return result
+}
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	MergePreferNone   = ""
+	MergePreferOurs   = "ours"
+	MergePreferTheirs = "theirs"
+)
+
+type MergeValue struct {
+	Value  string `json:"value"`
+	Exists bool   `json:"exists"`
+}
+
+type MergeChange struct {
+	Param  string     `json:"param"`
+	Source string     `json:"source"`
+	Base   MergeValue `json:"base"`
+	Result MergeValue `json:"result"`
+}
+
+type MergeConflict struct {
+	Param      string     `json:"param"`
+	Base       MergeValue `json:"base"`
+	Ours       MergeValue `json:"ours"`
+	Theirs     MergeValue `json:"theirs"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+}
+
+type MergeResult struct {
+	Merged    map[string]map[string]string `json:"-"`
+	Applied   []MergeChange                `json:"applied"`
+	Conflicts []MergeConflict              `json:"conflicts"`
+}
+
+// UnresolvedConflicts возвращает конфликты, которые не были разрешены через --prefer.
+func (r *MergeResult) UnresolvedConflicts() []MergeConflict {
+	var unresolved []MergeConflict
+	for _, c := range r.Conflicts {
+		if c.ResolvedBy == "" {
+			unresolved = append(unresolved, c)
+		}
+	}
+	return unresolved
+}
+
+// MergeConfigs выполняет трёхстороннее слияние: изменения ours и theirs
+// относительно base вычисляются через CompareConfigs, непересекающиеся
+// применяются автоматически, а разные изменения одного параметра считаются
+// конфликтом (или разрешаются в пользу prefer).
+func MergeConfigs(base, ours, theirs map[string]map[string]string, prefer string) (*MergeResult, error) {
+	if prefer != MergePreferNone && prefer != MergePreferOurs && prefer != MergePreferTheirs {
+		return nil, fmt.Errorf("неверное значение prefer '%s': допустимо ours или theirs", prefer)
+	}
+
+	oursDiff := CompareConfigs(base, ours, "base", "ours")
+	theirsDiff := CompareConfigs(base, theirs, "base", "theirs")
+
+	result := &MergeResult{Merged: copyConfig(base)}
+
+	params := make(map[string]bool)
+	for param := range oursDiff {
+		params[param] = true
+	}
+	for param := range theirsDiff {
+		params[param] = true
+	}
+
+	sortedParams := make([]string, 0, len(params))
+	for param := range params {
+		sortedParams = append(sortedParams, param)
+	}
+	sort.Strings(sortedParams)
+
+	for _, param := range sortedParams {
+		section, key := splitParamPath(param)
+		baseVal := lookupMergeValue(base, section, key)
+		oursVal := lookupMergeValue(ours, section, key)
+		theirsVal := lookupMergeValue(theirs, section, key)
+
+		_, oursChanged := oursDiff[param]
+		_, theirsChanged := theirsDiff[param]
+
+		switch {
+		case oursChanged && !theirsChanged:
+			setMergeValue(result.Merged, section, key, oursVal)
+			result.Applied = append(result.Applied, MergeChange{Param: param, Source: "ours", Base: baseVal, Result: oursVal})
+		case theirsChanged && !oursChanged:
+			setMergeValue(result.Merged, section, key, theirsVal)
+			result.Applied = append(result.Applied, MergeChange{Param: param, Source: "theirs", Base: baseVal, Result: theirsVal})
+		case sameMergeValue(key, oursVal, theirsVal):
+			setMergeValue(result.Merged, section, key, oursVal)
+			result.Applied = append(result.Applied, MergeChange{Param: param, Source: "both", Base: baseVal, Result: oursVal})
+		default:
+			conflict := MergeConflict{Param: param, Base: baseVal, Ours: oursVal, Theirs: theirsVal, ResolvedBy: prefer}
+			switch prefer {
+			case MergePreferOurs:
+				setMergeValue(result.Merged, section, key, oursVal)
+			case MergePreferTheirs:
+				setMergeValue(result.Merged, section, key, theirsVal)
+			}
+			result.Conflicts = append(result.Conflicts, conflict)
+		}
+	}
+
+	return result, nil
+}
+
+// RenderMergedConfig выводит результат слияния в формате key = value.
+// Неразрешённые конфликты оформляются маркерами в стиле git.
+func RenderMergedConfig(result *MergeResult) string {
+	conflicts := make(map[string]map[string]MergeConflict)
+	for _, c := range result.UnresolvedConflicts() {
+		section, key := splitParamPath(c.Param)
+		if _, exists := conflicts[section]; !exists {
+			conflicts[section] = make(map[string]MergeConflict)
+		}
+		conflicts[section][key] = c
+	}
+
+	sectionSet := make(map[string]bool)
+	for section := range result.Merged {
+		sectionSet[section] = true
+	}
+	for section := range conflicts {
+		sectionSet[section] = true
+	}
+	sections := make([]string, 0, len(sectionSet))
+	for section := range sectionSet {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	var sb strings.Builder
+	for _, section := range sections {
+		if section != "" {
+			fmt.Fprintf(&sb, "[%s]\n", section)
+		}
+
+		keySet := make(map[string]bool)
+		for key := range result.Merged[section] {
+			keySet[key] = true
+		}
+		for key := range conflicts[section] {
+			keySet[key] = true
+		}
+		keys := make([]string, 0, len(keySet))
+		for key := range keySet {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if c, isConflict := conflicts[section][key]; isConflict {
+				sb.WriteString("<<<<<<< ours\n")
+				writeMergeLine(&sb, key, c.Ours)
+				sb.WriteString("||||||| base\n")
+				writeMergeLine(&sb, key, c.Base)
+				sb.WriteString("=======\n")
+				writeMergeLine(&sb, key, c.Theirs)
+				sb.WriteString(">>>>>>> theirs\n")
+				continue
+			}
+			fmt.Fprintf(&sb, "%s = %s\n", key, result.Merged[section][key])
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func SaveMergeReport(result *MergeResult, path string) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal merge report: %v", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func writeMergeLine(sb *strings.Builder, key string, value MergeValue) {
+	if value.Exists {
+		fmt.Fprintf(sb, "%s = %s\n", key, value.Value)
+	}
+}
+
+func lookupMergeValue(config map[string]map[string]string, section, key string) MergeValue {
+	if params, ok := config[section]; ok {
+		if val, ok := params[key]; ok {
+			return MergeValue{Value: val, Exists: true}
+		}
+	}
+	return MergeValue{}
+}
+
+func setMergeValue(config map[string]map[string]string, section, key string, value MergeValue) {
+	if !value.Exists {
+		if params, ok := config[section]; ok {
+			delete(params, key)
+			if len(params) == 0 {
+				delete(config, section)
+			}
+		}
+		return
+	}
+	if _, ok := config[section]; !ok {
+		config[section] = make(map[string]string)
+	}
+	config[section][key] = value.Value
+}
+
+func sameMergeValue(key string, a, b MergeValue) bool {
+	if a.Exists != b.Exists {
+		return false
+	}
+	return equalValues(NormalizeParamValue(key, a.Value), NormalizeParamValue(key, b.Value))
+}
+
+func copyConfig(config map[string]map[string]string) map[string]map[string]string {
+	result := make(map[string]map[string]string, len(config))
+	for section, params := range config {
+		result[section] = make(map[string]string, len(params))
+		for key, value := range params {
+			result[section][key] = value
+		}
+	}
+	return result
+}
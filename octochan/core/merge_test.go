@@ -0,0 +1,108 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeConfigs(t *testing.T) {
+	base := map[string]map[string]string{"": {"work_mem": "4MB", "max_connections": "100", "fsync": "on"}}
+	tests := []struct {
+		name         string
+		ours, theirs map[string]string
+		prefer       string
+		merged       map[string]string
+		conflicts    []string
+		unresolved   int
+	}{
+		{
+			name:   "independent changes",
+			ours:   map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			theirs: map[string]string{"work_mem": "4MB", "max_connections": "200", "fsync": "on"},
+			merged: map[string]string{"work_mem": "8MB", "max_connections": "200", "fsync": "on"},
+		},
+		{
+			name:   "same change in other units",
+			ours:   map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			theirs: map[string]string{"work_mem": "8192kB", "max_connections": "100", "fsync": "on"},
+			merged: map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+		},
+		{
+			name:   "removal and addition",
+			ours:   map[string]string{"work_mem": "4MB", "max_connections": "100"},
+			theirs: map[string]string{"work_mem": "4MB", "max_connections": "100", "fsync": "on", "jit": "off"},
+			merged: map[string]string{"work_mem": "4MB", "max_connections": "100", "jit": "off"},
+		},
+		{
+			name:       "conflict",
+			ours:       map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			theirs:     map[string]string{"work_mem": "16MB", "max_connections": "100", "fsync": "on"},
+			merged:     map[string]string{"work_mem": "4MB", "max_connections": "100", "fsync": "on"},
+			conflicts:  []string{".work_mem"},
+			unresolved: 1,
+		},
+		{
+			name:      "conflict resolved by ours",
+			ours:      map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			theirs:    map[string]string{"work_mem": "16MB", "max_connections": "100", "fsync": "on"},
+			prefer:    MergePreferOurs,
+			merged:    map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			conflicts: []string{".work_mem"},
+		},
+		{
+			name:      "change against removal resolved by theirs",
+			ours:      map[string]string{"work_mem": "8MB", "max_connections": "100", "fsync": "on"},
+			theirs:    map[string]string{"max_connections": "100", "fsync": "on"},
+			prefer:    MergePreferTheirs,
+			merged:    map[string]string{"max_connections": "100", "fsync": "on"},
+			conflicts: []string{".work_mem"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ours := map[string]map[string]string{"": tt.ours}
+			theirs := map[string]map[string]string{"": tt.theirs}
+			result, err := MergeConfigs(base, ours, theirs, tt.prefer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Merged[""], tt.merged) {
+				t.Errorf("Merged = %v, want %v", result.Merged[""], tt.merged)
+			}
+			var conflicts []string
+			for _, c := range result.Conflicts {
+				conflicts = append(conflicts, c.Param)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("Conflicts = %v, want %v", conflicts, tt.conflicts)
+			}
+			if got := len(result.UnresolvedConflicts()); got != tt.unresolved {
+				t.Errorf("UnresolvedConflicts = %d, want %d", got, tt.unresolved)
+			}
+		})
+	}
+	if base[""]["work_mem"] != "4MB" || len(base[""]) != 3 {
+		t.Errorf("MergeConfigs modified base: %v", base)
+	}
+}
+
+func TestMergeConfigsInvalidPrefer(t *testing.T) {
+	if _, err := MergeConfigs(nil, nil, nil, "mine"); err == nil {
+		t.Error("MergeConfigs(prefer=mine): ожидалась ошибка")
+	}
+}
+
+func TestRenderMergedConfigConflictMarkers(t *testing.T) {
+	base := map[string]map[string]string{"": {"work_mem": "4MB"}}
+	ours := map[string]map[string]string{"": {"work_mem": "8MB"}}
+	theirs := map[string]map[string]string{"": {"work_mem": "16MB"}}
+	result, err := MergeConfigs(base, ours, theirs, MergePreferNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<<<<<<< ours\nwork_mem = 8MB\n||||||| base\nwork_mem = 4MB\n=======\nwork_mem = 16MB\n>>>>>>> theirs\n"
+	if got := RenderMergedConfig(result); !strings.Contains(got, want) {
+		t.Errorf("RenderMergedConfig =\n%s\nwant markers:\n%s", got, want)
+	}
+}
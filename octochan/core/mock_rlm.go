@@ -0,0 +1,509 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MockRLMConfig описывает поведение фейкового RLM (ochan mock-rlm).
+//
+//	default:
+//	  lifecycle: [enqueued:1s, in_progress:3s, success]
+//	services:
+//	  psql_tuning_params_se_sys:
+//	    lifecycle: [in_progress:2s, completed]
+//	    result:
+//	      table_id: psqlseclusterstandalone
+//	  pangolin_restart:
+//	    fail_rate: 0.3
+//	    fail_status: failed
+//	    reject_table_ids: [pangolinunique]
+//	latency: 100ms
+//	token: secret
+//	retry_after: 2
+type MockRLMConfig struct {
+	Default  MockServiceConfig            `yaml:"default"`
+	Services map[string]MockServiceConfig `yaml:"services"`
+	Latency  string                       `yaml:"latency"`
+	Token    string                       `yaml:"token"`
+	Seed     int64                        `yaml:"seed"`
+	// RetryAfter - значение заголовка Retry-After (секунды) в ответах 429 и 503.
+	RetryAfter int `yaml:"retry_after"`
+
+	latency time.Duration
+}
+
+// MockServiceConfig - жизненный цикл и сбои задач одного сервиса. Пустые
+// поля берутся из default; доли сбоев - указатели, чтобы явный 0 отключал
+// сбои сервиса, а не наследовал их.
+type MockServiceConfig struct {
+	// Lifecycle - статусы в порядке смены, "статус:длительность".
+	// Последний статус - конечный.
+	Lifecycle []string `yaml:"lifecycle"`
+	// FailRate - доля задач, которые завершаются FailStatus.
+	FailRate   *float64 `yaml:"fail_rate"`
+	FailStatus string   `yaml:"fail_status"`
+	// HTTPErrorRate - доля POST, на которые отвечаем HTTPErrorCode.
+	HTTPErrorRate *float64 `yaml:"http_error_rate"`
+	HTTPErrorCode int      `yaml:"http_error_code"`
+	// LostResponseRate - доля POST, после которых задача создаётся, но
+	// клиент получает 502, как при потерянном ответе.
+	LostResponseRate *float64 `yaml:"lost_response_rate"`
+	// RejectTableIDs - table_id, на которые RLM отвечает 400 (как на
+	// неизвестную таблицу).
+	RejectTableIDs []string `yaml:"reject_table_ids"`
+	// Result - дополнительные поля ответа статуса (например, table_id).
+	Result map[string]interface{} `yaml:"result"`
+}
+
+type mockStage struct {
+	Status   string
+	Duration time.Duration
+}
+
+// MockRecordedRequest - запрос, полученный фейковым RLM.
+type MockRecordedRequest struct {
+	Time     string      `json:"time"`
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Body     interface{} `json:"body,omitempty"`
+	Response int         `json:"response"`
+	TaskID   int         `json:"task_id,omitempty"`
+}
+
+type mockTask struct {
+	ID             int
+	IdempotencyKey string
+	Service        string
+	Body           map[string]interface{}
+	CreatedAt      time.Time
+	Stages         []mockStage
+	Result         map[string]interface{}
+}
+
+// MockRLM - http.Handler, имитирующий API задач RLM:
+//
+//	POST .../tasks.json            создать задачу, ответ {"id": N}; повтор с тем
+//	                               же Idempotency-Key возвращает ту же задачу
+//	GET  .../tasks.json?idempotency_key=K  поиск задачи по ключу
+//	GET  .../tasks[.json]/{id}/    статус задачи
+//	GET  .../tasks[.json]/{id}/events/
+//	POST .../tasks[.json]/{id}/cancel/
+//	GET  /_mock/requests           записанные запросы
+type MockRLM struct {
+	config MockRLMConfig
+
+	mu       sync.Mutex
+	nextID   int
+	tasks    map[int]*mockTask
+	keys     map[string]int
+	requests []MockRecordedRequest
+	record   io.Writer
+	rand     *rand.Rand
+	now      func() time.Time
+}
+
+var (
+	mockTaskPathRe = regexp.MustCompile(`/(\d+)/?(events/?|cancel/?)?$`)
+
+	defaultMockLifecycle = []string{"enqueued:1s", "validating:1s", "in_progress:3s", "success"}
+)
+
+func LoadMockRLMConfig(path string) (*MockRLMConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать конфиг mock-rlm: %w", err)
+	}
+	var config MockRLMConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("ошибка разбора конфига mock-rlm: %w", err)
+	}
+	return &config, nil
+}
+
+// NewMockRLM проверяет конфиг и создаёт сервер. record (может быть nil)
+// получает записанные запросы в формате JSON Lines.
+func NewMockRLM(config MockRLMConfig, record io.Writer) (*MockRLM, error) {
+	if len(config.Default.Lifecycle) == 0 {
+		config.Default.Lifecycle = defaultMockLifecycle
+	}
+	if config.Default.FailStatus == "" {
+		config.Default.FailStatus = "failed"
+	}
+	if config.Default.HTTPErrorCode == 0 {
+		config.Default.HTTPErrorCode = http.StatusInternalServerError
+	}
+
+	var errs []string
+	if config.Latency != "" {
+		latency, err := time.ParseDuration(config.Latency)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("latency: %v", err))
+		}
+		config.latency = latency
+	}
+	services := map[string]MockServiceConfig{"default": config.Default}
+	for name, svc := range config.Services {
+		services[name] = svc
+	}
+	for name, svc := range services {
+		if _, err := parseMockLifecycle(svc.Lifecycle); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+		for _, rate := range []*float64{svc.FailRate, svc.HTTPErrorRate, svc.LostResponseRate} {
+			if rate != nil && (*rate < 0 || *rate > 1) {
+				errs = append(errs, fmt.Sprintf("%s: доля сбоев должна быть от 0 до 1, получено %g", name, *rate))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("ошибки в конфиге mock-rlm:\n  %s", strings.Join(errs, "\n  "))
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &MockRLM{
+		config: config,
+		nextID: 1000,
+		tasks:  make(map[int]*mockTask),
+		keys:   make(map[string]int),
+		record: record,
+		rand:   rand.New(rand.NewSource(seed)),
+		now:    time.Now,
+	}, nil
+}
+
+func parseMockLifecycle(lifecycle []string) ([]mockStage, error) {
+	var stages []mockStage
+	for i, raw := range lifecycle {
+		status, duration, hasDuration := strings.Cut(raw, ":")
+		stage := mockStage{Status: strings.TrimSpace(status)}
+		if stage.Status == "" {
+			return nil, fmt.Errorf("пустой статус в lifecycle #%d", i+1)
+		}
+		if hasDuration {
+			d, err := time.ParseDuration(strings.TrimSpace(duration))
+			if err != nil {
+				return nil, fmt.Errorf("lifecycle '%s': %v", raw, err)
+			}
+			stage.Duration = d
+		}
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// service возвращает настройки сервиса с подставленными значениями default.
+func (m *MockRLM) service(name string) MockServiceConfig {
+	svc, ok := m.config.Services[name]
+	if !ok {
+		return m.config.Default
+	}
+	def := m.config.Default
+	if len(svc.Lifecycle) == 0 {
+		svc.Lifecycle = def.Lifecycle
+	}
+	if svc.FailRate == nil {
+		svc.FailRate = def.FailRate
+	}
+	if svc.HTTPErrorRate == nil {
+		svc.HTTPErrorRate = def.HTTPErrorRate
+	}
+	if svc.LostResponseRate == nil {
+		svc.LostResponseRate = def.LostResponseRate
+	}
+	if svc.FailStatus == "" {
+		svc.FailStatus = def.FailStatus
+	}
+	if svc.HTTPErrorCode == 0 {
+		svc.HTTPErrorCode = def.HTTPErrorCode
+	}
+	if svc.RejectTableIDs == nil {
+		svc.RejectTableIDs = def.RejectTableIDs
+	}
+	if svc.Result == nil {
+		svc.Result = def.Result
+	}
+	return svc
+}
+
+// chance выпадает с вероятностью rate; nil - никогда. Вызывается под m.mu.
+func (m *MockRLM) chance(rate *float64) bool {
+	return rate != nil && *rate > 0 && m.rand.Float64() < *rate
+}
+
+func (m *MockRLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.config.latency > 0 {
+		time.Sleep(m.config.latency)
+	}
+
+	var body interface{}
+	if r.Body != nil {
+		data, _ := io.ReadAll(r.Body)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				body = string(data)
+			}
+		}
+	}
+
+	code, response, taskID := m.handle(r, body)
+
+	m.mu.Lock()
+	rec := MockRecordedRequest{
+		Time:     m.now().Format(time.RFC3339),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Body:     body,
+		Response: code,
+		TaskID:   taskID,
+	}
+	if r.URL.Path != "/_mock/requests" {
+		m.requests = append(m.requests, rec)
+		if m.record != nil {
+			line, _ := json.Marshal(rec)
+			m.record.Write(append(line, '\n'))
+		}
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if m.config.RetryAfter > 0 && (code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(m.config.RetryAfter))
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (m *MockRLM) handle(r *http.Request, body interface{}) (int, interface{}, int) {
+	if r.URL.Path == "/_mock/requests" {
+		return http.StatusOK, m.Requests(), 0
+	}
+
+	if m.config.Token != "" && r.Header.Get("Authorization") != "Token "+m.config.Token {
+		return http.StatusUnauthorized, map[string]string{"detail": "Недопустимый токен."}, 0
+	}
+
+	if matches := mockTaskPathRe.FindStringSubmatch(r.URL.Path); matches != nil {
+		id, _ := strconv.Atoi(matches[1])
+		if strings.HasPrefix(matches[2], "cancel") {
+			if r.Method != http.MethodPost {
+				return http.StatusMethodNotAllowed, map[string]string{"detail": "Метод не разрешён."}, id
+			}
+			return m.cancelTask(id)
+		}
+		if r.Method != http.MethodGet {
+			return http.StatusMethodNotAllowed, map[string]string{"detail": "Метод не разрешён."}, id
+		}
+		if matches[2] != "" {
+			events, ok := m.TaskEvents(id)
+			if !ok {
+				return http.StatusNotFound, map[string]string{"detail": "Не найдено."}, id
+			}
+			return http.StatusOK, events, id
+		}
+		status, ok := m.TaskStatus(id)
+		if !ok {
+			return http.StatusNotFound, map[string]string{"detail": "Не найдено."}, id
+		}
+		return http.StatusOK, status, id
+	}
+
+	if strings.HasSuffix(r.URL.Path, "tasks.json") || strings.HasSuffix(r.URL.Path, "tasks/") {
+		switch r.Method {
+		case http.MethodPost:
+			payload, _ := body.(map[string]interface{})
+			return m.createTask(payload, r.Header.Get(IdempotencyKeyHeader))
+		case http.MethodGet:
+			return http.StatusOK, m.findTasksByKey(r.URL.Query().Get("idempotency_key")), 0
+		}
+	}
+
+	return http.StatusNotFound, map[string]string{"detail": "Не найдено."}, 0
+}
+
+func (m *MockRLM) createTask(payload map[string]interface{}, key string) (int, interface{}, int) {
+	service, _ := payload["service"].(string)
+	if service == "" {
+		return http.StatusBadRequest, map[string]interface{}{"service": []string{"Обязательное поле."}}, 0
+	}
+	svc := m.service(service)
+
+	if items, ok := payload["items"].([]interface{}); ok {
+		for _, item := range items {
+			fields, _ := item.(map[string]interface{})
+			tableID, _ := fields["table_id"].(string)
+			for _, rejected := range svc.RejectTableIDs {
+				if tableID == rejected {
+					return http.StatusBadRequest, map[string]interface{}{
+						"items": []string{fmt.Sprintf("Указан неверный идентификатор таблицы (table_id): %s", tableID)},
+					}, 0
+				}
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if id, ok := m.keys[key]; ok && key != "" {
+		task := m.tasks[id]
+		stage, _ := m.progress(task)
+		return http.StatusOK, map[string]interface{}{"id": id, "status": task.Stages[stage].Status}, id
+	}
+	if m.chance(svc.HTTPErrorRate) {
+		return svc.HTTPErrorCode, map[string]string{"detail": "Внутренняя ошибка сервера (mock-rlm)"}, 0
+	}
+
+	stages, _ := parseMockLifecycle(svc.Lifecycle)
+	if m.chance(svc.FailRate) {
+		stages[len(stages)-1].Status = svc.FailStatus
+	}
+
+	m.nextID++
+	task := &mockTask{
+		ID:             m.nextID,
+		IdempotencyKey: key,
+		Service:        service,
+		Body:           payload,
+		CreatedAt:      m.now(),
+		Stages:         stages,
+		Result:         svc.Result,
+	}
+	m.tasks[task.ID] = task
+	if key != "" {
+		m.keys[key] = task.ID
+	}
+	if m.chance(svc.LostResponseRate) {
+		return http.StatusBadGateway, map[string]string{"detail": "Bad Gateway (mock-rlm: ответ потерян)"}, task.ID
+	}
+	return http.StatusOK, map[string]interface{}{"id": task.ID, "status": stages[0].Status}, task.ID
+}
+
+// findTasksByKey - список задач с данным Idempotency-Key (пустой или из одной).
+func (m *MockRLM) findTasksByKey(key string) []map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := []map[string]interface{}{}
+	if id, ok := m.keys[key]; ok && key != "" {
+		task := m.tasks[id]
+		stage, _ := m.progress(task)
+		found = append(found, map[string]interface{}{
+			"id":              id,
+			"service":         task.Service,
+			"status":          task.Stages[stage].Status,
+			"idempotency_key": key,
+		})
+	}
+	return found
+}
+
+// progress возвращает индекс текущей стадии и время перехода в неё.
+func (m *MockRLM) progress(task *mockTask) (int, time.Time) {
+	elapsed := m.now().Sub(task.CreatedAt)
+	started := task.CreatedAt
+	for i, stage := range task.Stages {
+		if i == len(task.Stages)-1 || elapsed < stage.Duration {
+			return i, started
+		}
+		elapsed -= stage.Duration
+		started = started.Add(stage.Duration)
+	}
+	return len(task.Stages) - 1, started
+}
+
+// cancelTask обрывает жизненный цикл на текущей стадии и переводит задачу
+// в статус canceled.
+func (m *MockRLM) cancelTask(id int) (int, interface{}, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok {
+		return http.StatusNotFound, map[string]string{"detail": "Не найдено."}, id
+	}
+	current, started := m.progress(task)
+	if current == len(task.Stages)-1 {
+		return http.StatusConflict, map[string]string{"detail": "Задача уже завершена."}, id
+	}
+
+	stages := append([]mockStage(nil), task.Stages[:current+1]...)
+	stages[current].Duration = m.now().Sub(started)
+	task.Stages = append(stages, mockStage{Status: "canceled"})
+	return http.StatusOK, map[string]interface{}{"id": id, "status": "canceled"}, id
+}
+
+func (m *MockRLM) TaskStatus(id int) (map[string]interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok {
+		return nil, false
+	}
+	stage, updated := m.progress(task)
+	status := map[string]interface{}{
+		"id":         task.ID,
+		"service":    task.Service,
+		"status":     task.Stages[stage].Status,
+		"created_at": task.CreatedAt.Format(time.RFC3339),
+		"updated_at": updated.Format(time.RFC3339),
+		"progress":   100 * stage / max(len(task.Stages)-1, 1),
+	}
+	for k, v := range task.Result {
+		status[k] = v
+	}
+	return status, true
+}
+
+func (m *MockRLM) TaskEvents(id int) ([]map[string]interface{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok {
+		return nil, false
+	}
+	current, _ := m.progress(task)
+	failStatus := m.service(task.Service).FailStatus
+
+	events := []map[string]interface{}{}
+	at := task.CreatedAt
+	for i := 0; i <= current; i++ {
+		stage := task.Stages[i]
+		level := "INFO"
+		if i == len(task.Stages)-1 && stage.Status == failStatus {
+			level = "ERROR"
+		}
+		events = append(events, map[string]interface{}{
+			"timestamp": at.Format(time.RFC3339),
+			"level":     level,
+			"message":   fmt.Sprintf("Задача %d (%s): статус %s", task.ID, task.Service, stage.Status),
+		})
+		at = at.Add(stage.Duration)
+	}
+	return events, true
+}
+
+// Requests возвращает копию записанных запросов.
+func (m *MockRLM) Requests() []MockRecordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockRecordedRequest(nil), m.requests...)
+}
@@ -0,0 +1,489 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock - время mock-rlm в тестах. Каждый вызов Now сдвигает часы на
+// step, чтобы задачи проходили жизненный цикл за несколько опросов.
+type fakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func floatRate(rate float64) *float64 { return &rate }
+
+// startMockRLM поднимает mock-rlm на httptest-сервере и возвращает клиента
+// с быстрыми повторами.
+func startMockRLM(t *testing.T, config MockRLMConfig, step time.Duration) (*MockRLM, *fakeClock, *RLMClient) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	if config.Token == "" {
+		config.Token = "secret"
+	}
+	if config.Seed == 0 {
+		config.Seed = 1
+	}
+	mock, err := NewMockRLM(config, nil)
+	if err != nil {
+		t.Fatalf("NewMockRLM: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), step: step}
+	mock.now = clock.Now
+
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	client, err := NewRLMClient(RLMClientConfig{APIURL: server.URL + "/api/tasks.json", Token: config.Token})
+	if err != nil {
+		t.Fatalf("NewRLMClient: %v", err)
+	}
+	client.Retry = RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond,
+		Multiplier: 2, IdempotencyCheck: true}
+	return mock, clock, client
+}
+
+func mockTaskRequest(client *RLMClient, service string, items ...map[string]interface{}) *APIRequest {
+	body := map[string]interface{}{"service": service}
+	if len(items) > 0 {
+		list := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			list = append(list, item)
+		}
+		body["items"] = list
+	}
+	return client.NewRequest(body)
+}
+
+// countRequests - число записанных запросов method к путям с суффиксом suffix.
+func countRequests(mock *MockRLM, method, suffix string) int {
+	n := 0
+	for _, req := range mock.Requests() {
+		if req.Method == method && strings.HasSuffix(req.Path, suffix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMockRLMLifecycle(t *testing.T) {
+	mock, clock, client := startMockRLM(t, MockRLMConfig{
+		Default: MockServiceConfig{Lifecycle: []string{"enqueued:1s", "in_progress:2s", "success"}},
+		Services: map[string]MockServiceConfig{
+			"tuning": {Result: map[string]interface{}{"table_id": "psqlseclusterstandalone"}},
+		},
+	}, 0)
+	ctx := context.Background()
+
+	taskID, err := client.Submit(ctx, mockTaskRequest(client, "tuning"))
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	steps := []struct {
+		advance  time.Duration
+		status   string
+		progress float64
+		events   int
+	}{
+		{0, "enqueued", 0, 1},
+		{999 * time.Millisecond, "enqueued", 0, 1},
+		{time.Millisecond, "in_progress", 50, 2},
+		{2 * time.Second, "success", 100, 3},
+		{time.Hour, "success", 100, 3},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		status, err := client.TaskStatusWithEvents(ctx, taskID)
+		if err != nil {
+			t.Fatalf("TaskStatusWithEvents: %v", err)
+		}
+		if status["status"] != step.status || status["progress"] != step.progress {
+			t.Errorf("после +%s: status = %v, progress = %v; want %s, %v",
+				step.advance, status["status"], status["progress"], step.status, step.progress)
+		}
+		if events, _ := status["events"].([]map[string]interface{}); len(events) != step.events {
+			t.Errorf("после +%s: событий %d, want %d", step.advance, len(events), step.events)
+		}
+	}
+
+	status, _ := client.TaskStatus(ctx, taskID)
+	if status["table_id"] != "psqlseclusterstandalone" {
+		t.Errorf("результат сервиса не попал в статус: %v", status)
+	}
+	if _, err := client.TaskStatus(ctx, "999999"); err == nil {
+		t.Error("TaskStatus несуществующей задачи: ожидалась ошибка")
+	}
+	if got := countRequests(mock, http.MethodPost, "tasks.json"); got != 1 {
+		t.Errorf("записано POST: %d, want 1", got)
+	}
+}
+
+func TestMockRLMFailRate(t *testing.T) {
+	_, clock, client := startMockRLM(t, MockRLMConfig{
+		Default: MockServiceConfig{Lifecycle: []string{"in_progress:1s", "success"}, FailRate: floatRate(1)},
+		Services: map[string]MockServiceConfig{
+			"custom":    {FailStatus: "error"},
+			"never":     {FailRate: floatRate(0)},
+			"inherited": {},
+		},
+	}, 0)
+	ctx := context.Background()
+
+	want := map[string]string{"custom": "error", "never": "success", "inherited": "failed"}
+	ids := make(map[string]string)
+	for service := range want {
+		id, err := client.Submit(ctx, mockTaskRequest(client, service))
+		if err != nil {
+			t.Fatalf("Submit(%s): %v", service, err)
+		}
+		ids[service] = id
+	}
+	clock.Advance(time.Second)
+	for service, status := range want {
+		got, err := client.TaskStatus(ctx, ids[service])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["status"] != status {
+			t.Errorf("%s: status = %v, want %s", service, got["status"], status)
+		}
+	}
+}
+
+func TestMockRLMIdempotencyKey(t *testing.T) {
+	mock, _, client := startMockRLM(t, MockRLMConfig{}, 0)
+	ctx := context.Background()
+
+	req := mockTaskRequest(client, "tuning")
+	req.Headers[IdempotencyKeyHeader] = "key-1"
+	first, err := client.Submit(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Submit(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("повтор с тем же ключом создал задачу %s, want %s", second, first)
+	}
+
+	found, ok, err := client.FindTaskByIdempotencyKey(ctx, req)
+	if err != nil || !ok || found != first {
+		t.Errorf("FindTaskByIdempotencyKey = %q, %v, %v; want %q", found, ok, err, first)
+	}
+
+	other := mockTaskRequest(client, "tuning")
+	other.Headers[IdempotencyKeyHeader] = "key-2"
+	if _, ok, err := client.FindTaskByIdempotencyKey(ctx, other); err != nil || ok {
+		t.Errorf("FindTaskByIdempotencyKey(key-2) до отправки = %v, %v", ok, err)
+	}
+	third, err := client.Submit(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Errorf("другой ключ вернул ту же задачу %s", third)
+	}
+	if got := len(mock.tasks); got != 2 {
+		t.Errorf("создано задач: %d, want 2", got)
+	}
+}
+
+func TestMockRLMCancel(t *testing.T) {
+	_, clock, client := startMockRLM(t, MockRLMConfig{
+		Default: MockServiceConfig{Lifecycle: []string{"enqueued:1s", "in_progress:10s", "success"}},
+	}, 0)
+	ctx := context.Background()
+
+	running, _ := client.Submit(ctx, mockTaskRequest(client, "restart"))
+	finished, _ := client.Submit(ctx, mockTaskRequest(client, "restart"))
+	clock.Advance(2 * time.Second)
+
+	if err := client.CancelTask(ctx, running); err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+	clock.Advance(time.Hour)
+	status, err := client.TaskStatusWithEvents(ctx, running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status["status"] != "canceled" {
+		t.Errorf("статус после отмены = %v, want canceled", status["status"])
+	}
+	events, _ := status["events"].([]map[string]interface{})
+	if len(events) != 3 {
+		t.Errorf("событий после отмены: %d, want 3 (enqueued, in_progress, canceled)", len(events))
+	}
+
+	var apiErr *APIError
+	if err := client.CancelTask(ctx, finished); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("отмена завершённой задачи: %v, want 409", err)
+	}
+	if err := client.CancelTask(ctx, "999999"); !errors.Is(err, ErrCancelUnsupported) {
+		t.Errorf("отмена несуществующей задачи: %v, want ErrCancelUnsupported", err)
+	}
+}
+
+func TestMockRLMRejectsRequests(t *testing.T) {
+	mock, _, client := startMockRLM(t, MockRLMConfig{
+		Services: map[string]MockServiceConfig{
+			"restart": {RejectTableIDs: []string{"pangolinunique"}},
+		},
+	}, 0)
+	ctx := context.Background()
+
+	_, err := client.SubmitWithRetry(ctx, mockTaskRequest(client, "restart", map[string]interface{}{"table_id": "pangolinunique"}))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("SubmitWithRetry с неверным table_id: %v, want 400", err)
+	}
+	if got := countRequests(mock, http.MethodPost, "tasks.json"); got != 1 {
+		t.Errorf("ошибка 400 повторена: POST %d раз", got)
+	}
+	if _, err := client.Submit(ctx, mockTaskRequest(client, "restart", map[string]interface{}{"table_id": "pangolin"})); err != nil {
+		t.Errorf("Submit с другим table_id: %v", err)
+	}
+	if _, err := client.Submit(ctx, mockTaskRequest(client, "")); err == nil {
+		t.Error("Submit без service: ожидалась ошибка 400")
+	}
+
+	other, err := NewRLMClient(RLMClientConfig{APIURL: client.APIURL(), Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Submit(ctx, mockTaskRequest(other, "restart")); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Submit с чужим токеном: %v, want 401", err)
+	}
+}
+
+func TestSubmitWithRetryAgainstMock(t *testing.T) {
+	tests := []struct {
+		name    string
+		service MockServiceConfig
+		posts   int
+		tasks   int
+		wantErr bool
+	}{
+		{
+			name:    "server errors exhaust attempts",
+			service: MockServiceConfig{HTTPErrorRate: floatRate(1), HTTPErrorCode: http.StatusServiceUnavailable},
+			posts:   3,
+			wantErr: true,
+		},
+		{
+			name:    "lost response is found by idempotency key",
+			service: MockServiceConfig{LostResponseRate: floatRate(1)},
+			posts:   1,
+			tasks:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, _, client := startMockRLM(t, MockRLMConfig{Services: map[string]MockServiceConfig{"restart": tt.service}}, 0)
+
+			taskID, err := client.SubmitWithRetry(context.Background(), mockTaskRequest(client, "restart"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SubmitWithRetry = %q, %v; wantErr %v", taskID, err, tt.wantErr)
+			}
+			if got := countRequests(mock, http.MethodPost, "tasks.json"); got != tt.posts {
+				t.Errorf("POST: %d, want %d", got, tt.posts)
+			}
+			if got := len(mock.tasks); got != tt.tasks {
+				t.Errorf("создано задач: %d, want %d", got, tt.tasks)
+			}
+			if tt.tasks > 0 {
+				id, _ := strconv.Atoi(taskID)
+				if _, ok := mock.TaskStatus(id); !ok {
+					t.Errorf("SubmitWithRetry вернул неизвестную задачу %s", taskID)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitForTaskStatusAgainstMock(t *testing.T) {
+	_, _, client := startMockRLM(t, MockRLMConfig{
+		Default: MockServiceConfig{
+			Lifecycle: []string{"enqueued:1s", "in_progress:1s", "success"},
+			Result:    map[string]interface{}{"table_id": "psqlseclusterstandalone"},
+		},
+	}, 200*time.Millisecond)
+	ctx := context.Background()
+	opts := ExecOptions{PollInterval: time.Millisecond, TaskTimeout: 10 * time.Second}
+
+	taskID, err := client.Submit(ctx, mockTaskRequest(client, "tuning"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := WaitForTaskStatus(ctx, client, taskID, opts)
+	if err != nil {
+		t.Fatalf("WaitForTaskStatus: %v", err)
+	}
+	if status["status"] != "success" || TaskResultFields(status)["table_id"] != "psqlseclusterstandalone" {
+		t.Errorf("WaitForTaskStatus = %v", status)
+	}
+
+	if _, err := WaitForTaskStatus(ctx, client, "999999", opts); err == nil {
+		t.Error("WaitForTaskStatus несуществующей задачи: ожидалась ошибка")
+	}
+
+	stuck, _ := client.Submit(ctx, mockTaskRequest(client, "tuning"))
+	cancelCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	opts.PollInterval = time.Hour
+	if _, err := WaitForTaskStatus(cancelCtx, client, stuck, opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForTaskStatus после отмены ctx: %v, want DeadlineExceeded", err)
+	}
+}
+
+// mockScenarioModule - модуль сценария для тестов: одна задача на каждую цель,
+// service берётся из parameters.rlm_service, table_id - CI цели.
+type mockScenarioModule struct {
+	data   *ScenarioData
+	client *RLMClient
+}
+
+func (m *mockScenarioModule) Validate() error {
+	if _, ok := m.data.Parameters["rlm_service"].(string); !ok {
+		return fmt.Errorf("не задан parameters.rlm_service")
+	}
+	return nil
+}
+
+func (m *mockScenarioModule) GenerateRequests() ([]*APIRequest, error) {
+	service := m.data.Parameters["rlm_service"].(string)
+	var requests []*APIRequest
+	for _, target := range m.data.Targets {
+		for _, ci := range target.GetCIs() {
+			requests = append(requests, mockTaskRequest(m.client, service,
+				map[string]interface{}{"invsvm_ci_svm": ci, "table_id": ci}))
+		}
+	}
+	return requests, nil
+}
+
+func init() {
+	RegisterScenarioModule("mock_rlm_test", func(data *ScenarioData, client *RLMClient) (ScenarioModule, error) {
+		return &mockScenarioModule{data: data, client: client}, nil
+	}, nil)
+}
+
+func mockScenario(service string, targets ...string) []byte {
+	var list []string
+	for _, ci := range targets {
+		list = append(list, fmt.Sprintf(`{"svm_ci": %q}`, ci))
+	}
+	return []byte(fmt.Sprintf(`{"service": "mock_rlm_test", "parameters": {"rlm_service": %q}, "targets": [%s]}`,
+		service, strings.Join(list, ", ")))
+}
+
+func TestExecuteModularScenarioAgainstMock(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		targets  []string
+		statuses map[string]string
+		failed   int
+		err      string
+	}{
+		{
+			name:     "all tasks succeed",
+			service:  "tuning",
+			targets:  []string{"CI1", "CI2"},
+			statuses: map[string]string{"CI1": "success", "CI2": "success"},
+		},
+		{
+			name:     "tasks fail in RLM",
+			service:  "broken",
+			targets:  []string{"CI1", "CI2"},
+			statuses: map[string]string{"CI1": "failed", "CI2": "failed"},
+			failed:   2,
+		},
+		{
+			name:    "rejected request stops execution",
+			service: "tuning",
+			targets: []string{"REJECTED"},
+			err:     "код 400",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, client := startMockRLM(t, MockRLMConfig{
+				Default: MockServiceConfig{
+					Lifecycle:      []string{"in_progress:1s", "success"},
+					RejectTableIDs: []string{"REJECTED"},
+					Result:         map[string]interface{}{"table_id": "psqlseclusterstandalone"},
+				},
+				Services: map[string]MockServiceConfig{"broken": {FailRate: floatRate(1)}},
+			}, 100*time.Millisecond)
+			opts := ExecOptions{Wait: true, PollInterval: time.Millisecond, TaskTimeout: 10 * time.Second}
+
+			result, err := ExecuteModularScenarioContext(context.Background(), client, mockScenario(tt.service, tt.targets...), nil, opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ExecuteModularScenarioContext: %v, want error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecuteModularScenarioContext: %v", err)
+			}
+
+			statuses := make(map[string]string)
+			for _, outcome := range result.Outcomes {
+				statuses[strings.Join(outcome.Targets, ",")] = outcome.Status
+				if outcome.ID == "" || outcome.Finished.IsZero() {
+					t.Errorf("итог без ID или времени завершения: %+v", outcome)
+				}
+				if outcome.Result["table_id"] != "psqlseclusterstandalone" {
+					t.Errorf("результат задачи %s = %v", outcome.ID, outcome.Result)
+				}
+			}
+			if fmt.Sprint(statuses) != fmt.Sprint(tt.statuses) {
+				t.Errorf("статусы = %v, want %v", statuses, tt.statuses)
+			}
+			if got := result.Failed(); got != tt.failed {
+				t.Errorf("Failed() = %d, want %d", got, tt.failed)
+			}
+
+			store, err := DefaultTaskStore()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range result.TaskIDs() {
+				rec, err := store.Load(TaskKey(client.Name(), id))
+				if err != nil {
+					t.Errorf("задача %s не попала в реестр: %v", id, err)
+				} else if rec.Status != statuses[strings.Join(rec.Targets, ",")] {
+					t.Errorf("реестр: задача %s в статусе %s", id, rec.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Типы параметров схемы модуля.
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamNumber = "number"
+	ParamBool   = "bool"
+	ParamList   = "list"
+	ParamObject = "object"
+)
+
+// ParamSchema описывает параметр сценария. Для list - схема элемента в Items,
+// для object - поля в Fields.
+type ParamSchema struct {
+	Name        string         `json:"name"`
+	Type        string         `json:"type"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Default     interface{}    `json:"default,omitempty"`
+	Enum        []string       `json:"enum,omitempty"`
+	Example     interface{}    `json:"example,omitempty"`
+	Items       *ParamSchema   `json:"items,omitempty"`
+	Fields      []*ParamSchema `json:"fields,omitempty"`
+}
+
+// ModuleSchema - схема сценария сервиса, публикуется при регистрации модуля.
+type ModuleSchema struct {
+	Service     string         `json:"service"`
+	Description string         `json:"description,omitempty"`
+	Parameters  []*ParamSchema `json:"parameters"`
+	// TargetsRequired - нужен хотя бы один target. Если false, вместо
+	// targets можно передать items.
+	TargetsRequired bool `json:"targets_required"`
+	// AllowExtra - параметры вне схемы передаются в RLM как есть, а не
+	// считаются опечаткой.
+	AllowExtra bool `json:"allow_extra,omitempty"`
+}
+
+var scenarioSchemas = make(map[string]*ModuleSchema)
+
+// ScenarioSchema - схема модуля сервиса или nil, если модуль её не публикует.
+func ScenarioSchema(service string) *ModuleSchema {
+	return scenarioSchemas[service]
+}
+
+// ScenarioServices - имена зарегистрированных сервисов по алфавиту.
+func ScenarioServices() []string {
+	names := make([]string, 0, len(scenarioModules))
+	for name := range scenarioModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Param - схема параметра верхнего уровня по имени.
+func (s *ModuleSchema) Param(name string) *ParamSchema {
+	for _, param := range s.Parameters {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// ScenarioValidationError собирает все ошибки проверки сценария.
+type ScenarioValidationError struct {
+	Service string
+	Errors  []string
+}
+
+func (e *ScenarioValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0]
+	}
+	return fmt.Sprintf("сценарий %s, ошибок - %d:\n  - %s", e.Service, len(e.Errors), strings.Join(e.Errors, "\n  - "))
+}
+
+// Apply подставляет значения по умолчанию, приводит параметры к типам схемы
+// ("5432" -> 5432 для int) и возвращает все найденные ошибки.
+func (s *ModuleSchema) Apply(data *ScenarioData) []string {
+	var errs []string
+	if data.Parameters == nil {
+		data.Parameters = make(map[string]interface{})
+	}
+
+	for _, param := range s.Parameters {
+		value, ok := data.Parameters[param.Name]
+		if !ok || value == nil {
+			if param.Default != nil {
+				data.Parameters[param.Name] = param.Default
+			} else if param.Required {
+				errs = append(errs, fmt.Sprintf("parameters.%s: обязательный параметр не задан%s", param.Name, describeSuffix(param)))
+			}
+			continue
+		}
+		converted, paramErrs := param.check("parameters."+param.Name, value)
+		data.Parameters[param.Name] = converted
+		errs = append(errs, paramErrs...)
+	}
+
+	if !s.AllowExtra {
+		var unknown []string
+		for name := range data.Parameters {
+			if s.Param(name) == nil {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			errs = append(errs, fmt.Sprintf("parameters.%s: неизвестный параметр", name))
+		}
+	}
+
+	if s.TargetsRequired && len(data.Targets) == 0 {
+		errs = append(errs, "targets: не указаны целевые серверы")
+	}
+	for i, target := range data.Targets {
+		if len(target.GetCIs()) == 0 && target.IP == "" {
+			errs = append(errs, fmt.Sprintf("targets[%d]: пустой svm_ci", i))
+		}
+	}
+	return errs
+}
+
+// check проверяет значение и возвращает его, приведённое к типу схемы.
+func (p *ParamSchema) check(path string, value interface{}) (interface{}, []string) {
+	converted, err := convertParam(p.Type, value)
+	if err != nil {
+		return value, []string{fmt.Sprintf("%s: %v", path, err)}
+	}
+
+	var errs []string
+	if len(p.Enum) > 0 {
+		found := false
+		for _, allowed := range p.Enum {
+			if fmt.Sprint(converted) == allowed {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("%s: недопустимое значение %q, допустимо: %s", path, fmt.Sprint(converted), strings.Join(p.Enum, ", ")))
+		}
+	}
+
+	switch p.Type {
+	case ParamList:
+		if p.Items == nil {
+			break
+		}
+		list := converted.([]interface{})
+		for i, item := range list {
+			var itemErrs []string
+			list[i], itemErrs = p.Items.check(fmt.Sprintf("%s[%d]", path, i), item)
+			errs = append(errs, itemErrs...)
+		}
+	case ParamObject:
+		object := converted.(map[string]interface{})
+		for _, field := range p.Fields {
+			fieldValue, ok := object[field.Name]
+			if !ok || fieldValue == nil {
+				if field.Default != nil {
+					object[field.Name] = field.Default
+				} else if field.Required {
+					errs = append(errs, fmt.Sprintf("%s.%s: обязательное поле не задано", path, field.Name))
+				}
+				continue
+			}
+			var fieldErrs []string
+			object[field.Name], fieldErrs = field.check(path+"."+field.Name, fieldValue)
+			errs = append(errs, fieldErrs...)
+		}
+	}
+	if p.Required && converted == "" {
+		errs = append(errs, fmt.Sprintf("%s: не может быть пустым", path))
+	}
+	return converted, errs
+}
+
+// convertParam приводит значение из YAML/JSON или --var к типу схемы.
+// Строки допускаются для чисел и bool, числа - для строк.
+func convertParam(typ string, value interface{}) (interface{}, error) {
+	switch typ {
+	case ParamString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int, int64, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case ParamInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return n, nil
+			}
+		}
+	case ParamNumber:
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return n, nil
+			}
+		}
+	case ParamBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+	case ParamList:
+		if v, ok := value.([]interface{}); ok {
+			return v, nil
+		}
+	case ParamObject:
+		if v, ok := value.(map[string]interface{}); ok {
+			return v, nil
+		}
+	default:
+		return value, nil
+	}
+	return value, fmt.Errorf("ожидается %s, получено %s", typ, describeValue(value))
+}
+
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("строка %q", v)
+	case []interface{}:
+		return "список"
+	case map[string]interface{}:
+		return "словарь"
+	default:
+		return fmt.Sprintf("%T %v", v, v)
+	}
+}
+
+func describeSuffix(param *ParamSchema) string {
+	if param.Description == "" {
+		return ""
+	}
+	return " (" + param.Description + ")"
+}
+
+// ValidateScenarioData проверяет сценарий по схеме модуля и методом
+// Validate модуля. Ошибки схемы возвращаются все сразу.
+func ValidateScenarioData(data *ScenarioData, module ScenarioModule) error {
+	var errs []string
+	if schema := ScenarioSchema(data.Service); schema != nil {
+		errs = schema.Apply(data)
+	}
+	if data.Rollout != nil {
+		errs = append(errs, data.Rollout.check()...)
+	}
+	// Validate модуля рассчитан на параметры, прошедшие схему: при ошибках
+	// схемы он не вызывается, чтобы не дублировать их.
+	if len(errs) == 0 {
+		if err := module.Validate(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return &ScenarioValidationError{Service: data.Service, Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,553 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Скрипты проверок (.och) для ochan check. Пример:
+//
+//	ram = 64GB
+//	for f in glob("conf/*.conf") {
+//	    if get(f, "shared_buffers") < 128MB {
+//	        fail f + ": shared_buffers слишком мал"
+//	    } else if get(f, "max_connections") * get(f, "work_mem") > ram {
+//	        warn f + ": work_mem может исчерпать память"
+//	    } else {
+//	        print f, "ok"
+//	    }
+//	}
+//	assert get("postgresql.conf", "wal_level") in ["replica", "logical"], "wal_level"
+//
+// Выражения - те же, что в validate --rules (ParseExpr).
+
+type ochStmt interface{}
+
+type ochAssign struct {
+	line int
+	name string
+	expr Expr
+}
+
+type ochBranch struct {
+	cond Expr
+	body []ochStmt
+}
+
+type ochIf struct {
+	line     int
+	branches []ochBranch
+	elseBody []ochStmt
+}
+
+type ochFor struct {
+	line int
+	name string
+	iter Expr
+	body []ochStmt
+}
+
+// ochOutput - print, warn и fail.
+type ochOutput struct {
+	line  int
+	kind  string
+	exprs []Expr
+}
+
+type ochAssert struct {
+	line    int
+	cond    Expr
+	message Expr
+	source  string
+}
+
+type ochExit struct {
+	line int
+	code Expr
+}
+
+type OchScript struct {
+	Name  string
+	stmts []ochStmt
+}
+
+// OchResult - итог выполнения скрипта. ExitCode: 0 - проверки пройдены,
+// 1 - были fail или проваленные assert, либо значение из exit.
+type OchResult struct {
+	Failures int
+	Warnings int
+	ExitCode int
+}
+
+type ochLine struct {
+	num  int
+	text string
+}
+
+type ochScriptError struct {
+	name string
+	line int
+	err  error
+}
+
+func (e *ochScriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.name, e.line, e.err)
+}
+
+var (
+	ochIdentRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	ochAssignRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=([^=].*)$`)
+	ochForRe    = regexp.MustCompile(`^for\s+([A-Za-z_][A-Za-z0-9_]*)\s+in\s+(.+)\{$`)
+	ochIfRe     = regexp.MustCompile(`^if\s+(.+)\{$`)
+	ochElseIfRe = regexp.MustCompile(`^\}\s*else\s+if\s+(.+)\{$`)
+	ochElseRe   = regexp.MustCompile(`^\}\s*else\s*\{$`)
+)
+
+func ParseOchScript(src, name string) (*OchScript, error) {
+	var lines []ochLine
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		text := strings.TrimSpace(stripOchComment(raw))
+		if text != "" {
+			lines = append(lines, ochLine{num: i + 1, text: text})
+		}
+	}
+
+	p := &ochParser{name: name, lines: lines}
+	stmts, closing, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if closing != nil {
+		return nil, &ochScriptError{name, closing.num, fmt.Errorf("лишняя '}'")}
+	}
+	return &OchScript{Name: name, stmts: stmts}, nil
+}
+
+type ochParser struct {
+	name  string
+	lines []ochLine
+	pos   int
+}
+
+func (p *ochParser) errorf(line int, format string, args ...interface{}) error {
+	return &ochScriptError{p.name, line, fmt.Errorf(format, args...)}
+}
+
+func (p *ochParser) expr(line int, src string) (Expr, error) {
+	expr, err := ParseExpr(strings.TrimSpace(src))
+	if err != nil {
+		return nil, &ochScriptError{p.name, line, err}
+	}
+	return expr, nil
+}
+
+// parseBlock читает операторы до строки, начинающейся с '}', и возвращает
+// её (nil - конец файла).
+func (p *ochParser) parseBlock() ([]ochStmt, *ochLine, error) {
+	var stmts []ochStmt
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		p.pos++
+		text := line.text
+
+		if strings.HasPrefix(text, "}") {
+			return stmts, &line, nil
+		}
+
+		keyword := strings.Fields(text)[0]
+		rest := strings.TrimSpace(strings.TrimPrefix(text, keyword))
+
+		switch {
+		case keyword == "if":
+			stmt, err := p.parseIf(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			stmts = append(stmts, stmt)
+		case keyword == "for":
+			m := ochForRe.FindStringSubmatch(text)
+			if m == nil {
+				return nil, nil, p.errorf(line.num, "ожидается 'for <имя> in <выражение> {'")
+			}
+			iter, err := p.expr(line.num, m[2])
+			if err != nil {
+				return nil, nil, err
+			}
+			body, closing, err := p.parseBlock()
+			if err != nil {
+				return nil, nil, err
+			}
+			if closing == nil || closing.text != "}" {
+				return nil, nil, p.errorf(line.num, "цикл for не закрыт '}'")
+			}
+			stmts = append(stmts, &ochFor{line: line.num, name: m[1], iter: iter, body: body})
+		case keyword == "print" || keyword == "warn" || keyword == "fail":
+			exprs, err := ParseExprList(rest)
+			if err != nil {
+				return nil, nil, &ochScriptError{p.name, line.num, err}
+			}
+			stmts = append(stmts, &ochOutput{line: line.num, kind: keyword, exprs: exprs})
+		case keyword == "assert":
+			exprs, err := ParseExprList(rest)
+			if err != nil {
+				return nil, nil, &ochScriptError{p.name, line.num, err}
+			}
+			if len(exprs) == 0 || len(exprs) > 2 {
+				return nil, nil, p.errorf(line.num, "ожидается 'assert <условие>[, сообщение]'")
+			}
+			stmt := &ochAssert{line: line.num, cond: exprs[0], source: rest}
+			if len(exprs) == 2 {
+				stmt.message = exprs[1]
+			}
+			stmts = append(stmts, stmt)
+		case keyword == "exit":
+			stmt := &ochExit{line: line.num}
+			if rest != "" {
+				code, err := p.expr(line.num, rest)
+				if err != nil {
+					return nil, nil, err
+				}
+				stmt.code = code
+			}
+			stmts = append(stmts, stmt)
+		default:
+			m := ochAssignRe.FindStringSubmatch(text)
+			if m == nil {
+				return nil, nil, p.errorf(line.num, "неизвестный оператор '%s'", text)
+			}
+			expr, err := p.expr(line.num, m[2])
+			if err != nil {
+				return nil, nil, err
+			}
+			stmts = append(stmts, &ochAssign{line: line.num, name: m[1], expr: expr})
+		}
+	}
+	return stmts, nil, nil
+}
+
+func (p *ochParser) parseIf(line ochLine) (*ochIf, error) {
+	m := ochIfRe.FindStringSubmatch(line.text)
+	if m == nil {
+		return nil, p.errorf(line.num, "ожидается 'if <условие> {'")
+	}
+	cond, err := p.expr(line.num, m[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &ochIf{line: line.num}
+	for {
+		body, closing, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		if closing == nil {
+			return nil, p.errorf(line.num, "if не закрыт '}'")
+		}
+		stmt.branches = append(stmt.branches, ochBranch{cond: cond, body: body})
+
+		if closing.text == "}" {
+			return stmt, nil
+		}
+		if m := ochElseIfRe.FindStringSubmatch(closing.text); m != nil {
+			if cond, err = p.expr(closing.num, m[1]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if ochElseRe.MatchString(closing.text) {
+			body, end, err := p.parseBlock()
+			if err != nil {
+				return nil, err
+			}
+			if end == nil || end.text != "}" {
+				return nil, p.errorf(closing.num, "else не закрыт '}'")
+			}
+			stmt.elseBody = body
+			return stmt, nil
+		}
+		return nil, p.errorf(closing.num, "неожиданное '%s'", closing.text)
+	}
+}
+
+// ochExitSignal прерывает выполнение по оператору exit.
+type ochExitSignal struct{ code int }
+
+func (ochExitSignal) Error() string { return "exit" }
+
+type ochRuntime struct {
+	script  *OchScript
+	out     io.Writer
+	vars    map[string]ExprValue
+	configs map[string]map[string]map[string]string
+	result  *OchResult
+	env     *ExprEnv
+}
+
+// Run выполняет скрипт. vars задают начальные переменные (--var key=value).
+func (s *OchScript) Run(out io.Writer, vars map[string]string) (*OchResult, error) {
+	rt := &ochRuntime{
+		script:  s,
+		out:     out,
+		vars:    make(map[string]ExprValue),
+		configs: make(map[string]map[string]map[string]string),
+		result:  &OchResult{},
+	}
+	for name, raw := range vars {
+		rt.vars[name] = ParamExprValue("", raw)
+	}
+	rt.env = &ExprEnv{
+		Resolve: func(name string) (ExprValue, bool) {
+			v, ok := rt.vars[name]
+			return v, ok
+		},
+		Funcs: map[string]ExprFunc{
+			"get":  rt.fnGet,
+			"has":  rt.fnHas,
+			"keys": rt.fnKeys,
+			"glob": rt.fnGlob,
+		},
+	}
+
+	err := rt.exec(s.stmts)
+	if sig, ok := err.(ochExitSignal); ok {
+		rt.result.ExitCode = sig.code
+		return rt.result, nil
+	}
+	if err != nil {
+		return rt.result, err
+	}
+	if rt.result.Failures > 0 {
+		rt.result.ExitCode = 1
+	}
+	return rt.result, nil
+}
+
+func (rt *ochRuntime) eval(line int, expr Expr) (ExprValue, error) {
+	v, err := expr.Eval(rt.env)
+	if err != nil {
+		return v, &ochScriptError{rt.script.Name, line, err}
+	}
+	return v, nil
+}
+
+func (rt *ochRuntime) exec(stmts []ochStmt) error {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ochAssign:
+			v, err := rt.eval(s.line, s.expr)
+			if err != nil {
+				return err
+			}
+			rt.vars[s.name] = v
+		case *ochIf:
+			executed := false
+			for _, branch := range s.branches {
+				cond, err := rt.eval(s.line, branch.cond)
+				if err != nil {
+					return err
+				}
+				if cond.Truthy() {
+					if err := rt.exec(branch.body); err != nil {
+						return err
+					}
+					executed = true
+					break
+				}
+			}
+			if !executed && s.elseBody != nil {
+				if err := rt.exec(s.elseBody); err != nil {
+					return err
+				}
+			}
+		case *ochFor:
+			iter, err := rt.eval(s.line, s.iter)
+			if err != nil {
+				return err
+			}
+			if iter.Kind != ExprList {
+				return &ochScriptError{rt.script.Name, s.line, fmt.Errorf("for ожидает список, получено '%s'", iter)}
+			}
+			for _, item := range iter.List {
+				rt.vars[s.name] = item
+				if err := rt.exec(s.body); err != nil {
+					return err
+				}
+			}
+		case *ochOutput:
+			var parts []string
+			for _, expr := range s.exprs {
+				v, err := rt.eval(s.line, expr)
+				if err != nil {
+					return err
+				}
+				parts = append(parts, v.String())
+			}
+			message := strings.Join(parts, " ")
+			switch s.kind {
+			case "print":
+				fmt.Fprintln(rt.out, message)
+			case "warn":
+				rt.result.Warnings++
+				fmt.Fprintf(rt.out, "⚠️ %s\n", message)
+			case "fail":
+				rt.result.Failures++
+				fmt.Fprintf(rt.out, "❌ %s\n", message)
+			}
+		case *ochAssert:
+			cond, err := rt.eval(s.line, s.cond)
+			if err != nil {
+				return err
+			}
+			if !cond.Truthy() {
+				rt.result.Failures++
+				message := "assert " + s.source
+				if s.message != nil {
+					v, err := rt.eval(s.line, s.message)
+					if err != nil {
+						return err
+					}
+					message = v.String()
+				}
+				fmt.Fprintf(rt.out, "❌ %s:%d: %s\n", rt.script.Name, s.line, message)
+			}
+		case *ochExit:
+			code := 0
+			if s.code != nil {
+				v, err := rt.eval(s.line, s.code)
+				if err != nil {
+					return err
+				}
+				n, err := exprNumber(v)
+				if err != nil {
+					return &ochScriptError{rt.script.Name, s.line, err}
+				}
+				code = int(n.Num)
+			} else if rt.result.Failures > 0 {
+				code = 1
+			}
+			return ochExitSignal{code}
+		}
+	}
+	return nil
+}
+
+// config загружает и кеширует конфиг. postgresql.conf читается вместе с
+// include-файлами.
+func (rt *ochRuntime) config(path string) (map[string]map[string]string, error) {
+	if cfg, ok := rt.configs[path]; ok {
+		return cfg, nil
+	}
+	content, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg map[string]map[string]string
+	if DetectConfigFormat(path, content) == "ini" && HasConfIncludes(content) {
+		cfg, err = ParseEffectiveConfig(content, path)
+	} else {
+		cfg, err = ParseConfigAs(content, path, "auto")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	rt.configs[path] = cfg
+	return cfg, nil
+}
+
+// get(file, key[, default]) - значение параметра с учётом его единиц.
+func (rt *ochRuntime) fnGet(args []ExprValue) (ExprValue, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return NullValue(), fmt.Errorf("get() ожидает (файл, параметр[, по умолчанию])")
+	}
+	cfg, err := rt.config(args[0].String())
+	if err != nil {
+		return NullValue(), err
+	}
+	key := args[1].String()
+	if raw, ok := LookupConfigParam(cfg, key); ok {
+		return ParamExprValue(key, raw), nil
+	}
+	if len(args) == 3 {
+		return args[2], nil
+	}
+	return NullValue(), nil
+}
+
+func (rt *ochRuntime) fnHas(args []ExprValue) (ExprValue, error) {
+	if len(args) != 2 {
+		return NullValue(), fmt.Errorf("has() ожидает (файл, параметр)")
+	}
+	cfg, err := rt.config(args[0].String())
+	if err != nil {
+		return NullValue(), err
+	}
+	_, ok := LookupConfigParam(cfg, args[1].String())
+	return BoolValue(ok), nil
+}
+
+func (rt *ochRuntime) fnKeys(args []ExprValue) (ExprValue, error) {
+	if len(args) != 1 {
+		return NullValue(), fmt.Errorf("keys() ожидает (файл)")
+	}
+	cfg, err := rt.config(args[0].String())
+	if err != nil {
+		return NullValue(), err
+	}
+	var keys []string
+	for section, params := range cfg {
+		for key := range params {
+			if section != "" {
+				key = section + "." + key
+			}
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	items := make([]ExprValue, len(keys))
+	for i, key := range keys {
+		items[i] = StringValue(key)
+	}
+	return ListValue(items), nil
+}
+
+func (rt *ochRuntime) fnGlob(args []ExprValue) (ExprValue, error) {
+	var items []ExprValue
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg.String())
+		if err != nil {
+			return NullValue(), err
+		}
+		for _, match := range matches {
+			items = append(items, StringValue(match))
+		}
+	}
+	return ListValue(items), nil
+}
+
+func stripOchComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// IsOchIdent проверяет имя переменной для --var.
+func IsOchIdent(name string) bool {
+	return ochIdentRe.MatchString(name)
+}
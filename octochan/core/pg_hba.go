@@ -0,0 +1,412 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HbaToken - элемент поля pg_hba.conf. Quoted важен: "all" в кавычках -
+// это имя базы/роли, а не ключевое слово.
+type HbaToken struct {
+	Value  string `json:"value"`
+	Quoted bool   `json:"quoted,omitempty"`
+}
+
+type HbaOption struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HbaRule struct {
+	File      string      `json:"file"`
+	Line      int         `json:"line"`
+	Type      string      `json:"type"`
+	Databases []HbaToken  `json:"databases"`
+	Users     []HbaToken  `json:"users"`
+	Address   string      `json:"address,omitempty"`
+	Netmask   string      `json:"netmask,omitempty"`
+	Method    string      `json:"method"`
+	Options   []HbaOption `json:"options,omitempty"`
+	Raw       string      `json:"raw"`
+	network   *net.IPNet
+}
+
+type HbaInclude struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Directive string `json:"directive"`
+	Path      string `json:"path"`
+}
+
+type HbaParseError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e HbaParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+type HbaFile struct {
+	Rules    []*HbaRule      `json:"rules"`
+	Includes []HbaInclude    `json:"includes,omitempty"`
+	Errors   []HbaParseError `json:"-"`
+}
+
+var hbaConnectionTypes = map[string]bool{
+	"local":        true,
+	"host":         true,
+	"hostssl":      true,
+	"hostnossl":    true,
+	"hostgssenc":   true,
+	"hostnogssenc": true,
+}
+
+var hbaIncludeDirectives = map[string]bool{
+	"include":           true,
+	"include_if_exists": true,
+	"include_dir":       true,
+}
+
+// ParsePgHbaContent разбирает содержимое pg_hba.conf без раскрытия include:
+// директивы include сохраняются в Includes, ошибки строк - в Errors.
+func ParsePgHbaContent(content, fileName string) *HbaFile {
+	hba := &HbaFile{}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNum := i + 1
+		raw := lines[i]
+		// Продолжение строки обратным слешем (PostgreSQL 16+)
+		for strings.HasSuffix(strings.TrimRight(raw, " \t"), "\\") && i+1 < len(lines) {
+			raw = strings.TrimSuffix(strings.TrimRight(raw, " \t"), "\\") + " " + lines[i+1]
+			i++
+		}
+
+		fields, err := tokenizeHbaLine(raw)
+		if err != nil {
+			hba.Errors = append(hba.Errors, HbaParseError{File: fileName, Line: lineNum, Message: err.Error()})
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		first := fields[0][0]
+		if !first.Quoted && hbaIncludeDirectives[first.Value] {
+			if len(fields) != 2 || len(fields[1]) != 1 {
+				hba.Errors = append(hba.Errors, HbaParseError{File: fileName, Line: lineNum, Message: fmt.Sprintf("%s ожидает ровно один путь", first.Value)})
+				continue
+			}
+			hba.Includes = append(hba.Includes, HbaInclude{File: fileName, Line: lineNum, Directive: first.Value, Path: fields[1][0].Value})
+			continue
+		}
+
+		rule, err := parseHbaRule(fields)
+		if err != nil {
+			hba.Errors = append(hba.Errors, HbaParseError{File: fileName, Line: lineNum, Message: err.Error()})
+			continue
+		}
+		rule.File = fileName
+		rule.Line = lineNum
+		rule.Raw = strings.TrimSpace(raw)
+		hba.Rules = append(hba.Rules, rule)
+	}
+	return hba
+}
+
+// LoadPgHba читает pg_hba.conf и раскрывает include-директивы в порядке их
+// появления, как это делает PostgreSQL. Относительные пути считаются от
+// директории включающего файла.
+func LoadPgHba(path string) (*HbaFile, error) {
+	result := &HbaFile{}
+	if err := loadPgHba(path, result, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func loadPgHba(path string, result *HbaFile, stack map[string]bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if stack[absPath] {
+		return fmt.Errorf("циклическое включение файла %s", path)
+	}
+	stack[absPath] = true
+	defer delete(stack, absPath)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	hba := ParsePgHbaContent(string(content), path)
+	result.Errors = append(result.Errors, hba.Errors...)
+
+	// Правила и include нужно обходить в порядке строк
+	includes := hba.Includes
+	for _, rule := range hba.Rules {
+		for len(includes) > 0 && includes[0].Line < rule.Line {
+			if err := loadHbaInclude(includes[0], result, stack); err != nil {
+				return err
+			}
+			includes = includes[1:]
+		}
+		result.Rules = append(result.Rules, rule)
+	}
+	for _, inc := range includes {
+		if err := loadHbaInclude(inc, result, stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadHbaInclude(inc HbaInclude, result *HbaFile, stack map[string]bool) error {
+	result.Includes = append(result.Includes, inc)
+
+	target := inc.Path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(inc.File), target)
+	}
+
+	switch inc.Directive {
+	case "include_if_exists":
+		if !FileExists(target) {
+			return nil
+		}
+	case "include_dir":
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", inc.File, inc.Line, err)
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".conf") && !strings.HasPrefix(entry.Name(), ".") {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := loadPgHba(filepath.Join(target, name), result, stack); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := loadPgHba(target, result, stack); err != nil {
+		return fmt.Errorf("%s:%d: %v", inc.File, inc.Line, err)
+	}
+	return nil
+}
+
+// ParsePgHba разбирает одну строку pg_hba.conf в плоскую карту полей.
+func ParsePgHba(line string) map[string]string {
+	hba := ParsePgHbaContent(line, "")
+	if len(hba.Rules) == 0 {
+		return nil
+	}
+	rule := hba.Rules[0]
+
+	var options []string
+	for _, opt := range rule.Options {
+		options = append(options, opt.Name+"="+opt.Value)
+	}
+
+	result := make(map[string]string)
+	result["type"] = rule.Type
+	result["database"] = joinHbaTokens(rule.Databases)
+	result["user"] = joinHbaTokens(rule.Users)
+	result["address"] = rule.AddressString()
+	result["method"] = rule.Method
+	result["options"] = strings.Join(options, " ")
+	return result
+}
+
+func parseHbaRule(fields [][]HbaToken) (*HbaRule, error) {
+	single := func(i int) (string, error) {
+		if len(fields[i]) != 1 {
+			return "", fmt.Errorf("поле %d не может быть списком", i+1)
+		}
+		return fields[i][0].Value, nil
+	}
+
+	connType, err := single(0)
+	if err != nil {
+		return nil, err
+	}
+	if !hbaConnectionTypes[connType] {
+		return nil, fmt.Errorf("неизвестный тип подключения '%s'", connType)
+	}
+
+	rule := &HbaRule{Type: connType}
+	minFields := 5
+	if connType == "local" {
+		minFields = 4
+	}
+	if len(fields) < minFields {
+		return nil, fmt.Errorf("недостаточно полей для правила %s", connType)
+	}
+	rule.Databases = fields[1]
+	rule.Users = fields[2]
+
+	next := 3
+	if connType != "local" {
+		if rule.Address, err = single(3); err != nil {
+			return nil, err
+		}
+		next = 4
+		if ip := net.ParseIP(rule.Address); ip != nil {
+			if len(fields) < 6 {
+				return nil, fmt.Errorf("для адреса %s без префикса нужна маска", rule.Address)
+			}
+			if rule.Netmask, err = single(4); err != nil {
+				return nil, err
+			}
+			mask := net.ParseIP(rule.Netmask)
+			if mask == nil {
+				return nil, fmt.Errorf("неверная маска '%s'", rule.Netmask)
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, mask = ip4, mask.To4()
+			}
+			ipMask := net.IPMask(mask)
+			if _, bits := ipMask.Size(); bits == 0 {
+				return nil, fmt.Errorf("неверная маска '%s'", rule.Netmask)
+			}
+			rule.network = &net.IPNet{IP: ip.Mask(ipMask), Mask: ipMask}
+			next = 5
+		} else if strings.Contains(rule.Address, "/") {
+			_, network, err := net.ParseCIDR(rule.Address)
+			if err != nil {
+				return nil, fmt.Errorf("неверный CIDR '%s'", rule.Address)
+			}
+			rule.network = network
+		}
+	}
+
+	if rule.Method, err = single(next); err != nil {
+		return nil, err
+	}
+	for _, field := range fields[next+1:] {
+		if len(field) != 1 || !strings.Contains(field[0].Value, "=") {
+			return nil, fmt.Errorf("опция аутентификации должна иметь вид name=value")
+		}
+		parts := strings.SplitN(field[0].Value, "=", 2)
+		rule.Options = append(rule.Options, HbaOption{Name: parts[0], Value: parts[1]})
+	}
+	return rule, nil
+}
+
+// tokenizeHbaLine разбивает строку на поля, а поля - на элементы списка через
+// запятую. Кавычки защищают пробелы, запятые и '#'.
+func tokenizeHbaLine(line string) ([][]HbaToken, error) {
+	var fields [][]HbaToken
+	var field []HbaToken
+	var cur strings.Builder
+	quoted, inQuotes, hasToken := false, false, false
+
+	flushToken := func() {
+		if hasToken {
+			field = append(field, HbaToken{Value: cur.String(), Quoted: quoted})
+		}
+		cur.Reset()
+		quoted, hasToken = false, false
+	}
+	flushField := func() {
+		flushToken()
+		if len(field) > 0 {
+			fields = append(fields, field)
+		}
+		field = nil
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuotes && c == '"':
+			if i+1 < len(line) && line[i+1] == '"' {
+				cur.WriteByte('"')
+				i++
+				continue
+			}
+			inQuotes = false
+		case inQuotes:
+			cur.WriteByte(c)
+		case c == '"':
+			inQuotes, quoted, hasToken = true, true, true
+		case c == '#':
+			flushField()
+			return fields, nil
+		case c == ',':
+			flushToken()
+		case c == ' ' || c == '\t':
+			// Пробелы вокруг запятой не разрывают список: "db1, db2"
+			before := strings.TrimRight(line[:i], " \t")
+			after := strings.TrimLeft(line[i:], " \t")
+			if strings.HasSuffix(before, ",") || strings.HasPrefix(after, ",") {
+				continue
+			}
+			flushField()
+		default:
+			cur.WriteByte(c)
+			hasToken = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("незакрытая кавычка")
+	}
+	flushField()
+	return fields, nil
+}
+
+func (r *HbaRule) AddressString() string {
+	if r.Netmask != "" {
+		return r.Address + "/" + r.Netmask
+	}
+	return r.Address
+}
+
+// Key - каноническое представление правила для сравнения.
+func (r *HbaRule) Key() string {
+	var options []string
+	for _, opt := range r.Options {
+		options = append(options, opt.Name+"="+opt.Value)
+	}
+	return strings.Join([]string{r.matchKey(), r.Method, strings.Join(options, " ")}, " ")
+}
+
+// matchKey описывает, какие подключения выбирает правило (без метода).
+func (r *HbaRule) matchKey() string {
+	address := r.AddressString()
+	if r.network != nil {
+		address = r.network.String()
+	}
+	return strings.Join([]string{r.Type, joinHbaTokens(r.Databases), joinHbaTokens(r.Users), address}, " ")
+}
+
+func (r *HbaRule) Location() string {
+	if r.File == "" {
+		return fmt.Sprintf("строка %d", r.Line)
+	}
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+func joinHbaTokens(tokens []HbaToken) string {
+	values := make([]string, len(tokens))
+	for i, t := range tokens {
+		if t.Quoted {
+			values[i] = `"` + strings.ReplaceAll(t.Value, `"`, `""`) + `"`
+		} else {
+			values[i] = t.Value
+		}
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	HbaIssueError   = "error"
+	HbaIssueWarning = "warning"
+)
+
+const (
+	HbaDiffAdded    = "added"
+	HbaDiffRemoved  = "removed"
+	HbaDiffModified = "modified"
+	HbaDiffMoved    = "moved"
+)
+
+// Минимальная длина префикса, начиная с которой сеть не считается слишком широкой.
+const (
+	hbaMinIPv4Prefix = 16
+	hbaMinIPv6Prefix = 48
+)
+
+type HbaDiffEntry struct {
+	Status string   `json:"status"`
+	Old    *HbaRule `json:"old,omitempty"`
+	New    *HbaRule `json:"new,omitempty"`
+}
+
+type HbaIssue struct {
+	Severity string   `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Rule     *HbaRule `json:"rule,omitempty"`
+}
+
+// DiffPgHba сравнивает правила с учётом порядка: PostgreSQL применяет первое
+// подходящее правило, поэтому перестановка - тоже изменение. Общая
+// подпоследовательность (LCS) считается неизменной, остальные правила
+// сопоставляются как перемещённые (то же правило) или изменённые (тот же
+// тип/база/пользователь/адрес).
+func DiffPgHba(oldRules, newRules []*HbaRule) []HbaDiffEntry {
+	n, m := len(oldRules), len(newRules)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldRules[i].Key() == newRules[j].Key() {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	matchedOld := make([]bool, n)
+	matchedNew := make([]bool, m)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case oldRules[i].Key() == newRules[j].Key():
+			matchedOld[i], matchedNew[j] = true, true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	type positioned struct {
+		entry HbaDiffEntry
+		pos   float64
+	}
+	var entries []positioned
+
+	pair := func(status string, same func(a, b *HbaRule) bool) {
+		for i := 0; i < n; i++ {
+			if matchedOld[i] {
+				continue
+			}
+			for j := 0; j < m; j++ {
+				if !matchedNew[j] && same(oldRules[i], newRules[j]) {
+					matchedOld[i], matchedNew[j] = true, true
+					entries = append(entries, positioned{HbaDiffEntry{Status: status, Old: oldRules[i], New: newRules[j]}, float64(j)})
+					break
+				}
+			}
+		}
+	}
+	pair(HbaDiffMoved, func(a, b *HbaRule) bool { return a.Key() == b.Key() })
+	pair(HbaDiffModified, func(a, b *HbaRule) bool { return a.matchKey() == b.matchKey() })
+
+	for i := 0; i < n; i++ {
+		if !matchedOld[i] {
+			// Удалённое правило показываем рядом с тем местом, где оно стояло
+			entries = append(entries, positioned{HbaDiffEntry{Status: HbaDiffRemoved, Old: oldRules[i]}, float64(i) - 0.5})
+		}
+	}
+	for j := 0; j < m; j++ {
+		if !matchedNew[j] {
+			entries = append(entries, positioned{HbaDiffEntry{Status: HbaDiffAdded, New: newRules[j]}, float64(j)})
+		}
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].pos < entries[b].pos })
+	result := make([]HbaDiffEntry, len(entries))
+	for i, e := range entries {
+		result[i] = e.entry
+	}
+	return result
+}
+
+// LintPgHba проверяет правила: ошибки разбора, правила, перекрытые более
+// ранними (они никогда не сработают), trust и слишком широкие сети.
+func LintPgHba(hba *HbaFile) []HbaIssue {
+	var issues []HbaIssue
+
+	for _, e := range hba.Errors {
+		issues = append(issues, HbaIssue{Severity: HbaIssueError, Code: "parse", Message: e.Error()})
+	}
+
+	for i, rule := range hba.Rules {
+		for _, earlier := range hba.Rules[:i] {
+			if hbaRuleCovers(earlier, rule) {
+				issues = append(issues, HbaIssue{
+					Severity: HbaIssueError,
+					Code:     "shadowed",
+					Message:  fmt.Sprintf("правило никогда не сработает: его перекрывает %s (%s)", earlier.Location(), earlier.Raw),
+					Rule:     rule,
+				})
+				break
+			}
+		}
+
+		broad, why := hbaBroadAddress(rule)
+		if rule.Method == "trust" {
+			switch {
+			case rule.Type == "local":
+				issues = append(issues, HbaIssue{Severity: HbaIssueWarning, Code: "trust", Message: "trust для локальных подключений: любой пользователь ОС может войти под любой ролью", Rule: rule})
+			case broad:
+				issues = append(issues, HbaIssue{Severity: HbaIssueError, Code: "trust", Message: fmt.Sprintf("trust для %s: подключение без пароля из широкой сети", why), Rule: rule})
+			default:
+				issues = append(issues, HbaIssue{Severity: HbaIssueWarning, Code: "trust", Message: "trust: подключение по сети без аутентификации", Rule: rule})
+			}
+		} else if broad {
+			issues = append(issues, HbaIssue{Severity: HbaIssueWarning, Code: "broad-address", Message: fmt.Sprintf("слишком широкий адрес: %s", why), Rule: rule})
+		}
+
+		if rule.Method == "password" && rule.Type != "local" && rule.Type != "hostssl" {
+			issues = append(issues, HbaIssue{Severity: HbaIssueWarning, Code: "cleartext", Message: "password передаёт пароль открытым текстом без SSL", Rule: rule})
+		}
+	}
+	return issues
+}
+
+func hbaBroadAddress(rule *HbaRule) (bool, string) {
+	if rule.Type == "local" {
+		return false, ""
+	}
+	if rule.Address == "all" {
+		return true, "all (любой адрес)"
+	}
+	if rule.network == nil {
+		return false, ""
+	}
+	ones, bits := rule.network.Mask.Size()
+	if (bits == 32 && ones < hbaMinIPv4Prefix) || (bits == 128 && ones < hbaMinIPv6Prefix) {
+		return true, rule.network.String()
+	}
+	return false, ""
+}
+
+// hbaRuleCovers сообщает, выбирает ли правило a все подключения правила b.
+func hbaRuleCovers(a, b *HbaRule) bool {
+	if a.Type != b.Type && !(a.Type == "host" && b.Type != "local") {
+		return false
+	}
+	if !hbaTokensCover(a.Databases, b.Databases, true) || !hbaTokensCover(a.Users, b.Users, false) {
+		return false
+	}
+	if b.Type == "local" {
+		return true
+	}
+	return hbaAddressCovers(a, b)
+}
+
+func hbaTokensCover(a, b []HbaToken, databases bool) bool {
+	hasAll := false
+	for _, t := range a {
+		if !t.Quoted && t.Value == "all" {
+			hasAll = true
+		}
+	}
+
+	for _, t := range b {
+		// "all" не включает replication-подключения
+		if hasAll && !(databases && !t.Quoted && t.Value == "replication") {
+			continue
+		}
+		found := false
+		for _, candidate := range a {
+			if candidate == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hbaAddressCovers(a, b *HbaRule) bool {
+	if a.Address == "all" {
+		return true
+	}
+	if a.network != nil && b.network != nil {
+		aOnes, aBits := a.network.Mask.Size()
+		bOnes, bBits := b.network.Mask.Size()
+		return aBits == bBits && aOnes <= bOnes && a.network.Contains(b.network.IP)
+	}
+	return strings.EqualFold(a.AddressString(), b.AddressString())
+}
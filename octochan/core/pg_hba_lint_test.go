@@ -0,0 +1,119 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLintPgHba(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		codes   []string
+	}{
+		{
+			name: "clean",
+			content: `local all postgres peer
+hostssl app app 10.0.0.0/24 scram-sha-256`,
+		},
+		{
+			name: "shadowed by broader network",
+			content: `host all all 10.0.0.0/16 scram-sha-256
+host app app 10.0.1.0/24 md5`,
+			codes: []string{"shadowed"},
+		},
+		{
+			name: "host covers hostssl",
+			content: `host all all 10.0.0.0/24 md5
+hostssl app app 10.0.0.5/32 scram-sha-256`,
+			codes: []string{"shadowed"},
+		},
+		{
+			name: "all does not cover replication",
+			content: `host all all 10.0.0.0/24 scram-sha-256
+host replication repl 10.0.0.5/32 scram-sha-256`,
+		},
+		{
+			name:    "trust from all addresses",
+			content: `host all all all trust`,
+			codes:   []string{"trust"},
+		},
+		{
+			name:    "local trust",
+			content: `local all all trust`,
+			codes:   []string{"trust"},
+		},
+		{
+			name:    "broad network",
+			content: `host all all 10.0.0.0/8 scram-sha-256`,
+			codes:   []string{"broad-address"},
+		},
+		{
+			name:    "cleartext password",
+			content: `host app app 10.0.0.0/24 password`,
+			codes:   []string{"cleartext"},
+		},
+		{
+			name:    "parse error",
+			content: `host app`,
+			codes:   []string{"parse"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var codes []string
+			for _, issue := range LintPgHba(ParsePgHbaContent(tt.content, "pg_hba.conf")) {
+				codes = append(codes, issue.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.codes) {
+				t.Errorf("LintPgHba codes = %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
+
+func TestDiffPgHba(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		statuses []string
+	}{
+		{
+			name:     "unchanged",
+			old:      "local all all peer\nhost all all 10.0.0.0/24 md5",
+			new:      "local all all peer\nhost all all 10.0.0.0/24 md5",
+			statuses: nil,
+		},
+		{
+			name:     "added and removed",
+			old:      "local all all peer\nhost all all 10.0.0.0/24 md5",
+			new:      "local all all peer\nhost app app 10.0.1.0/24 scram-sha-256",
+			statuses: []string{HbaDiffRemoved, HbaDiffAdded},
+		},
+		{
+			name:     "method changed",
+			old:      "host all all 10.0.0.0/24 md5",
+			new:      "host all all 10.0.0.0/24 scram-sha-256",
+			statuses: []string{HbaDiffModified},
+		},
+		{
+			name:     "reordered",
+			old:      "local all all peer\nhost all all 10.0.0.0/24 md5\nhost app app 10.0.1.0/24 md5",
+			new:      "local all all peer\nhost app app 10.0.1.0/24 md5\nhost all all 10.0.0.0/24 md5",
+			statuses: []string{HbaDiffMoved},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldFile := ParsePgHbaContent(tt.old, "old")
+			newFile := ParsePgHbaContent(tt.new, "new")
+			var statuses []string
+			for _, entry := range DiffPgHba(oldFile.Rules, newFile.Rules) {
+				statuses = append(statuses, entry.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("DiffPgHba statuses = %v, want %v", statuses, tt.statuses)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	WorkloadOLTP    = "oltp"
+	WorkloadOLAP    = "olap"
+	WorkloadWeb     = "web"
+	WorkloadMixed   = "mixed"
+	WorkloadDesktop = "desktop"
+
+	StorageSSD = "ssd"
+	StorageHDD = "hdd"
+	StorageSAN = "san"
+)
+
+// TuneProfile - характеристики сервера для ochan tune.
+type TuneProfile struct {
+	RAM         float64 // байты
+	CPUs        int
+	Storage     string
+	Workload    string
+	Connections int
+}
+
+// TuneRecommendation - рекомендуемое значение параметра с пояснением.
+// Setting и Unit записываются в сценарий psql_tuning_params_se как есть.
+type TuneRecommendation struct {
+	Name    string `json:"name"`
+	Setting string `json:"setting"`
+	Unit    string `json:"unit"`
+	Reason  string `json:"reason"`
+	Restart bool   `json:"restart"`
+}
+
+func (r TuneRecommendation) Value() string {
+	return r.Setting + r.Unit
+}
+
+// TuneResult - итог расчёта: параметры и общие замечания по профилю.
+type TuneResult struct {
+	Profile         TuneProfile
+	Recommendations []TuneRecommendation
+	Notes           []string
+	Hugepages       bool
+}
+
+// NeedsRestart сообщает, требует ли хотя бы один параметр перезапуска.
+func (r *TuneResult) NeedsRestart() bool {
+	for _, rec := range r.Recommendations {
+		if rec.Restart {
+			return true
+		}
+	}
+	return false
+}
+
+var tuneWorkloads = map[string]string{
+	WorkloadOLTP:    "короткие транзакции, много соединений",
+	WorkloadOLAP:    "аналитика, тяжёлые запросы, мало соединений",
+	WorkloadWeb:     "веб-приложение, в основном чтение",
+	WorkloadMixed:   "смешанная нагрузка",
+	WorkloadDesktop: "рабочая станция разработчика",
+}
+
+var tuneStorages = map[string]bool{StorageSSD: true, StorageHDD: true, StorageSAN: true}
+
+// ParseTuneRAM разбирает объём памяти вида 64GB или 65536MB.
+func ParseTuneRAM(value string) (float64, error) {
+	amount, kind, ok := ParsePgValue("", value)
+	if !ok || kind != PgKindMemory {
+		return 0, fmt.Errorf("неверный объём памяти '%s', ожидается например 64GB", value)
+	}
+	if amount < 256*pgMemoryUnits["mb"] {
+		return 0, fmt.Errorf("объём памяти %s слишком мал, нужно не меньше 256MB", value)
+	}
+	return amount, nil
+}
+
+func (p TuneProfile) Validate() error {
+	var errs []string
+	if p.RAM <= 0 {
+		errs = append(errs, "не указан объём памяти (--ram)")
+	}
+	if p.CPUs <= 0 {
+		errs = append(errs, "число CPU должно быть больше 0")
+	}
+	if _, ok := tuneWorkloads[p.Workload]; !ok {
+		errs = append(errs, fmt.Sprintf("неизвестный тип нагрузки '%s' (oltp, olap, web, mixed, desktop)", p.Workload))
+	}
+	if !tuneStorages[p.Storage] {
+		errs = append(errs, fmt.Sprintf("неизвестный тип хранилища '%s' (ssd, hdd, san)", p.Storage))
+	}
+	if p.Connections <= 0 {
+		errs = append(errs, "число соединений должно быть больше 0")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RecommendPgTuning рассчитывает параметры по эвристикам pgtune: доля памяти
+// под shared_buffers и кеш ОС, бюджет work_mem на соединение, размер WAL по
+// типу нагрузки и стоимость случайного чтения по типу хранилища.
+func RecommendPgTuning(p TuneProfile) (*TuneResult, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	const (
+		kb = 1024.0
+		mb = 1024 * kb
+		gb = 1024 * mb
+	)
+	res := &TuneResult{Profile: p}
+	addSetting := func(name, setting, unit string, restart bool, reason string, args ...interface{}) {
+		res.Recommendations = append(res.Recommendations, TuneRecommendation{
+			Name:    name,
+			Setting: setting,
+			Unit:    unit,
+			Restart: restart,
+			Reason:  fmt.Sprintf(reason, args...),
+		})
+	}
+	add := func(name string, value float64, unit string, restart bool, reason string, args ...interface{}) {
+		addSetting(name, strconv.FormatFloat(value, 'f', -1, 64), unit, restart, reason, args...)
+	}
+	addMemory := func(name string, bytes float64, restart bool, reason string, args ...interface{}) {
+		value, unit := tuneMemory(bytes)
+		add(name, value, unit, restart, reason, args...)
+	}
+	ram := FormatPgMemory(math.Floor(p.RAM/mb) * mb)
+
+	// Соединения
+	add("max_connections", float64(p.Connections), "", true,
+		"задано --connections; каждое соединение - отдельный процесс с собственной памятью")
+	if p.Connections > 300 {
+		res.Notes = append(res.Notes, fmt.Sprintf(
+			"%d соединений - много для PostgreSQL: рассмотрите pgbouncer (psqlse_tuningpgbouncer) и уменьшение max_connections", p.Connections))
+	}
+
+	// Память
+	sharedBuffers := p.RAM / 4
+	sbReason := "25%% от RAM (%s): остальное остаётся под кеш ОС и память процессов"
+	if p.Workload == WorkloadDesktop {
+		sharedBuffers = p.RAM / 16
+		sbReason = "1/16 от RAM (%s): на рабочей станции память нужна другим приложениям"
+	}
+	sharedBuffers = tuneRound(sharedBuffers, mb)
+	addMemory("shared_buffers", sharedBuffers, true, sbReason, ram)
+
+	effectiveCache := p.RAM * 3 / 4
+	ecReason := "75%% от RAM (%s): оценка shared_buffers + кеш ОС, влияет только на выбор планов"
+	if p.Workload == WorkloadDesktop {
+		effectiveCache = p.RAM / 4
+		ecReason = "25%% от RAM (%s): на рабочей станции кеш ОС делится с другими приложениями"
+	}
+	addMemory("effective_cache_size", tuneRound(effectiveCache, mb), false, ecReason, ram)
+
+	maintenanceDivider := 16.0
+	if p.Workload == WorkloadOLAP {
+		maintenanceDivider = 8
+	}
+	maintenance := math.Min(tuneRound(p.RAM/maintenanceDivider, mb), 2*gb)
+	addMemory("maintenance_work_mem", maintenance, false,
+		"RAM/%g, не больше 2GB: ускоряет VACUUM, CREATE INDEX и восстановление FK", maintenanceDivider)
+
+	parallelPerGather := int(math.Ceil(float64(p.CPUs) / 2))
+	if p.Workload != WorkloadOLAP && parallelPerGather > 4 {
+		parallelPerGather = 4
+	}
+	if parallelPerGather < 1 {
+		parallelPerGather = 1
+	}
+
+	workMemDivider := map[string]float64{
+		WorkloadOLTP: 1, WorkloadWeb: 1, WorkloadOLAP: 2, WorkloadMixed: 2, WorkloadDesktop: 6,
+	}[p.Workload]
+	workMem := (p.RAM - sharedBuffers) / float64(p.Connections*3) / float64(parallelPerGather) / workMemDivider
+	workMem = math.Max(tuneRound(workMem, kb), 64*kb)
+	formula := fmt.Sprintf("(RAM - shared_buffers) / (%d соединений * 3 операции) / %d параллельных воркера", p.Connections, parallelPerGather)
+	if workMemDivider > 1 {
+		formula += fmt.Sprintf(" / %g", workMemDivider)
+	}
+	addMemory("work_mem", workMem, false,
+		"%s: лимит на одну сортировку или хеш, запрос может занять его несколько раз", formula)
+
+	// WAL и контрольные точки
+	walBuffers := sharedBuffers * 3 / 100
+	if walBuffers > 14*mb {
+		walBuffers = 16 * mb
+	}
+	walBuffers = math.Max(tuneRound(walBuffers, kb), 32*kb)
+	addMemory("wal_buffers", walBuffers, true,
+		"3%% от shared_buffers, не больше 16MB: больший буфер не даёт выигрыша")
+
+	walSizes := map[string][2]float64{
+		WorkloadOLTP:    {2 * gb, 8 * gb},
+		WorkloadOLAP:    {4 * gb, 16 * gb},
+		WorkloadWeb:     {1 * gb, 4 * gb},
+		WorkloadMixed:   {1 * gb, 4 * gb},
+		WorkloadDesktop: {100 * mb, 2 * gb},
+	}[p.Workload]
+	addMemory("min_wal_size", walSizes[0], false,
+		"для нагрузки %s: WAL-сегменты переиспользуются, а не создаются заново", p.Workload)
+	addMemory("max_wal_size", walSizes[1], false,
+		"для нагрузки %s: реже контрольные точки по объёму WAL, меньше full page writes", p.Workload)
+	add("checkpoint_completion_target", 0.9, "", false,
+		"запись контрольной точки растягивается на 90%% интервала, сглаживая пики ввода-вывода")
+	addSetting("wal_compression", "on", "", false,
+		"сжатие full page images уменьшает объём WAL ценой небольшой нагрузки на CPU")
+
+	// Хранилище и планировщик
+	switch p.Storage {
+	case StorageSSD:
+		add("random_page_cost", 1.1, "", false, "SSD: случайное чтение почти не дороже последовательного")
+		add("effective_io_concurrency", 200, "", false, "SSD выдерживает много параллельных запросов ввода-вывода")
+	case StorageSAN:
+		add("random_page_cost", 1.1, "", false, "SAN: случайное чтение почти не дороже последовательного, данные в кеше массива")
+		add("effective_io_concurrency", 300, "", false, "SAN выдерживает много параллельных запросов ввода-вывода")
+	case StorageHDD:
+		add("random_page_cost", 4, "", false, "HDD: случайное чтение требует перемещения головки")
+		add("effective_io_concurrency", 2, "", false, "HDD плохо обрабатывает параллельные запросы")
+	}
+	if p.Workload == WorkloadOLAP {
+		add("default_statistics_target", 500, "", false,
+			"аналитические запросы выигрывают от подробной статистики для планировщика")
+	} else {
+		add("default_statistics_target", 100, "", false,
+			"значения по умолчанию достаточно для простых запросов")
+	}
+
+	// Параллелизм
+	if p.CPUs >= 4 {
+		add("max_worker_processes", float64(p.CPUs), "", true, "по числу CPU (%d)", p.CPUs)
+		add("max_parallel_workers", float64(p.CPUs), "", false, "по числу CPU (%d)", p.CPUs)
+		add("max_parallel_workers_per_gather", float64(parallelPerGather), "", false,
+			"половина CPU (кроме olap - не больше 4): параллельные запросы не должны занимать весь сервер")
+		maintenanceWorkers := parallelPerGather
+		if maintenanceWorkers > 4 {
+			maintenanceWorkers = 4
+		}
+		add("max_parallel_maintenance_workers", float64(maintenanceWorkers), "", false,
+			"половина CPU, не больше 4: параллельное построение индексов")
+	}
+
+	// Autovacuum
+	autovacuumWorkers := p.CPUs / 4
+	if autovacuumWorkers < 3 {
+		autovacuumWorkers = 3
+	}
+	if autovacuumWorkers > 10 {
+		autovacuumWorkers = 10
+	}
+	add("autovacuum_max_workers", float64(autovacuumWorkers), "", true,
+		"CPU/4, от 3 до 10: больше таблиц обрабатываются одновременно")
+	if p.Storage == StorageHDD {
+		add("autovacuum_vacuum_cost_limit", 400, "", false,
+			"лимит делится между %d воркерами; HDD не выдержит агрессивной очистки", autovacuumWorkers)
+	} else {
+		add("autovacuum_vacuum_cost_limit", 2000, "", false,
+			"лимит делится между %d воркерами; быстрое хранилище позволяет чистить агрессивнее", autovacuumWorkers)
+	}
+
+	switch p.Workload {
+	case WorkloadOLTP, WorkloadWeb:
+		add("autovacuum_naptime", 15, "s", false,
+			"частые обновления: таблицы проверяются чаще, чем раз в минуту")
+		add("autovacuum_vacuum_scale_factor", 0.05, "", false,
+			"очистка после изменения 5%% строк, а не 20%%: меньше раздувание горячих таблиц")
+		add("autovacuum_analyze_scale_factor", 0.02, "", false,
+			"статистика обновляется после изменения 2%% строк")
+	case WorkloadOLAP:
+		add("autovacuum_vacuum_scale_factor", 0.1, "", false,
+			"большие таблицы: очистка после изменения 10%% строк")
+		add("autovacuum_analyze_scale_factor", 0.05, "", false,
+			"статистика обновляется после загрузки 5%% строк")
+	default:
+		add("autovacuum_vacuum_scale_factor", 0.1, "", false, "очистка после изменения 10%% строк")
+		add("autovacuum_analyze_scale_factor", 0.05, "", false, "статистика обновляется после изменения 5%% строк")
+	}
+
+	if sharedBuffers >= 8*gb {
+		res.Hugepages = true
+		res.Notes = append(res.Notes, fmt.Sprintf(
+			"shared_buffers %s: включён hugepages, это снижает накладные расходы на таблицы страниц", FormatPgMemory(sharedBuffers)))
+	}
+	if p.Workload != WorkloadDesktop && p.RAM < 2*gb {
+		res.Notes = append(res.Notes, "меньше 2GB RAM: рекомендации ориентировочные, проверьте потребление памяти под нагрузкой")
+	}
+
+	return res, nil
+}
+
+// tuneMemory выражает объём в наибольшей единице, в которой он целый.
+func tuneMemory(bytes float64) (float64, string) {
+	formatted := FormatPgMemory(bytes)
+	matches := pgValueRe.FindStringSubmatch(formatted)
+	value, _ := strconv.ParseFloat(matches[1], 64)
+	return value, matches[2]
+}
+
+func tuneRound(value, step float64) float64 {
+	return math.Floor(value/step) * step
+}
+
+// TuneScenario - сценарий psql_tuning_params_se в формате conf_pgg.json.
+type TuneScenario struct {
+	Service    string             `json:"service" yaml:"service"`
+	Parameters TuneScenarioParams `json:"parameters" yaml:"parameters"`
+	Targets    []TuneTarget       `json:"targets" yaml:"targets"`
+}
+
+type TuneScenarioParams struct {
+	Restart         bool        `json:"restart" yaml:"restart"`
+	Port            int         `json:"port" yaml:"port"`
+	Role            string      `json:"role" yaml:"role"`
+	IPReplics       string      `json:"ip_replics" yaml:"ip_replics"`
+	SvmIP           string      `json:"svm_ip" yaml:"svm_ip"`
+	SkipSMConflicts bool        `json:"skip_sm_conflicts" yaml:"skip_sm_conflicts"`
+	Hugepages       bool        `json:"hugepages" yaml:"hugepages"`
+	Parameters      []TuneParam `json:"parameters" yaml:"parameters"`
+}
+
+type TuneParam struct {
+	Name    string `json:"name" yaml:"name"`
+	Setting string `json:"setting" yaml:"setting"`
+	Unit    string `json:"unit" yaml:"unit"`
+}
+
+type TuneTarget struct {
+	SvmCI string `json:"svm_ci" yaml:"svm_ci"`
+}
+
+// Scenario собирает сценарий для apply --rlm. Параметры подключения берутся
+// из params, список параметров и hugepages - из рекомендаций.
+func (r *TuneResult) Scenario(params TuneScenarioParams, cis []string) *TuneScenario {
+	params.Hugepages = r.Hugepages
+	params.Parameters = nil
+	for _, rec := range r.Recommendations {
+		params.Parameters = append(params.Parameters, TuneParam{Name: rec.Name, Setting: rec.Setting, Unit: rec.Unit})
+	}
+
+	scenario := &TuneScenario{Service: "psql_tuning_params_se", Parameters: params}
+	for _, ci := range cis {
+		scenario.Targets = append(scenario.Targets, TuneTarget{SvmCI: ci})
+	}
+	return scenario
+}
@@ -0,0 +1,481 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	PgKindMemory = "memory"
+	PgKindTime   = "time"
+	PgKindReal   = "real"
+	PgKindBool   = "bool"
+)
+
+// PgParamInfo описывает тип GUC-параметра и его базовую единицу: в ней
+// PostgreSQL интерпретирует значение, заданное без суффикса.
+type PgParamInfo struct {
+	Kind string
+	Unit string
+}
+
+var pgParams = map[string]PgParamInfo{
+	// память, базовая единица B
+	"track_activity_query_size":         {PgKindMemory, "B"},
+	"log_parameter_max_length":          {PgKindMemory, "B"},
+	"log_parameter_max_length_on_error": {PgKindMemory, "B"},
+	"wal_segment_size":                  {PgKindMemory, "B"},
+
+	// память, базовая единица kB
+	"work_mem":                  {PgKindMemory, "kB"},
+	"maintenance_work_mem":      {PgKindMemory, "kB"},
+	"autovacuum_work_mem":       {PgKindMemory, "kB"},
+	"logical_decoding_work_mem": {PgKindMemory, "kB"},
+	"max_stack_depth":           {PgKindMemory, "kB"},
+	"temp_file_limit":           {PgKindMemory, "kB"},
+	"log_temp_files":            {PgKindMemory, "kB"},
+	"gin_pending_list_limit":    {PgKindMemory, "kB"},
+	"wal_skip_threshold":        {PgKindMemory, "kB"},
+	"huge_page_size":            {PgKindMemory, "kB"},
+	"vacuum_buffer_usage_limit": {PgKindMemory, "kB"},
+
+	// память, базовая единица - страница 8kB
+	"shared_buffers":               {PgKindMemory, "8kB"},
+	"effective_cache_size":         {PgKindMemory, "8kB"},
+	"temp_buffers":                 {PgKindMemory, "8kB"},
+	"wal_buffers":                  {PgKindMemory, "8kB"},
+	"checkpoint_flush_after":       {PgKindMemory, "8kB"},
+	"bgwriter_flush_after":         {PgKindMemory, "8kB"},
+	"backend_flush_after":          {PgKindMemory, "8kB"},
+	"wal_writer_flush_after":       {PgKindMemory, "8kB"},
+	"min_parallel_table_scan_size": {PgKindMemory, "8kB"},
+	"min_parallel_index_scan_size": {PgKindMemory, "8kB"},
+
+	// память, базовая единица MB
+	"max_wal_size":              {PgKindMemory, "MB"},
+	"min_wal_size":              {PgKindMemory, "MB"},
+	"wal_keep_size":             {PgKindMemory, "MB"},
+	"max_slot_wal_keep_size":    {PgKindMemory, "MB"},
+	"min_dynamic_shared_memory": {PgKindMemory, "MB"},
+
+	// время, базовая единица us
+	"commit_delay": {PgKindTime, "us"},
+
+	// время, базовая единица ms
+	"statement_timeout":                   {PgKindTime, "ms"},
+	"lock_timeout":                        {PgKindTime, "ms"},
+	"idle_in_transaction_session_timeout": {PgKindTime, "ms"},
+	"idle_session_timeout":                {PgKindTime, "ms"},
+	"transaction_timeout":                 {PgKindTime, "ms"},
+	"deadlock_timeout":                    {PgKindTime, "ms"},
+	"log_min_duration_statement":          {PgKindTime, "ms"},
+	"log_min_duration_sample":             {PgKindTime, "ms"},
+	"log_autovacuum_min_duration":         {PgKindTime, "ms"},
+	"log_startup_progress_interval":       {PgKindTime, "ms"},
+	"autovacuum_vacuum_cost_delay":        {PgKindTime, "ms"},
+	"vacuum_cost_delay":                   {PgKindTime, "ms"},
+	"bgwriter_delay":                      {PgKindTime, "ms"},
+	"wal_writer_delay":                    {PgKindTime, "ms"},
+	"max_standby_archive_delay":           {PgKindTime, "ms"},
+	"max_standby_streaming_delay":         {PgKindTime, "ms"},
+	"wal_receiver_timeout":                {PgKindTime, "ms"},
+	"wal_sender_timeout":                  {PgKindTime, "ms"},
+	"wal_retrieve_retry_interval":         {PgKindTime, "ms"},
+	"recovery_min_apply_delay":            {PgKindTime, "ms"},
+	"tcp_user_timeout":                    {PgKindTime, "ms"},
+	"client_connection_check_interval":    {PgKindTime, "ms"},
+
+	// время, базовая единица s
+	"archive_timeout":              {PgKindTime, "s"},
+	"checkpoint_timeout":           {PgKindTime, "s"},
+	"checkpoint_warning":           {PgKindTime, "s"},
+	"authentication_timeout":       {PgKindTime, "s"},
+	"autovacuum_naptime":           {PgKindTime, "s"},
+	"wal_receiver_status_interval": {PgKindTime, "s"},
+	"tcp_keepalives_idle":          {PgKindTime, "s"},
+	"tcp_keepalives_interval":      {PgKindTime, "s"},
+
+	// время, базовая единица min
+	"log_rotation_age":       {PgKindTime, "min"},
+	"old_snapshot_threshold": {PgKindTime, "min"},
+
+	// вещественные
+	"random_page_cost":                      {PgKindReal, ""},
+	"seq_page_cost":                         {PgKindReal, ""},
+	"cpu_tuple_cost":                        {PgKindReal, ""},
+	"cpu_index_tuple_cost":                  {PgKindReal, ""},
+	"cpu_operator_cost":                     {PgKindReal, ""},
+	"parallel_tuple_cost":                   {PgKindReal, ""},
+	"parallel_setup_cost":                   {PgKindReal, ""},
+	"jit_above_cost":                        {PgKindReal, ""},
+	"jit_inline_above_cost":                 {PgKindReal, ""},
+	"jit_optimize_above_cost":               {PgKindReal, ""},
+	"checkpoint_completion_target":          {PgKindReal, ""},
+	"autovacuum_vacuum_scale_factor":        {PgKindReal, ""},
+	"autovacuum_analyze_scale_factor":       {PgKindReal, ""},
+	"autovacuum_vacuum_insert_scale_factor": {PgKindReal, ""},
+	"hash_mem_multiplier":                   {PgKindReal, ""},
+	"bgwriter_lru_multiplier":               {PgKindReal, ""},
+	"cursor_tuple_fraction":                 {PgKindReal, ""},
+	"geqo_selection_bias":                   {PgKindReal, ""},
+	"geqo_seed":                             {PgKindReal, ""},
+	"log_statement_sample_rate":             {PgKindReal, ""},
+	"log_transaction_sample_rate":           {PgKindReal, ""},
+
+	// логические
+	"autovacuum":                  {PgKindBool, ""},
+	"fsync":                       {PgKindBool, ""},
+	"full_page_writes":            {PgKindBool, ""},
+	"wal_log_hints":               {PgKindBool, ""},
+	"hot_standby":                 {PgKindBool, ""},
+	"hot_standby_feedback":        {PgKindBool, ""},
+	"ssl":                         {PgKindBool, ""},
+	"jit":                         {PgKindBool, ""},
+	"log_checkpoints":             {PgKindBool, ""},
+	"log_connections":             {PgKindBool, ""},
+	"log_disconnections":          {PgKindBool, ""},
+	"log_lock_waits":              {PgKindBool, ""},
+	"log_hostname":                {PgKindBool, ""},
+	"log_duration":                {PgKindBool, ""},
+	"logging_collector":           {PgKindBool, ""},
+	"log_truncate_on_rotation":    {PgKindBool, ""},
+	"track_activities":            {PgKindBool, ""},
+	"track_counts":                {PgKindBool, ""},
+	"track_io_timing":             {PgKindBool, ""},
+	"track_wal_io_timing":         {PgKindBool, ""},
+	"track_commit_timestamp":      {PgKindBool, ""},
+	"data_sync_retry":             {PgKindBool, ""},
+	"restart_after_crash":         {PgKindBool, ""},
+	"standard_conforming_strings": {PgKindBool, ""},
+	"wal_init_zero":               {PgKindBool, ""},
+	"wal_recycle":                 {PgKindBool, ""},
+}
+
+// pgDefaults - значения по умолчанию PostgreSQL 16 для параметров, которые
+// обычно тюнингуют. Ими откатываются параметры, не заданные явно до изменения.
+var pgDefaults = map[string]string{
+	"max_connections":                  "100",
+	"superuser_reserved_connections":   "3",
+	"shared_buffers":                   "128MB",
+	"huge_pages":                       "try",
+	"temp_buffers":                     "8MB",
+	"max_prepared_transactions":        "0",
+	"work_mem":                         "4MB",
+	"hash_mem_multiplier":              "2",
+	"maintenance_work_mem":             "64MB",
+	"autovacuum_work_mem":              "-1",
+	"logical_decoding_work_mem":        "64MB",
+	"max_stack_depth":                  "2MB",
+	"temp_file_limit":                  "-1",
+	"effective_cache_size":             "4GB",
+	"effective_io_concurrency":         "1",
+	"maintenance_io_concurrency":       "10",
+	"max_worker_processes":             "8",
+	"max_parallel_workers":             "8",
+	"max_parallel_workers_per_gather":  "2",
+	"max_parallel_maintenance_workers": "2",
+	"default_statistics_target":        "100",
+	"random_page_cost":                 "4",
+	"seq_page_cost":                    "1",
+	"cpu_tuple_cost":                   "0.01",
+	"cpu_index_tuple_cost":             "0.005",
+	"cpu_operator_cost":                "0.0025",
+	"parallel_tuple_cost":              "0.1",
+	"parallel_setup_cost":              "1000",
+	"jit":                              "on",
+
+	"wal_level":                    "replica",
+	"wal_buffers":                  "-1",
+	"wal_compression":              "off",
+	"wal_log_hints":                "off",
+	"wal_writer_delay":             "200ms",
+	"commit_delay":                 "0",
+	"synchronous_commit":           "on",
+	"checkpoint_timeout":           "5min",
+	"checkpoint_completion_target": "0.9",
+	"checkpoint_warning":           "30s",
+	"max_wal_size":                 "1GB",
+	"min_wal_size":                 "80MB",
+	"wal_keep_size":                "0",
+	"max_slot_wal_keep_size":       "-1",
+	"max_wal_senders":              "10",
+	"max_replication_slots":        "10",
+	"hot_standby":                  "on",
+	"hot_standby_feedback":         "off",
+	"max_standby_archive_delay":    "30s",
+	"max_standby_streaming_delay":  "30s",
+	"wal_receiver_timeout":         "1min",
+	"wal_sender_timeout":           "1min",
+	"archive_timeout":              "0",
+
+	"bgwriter_delay":          "200ms",
+	"bgwriter_lru_maxpages":   "100",
+	"bgwriter_lru_multiplier": "2",
+
+	"autovacuum":                      "on",
+	"autovacuum_max_workers":          "3",
+	"autovacuum_naptime":              "1min",
+	"autovacuum_vacuum_scale_factor":  "0.2",
+	"autovacuum_analyze_scale_factor": "0.1",
+	"autovacuum_vacuum_cost_delay":    "2ms",
+	"autovacuum_vacuum_cost_limit":    "-1",
+	"vacuum_cost_delay":               "0",
+	"vacuum_cost_limit":               "200",
+
+	"statement_timeout":                   "0",
+	"lock_timeout":                        "0",
+	"idle_in_transaction_session_timeout": "0",
+	"idle_session_timeout":                "0",
+	"deadlock_timeout":                    "1s",
+	"max_locks_per_transaction":           "64",
+
+	"log_min_duration_statement":  "-1",
+	"log_autovacuum_min_duration": "10min",
+	"log_checkpoints":             "on",
+	"log_connections":             "off",
+	"log_disconnections":          "off",
+	"log_lock_waits":              "off",
+	"log_temp_files":              "-1",
+	"track_io_timing":             "off",
+	"track_activity_query_size":   "1kB",
+}
+
+// PgDefaultValue - значение параметра по умолчанию. Встроенный справочник,
+// как и pg_units, дополняется в config.yaml:
+//
+//	pg_defaults:
+//	  pangolin.audit_mode: "off"
+func PgDefaultValue(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if value, ok := viper.GetStringMapString("pg_defaults")[name]; ok && value != "" {
+		return value, true
+	}
+	value, ok := pgDefaults[name]
+	return value, ok
+}
+
+var (
+	pgValueRe = regexp.MustCompile(`^(-?\d+(?:\.\d+)?(?:[eE][-+]?\d+)?)\s*([a-zA-Z]*)$`)
+
+	pgMemoryUnits = map[string]float64{
+		"b":   1,
+		"kb":  1024,
+		"8kb": 8 * 1024,
+		"mb":  1024 * 1024,
+		"gb":  1024 * 1024 * 1024,
+		"tb":  1024 * 1024 * 1024 * 1024,
+	}
+
+	// время хранится в миллисекундах
+	pgTimeUnits = map[string]float64{
+		"us":  0.001,
+		"ms":  1,
+		"s":   1000,
+		"min": 60 * 1000,
+		"h":   60 * 60 * 1000,
+		"d":   24 * 60 * 60 * 1000,
+	}
+
+	pgBoolValues = map[string]string{
+		"on": "on", "off": "off",
+		"true": "on", "false": "off",
+		"yes": "on", "no": "off",
+		"1": "on", "0": "off",
+	}
+)
+
+// LookupPgParam возвращает описание параметра. Встроенный справочник можно
+// дополнить в config.yaml секцией pg_units (например, для параметров Pangolin):
+//
+//	pg_units:
+//	  auth_activity_period: s
+//	  performance_insights.sampling_period: ms
+func LookupPgParam(name string) (PgParamInfo, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if unit, ok := viper.GetStringMapString("pg_units")[name]; ok && unit != "" {
+		return pgParamInfoFromUnit(unit), true
+	}
+
+	if info, ok := pgParams[name]; ok {
+		return info, true
+	}
+	if strings.HasPrefix(name, "enable_") {
+		return PgParamInfo{Kind: PgKindBool}, true
+	}
+	return PgParamInfo{}, false
+}
+
+func pgParamInfoFromUnit(unit string) PgParamInfo {
+	lower := strings.ToLower(unit)
+	switch {
+	case lower == "bool":
+		return PgParamInfo{Kind: PgKindBool}
+	case lower == "real":
+		return PgParamInfo{Kind: PgKindReal}
+	case pgMemoryUnits[lower] > 0:
+		return PgParamInfo{Kind: PgKindMemory, Unit: unit}
+	case pgTimeUnits[lower] > 0:
+		return PgParamInfo{Kind: PgKindTime, Unit: lower}
+	}
+	return PgParamInfo{}
+}
+
+// ParsePgValue переводит значение параметра в базовую величину: байты для
+// памяти и миллисекунды для времени. Значение без единицы трактуется в
+// базовой единице параметра, как это делает сам PostgreSQL.
+func ParsePgValue(name, value string) (float64, string, bool) {
+	clean := cleanPgValue(value)
+	if clean == "" {
+		return 0, "", false
+	}
+
+	info, known := LookupPgParam(name)
+	matches := pgValueRe.FindStringSubmatch(clean)
+	if matches == nil {
+		return 0, "", false
+	}
+
+	num, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, "", false
+	}
+	unit := strings.ToLower(matches[2])
+
+	if unit == "" {
+		if !known || info.Unit == "" {
+			if known && info.Kind == PgKindBool {
+				return 0, "", false
+			}
+			return num, PgKindReal, true
+		}
+		unit = strings.ToLower(info.Unit)
+	}
+
+	if multiplier, ok := pgMemoryUnits[unit]; ok && (!known || info.Kind == PgKindMemory) {
+		return num * multiplier, PgKindMemory, true
+	}
+	if multiplier, ok := pgTimeUnits[unit]; ok && (!known || info.Kind == PgKindTime) {
+		return num * multiplier, PgKindTime, true
+	}
+	return 0, "", false
+}
+
+// NormalizeParamValue приводит значение к каноническому виду с учётом
+// базовой единицы параметра, чтобы 3min и 180 для archive_timeout или
+// 32768kB и 32MB для work_mem считались одинаковыми.
+func NormalizeParamValue(name string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	clean := cleanPgValue(fmt.Sprintf("%v", value))
+	if clean == "" {
+		return nil
+	}
+
+	info, known := LookupPgParam(name)
+	if known && info.Kind == PgKindBool {
+		if canonical, ok := pgBoolValues[strings.ToLower(clean)]; ok {
+			return canonical
+		}
+		return strings.ToLower(clean)
+	}
+
+	// -1 у параметров с единицами означает "без ограничения"/"выключено"
+	if clean == "-1" {
+		return clean
+	}
+
+	if amount, kind, ok := ParsePgValue(name, clean); ok {
+		// 0 - тоже "выключено", в какой бы единице он ни был записан
+		if amount == 0 {
+			return "0"
+		}
+		switch kind {
+		case PgKindMemory:
+			return FormatPgMemory(amount)
+		case PgKindTime:
+			return FormatPgDuration(amount)
+		case PgKindReal:
+			return strconv.FormatFloat(amount, 'f', -1, 64)
+		}
+	}
+
+	return Normalize_value(clean)
+}
+
+// FormatPgSetting переводит строку pg_settings - число setting в единицах
+// unit (16384 и 8kB) - в значение для postgresql.conf (128MB). Значения без
+// единицы и -1 возвращаются как есть.
+func FormatPgSetting(setting, unit string) string {
+	setting = strings.TrimSpace(setting)
+	unit = strings.TrimSpace(unit)
+	num, err := strconv.ParseFloat(setting, 64)
+	if err != nil || unit == "" || num == -1 {
+		return setting
+	}
+	if num == 0 {
+		return "0"
+	}
+	if multiplier, ok := pgMemoryUnits[strings.ToLower(unit)]; ok {
+		return FormatPgMemory(num * multiplier)
+	}
+	if multiplier, ok := pgTimeUnits[strings.ToLower(unit)]; ok {
+		return FormatPgDuration(num * multiplier)
+	}
+	return setting + unit
+}
+
+// FormatPgMemory выводит объём в наибольшей единице, на которую он делится нацело.
+func FormatPgMemory(bytes float64) string {
+	units := []struct {
+		name string
+		size float64
+	}{
+		{"TB", pgMemoryUnits["tb"]},
+		{"GB", pgMemoryUnits["gb"]},
+		{"MB", pgMemoryUnits["mb"]},
+		{"kB", pgMemoryUnits["kb"]},
+	}
+	for _, u := range units {
+		if bytes != 0 && math.Mod(bytes, u.size) == 0 {
+			return fmt.Sprintf("%.0f%s", bytes/u.size, u.name)
+		}
+	}
+	return fmt.Sprintf("%.0fB", bytes)
+}
+
+// FormatPgDuration выводит длительность (в миллисекундах) в наибольшей
+// единице, на которую она делится нацело.
+func FormatPgDuration(ms float64) string {
+	units := []struct {
+		name string
+		size float64
+	}{
+		{"d", pgTimeUnits["d"]},
+		{"h", pgTimeUnits["h"]},
+		{"min", pgTimeUnits["min"]},
+		{"s", pgTimeUnits["s"]},
+		{"ms", pgTimeUnits["ms"]},
+	}
+	for _, u := range units {
+		if ms != 0 && math.Mod(ms, u.size) == 0 {
+			return fmt.Sprintf("%.0f%s", ms/u.size, u.name)
+		}
+	}
+	return fmt.Sprintf("%.0fus", ms*1000)
+}
+
+func cleanPgValue(value string) string {
+	if idx := strings.Index(value, "#"); idx >= 0 {
+		value = value[:idx]
+	}
+	value = strings.TrimSpace(value)
+	return strings.TrimSpace(strings.Trim(value, "'\""))
+}
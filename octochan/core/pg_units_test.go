@@ -0,0 +1,90 @@
+package core
+
+import "testing"
+
+func TestParsePgValue(t *testing.T) {
+	tests := []struct {
+		name, param, value string
+		want               float64
+		kind               string
+		ok                 bool
+	}{
+		{"memory with unit", "work_mem", "4MB", 4 * 1024 * 1024, PgKindMemory, true},
+		{"memory in base kB", "work_mem", "4096", 4096 * 1024, PgKindMemory, true},
+		{"memory in 8kB pages", "shared_buffers", "16384", 16384 * 8192, PgKindMemory, true},
+		{"quoted with comment", "shared_buffers", "'128MB' # comment", 128 * 1024 * 1024, PgKindMemory, true},
+		{"time with unit", "archive_timeout", "3min", 180000, PgKindTime, true},
+		{"time in base s", "archive_timeout", "180", 180000, PgKindTime, true},
+		{"unknown unitless", "some_param", "1.5", 1.5, PgKindReal, true},
+		{"bool is not a number", "enable_seqscan", "1", 0, "", false},
+		{"memory unit on time param", "archive_timeout", "5MB", 0, "", false},
+		{"garbage", "work_mem", "lots", 0, "", false},
+		{"empty", "work_mem", "", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, kind, ok := ParsePgValue(tt.param, tt.value)
+			if ok != tt.ok || kind != tt.kind || got != tt.want {
+				t.Errorf("ParsePgValue(%q, %q) = %v, %q, %v; want %v, %q, %v",
+					tt.param, tt.value, got, kind, ok, tt.want, tt.kind, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNormalizeParamValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		a, b  interface{}
+		equal bool
+	}{
+		{"kB and MB", "work_mem", "32768kB", "32MB", true},
+		{"base unit and suffix", "archive_timeout", "180", "3min", true},
+		{"8kB pages", "shared_buffers", "16384", "128MB", true},
+		{"different sizes", "work_mem", "4MB", "8MB", false},
+		{"zero with and without unit", "work_mem", "0", "0kB", true},
+		{"zero time", "archive_timeout", "0", "0s", true},
+		{"minus one kept", "log_temp_files", "-1", "-1", true},
+		{"bool synonyms", "enable_seqscan", "true", "on", true},
+		{"bool differs", "enable_seqscan", "off", "on", false},
+		{"number from yaml", "max_connections", 100, "100", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := NormalizeParamValue(tt.param, tt.a), NormalizeParamValue(tt.param, tt.b)
+			if (a == b) != tt.equal {
+				t.Errorf("NormalizeParamValue(%q): %v -> %v, %v -> %v; equal = %v, want %v",
+					tt.param, tt.a, a, tt.b, b, a == b, tt.equal)
+			}
+		})
+	}
+}
+
+func TestFormatPgMemoryAndDuration(t *testing.T) {
+	memory := map[float64]string{
+		0:                  "0B",
+		512:                "512B",
+		1024:               "1kB",
+		1536:               "1536B",
+		128 * 1024 * 1024:  "128MB",
+		1024 * 1024 * 1024: "1GB",
+	}
+	for bytes, want := range memory {
+		if got := FormatPgMemory(bytes); got != want {
+			t.Errorf("FormatPgMemory(%v) = %q, want %q", bytes, got, want)
+		}
+	}
+
+	durations := map[float64]string{
+		1500:    "1500ms",
+		60000:   "1min",
+		3600000: "1h",
+		0.5:     "500us",
+	}
+	for ms, want := range durations {
+		if got := FormatPgDuration(ms); got != want {
+			t.Errorf("FormatPgDuration(%v) = %q, want %q", ms, got, want)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo:    0,
+	SeverityWarning: 1,
+	SeverityError:   2,
+}
+
+// ParseSeverity приводит severity к каноническому виду ("Error" -> "error")
+// и отклоняет неизвестные значения.
+func ParseSeverity(severity string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(severity))
+	if _, ok := severityRank[normalized]; !ok {
+		return "", fmt.Errorf("неизвестная severity '%s', допустимые значения: %s, %s, %s",
+			severity, SeverityError, SeverityWarning, SeverityInfo)
+	}
+	return normalized, nil
+}
+
+// Policy - набор правил проверки конфига (validate --rules).
+//
+//	vars:
+//	  ram: 64GB
+//	rules:
+//	  - param: shared_buffers
+//	    min: 128MB
+//	    max: 16GB
+//	  - param: wal_level
+//	    enum: [replica, logical]
+//	  - name: memory-budget
+//	    expr: max_connections * work_mem < 0.5 * ram
+//	    severity: warning
+//	  - name: archive
+//	    when: archive_mode == on
+//	    require: [archive_command]
+type Policy struct {
+	Vars  map[string]string `yaml:"vars"`
+	Rules []PolicyRule      `yaml:"rules"`
+}
+
+type PolicyRule struct {
+	Name      string   `yaml:"name"`
+	Param     string   `yaml:"param"`
+	Severity  string   `yaml:"severity"`
+	Message   string   `yaml:"message"`
+	Required  bool     `yaml:"required"`
+	Forbidden bool     `yaml:"forbidden"`
+	Enum      []string `yaml:"enum"`
+	Min       string   `yaml:"min"`
+	Max       string   `yaml:"max"`
+	Regex     string   `yaml:"regex"`
+	When      string   `yaml:"when"`
+	Expr      string   `yaml:"expr"`
+	Require   []string `yaml:"require"`
+
+	regex *regexp.Regexp
+	when  Expr
+	expr  Expr
+}
+
+type PolicyViolation struct {
+	Rule     string `json:"rule"`
+	Param    string `json:"param,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Value    string `json:"value,omitempty"`
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл правил: %w", err)
+	}
+
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("ошибка разбора файла правил: %w", err)
+	}
+	if err := policy.Compile(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Compile проверяет правила и заранее разбирает регулярные выражения и
+// выражения when/expr, собирая все ошибки сразу.
+func (p *Policy) Compile() error {
+	var errs []string
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = rule.Param
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if rule.Severity == "" {
+			rule.Severity = SeverityError
+		}
+		if _, ok := severityRank[rule.Severity]; !ok {
+			errs = append(errs, fmt.Sprintf("%s: неизвестная severity '%s'", rule.Name, rule.Severity))
+		}
+		if rule.Param == "" && rule.Expr == "" && len(rule.Require) == 0 {
+			errs = append(errs, fmt.Sprintf("%s: нужно указать param, expr или require", rule.Name))
+		}
+
+		var err error
+		if rule.Regex != "" {
+			if rule.regex, err = regexp.Compile(rule.Regex); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: неверное регулярное выражение: %v", rule.Name, err))
+			}
+		}
+		if rule.When != "" {
+			if rule.when, err = ParseExpr(rule.When); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: when: %v", rule.Name, err))
+			}
+		}
+		if rule.Expr != "" {
+			if rule.expr, err = ParseExpr(rule.Expr); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: expr: %v", rule.Name, err))
+			}
+		}
+		for _, bound := range []string{rule.Min, rule.Max} {
+			if bound != "" {
+				if _, _, ok := ParsePgValue(rule.Param, bound); !ok {
+					errs = append(errs, fmt.Sprintf("%s: неверная граница '%s'", rule.Name, bound))
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("ошибки в файле правил:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// Evaluate проверяет конфиг и возвращает нарушения, отсортированные по
+// убыванию серьёзности.
+func (p *Policy) Evaluate(config map[string]map[string]string) []PolicyViolation {
+	env := p.Env(config)
+	var violations []PolicyViolation
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		violate := func(param, value, message string) {
+			if rule.Message != "" {
+				message = rule.Message + " (" + message + ")"
+			}
+			violations = append(violations, PolicyViolation{Rule: rule.Name, Param: param, Severity: rule.Severity, Message: message, Value: value})
+		}
+
+		if rule.when != nil {
+			cond, err := rule.when.Eval(env)
+			if err != nil {
+				violate("", "", fmt.Sprintf("ошибка вычисления when: %v", err))
+				continue
+			}
+			if !cond.Truthy() {
+				continue
+			}
+		}
+
+		for _, name := range rule.Require {
+			if value, ok := LookupConfigParam(config, name); !ok || cleanPgValue(value) == "" {
+				message := fmt.Sprintf("параметр %s обязателен", name)
+				if rule.When != "" {
+					message += fmt.Sprintf(" при условии '%s'", rule.When)
+				}
+				violate(name, "", message)
+			}
+		}
+
+		if rule.Param != "" {
+			p.checkParam(rule, config, violate)
+		}
+
+		if rule.expr != nil {
+			result, err := rule.expr.Eval(env)
+			if err != nil {
+				violate("", "", fmt.Sprintf("ошибка вычисления '%s': %v", rule.Expr, err))
+			} else if !result.Truthy() {
+				violate("", "", fmt.Sprintf("не выполняется условие '%s'", rule.Expr))
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return severityRank[violations[i].Severity] > severityRank[violations[j].Severity]
+	})
+	return violations
+}
+
+func (p *Policy) checkParam(rule *PolicyRule, config map[string]map[string]string, violate func(param, value, message string)) {
+	value, exists := LookupConfigParam(config, rule.Param)
+	if !exists {
+		if rule.Required {
+			violate(rule.Param, "", "обязательный параметр не задан")
+		}
+		return
+	}
+	if rule.Forbidden {
+		violate(rule.Param, value, "параметр запрещён")
+		return
+	}
+
+	clean := cleanPgValue(value)
+	if len(rule.Enum) > 0 {
+		allowed := false
+		for _, candidate := range rule.Enum {
+			if ExprEqual(ParamExprValue(rule.Param, clean), ParamExprValue(rule.Param, candidate)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			violate(rule.Param, value, fmt.Sprintf("значение '%s' не входит в %v", clean, rule.Enum))
+		}
+	}
+
+	if rule.Min != "" || rule.Max != "" {
+		amount, _, ok := ParsePgValue(rule.Param, clean)
+		if !ok {
+			violate(rule.Param, value, fmt.Sprintf("значение '%s' не является числом", clean))
+		} else {
+			if min, _, ok := ParsePgValue(rule.Param, rule.Min); ok && rule.Min != "" && amount < min {
+				violate(rule.Param, value, fmt.Sprintf("значение %s меньше минимума %s", clean, rule.Min))
+			}
+			if max, _, ok := ParsePgValue(rule.Param, rule.Max); ok && rule.Max != "" && amount > max {
+				violate(rule.Param, value, fmt.Sprintf("значение %s больше максимума %s", clean, rule.Max))
+			}
+		}
+	}
+
+	if rule.regex != nil && !rule.regex.MatchString(clean) {
+		violate(rule.Param, value, fmt.Sprintf("значение '%s' не соответствует %s", clean, rule.Regex))
+	}
+}
+
+// Env строит окружение выражений: переменные из vars и параметры конфига.
+// Переменные из vars имеют приоритет.
+func (p *Policy) Env(config map[string]map[string]string) *ExprEnv {
+	return &ExprEnv{
+		Resolve: func(name string) (ExprValue, bool) {
+			if raw, ok := p.Vars[name]; ok {
+				return ParamExprValue("", raw), true
+			}
+			if raw, ok := LookupConfigParam(config, name); ok {
+				return ParamExprValue(name, raw), true
+			}
+			return NullValue(), false
+		},
+	}
+}
+
+// HasFailures сообщает, есть ли нарушения уровня threshold и выше.
+func HasFailures(violations []PolicyViolation, threshold string) bool {
+	for _, v := range violations {
+		if severityRank[v.Severity] >= severityRank[threshold] {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupConfigParam ищет параметр без учёта регистра. Имя с точкой сначала
+// ищется целиком (auto_explain.log_min_duration в postgresql.conf), затем
+// как section.param.
+func LookupConfigParam(config map[string]map[string]string, name string) (string, bool) {
+	find := func(section, key string) (string, bool) {
+		params, ok := config[section]
+		if !ok {
+			return "", false
+		}
+		if value, ok := params[key]; ok {
+			return value, true
+		}
+		for k, value := range params {
+			if strings.EqualFold(k, key) {
+				return value, true
+			}
+		}
+		return "", false
+	}
+
+	if value, ok := find("", name); ok {
+		return value, true
+	}
+	if idx := strings.Index(name, "."); idx > 0 {
+		return find(name[:idx], name[idx+1:])
+	}
+	return "", false
+}
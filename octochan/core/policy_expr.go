@@ -0,0 +1,838 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	ExprNull = iota
+	ExprNumber
+	ExprString
+	ExprBool
+	ExprList
+)
+
+// ExprValue - значение выражения. Числа с единицами хранятся в базовых
+// величинах (байты, миллисекунды), Unit хранит вид (PgKindMemory/PgKindTime)
+// для сравнения и вывода.
+type ExprValue struct {
+	Kind int
+	Num  float64
+	Str  string
+	Bool bool
+	Unit string
+	List []ExprValue
+}
+
+func NullValue() ExprValue            { return ExprValue{Kind: ExprNull} }
+func NumberValue(n float64) ExprValue { return ExprValue{Kind: ExprNumber, Num: n} }
+func StringValue(s string) ExprValue  { return ExprValue{Kind: ExprString, Str: s} }
+func BoolValue(b bool) ExprValue      { return ExprValue{Kind: ExprBool, Bool: b} }
+func ListValue(items []ExprValue) ExprValue {
+	return ExprValue{Kind: ExprList, List: items}
+}
+func unitValue(n float64, unit string) ExprValue {
+	return ExprValue{Kind: ExprNumber, Num: n, Unit: unit}
+}
+
+// ParamExprValue превращает значение параметра конфига в значение выражения:
+// размеры и длительности - в числа в базовых единицах, остальное - в строку.
+func ParamExprValue(name, raw string) ExprValue {
+	if amount, kind, ok := ParsePgValue(name, raw); ok {
+		if kind == PgKindReal {
+			kind = ""
+		}
+		return unitValue(amount, kind)
+	}
+	return StringValue(cleanPgValue(raw))
+}
+
+func (v ExprValue) String() string {
+	switch v.Kind {
+	case ExprNumber:
+		switch v.Unit {
+		case PgKindMemory:
+			return FormatPgMemory(v.Num)
+		case PgKindTime:
+			return FormatPgDuration(v.Num)
+		}
+		return strconv.FormatFloat(v.Num, 'f', -1, 64)
+	case ExprString:
+		return v.Str
+	case ExprBool:
+		if v.Bool {
+			return "on"
+		}
+		return "off"
+	case ExprList:
+		items := make([]string, len(v.List))
+		for i, item := range v.List {
+			items[i] = item.String()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return "N/A"
+}
+
+// Truthy: on/true/yes и ненулевые числа - истина, null - ложь.
+func (v ExprValue) Truthy() bool {
+	switch v.Kind {
+	case ExprBool:
+		return v.Bool
+	case ExprNumber:
+		return v.Num != 0
+	case ExprString:
+		if b, ok := exprBool(v); ok {
+			return b
+		}
+		return v.Str != ""
+	case ExprList:
+		return len(v.List) > 0
+	}
+	return false
+}
+
+// ExprFunc - функция, доступная в выражениях.
+type ExprFunc func(args []ExprValue) (ExprValue, error)
+
+// ExprEnv задаёт имена и функции, доступные выражению.
+type ExprEnv struct {
+	Resolve func(name string) (ExprValue, bool)
+	Funcs   map[string]ExprFunc
+}
+
+func (env *ExprEnv) lookup(name string) (ExprValue, bool) {
+	if env == nil || env.Resolve == nil {
+		return NullValue(), false
+	}
+	return env.Resolve(name)
+}
+
+// Expr - разобранное выражение.
+type Expr interface {
+	Eval(env *ExprEnv) (ExprValue, error)
+}
+
+type literalExpr struct{ value ExprValue }
+type identExpr struct{ name string }
+type unaryExpr struct {
+	op      string
+	operand Expr
+}
+type binaryExpr struct {
+	op          string
+	left, right Expr
+}
+type callExpr struct {
+	name string
+	args []Expr
+}
+type listExpr struct{ items []Expr }
+
+func (e listExpr) Eval(env *ExprEnv) (ExprValue, error) {
+	items := make([]ExprValue, len(e.items))
+	for i, item := range e.items {
+		v, err := item.Eval(env)
+		if err != nil {
+			return NullValue(), err
+		}
+		items[i] = v
+	}
+	return ListValue(items), nil
+}
+
+func (e literalExpr) Eval(env *ExprEnv) (ExprValue, error) { return e.value, nil }
+
+// Неизвестное имя даёт null: так отсутствующий параметр можно проверить
+// через defined(name) или сравнение.
+func (e identExpr) Eval(env *ExprEnv) (ExprValue, error) {
+	value, _ := env.lookup(e.name)
+	return value, nil
+}
+
+func (e unaryExpr) Eval(env *ExprEnv) (ExprValue, error) {
+	v, err := e.operand.Eval(env)
+	if err != nil {
+		return NullValue(), err
+	}
+	switch e.op {
+	case "not":
+		return BoolValue(!v.Truthy()), nil
+	case "-":
+		n, err := exprNumber(v)
+		if err != nil {
+			return NullValue(), err
+		}
+		n.Num = -n.Num
+		return n, nil
+	}
+	return NullValue(), fmt.Errorf("неизвестный оператор %s", e.op)
+}
+
+func (e binaryExpr) Eval(env *ExprEnv) (ExprValue, error) {
+	left, err := e.left.Eval(env)
+	if err != nil {
+		return NullValue(), err
+	}
+
+	// and/or вычисляются лениво
+	switch e.op {
+	case "and":
+		if !left.Truthy() {
+			return BoolValue(false), nil
+		}
+		right, err := e.right.Eval(env)
+		if err != nil {
+			return NullValue(), err
+		}
+		return BoolValue(right.Truthy()), nil
+	case "or":
+		if left.Truthy() {
+			return BoolValue(true), nil
+		}
+		right, err := e.right.Eval(env)
+		if err != nil {
+			return NullValue(), err
+		}
+		return BoolValue(right.Truthy()), nil
+	}
+
+	right, err := e.right.Eval(env)
+	if err != nil {
+		return NullValue(), err
+	}
+
+	switch e.op {
+	case "==":
+		return BoolValue(ExprEqual(left, right)), nil
+	case "!=":
+		return BoolValue(!ExprEqual(left, right)), nil
+	case "in":
+		return exprContains(right, left)
+	case "<", "<=", ">", ">=":
+		if left.Kind == ExprNull || right.Kind == ExprNull {
+			return BoolValue(false), nil
+		}
+		l, err := exprNumber(left)
+		if err != nil {
+			return NullValue(), err
+		}
+		r, err := exprNumber(right)
+		if err != nil {
+			return NullValue(), err
+		}
+		if l.Unit != "" && r.Unit != "" && l.Unit != r.Unit {
+			return NullValue(), fmt.Errorf("нельзя сравнивать %s (%s) и %s (%s)", l, l.Unit, r, r.Unit)
+		}
+		switch e.op {
+		case "<":
+			return BoolValue(l.Num < r.Num), nil
+		case "<=":
+			return BoolValue(l.Num <= r.Num), nil
+		case ">":
+			return BoolValue(l.Num > r.Num), nil
+		default:
+			return BoolValue(l.Num >= r.Num), nil
+		}
+	case "+", "-", "*", "/":
+		if e.op == "+" && (left.Kind == ExprString || right.Kind == ExprString) {
+			if _, err := exprNumber(left); err != nil {
+				return StringValue(left.String() + right.String()), nil
+			}
+			if _, err := exprNumber(right); err != nil {
+				return StringValue(left.String() + right.String()), nil
+			}
+		}
+		l, err := exprNumber(left)
+		if err != nil {
+			return NullValue(), err
+		}
+		r, err := exprNumber(right)
+		if err != nil {
+			return NullValue(), err
+		}
+		unit := l.Unit
+		if unit == "" {
+			unit = r.Unit
+		}
+		switch e.op {
+		case "+":
+			return unitValue(l.Num+r.Num, unit), nil
+		case "-":
+			return unitValue(l.Num-r.Num, unit), nil
+		case "*":
+			return unitValue(l.Num*r.Num, unit), nil
+		default:
+			if r.Num == 0 {
+				return NullValue(), fmt.Errorf("деление на ноль")
+			}
+			// размер / размер - безразмерное отношение
+			if l.Unit != "" && l.Unit == r.Unit {
+				unit = ""
+			}
+			return unitValue(l.Num/r.Num, unit), nil
+		}
+	}
+	return NullValue(), fmt.Errorf("неизвестный оператор %s", e.op)
+}
+
+func (e callExpr) Eval(env *ExprEnv) (ExprValue, error) {
+	if e.name == "defined" {
+		if len(e.args) != 1 {
+			return NullValue(), fmt.Errorf("defined() принимает один аргумент")
+		}
+		if ident, ok := e.args[0].(identExpr); ok {
+			_, found := env.lookup(ident.name)
+			return BoolValue(found), nil
+		}
+		v, err := e.args[0].Eval(env)
+		if err != nil {
+			return NullValue(), err
+		}
+		return BoolValue(v.Kind != ExprNull), nil
+	}
+
+	var fn ExprFunc
+	if env != nil {
+		fn = env.Funcs[e.name]
+	}
+	if fn == nil {
+		fn = exprBuiltins[e.name]
+	}
+	if fn == nil {
+		return NullValue(), fmt.Errorf("неизвестная функция %s()", e.name)
+	}
+
+	args := make([]ExprValue, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.Eval(env)
+		if err != nil {
+			return NullValue(), err
+		}
+		args[i] = v
+	}
+	return fn(args)
+}
+
+var exprBuiltins = map[string]ExprFunc{
+	"lower": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 1 {
+			return NullValue(), fmt.Errorf("lower() принимает один аргумент")
+		}
+		return StringValue(strings.ToLower(args[0].String())), nil
+	},
+	"len": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 1 {
+			return NullValue(), fmt.Errorf("len() принимает один аргумент")
+		}
+		switch args[0].Kind {
+		case ExprNull:
+			return NumberValue(0), nil
+		case ExprList:
+			return NumberValue(float64(len(args[0].List))), nil
+		}
+		return NumberValue(float64(len(args[0].String()))), nil
+	},
+	"contains": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 2 {
+			return NullValue(), fmt.Errorf("contains() принимает два аргумента")
+		}
+		return exprContains(args[0], args[1])
+	},
+	"startsWith": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 2 {
+			return NullValue(), fmt.Errorf("startsWith() принимает два аргумента")
+		}
+		return BoolValue(strings.HasPrefix(args[0].String(), args[1].String())), nil
+	},
+	"endsWith": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 2 {
+			return NullValue(), fmt.Errorf("endsWith() принимает два аргумента")
+		}
+		return BoolValue(strings.HasSuffix(args[0].String(), args[1].String())), nil
+	},
+	"matches": func(args []ExprValue) (ExprValue, error) {
+		if len(args) != 2 {
+			return NullValue(), fmt.Errorf("matches() принимает два аргумента")
+		}
+		re, err := regexp.Compile(args[1].String())
+		if err != nil {
+			return NullValue(), err
+		}
+		return BoolValue(re.MatchString(args[0].String())), nil
+	},
+	"min": exprMinMax(false),
+	"max": exprMinMax(true),
+}
+
+// exprContains: элемент списка (с учётом единиц) или подстрока.
+func exprContains(haystack, needle ExprValue) (ExprValue, error) {
+	switch haystack.Kind {
+	case ExprList:
+		for _, item := range haystack.List {
+			if ExprEqual(item, needle) {
+				return BoolValue(true), nil
+			}
+		}
+		return BoolValue(false), nil
+	case ExprNull:
+		return BoolValue(false), nil
+	}
+	return BoolValue(strings.Contains(haystack.String(), needle.String())), nil
+}
+
+func exprMinMax(max bool) ExprFunc {
+	return func(args []ExprValue) (ExprValue, error) {
+		if len(args) == 0 {
+			return NullValue(), fmt.Errorf("нужен хотя бы один аргумент")
+		}
+		best, err := exprNumber(args[0])
+		if err != nil {
+			return NullValue(), err
+		}
+		for _, arg := range args[1:] {
+			n, err := exprNumber(arg)
+			if err != nil {
+				return NullValue(), err
+			}
+			if (max && n.Num > best.Num) || (!max && n.Num < best.Num) {
+				best = n
+			}
+		}
+		return best, nil
+	}
+}
+
+// ExprEqual сравнивает значения с учётом единиц и логических синонимов:
+// 1GB == 1024MB, on == true.
+func ExprEqual(a, b ExprValue) bool {
+	if a.Kind == ExprNull || b.Kind == ExprNull {
+		return a.Kind == b.Kind
+	}
+	if a.Kind == ExprList || b.Kind == ExprList {
+		if a.Kind != b.Kind || len(a.List) != len(b.List) {
+			return false
+		}
+		for i := range a.List {
+			if !ExprEqual(a.List[i], b.List[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if a.Kind == ExprBool || b.Kind == ExprBool {
+		ab, aok := exprBool(a)
+		bb, bok := exprBool(b)
+		return aok && bok && ab == bb
+	}
+	an, aerr := exprNumber(a)
+	bn, berr := exprNumber(b)
+	if aerr == nil && berr == nil {
+		return math.Abs(an.Num-bn.Num) < 1e-9
+	}
+	if ab, aok := exprBool(a); aok {
+		if bb, bok := exprBool(b); bok {
+			return ab == bb
+		}
+	}
+	return strings.EqualFold(a.String(), b.String())
+}
+
+func exprNumber(v ExprValue) (ExprValue, error) {
+	switch v.Kind {
+	case ExprNumber:
+		return v, nil
+	case ExprString:
+		if amount, kind, ok := ParsePgValue("", v.Str); ok {
+			if kind == PgKindReal {
+				kind = ""
+			}
+			return unitValue(amount, kind), nil
+		}
+	case ExprBool:
+		if v.Bool {
+			return NumberValue(1), nil
+		}
+		return NumberValue(0), nil
+	}
+	return NullValue(), fmt.Errorf("значение '%s' не является числом", v)
+}
+
+func exprBool(v ExprValue) (bool, bool) {
+	switch v.Kind {
+	case ExprBool:
+		return v.Bool, true
+	case ExprString:
+		canonical, ok := pgBoolValues[strings.ToLower(strings.TrimSpace(v.Str))]
+		return canonical == "on", ok
+	case ExprNumber:
+		if v.Unit == "" && (v.Num == 0 || v.Num == 1) {
+			return v.Num == 1, true
+		}
+	}
+	return false, false
+}
+
+// ParseExpr разбирает выражение вида
+//
+//	max_connections * work_mem < 0.5 * ram and archive_mode == on
+//
+// Поддерживаются and/or/not (&&, ||, !), сравнения, арифметика, числа с
+// единицами PostgreSQL (128MB, 5min), строки в кавычках и вызовы функций.
+func ParseExpr(src string) (Expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("неожиданный токен '%s' в выражении '%s'", p.tokens[p.pos].text, src)
+	}
+	return expr, nil
+}
+
+// ParseExprList разбирает список выражений через запятую: a, b + 1, "text".
+func ParseExprList(src string) ([]Expr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	var exprs []Expr
+	for p.pos < len(p.tokens) {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+		if p.pos < len(p.tokens) {
+			if _, ok := p.accept(","); !ok {
+				return nil, fmt.Errorf("неожиданный токен '%s' в '%s'", p.tokens[p.pos].text, src)
+			}
+		}
+	}
+	return exprs, nil
+}
+
+// EvalExpr разбирает и вычисляет выражение.
+func EvalExpr(src string, env *ExprEnv) (ExprValue, error) {
+	expr, err := ParseExpr(src)
+	if err != nil {
+		return NullValue(), err
+	}
+	return expr.Eval(env)
+}
+
+const (
+	tokIdent = iota
+	tokNumber
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			j := i + 1
+			var sb strings.Builder
+			for j < len(runes) && runes[j] != c {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("незакрытая строка в выражении '%s'", src)
+			}
+			tokens = append(tokens, exprToken{tokString, sb.String()})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			for j < len(runes) && unicode.IsLetter(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokNumber, string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{tokIdent, string(runes[i:j])})
+			i = j
+		default:
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					tokens = append(tokens, exprToken{tokOp, two})
+					i += 2
+					continue
+				}
+			}
+			if strings.ContainsRune("<>=!+-*/(),[]", c) {
+				tokens = append(tokens, exprToken{tokOp, string(c)})
+				i++
+				continue
+			}
+			return nil, fmt.Errorf("неожиданный символ '%c' в выражении '%s'", c, src)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return exprToken{}, false
+}
+
+// accept съедает токен, если он совпадает с одним из вариантов (операторы
+// и ключевые слова and/or/not), и возвращает каноническое имя.
+func (p *exprParser) accept(options ...string) (string, bool) {
+	tok, ok := p.peek()
+	if !ok || tok.kind == tokString || tok.kind == tokNumber {
+		return "", false
+	}
+	for _, opt := range options {
+		if strings.EqualFold(tok.text, opt) {
+			p.pos++
+			return canonicalExprOp(opt), true
+		}
+	}
+	return "", false
+}
+
+func canonicalExprOp(op string) string {
+	switch strings.ToLower(op) {
+	case "&&":
+		return "and"
+	case "||":
+		return "or"
+	case "!":
+		return "not"
+	case "=":
+		return "=="
+	}
+	return strings.ToLower(op)
+}
+
+func (p *exprParser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"or", left, right}
+	}
+}
+
+func (p *exprParser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{"and", left, right}
+	}
+}
+
+func (p *exprParser) parseNot() (Expr, error) {
+	if _, ok := p.accept("not", "!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{"not", operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (Expr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=", "in"); ok {
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpr{op, left, right}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAdditive() (Expr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{"-", operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("неожиданный конец выражения")
+	}
+	p.pos++
+
+	switch tok.kind {
+	case tokNumber:
+		amount, kind, ok := ParsePgValue("", tok.text)
+		if !ok {
+			return nil, fmt.Errorf("неверное число '%s'", tok.text)
+		}
+		if kind == PgKindReal {
+			kind = ""
+		}
+		return literalExpr{unitValue(amount, kind)}, nil
+	case tokString:
+		return literalExpr{StringValue(tok.text)}, nil
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true", "on", "yes":
+			return literalExpr{BoolValue(true)}, nil
+		case "false", "off", "no":
+			return literalExpr{BoolValue(false)}, nil
+		case "null":
+			return literalExpr{NullValue()}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			var args []Expr
+			if _, ok := p.accept(")"); ok {
+				return callExpr{tok.text, args}, nil
+			}
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+				if _, ok := p.accept(")"); ok {
+					return callExpr{tok.text, args}, nil
+				}
+				if _, ok := p.accept(","); !ok {
+					return nil, fmt.Errorf("ожидалась ',' или ')' в вызове %s()", tok.text)
+				}
+			}
+		}
+		return identExpr{tok.text}, nil
+	case tokOp:
+		if tok.text == "[" {
+			var items []Expr
+			if _, ok := p.accept("]"); ok {
+				return listExpr{items}, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+				if _, ok := p.accept("]"); ok {
+					return listExpr{items}, nil
+				}
+				if _, ok := p.accept(","); !ok {
+					return nil, fmt.Errorf("ожидалась ',' или ']' в списке")
+				}
+			}
+		}
+		if tok.text == "(" {
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("ожидалась ')'")
+			}
+			return expr, nil
+		}
+	}
+	return nil, fmt.Errorf("неожиданный токен '%s'", tok.text)
+}
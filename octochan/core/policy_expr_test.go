@@ -0,0 +1,86 @@
+package core
+
+import "testing"
+
+func TestEvalExpr(t *testing.T) {
+	params := map[string]string{
+		"shared_buffers":  "8GB",
+		"work_mem":        "65536",
+		"max_connections": "200",
+		"fsync":           "on",
+		"archive_timeout": "5min",
+		"wal_level":       "replica",
+	}
+	env := &ExprEnv{
+		Resolve: func(name string) (ExprValue, bool) {
+			raw, ok := params[name]
+			if !ok {
+				return NullValue(), false
+			}
+			return ParamExprValue(name, raw), true
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"shared_buffers >= 4GB", "on"},
+		{"shared_buffers == 8192MB", "on"},
+		{"work_mem == 64MB", "on"},
+		{"shared_buffers / 4", "2GB"},
+		{"shared_buffers / work_mem", "128"},
+		{"max_connections * work_mem", "12800MB"},
+		{"archive_timeout > 1min and archive_timeout <= 300s", "on"},
+		{"fsync == true", "on"},
+		{"not fsync", "off"},
+		{"wal_level in ['replica', 'logical']", "on"},
+		{"wal_level + '_x'", "replica_x"},
+		{"defined(missing_param)", "off"},
+		{"missing_param > 10", "off"},
+		{"missing_param == null", "on"},
+		{"max(work_mem, 1GB)", "1GB"},
+		{"min(1, 2, -3)", "-3"},
+		{"len([1, 2, 3])", "3"},
+		{"startsWith(wal_level, 'rep') && matches(wal_level, '^r.*a$')", "on"},
+		{"contains(lower('ABC'), 'b')", "on"},
+		{"-(2 + 3) * 2", "-10"},
+		{"1 < 2 || 1 / 0", "on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := EvalExpr(tt.expr, env)
+			if err != nil {
+				t.Fatalf("EvalExpr(%q): %v", tt.expr, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("EvalExpr(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	env := &ExprEnv{Resolve: func(name string) (ExprValue, bool) {
+		if name == "archive_timeout" {
+			return ParamExprValue(name, "5min"), true
+		}
+		return NullValue(), false
+	}}
+	for _, expr := range []string{
+		"archive_timeout > 1GB",
+		"1 / 0",
+		"unknown_func(1)",
+		"'unterminated",
+		"1 +",
+		"(1 + 2",
+		"a # b",
+		"len(1, 2)",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			if got, err := EvalExpr(expr, env); err == nil {
+				t.Errorf("EvalExpr(%q) = %s, ожидалась ошибка", expr, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+import "testing"
+
+func TestParseSeverity(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"error", SeverityError},
+		{"Error", SeverityError},
+		{" WARNING ", SeverityWarning},
+		{"info", SeverityInfo},
+	}
+	for _, tt := range tests {
+		got, err := ParseSeverity(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSeverity(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "errors", "critical"} {
+		if got, err := ParseSeverity(bad); err == nil {
+			t.Errorf("ParseSeverity(%q) = %q, ожидалась ошибка", bad, got)
+		}
+	}
+}
+
+func TestHasFailures(t *testing.T) {
+	violations := []PolicyViolation{{Rule: "a", Severity: SeverityWarning}}
+	tests := []struct {
+		threshold string
+		want      bool
+	}{
+		{SeverityError, false},
+		{SeverityWarning, true},
+		{SeverityInfo, true},
+	}
+	for _, tt := range tests {
+		if got := HasFailures(violations, tt.threshold); got != tt.want {
+			t.Errorf("HasFailures(--fail-on %s) = %v, want %v", tt.threshold, got, tt.want)
+		}
+	}
+}
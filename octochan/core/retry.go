@@ -0,0 +1,341 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RetryPolicy - повторы запросов к RLM. Настраивается в config.yaml:
+//
+//	defaults:
+//	  retry:
+//	    max_attempts: 4
+//	    initial_delay: 1s
+//	    max_delay: 30s
+//	    multiplier: 2
+//	    jitter: 0.2
+//	    idempotency_check: true
+//
+// Повторяются только сетевые ошибки, 5xx и 429. Ошибки валидации (4xx)
+// и проверки TLS-сертификата возвращаются сразу. Retry-After сервера
+// соблюдается, но не дольше max_delay.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Jitter - доля случайного разброса задержки: 0.2 означает ±20%.
+	Jitter float64
+	// IdempotencyCheck - перед повторной отправкой POST, результат которой
+	// неизвестен, искать в RLM задачу с тем же Idempotency-Key.
+	IdempotencyCheck bool
+}
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      3,
+		InitialDelay:     time.Second,
+		MaxDelay:         30 * time.Second,
+		Multiplier:       2,
+		Jitter:           0.2,
+		IdempotencyCheck: true,
+	}
+}
+
+// LoadRetryPolicy читает defaults.retry.* поверх DefaultRetryPolicy.
+func LoadRetryPolicy() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	if viper.IsSet("defaults.retry.max_attempts") {
+		policy.MaxAttempts = viper.GetInt("defaults.retry.max_attempts")
+	}
+	if viper.IsSet("defaults.retry.initial_delay") {
+		policy.InitialDelay = viper.GetDuration("defaults.retry.initial_delay")
+	}
+	if viper.IsSet("defaults.retry.max_delay") {
+		policy.MaxDelay = viper.GetDuration("defaults.retry.max_delay")
+	}
+	if viper.IsSet("defaults.retry.multiplier") {
+		policy.Multiplier = viper.GetFloat64("defaults.retry.multiplier")
+	}
+	if viper.IsSet("defaults.retry.jitter") {
+		policy.Jitter = viper.GetFloat64("defaults.retry.jitter")
+	}
+	if viper.IsSet("defaults.retry.idempotency_check") {
+		policy.IdempotencyCheck = viper.GetBool("defaults.retry.idempotency_check")
+	}
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 1
+	}
+	policy.Jitter = math.Max(0, math.Min(policy.Jitter, 1))
+	return policy
+}
+
+// Delay - пауза перед попыткой attempt (с 1): InitialDelay * Multiplier^(attempt-1),
+// не больше MaxDelay, с разбросом ±Jitter.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 - p.Jitter + 2*p.Jitter*mathrand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// DelayAfter - пауза после неудачной попытки attempt: Retry-After ответа,
+// если сервер его прислал, иначе Delay. Обе не превышают MaxDelay.
+func (p RetryPolicy) DelayAfter(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter <= 0 {
+		return p.Delay(attempt)
+	}
+	if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return apiErr.RetryAfter
+}
+
+// APIError - ответ RLM с кодом не 2xx.
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == http.StatusUnauthorized {
+		return fmt.Sprintf("RLM отклонил токен (код 401): срок действия истёк или токен отозван, обновите его командой auth: %s", e.Body)
+	}
+	return fmt.Sprintf("ошибка API (код %d): %s", e.StatusCode, e.Body)
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter понимает оба формата заголовка: секунды и HTTP-дату.
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// IsRetryableError сообщает, имеет ли смысл повторить запрос: сетевые
+// ошибки, 5xx и 429. Отмена контекста и ошибки проверки сертификата не
+// повторяются.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if isCertificateError(err) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	var urlErr *url.Error
+	return errors.As(err, &netErr) || errors.As(err, &urlErr)
+}
+
+// isCertificateError - TLS-сертификат сервера не прошёл проверку; повтор
+// даст тот же результат.
+func isCertificateError(err error) bool {
+	var (
+		verifyErr     *tls.CertificateVerificationError
+		unknownErr    x509.UnknownAuthorityError
+		invalidErr    x509.CertificateInvalidError
+		hostnameErr   x509.HostnameError
+		constraintErr x509.ConstraintViolationError
+	)
+	return errors.As(err, &verifyErr) || errors.As(err, &unknownErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &constraintErr)
+}
+
+// isAmbiguousError - запрос мог дойти до RLM и быть выполнен: ответ потерян,
+// истёк таймаут или прокси вернул 500/502/504. Отказ в соединении и 429/503
+// означают, что запрос не обрабатывался.
+func isAmbiguousError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return false
+		}
+		return apiErr.StatusCode >= 500
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return false
+	}
+	return true
+}
+
+// SubmitWithRetry отправляет запрос, повторяя его по c.Retry.
+// POST получает Idempotency-Key, одинаковый для всех попыток. Если исход
+// попытки неизвестен, перед повтором задача ищется по ключу; когда найти её
+// нельзя, запрос не повторяется, чтобы не создать дубль.
+func (c *RLMClient) SubmitWithRetry(ctx context.Context, req *APIRequest) (string, error) {
+	policy := c.Retry
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	if req.Method == http.MethodPost {
+		ensureIdempotencyKey(req)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 && req.Method == http.MethodPost && isAmbiguousError(lastErr) {
+			if !policy.IdempotencyCheck {
+				return "", fmt.Errorf("запрос мог быть выполнен, повтор отключён (idempotency_check: false): %w", lastErr)
+			}
+			taskID, found, err := c.FindTaskByIdempotencyKey(ctx, req)
+			if err != nil {
+				return "", fmt.Errorf("запрос мог быть выполнен, а проверить это не удалось (%v), повтор не выполняется: %w", err, lastErr)
+			}
+			if found {
+				fmt.Printf("♻️ Задача уже создана предыдущей попыткой: %s\n", taskID)
+				return taskID, nil
+			}
+		}
+
+		taskID, err := c.Submit(ctx, req)
+		if err == nil {
+			return taskID, nil
+		}
+		lastErr = err
+		if !IsRetryableError(err) || attempt == policy.MaxAttempts {
+			break
+		}
+
+		delay := policy.DelayAfter(attempt, err)
+		fmt.Printf("⚠️ Попытка %d/%d не удалась: %v. Повтор через %s\n",
+			attempt, policy.MaxAttempts, err, delay.Round(100*time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("запрос прерван: %w", context.Cause(ctx))
+		case <-time.After(delay):
+		}
+	}
+
+	if !IsRetryableError(lastErr) {
+		return "", lastErr
+	}
+	return "", fmt.Errorf("после %d попыток: %w", policy.MaxAttempts, lastErr)
+}
+
+func ensureIdempotencyKey(req *APIRequest) {
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	if req.Headers[IdempotencyKeyHeader] != "" {
+		return
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	req.Headers[IdempotencyKeyHeader] = hex.EncodeToString(buf)
+}
+
+// FindTaskByIdempotencyKey ищет задачу: GET <api_url>?idempotency_key=<key>.
+// Ответ - задача, список задач или {"results": [...]}; засчитывается только
+// задача, у которой idempotency_key совпадает с ключом запроса.
+func (c *RLMClient) FindTaskByIdempotencyKey(ctx context.Context, req *APIRequest) (string, bool, error) {
+	key := req.Headers[IdempotencyKeyHeader]
+	if key == "" {
+		return "", false, fmt.Errorf("у запроса нет %s", IdempotencyKeyHeader)
+	}
+
+	lookupURL, err := url.Parse(req.URL)
+	if err != nil {
+		return "", false, fmt.Errorf("некорректный URL: %w", err)
+	}
+	query := lookupURL.Query()
+	query.Set("idempotency_key", key)
+	lookupURL.RawQuery = query.Encode()
+
+	body, err := c.do(ctx, http.MethodGet, lookupURL.String(), nil, nil)
+	if err != nil {
+		return "", false, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return "", false, fmt.Errorf("ошибка парсинга ответа: %w", err)
+	}
+	var candidates []interface{}
+	switch v := decoded.(type) {
+	case []interface{}:
+		candidates = v
+	case map[string]interface{}:
+		if results, ok := v["results"].([]interface{}); ok {
+			candidates = results
+		} else {
+			candidates = []interface{}{v}
+		}
+	}
+
+	keyed := 0
+	for _, candidate := range candidates {
+		task, ok := candidate.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, ok := task["idempotency_key"]; ok {
+			keyed++
+		}
+		if task["idempotency_key"] != key {
+			continue
+		}
+		switch id := task["id"].(type) {
+		case string:
+			return id, true, nil
+		case float64:
+			return strconv.FormatInt(int64(id), 10), true, nil
+		}
+	}
+	// Непустой ответ без idempotency_key - API игнорирует фильтр, и отсутствие
+	// задачи ничего не доказывает.
+	if len(candidates) > 0 && keyed == 0 {
+		return "", false, fmt.Errorf("API не поддерживает поиск задач по idempotency_key")
+	}
+	return "", false, nil
+}
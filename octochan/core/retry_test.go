@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	policy.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(2); got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("Delay(2) с разбросом 20%% = %s, want 1.6s..2.4s", got)
+		}
+	}
+}
+
+func TestRetryPolicyDelayAfter(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 30 * time.Second, Multiplier: 2}
+	tests := []struct {
+		name string
+		err  error
+		want time.Duration
+	}{
+		{"network error", errors.New("connection reset"), 2 * time.Second},
+		{"5xx without Retry-After", &APIError{StatusCode: 503}, 2 * time.Second},
+		{"Retry-After", &APIError{StatusCode: 429, RetryAfter: 5 * time.Second}, 5 * time.Second},
+		{"Retry-After capped", &APIError{StatusCode: 429, RetryAfter: time.Hour}, 30 * time.Second},
+		{"wrapped Retry-After", fmt.Errorf("submit: %w", &APIError{StatusCode: 503, RetryAfter: 3 * time.Second}), 3 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.DelayAfter(2, tt.err); got != tt.want {
+				t.Errorf("DelayAfter(2, %v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"7", 7 * time.Second},
+		{"0", 0},
+		{"-3", 0},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got <= 0 || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %s, want 0..1m", future, got)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://rlm.example/api/tasks.json", Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"context canceled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("wait: %w", context.DeadlineExceeded), false},
+		{"429", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500", &APIError{StatusCode: http.StatusInternalServerError}, true},
+		{"503 wrapped", fmt.Errorf("submit: %w", &APIError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"400", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"401", &APIError{StatusCode: http.StatusUnauthorized}, false},
+		{"connection refused", urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true},
+		{"unexpected EOF", urlErr(io.ErrUnexpectedEOF), true},
+		{"unknown authority", urlErr(x509.UnknownAuthorityError{}), false},
+		{"hostname mismatch", urlErr(x509.HostnameError{Host: "rlm.example"}), false},
+		{"expired certificate", urlErr(x509.CertificateInvalidError{Reason: x509.Expired}), false},
+		{"tls verification", urlErr(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), false},
+		{"plain error", errors.New("ошибка парсинга ответа"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// RLMClientConfig - подключение к одному экземпляру RLM. Основной экземпляр
+// задаётся в defaults, дополнительные - в секции rlm:
+//
+//	defaults:
+//	  api_url: https://rlm.sigma.sbrf.ru/api/tasks.json
+//	  api_token: ...
+//	rlm:
+//	  test:
+//	    api_url: https://rlm-test.example/api/tasks.json
+//	    api_token: ...
+//	    timeout: 60s
+//	    ca_bundle: /etc/ssl/certs/test-ca.pem
+//	    proxy: http://proxy.local:3128
+type RLMClientConfig struct {
+	Name               string        `mapstructure:"-" yaml:"-"`
+	APIURL             string        `mapstructure:"api_url" yaml:"api_url"`
+	Token              string        `mapstructure:"api_token" yaml:"api_token"`
+	Timeout            time.Duration `mapstructure:"timeout" yaml:"timeout"`
+	CABundle           string        `mapstructure:"ca_bundle" yaml:"ca_bundle"`
+	Proxy              string        `mapstructure:"proxy" yaml:"proxy"`
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	// TokenSource - откуда взят токен: TokenSourceConfig, TokenSourceVault
+	// или TokenSourceLegacyEnv. Для токена из хранилища клиент отмечает
+	// последнее успешное использование и ответы 401.
+	TokenSource string `mapstructure:"-" yaml:"-"`
+}
+
+const (
+	TokenSourceConfig    = "config"
+	TokenSourceVault     = "vault"
+	TokenSourceLegacyEnv = "env"
+)
+
+// RLMClient - клиент API задач RLM. Все обращения к RLM идут через него,
+// поэтому в одном процессе можно работать с несколькими экземплярами.
+type RLMClient struct {
+	config RLMClientConfig
+	http   *http.Client
+	Retry  RetryPolicy
+
+	// Токен из хранилища расшифровывается при первом обращении к RLM, чтобы
+	// команды без запросов (validate, dry-run) не спрашивали пароль.
+	unlockOnce sync.Once
+	unlockErr  error
+}
+
+const DefaultRLMInstance = "default"
+
+func NewRLMClient(config RLMClientConfig) (*RLMClient, error) {
+	if config.APIURL == "" {
+		return nil, fmt.Errorf("RLM %s: не задан api_url", config.Name)
+	}
+	if _, err := url.Parse(config.APIURL); err != nil {
+		return nil, fmt.Errorf("RLM %s: некорректный api_url: %w", config.Name, err)
+	}
+	if config.Name == "" {
+		config.Name = DefaultRLMInstance
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("RLM %s: некорректный proxy: %w", config.Name, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if config.CABundle != "" || config.InsecureSkipVerify {
+		tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+		if config.CABundle != "" {
+			pem, err := os.ReadFile(config.CABundle)
+			if err != nil {
+				return nil, fmt.Errorf("RLM %s: не удалось прочитать ca_bundle: %w", config.Name, err)
+			}
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("RLM %s: в %s нет PEM-сертификатов", config.Name, config.CABundle)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &RLMClient{
+		config: config,
+		http:   &http.Client{Timeout: config.Timeout, Transport: transport},
+		Retry:  LoadRetryPolicy(),
+	}, nil
+}
+
+// RLMClientConfigFromViper читает настройки экземпляра name из конфига.
+// Пустое имя и "default" - секция defaults. Если api_token в конфиге не задан,
+// токен берётся из хранилища (ochan auth) при первом запросе, для default -
+// ещё и из старого ~/.octochan/.env.
+func RLMClientConfigFromViper(name string) (RLMClientConfig, error) {
+	prefix := "defaults."
+	if name != "" && name != DefaultRLMInstance {
+		prefix = "rlm." + name + "."
+		if !viper.IsSet("rlm." + name) {
+			return RLMClientConfig{}, fmt.Errorf("экземпляр RLM '%s' не описан в конфиге. Доступные: %s",
+				name, strings.Join(RLMInstances(), ", "))
+		}
+	} else {
+		name = DefaultRLMInstance
+	}
+
+	config := RLMClientConfig{
+		Name:               name,
+		APIURL:             viper.GetString(prefix + "api_url"),
+		Token:              viper.GetString(prefix + "api_token"),
+		Timeout:            viper.GetDuration(prefix + "timeout"),
+		CABundle:           viper.GetString(prefix + "ca_bundle"),
+		Proxy:              viper.GetString(prefix + "proxy"),
+		InsecureSkipVerify: viper.GetBool(prefix + "insecure_skip_verify"),
+	}
+	if config.Token != "" {
+		config.TokenSource = TokenSourceConfig
+		return config, nil
+	}
+
+	if VaultHasToken(name) {
+		config.TokenSource = TokenSourceVault
+	} else if name == DefaultRLMInstance {
+		if token := LegacyEnvToken(); token != "" {
+			config.Token, config.TokenSource = token, TokenSourceLegacyEnv
+		}
+	}
+	return config, nil
+}
+
+// RLMInstances - имена экземпляров RLM из конфига, default первым.
+func RLMInstances() []string {
+	var names []string
+	for name := range viper.GetStringMap("rlm") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultRLMInstance}, names...)
+}
+
+func NewRLMClientFromConfig(name string) (*RLMClient, error) {
+	config, err := RLMClientConfigFromViper(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewRLMClient(config)
+}
+
+// DefaultRLMClient - клиент для defaults. Собирается при каждом вызове,
+// чтобы учитывать изменения конфига (config set, auth).
+func DefaultRLMClient() (*RLMClient, error) {
+	return NewRLMClientFromConfig("")
+}
+
+func (c *RLMClient) Name() string {
+	return c.config.Name
+}
+
+// APIURL - адрес создания задач (…/api/tasks.json).
+func (c *RLMClient) APIURL() string {
+	return c.config.APIURL
+}
+
+// UnlockToken расшифровывает токен из хранилища, если он ещё не получен.
+func (c *RLMClient) UnlockToken() error {
+	if c.config.TokenSource != TokenSourceVault {
+		return nil
+	}
+	c.unlockOnce.Do(func() {
+		token, err := VaultToken(c.config.Name)
+		if err != nil {
+			c.unlockErr = fmt.Errorf("RLM %s: %w", c.config.Name, err)
+			return
+		}
+		c.config.Token = token
+	})
+	return c.unlockErr
+}
+
+// Token - токен экземпляра. Токен из хранилища при этом расшифровывается,
+// поэтому для вывода без запросов к RLM используется PlanAuthorization.
+func (c *RLMClient) Token() (string, error) {
+	if err := c.UnlockToken(); err != nil {
+		return "", err
+	}
+	return c.config.Token, nil
+}
+
+// PlanAuthorization - заголовок Authorization для dry-run. Ещё не
+// расшифрованный токен из хранилища заменяется на ***, чтобы план не
+// спрашивал пароль.
+func (c *RLMClient) PlanAuthorization() string {
+	if c.config.Token == "" {
+		return "Token ***"
+	}
+	return "Token " + c.config.Token
+}
+
+func (c *RLMClient) HasToken() bool {
+	return c.config.Token != "" || c.config.TokenSource == TokenSourceVault
+}
+
+// BaseURL - адрес задач без .json, от него строятся …/{id}/ и …/{id}/events/.
+func (c *RLMClient) BaseURL() string {
+	return strings.TrimSuffix(strings.TrimSuffix(c.config.APIURL, ".json"), "/")
+}
+
+func (c *RLMClient) TaskURL(taskID string) string {
+	return fmt.Sprintf("%s/%s/", c.BaseURL(), taskID)
+}
+
+// NewRequest - запрос на создание задачи. Authorization добавляет do при
+// отправке, поэтому подготовка запросов не требует токена.
+func (c *RLMClient) NewRequest(body map[string]interface{}) *APIRequest {
+	return &APIRequest{
+		Method: http.MethodPost,
+		URL:    c.config.APIURL,
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Accept":       "application/json",
+		},
+		Body: body,
+	}
+}
+
+// do выполняет запрос с токеном клиента и возвращает тело ответа 2xx.
+// Остальные коды возвращаются как *APIError. Authorization из headers
+// игнорируется: запрос всегда подписывается токеном клиента.
+func (c *RLMClient) do(ctx context.Context, method, rawURL string, headers map[string]string, body io.Reader) ([]byte, error) {
+	if err := c.UnlockToken(); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Authorization", "Token "+c.config.Token)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Authorization") {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка HTTP запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ответа: %w", err)
+	}
+	if c.config.TokenSource == TokenSourceVault {
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized:
+			markVaultTokenRejected(c.config.Name)
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			markVaultTokenUsed(c.config.Name)
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newAPIError(resp, data)
+	}
+	return data, nil
+}
+
+// Submit отправляет запрос модуля и возвращает ID созданной задачи.
+func (c *RLMClient) Submit(ctx context.Context, req *APIRequest) (string, error) {
+	jsonData, err := json.Marshal(req.Body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования JSON: %w", err)
+	}
+
+	body, err := c.do(ctx, req.Method, req.URL, req.Headers, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("ошибка парсинга ответа: %w", err)
+	}
+
+	switch v := result["id"].(type) {
+	case string:
+		return v, nil
+	case float64:
+		if v == float64(int64(v)) {
+			return strconv.FormatInt(int64(v), 10), nil
+		}
+		return strconv.FormatFloat(v, 'f', 0, 64), nil
+	case nil:
+		return "", fmt.Errorf("ID задачи отсутствует в ответе сервера")
+	default:
+		return "", fmt.Errorf("неподдерживаемый формат ID: %T, полный ответ: %v", result["id"], result)
+	}
+}
+
+// TaskStatus - ответ RLM на GET …/{id}/.
+func (c *RLMClient) TaskStatus(ctx context.Context, taskID string) (map[string]interface{}, error) {
+	body, err := c.do(ctx, http.MethodGet, c.TaskURL(taskID), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+	return result, nil
+}
+
+// TaskEvents - ответ RLM на GET …/{id}/events/.
+func (c *RLMClient) TaskEvents(ctx context.Context, taskID string) ([]map[string]interface{}, error) {
+	body, err := c.do(ctx, http.MethodGet, c.TaskURL(taskID)+"events/", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var events []map[string]interface{}
+	if err := json.Unmarshal(body, &events); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга JSON: %w", err)
+	}
+	return events, nil
+}
+
+// TaskStatusWithEvents - статус задачи с событиями в поле "events". Если API
+// не отдаёт события (404), возвращается только статус.
+func (c *RLMClient) TaskStatusWithEvents(ctx context.Context, taskID string) (map[string]interface{}, error) {
+	result, err := c.TaskStatus(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if events, err := c.TaskEvents(ctx, taskID); err == nil {
+		result["events"] = events
+	} else if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		fmt.Printf("⚠️ Не удалось получить события: %v\n", err)
+	}
+	return result, nil
+}
+
+// CancelTask просит RLM отменить задачу: POST …/{id}/cancel/. Если API
+// не поддерживает отмену (404/405), возвращается ErrCancelUnsupported.
+func (c *RLMClient) CancelTask(ctx context.Context, taskID string) error {
+	_, err := c.do(ctx, http.MethodPost, c.TaskURL(taskID)+"cancel/", nil, nil)
+	if apiErr, ok := err.(*APIError); ok &&
+		(apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed) {
+		return ErrCancelUnsupported
+	}
+	return err
+}
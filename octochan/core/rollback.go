@@ -0,0 +1,135 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// SnapshotRestore - сценарий, возвращающий состояние снапшота: сервис и
+// полные параметры сценария для каждого CI. Заполняется модулем, который
+// перед изменением сохранил текущие значения (см. psql_tuning_params_se).
+type SnapshotRestore struct {
+	Service    string                            `json:"service"`
+	Parameters map[string]map[string]interface{} `json:"parameters"`
+}
+
+// BackupSnapshotStore - хранилище значений до изменения (~/.octochan/backups).
+// Оно отдельно от истории конфигов, поэтому снапшоты для отката не попадают
+// в snapshot log и не становятся родителями снапшотов конфигов.
+func BackupSnapshotStore() (*SnapshotStore, error) {
+	dir, err := GetSnapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewSnapshotStore(filepath.Join(filepath.Dir(dir), "backups"))
+}
+
+// CommitBackup сохраняет значения до изменения и сценарий их возврата
+// снапшотом поверх предыдущего бэкапа, поэтому у каждого изменения свой
+// снапшот, даже если значения совпадают: задачи и Restore прежних изменений
+// не перезаписываются.
+func (s *SnapshotStore) CommitBackup(config map[string]map[string]string, restore *SnapshotRestore, author, message string) (*Snapshot, error) {
+	head, err := s.Head()
+	if err != nil {
+		return nil, err
+	}
+	var parentID *string
+	if _, err := s.Load(head); head != "" && err == nil {
+		parentID = &head
+	}
+
+	snapshot, err := s.Commit(parentID, config, author, message)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.Restore != nil || len(snapshot.Tasks) > 0 {
+		return nil, fmt.Errorf("снапшот %s уже относится к другому изменению", shortID(snapshot.ID))
+	}
+	snapshot.Restore = restore
+	if err := s.Save(snapshot); err != nil {
+		return nil, err
+	}
+	if err := s.SetHead(snapshot.ID); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RollbackTarget - что откатывать: снапшот и его CI.
+type RollbackTarget struct {
+	Snapshot *Snapshot
+	CIs      []string
+}
+
+// ResolveRollback находит снапшот по ID задачи RLM (откатывается только CI
+// этой задачи) или по ID/префиксу снапшота (откатываются все его CI).
+func ResolveRollback(store *SnapshotStore, ref string) (*RollbackTarget, error) {
+	snapshot, err := store.FindByTask(ref)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		if snapshot.Restore == nil {
+			return nil, fmt.Errorf("снапшот %s задачи %s не содержит сценария отката", shortID(snapshot.ID), ref)
+		}
+		ci := snapshot.Tasks[ref]
+		if _, ok := snapshot.Restore.Parameters[ci]; !ok {
+			return nil, fmt.Errorf("в снапшоте %s нет сохранённых значений для CI %s задачи %s", shortID(snapshot.ID), ci, ref)
+		}
+		return &RollbackTarget{Snapshot: snapshot, CIs: []string{ci}}, nil
+	}
+
+	snapshot, err = store.Load(ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s не найден ни среди задач снапшотов, ни среди снапшотов: %w", ref, err)
+	}
+	if snapshot.Restore == nil {
+		return nil, fmt.Errorf("снапшот %s не содержит сценария отката", shortID(snapshot.ID))
+	}
+	target := &RollbackTarget{Snapshot: snapshot}
+	for ci := range snapshot.Restore.Parameters {
+		target.CIs = append(target.CIs, ci)
+	}
+	sort.Strings(target.CIs)
+	return target, nil
+}
+
+// RollbackScenarios строит сценарии отката. CI с одинаковыми параметрами
+// объединяются в один сценарий, порядок CI сохраняется.
+func RollbackScenarios(targets []*RollbackTarget) ([]map[string]interface{}, error) {
+	var (
+		scenarios []map[string]interface{}
+		byKey     = make(map[string]map[string]interface{})
+		seen      = make(map[string]bool)
+	)
+	for _, target := range targets {
+		restore := target.Snapshot.Restore
+		for _, ci := range target.CIs {
+			if seen[ci] {
+				return nil, fmt.Errorf("CI %s встречается в нескольких откатах", ci)
+			}
+			seen[ci] = true
+
+			params := restore.Parameters[ci]
+			encoded, err := json.Marshal(params)
+			if err != nil {
+				return nil, fmt.Errorf("параметры отката для CI %s: %w", ci, err)
+			}
+			key := restore.Service + "\n" + string(encoded)
+			if scenario, ok := byKey[key]; ok {
+				scenario["targets"] = append(scenario["targets"].([]map[string]interface{}), map[string]interface{}{"svm_ci": ci})
+				continue
+			}
+			scenario := map[string]interface{}{
+				"service":    restore.Service,
+				"parameters": DeepCopyMap(params),
+				"targets":    []map[string]interface{}{{"svm_ci": ci}},
+			}
+			byKey[key] = scenario
+			scenarios = append(scenarios, scenario)
+		}
+	}
+	return scenarios, nil
+}
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RolloutConfig - поэтапная раскатка сценария по целям вместо отправки всех
+// запросов сразу:
+//
+//	rollout:
+//	  canary: 1              # сначала только первая цель
+//	  wave_size: 5           # затем волнами по 5 целей
+//	  pause: 2m              # пауза между волнами
+//	  confirm: canary        # спросить подтверждение после канарейки (waves - после каждой волны)
+//	  max_failure_ratio: 0.2 # остановиться, если неуспешных задач больше 20%
+//
+// Каждая волна ждёт завершения своих задач. После волны считается доля
+// неуспешных задач по всем волнам; если она больше max_failure_ratio
+// (по умолчанию 0 - любая ошибка), следующие волны не запускаются.
+type RolloutConfig struct {
+	Canary          int           `yaml:"canary" json:"canary,omitempty"`
+	WaveSize        int           `yaml:"wave_size" json:"wave_size,omitempty"`
+	Pause           time.Duration `yaml:"pause" json:"pause,omitempty"`
+	Confirm         string        `yaml:"confirm" json:"confirm,omitempty"`
+	MaxFailureRatio float64       `yaml:"max_failure_ratio" json:"max_failure_ratio,omitempty"`
+}
+
+// Когда запрашивать подтверждение продолжения раскатки.
+const (
+	RolloutConfirmNone   = "none"
+	RolloutConfirmCanary = "canary"
+	RolloutConfirmWaves  = "waves"
+)
+
+func (r *RolloutConfig) check() []string {
+	var errs []string
+	if r.Canary < 0 {
+		errs = append(errs, "rollout.canary: не может быть отрицательным")
+	}
+	if r.WaveSize < 0 {
+		errs = append(errs, "rollout.wave_size: не может быть отрицательным")
+	}
+	if r.Pause < 0 {
+		errs = append(errs, "rollout.pause: не может быть отрицательной")
+	}
+	if r.MaxFailureRatio < 0 || r.MaxFailureRatio > 1 {
+		errs = append(errs, fmt.Sprintf("rollout.max_failure_ratio: ожидается число от 0 до 1, получено %v", r.MaxFailureRatio))
+	}
+	switch r.confirmMode() {
+	case RolloutConfirmNone, RolloutConfirmCanary, RolloutConfirmWaves:
+	default:
+		errs = append(errs, fmt.Sprintf("rollout.confirm: недопустимое значение %q, допустимо: none, canary, waves", r.Confirm))
+	}
+	return errs
+}
+
+func (r *RolloutConfig) confirmMode() string {
+	switch strings.ToLower(r.Confirm) {
+	case "", "false", "no":
+		return RolloutConfirmNone
+	case "true", "yes":
+		return RolloutConfirmWaves
+	}
+	return strings.ToLower(r.Confirm)
+}
+
+// String - краткое описание стратегии для вывода.
+func (r *RolloutConfig) String() string {
+	var parts []string
+	if r.Canary > 0 {
+		parts = append(parts, fmt.Sprintf("канарейка %d", r.Canary))
+	}
+	if r.WaveSize > 0 {
+		parts = append(parts, fmt.Sprintf("волны по %d", r.WaveSize))
+	} else {
+		parts = append(parts, "остальные одной волной")
+	}
+	if r.Pause > 0 {
+		parts = append(parts, fmt.Sprintf("пауза %s", r.Pause))
+	}
+	switch r.confirmMode() {
+	case RolloutConfirmCanary:
+		parts = append(parts, "подтверждение после канарейки")
+	case RolloutConfirmWaves:
+		parts = append(parts, "подтверждение после каждой волны")
+	}
+	parts = append(parts, fmt.Sprintf("порог ошибок %.0f%%", r.MaxFailureRatio*100))
+	return strings.Join(parts, ", ")
+}
+
+// RolloutWave - волна раскатки: цели и их запросы.
+type RolloutWave struct {
+	Number  int
+	Canary  bool
+	Targets []string
+	Started bool
+
+	requests       []*APIRequest
+	requestTargets []string
+}
+
+// PlanWaves делит запросы на волны по целям. Запросы одной цели всегда
+// попадают в одну волну; запрос без цели считается отдельной целью.
+func (r *RolloutConfig) PlanWaves(requests []*APIRequest) []*RolloutWave {
+	var (
+		order  []string
+		groups = make(map[string][]*APIRequest)
+	)
+	for i, req := range requests {
+		key := strings.Join(RequestTargets(req.Body), ",")
+		if key == "" {
+			key = fmt.Sprintf("запрос #%d", i+1)
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], req)
+	}
+
+	var waves []*RolloutWave
+	addWave := func(keys []string, canary bool) {
+		wave := &RolloutWave{Number: len(waves) + 1, Canary: canary, Targets: keys}
+		for _, key := range keys {
+			for _, req := range groups[key] {
+				wave.requests = append(wave.requests, req)
+				wave.requestTargets = append(wave.requestTargets, key)
+			}
+		}
+		waves = append(waves, wave)
+	}
+
+	if r.Canary > 0 && len(order) > 0 {
+		n := min(r.Canary, len(order))
+		addWave(order[:n], true)
+		order = order[n:]
+	}
+	size := r.WaveSize
+	if size <= 0 {
+		size = len(order)
+	}
+	for len(order) > 0 {
+		n := min(size, len(order))
+		addWave(order[:n], false)
+		order = order[n:]
+	}
+	return waves
+}
+
+// runRollout выполняет волны по очереди. Возвращает ошибку, если раскатка
+// остановлена: по порогу ошибок, оператором или отменой ctx.
+func runRollout(ctx context.Context, client *RLMClient, rollout *RolloutConfig, requests []*APIRequest, scenarioHash string, opts ExecOptions, result *ExecutionResult) error {
+	opts.Wait = true
+	result.Rollout = rollout
+	result.Waves = rollout.PlanWaves(requests)
+	targets := 0
+	for _, wave := range result.Waves {
+		targets += len(wave.Targets)
+	}
+	fmt.Printf("🌊 Раскатка: целей - %d, волн - %d (%s)\n", targets, len(result.Waves), rollout)
+
+	for i, wave := range result.Waves {
+		if i > 0 {
+			if rollout.Pause > 0 {
+				fmt.Printf("⏸ Пауза %s перед волной %d\n", rollout.Pause, wave.Number)
+				timer := time.NewTimer(rollout.Pause)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return fmt.Errorf("раскатка прервана перед волной %d: %w", wave.Number, context.Cause(ctx))
+				}
+			}
+			previous := result.Waves[i-1]
+			mode := rollout.confirmMode()
+			if mode == RolloutConfirmWaves || (mode == RolloutConfirmCanary && previous.Canary) {
+				ok, err := confirmRollout(ctx, opts, fmt.Sprintf("Продолжить раскатку: волна %d из %d, цели: %s?",
+					wave.Number, len(result.Waves), strings.Join(wave.Targets, ", ")))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("раскатка остановлена оператором перед волной %d", wave.Number)
+				}
+			}
+		}
+
+		label := ""
+		if wave.Canary {
+			label = " (канарейка)"
+		}
+		fmt.Printf("\n🌊 Волна %d/%d%s: %s\n", wave.Number, len(result.Waves), label, strings.Join(wave.Targets, ", "))
+		wave.Started = true
+		if err := submitRequests(ctx, client, wave.requests, scenarioHash, opts, result, wave.Number); err != nil {
+			return err
+		}
+
+		failed := result.Failed()
+		ratio := float64(failed) / float64(max(len(result.Outcomes), 1))
+		fmt.Printf("Волна %d завершена: неуспешных задач всего %d из %d (%.0f%%)\n",
+			wave.Number, failed, len(result.Outcomes), ratio*100)
+		if ctx.Err() != nil {
+			return fmt.Errorf("раскатка прервана на волне %d: %w", wave.Number, context.Cause(ctx))
+		}
+		if ratio > rollout.MaxFailureRatio && i < len(result.Waves)-1 {
+			return fmt.Errorf("раскатка остановлена после волны %d: доля неуспешных задач %.0f%% превысила порог %.0f%%",
+				wave.Number, ratio*100, rollout.MaxFailureRatio*100)
+		}
+	}
+	return nil
+}
+
+// confirmRollout спрашивает подтверждение через opts.Confirm. Ожидание
+// ответа прерывается отменой ctx.
+func confirmRollout(ctx context.Context, opts ExecOptions, prompt string) (bool, error) {
+	if opts.Confirm == nil {
+		return false, fmt.Errorf("раскатка требует подтверждения, но ввод недоступен")
+	}
+	ok := opts.Confirm(ctx, prompt)
+	if ctx.Err() != nil {
+		return false, context.Cause(ctx)
+	}
+	return ok, nil
+}
+
+// TargetResult - итог раскатки по одной цели.
+type TargetResult struct {
+	Target string
+	Wave   int
+	Tasks  []string
+	Status string
+	Err    error
+}
+
+// TargetReport - итог по целям в порядке волн. Цели волн, которые не
+// запускались, получают статус not_started, цели без созданных задач -
+// not_created.
+func (r *ExecutionResult) TargetReport() []TargetResult {
+	byRequest := make(map[*APIRequest]*TaskOutcome, len(r.Outcomes))
+	for _, outcome := range r.Outcomes {
+		byRequest[outcome.request] = outcome
+	}
+
+	var report []TargetResult
+	for _, wave := range r.Waves {
+		for _, target := range wave.Targets {
+			item := TargetResult{Target: target, Wave: wave.Number, Status: "not_started"}
+			if wave.Started {
+				item.Status = "not_created"
+			}
+			found := false
+			for i, req := range wave.requests {
+				outcome, ok := byRequest[req]
+				if wave.requestTargets[i] != target || !ok {
+					continue
+				}
+				if outcome.ID != "" {
+					item.Tasks = append(item.Tasks, outcome.ID)
+				}
+				// Итог цели - первый неуспешный статус её задач.
+				if !found || IsSuccessfulTaskStatus(item.Status) {
+					found = true
+					item.Status, item.Err = outcome.Status, outcome.Err
+					if item.Status == "" {
+						item.Status = "unknown"
+					}
+				}
+			}
+			report = append(report, item)
+		}
+	}
+	return report
+}
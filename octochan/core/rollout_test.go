@@ -0,0 +1,199 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func rolloutRequest(cis ...string) *APIRequest {
+	var items []interface{}
+	for _, ci := range cis {
+		items = append(items, map[string]interface{}{"invsvm_ci_svm": ci})
+	}
+	return &APIRequest{Body: map[string]interface{}{"service": "pangolin_restart", "items": items}}
+}
+
+func TestPlanWaves(t *testing.T) {
+	five := []*APIRequest{rolloutRequest("CI1"), rolloutRequest("CI2"), rolloutRequest("CI3"), rolloutRequest("CI4"), rolloutRequest("CI5")}
+	tests := []struct {
+		name     string
+		rollout  RolloutConfig
+		requests []*APIRequest
+		waves    [][]string
+		canary   []bool
+	}{
+		{
+			name:     "one wave",
+			requests: five,
+			waves:    [][]string{{"CI1", "CI2", "CI3", "CI4", "CI5"}},
+			canary:   []bool{false},
+		},
+		{
+			name:     "canary then the rest",
+			rollout:  RolloutConfig{Canary: 1},
+			requests: five,
+			waves:    [][]string{{"CI1"}, {"CI2", "CI3", "CI4", "CI5"}},
+			canary:   []bool{true, false},
+		},
+		{
+			name:     "canary and waves",
+			rollout:  RolloutConfig{Canary: 1, WaveSize: 2},
+			requests: five,
+			waves:    [][]string{{"CI1"}, {"CI2", "CI3"}, {"CI4", "CI5"}},
+			canary:   []bool{true, false, false},
+		},
+		{
+			name:     "canary larger than targets",
+			rollout:  RolloutConfig{Canary: 10, WaveSize: 2},
+			requests: five[:2],
+			waves:    [][]string{{"CI1", "CI2"}},
+			canary:   []bool{true},
+		},
+		{
+			name:     "requests of one target stay together",
+			rollout:  RolloutConfig{WaveSize: 1},
+			requests: []*APIRequest{rolloutRequest("CI1"), rolloutRequest("CI2"), rolloutRequest("CI1")},
+			waves:    [][]string{{"CI1"}, {"CI2"}},
+			canary:   []bool{false, false},
+		},
+		{
+			name:     "request without target",
+			rollout:  RolloutConfig{WaveSize: 2},
+			requests: []*APIRequest{{Body: map[string]interface{}{}}, rolloutRequest("CI1", "CI2")},
+			waves:    [][]string{{"запрос #1", "CI1,CI2"}},
+			canary:   []bool{false},
+		},
+		{
+			name: "no requests",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waves := tt.rollout.PlanWaves(tt.requests)
+			var targets [][]string
+			var canary []bool
+			planned := 0
+			for i, wave := range waves {
+				if wave.Number != i+1 {
+					t.Errorf("волна %d: Number = %d", i+1, wave.Number)
+				}
+				targets = append(targets, wave.Targets)
+				canary = append(canary, wave.Canary)
+				planned += len(wave.requests)
+			}
+			if !reflect.DeepEqual(targets, tt.waves) {
+				t.Errorf("PlanWaves targets = %v, want %v", targets, tt.waves)
+			}
+			if !reflect.DeepEqual(canary, tt.canary) {
+				t.Errorf("PlanWaves canary = %v, want %v", canary, tt.canary)
+			}
+			if planned != len(tt.requests) {
+				t.Errorf("PlanWaves распределил %d запросов из %d", planned, len(tt.requests))
+			}
+		})
+	}
+}
+
+func TestTargetReport(t *testing.T) {
+	requests := []*APIRequest{rolloutRequest("CI1"), rolloutRequest("CI2"), rolloutRequest("CI3"), rolloutRequest("CI4")}
+	rollout := RolloutConfig{Canary: 1, WaveSize: 2}
+	result := &ExecutionResult{Waves: rollout.PlanWaves(requests)}
+	result.Waves[0].Started = true
+	result.Waves[1].Started = true
+	result.Outcomes = []*TaskOutcome{
+		{ID: "1001", Status: "success", request: requests[0]},
+		{Status: TaskSubmitFailed, Err: errors.New("ошибка API (код 400)"), request: requests[1]},
+	}
+
+	want := []TargetResult{
+		{Target: "CI1", Wave: 1, Tasks: []string{"1001"}, Status: "success"},
+		{Target: "CI2", Wave: 2, Status: TaskSubmitFailed},
+		{Target: "CI3", Wave: 2, Status: "not_created"},
+		{Target: "CI4", Wave: 3, Status: "not_started"},
+	}
+	report := result.TargetReport()
+	if len(report) != len(want) {
+		t.Fatalf("TargetReport = %+v, want %+v", report, want)
+	}
+	for i := range want {
+		got := report[i]
+		if got.Target != want[i].Target || got.Wave != want[i].Wave || got.Status != want[i].Status ||
+			!reflect.DeepEqual(got.Tasks, want[i].Tasks) {
+			t.Errorf("TargetReport[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if report[1].Err == nil {
+		t.Error("TargetReport: ошибка отправки CI2 потеряна")
+	}
+	if got := result.Failed(); got != 1 {
+		t.Errorf("Failed() = %d, want 1", got)
+	}
+	if ids := result.TaskIDs(); !reflect.DeepEqual(ids, []string{"1001"}) {
+		t.Errorf("TaskIDs() = %v, want [1001]", ids)
+	}
+}
+
+func TestRunRolloutAgainstMock(t *testing.T) {
+	targets := []string{"CI1", "REJECTED", "CI3"}
+	tests := []struct {
+		name     string
+		rollout  RolloutConfig
+		confirm  bool
+		statuses []string
+		err      string
+	}{
+		{
+			name:     "threshold stops after failed submission",
+			rollout:  RolloutConfig{WaveSize: 1},
+			statuses: []string{"success", TaskSubmitFailed, "not_started"},
+			err:      "превысила порог",
+		},
+		{
+			name:     "failures within threshold",
+			rollout:  RolloutConfig{WaveSize: 1, MaxFailureRatio: 0.5},
+			statuses: []string{"success", TaskSubmitFailed, "success"},
+		},
+		{
+			name:     "operator stops after canary",
+			rollout:  RolloutConfig{Canary: 1, Confirm: RolloutConfirmCanary, MaxFailureRatio: 1},
+			statuses: []string{"success", "not_started", "not_started"},
+			err:      "остановлена оператором",
+		},
+		{
+			name:     "operator confirms canary",
+			rollout:  RolloutConfig{Canary: 1, Confirm: RolloutConfirmCanary, MaxFailureRatio: 1},
+			confirm:  true,
+			statuses: []string{"success", TaskSubmitFailed, "success"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, client := startMockRLM(t, MockRLMConfig{
+				Default: MockServiceConfig{Lifecycle: []string{"in_progress:1s", "success"}, RejectTableIDs: []string{"REJECTED"}},
+			}, 100*time.Millisecond)
+			rollout := tt.rollout
+			opts := ExecOptions{PollInterval: time.Millisecond, TaskTimeout: 10 * time.Second, Rollout: &rollout,
+				Confirm: func(ctx context.Context, prompt string) bool { return tt.confirm }}
+
+			result, err := ExecuteModularScenarioContext(context.Background(), client, mockScenario("restart", targets...), nil, opts)
+			if tt.err == "" && err != nil {
+				t.Fatalf("ExecuteModularScenarioContext: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("ExecuteModularScenarioContext: %v, want error containing %q", err, tt.err)
+			}
+
+			var statuses []string
+			for _, target := range result.TargetReport() {
+				statuses = append(statuses, target.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.statuses) {
+				t.Errorf("статусы целей = %v, want %v", statuses, tt.statuses)
+			}
+		})
+	}
+}
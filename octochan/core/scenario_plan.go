@@ -0,0 +1,184 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ScenarioStep - шаг, который модуль выполняет при подготовке запросов.
+// SideEffectFree означает, что шаг не обращается к RLM и ничего не
+// запускает - его можно выполнять в apply --dry-run.
+type ScenarioStep struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	SideEffectFree bool   `json:"side_effect_free"`
+}
+
+// ScenarioStepper - необязательный интерфейс модуля: шаги GenerateRequests.
+// Модуль без него считается небезопасным, и в dry-run GenerateRequests
+// не вызывается.
+type ScenarioStepper interface {
+	Steps() []ScenarioStep
+}
+
+// ScenarioPlanner - необязательный интерфейс модуля, у которого
+// GenerateRequests имеет побочные эффекты (например, запускает разведку).
+// PlanRequests строит те же запросы без обращений к сети, подставляя
+// заглушки вместо данных, которые станут известны только при выполнении.
+type ScenarioPlanner interface {
+	PlanRequests() ([]*APIRequest, error)
+}
+
+// ScenarioPlan - результат apply --dry-run.
+type ScenarioPlan struct {
+	Service  string         `json:"service"`
+	Targets  []string       `json:"targets"`
+	Steps    []ScenarioStep `json:"steps,omitempty"`
+	Requests []*APIRequest  `json:"requests"`
+	Notes    []string       `json:"notes,omitempty"`
+	// Rollout и Waves - стратегия раскатки и цели по волнам, если она задана.
+	Rollout *RolloutConfig `json:"rollout,omitempty"`
+	Waves   [][]string     `json:"waves,omitempty"`
+}
+
+// PlanModularScenario проходит те же этапы, что ExecuteModularScenario, -
+// разбор, параметры, валидация, подготовка запросов - но ничего не отправляет.
+func PlanModularScenario(client *RLMClient, scenarioData []byte, customParams map[string]string) (*ScenarioPlan, error) {
+	data, module, err := prepareScenarioModule(client, scenarioData, customParams)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ScenarioPlan{Service: data.Service}
+	for _, target := range data.Targets {
+		plan.Targets = append(plan.Targets, target.GetCIs()...)
+	}
+	for _, item := range data.Items {
+		if ci, ok := item["invsvm_ci_svm"].(string); ok && ci != "" {
+			plan.Targets = append(plan.Targets, ci)
+		}
+	}
+
+	if stepper, ok := module.(ScenarioStepper); ok {
+		plan.Steps = stepper.Steps()
+	}
+
+	switch {
+	case isScenarioPlanner(module):
+		plan.Requests, err = module.(ScenarioPlanner).PlanRequests()
+	case len(plan.Steps) > 0 && stepsSideEffectFree(plan.Steps):
+		plan.Requests, err = module.GenerateRequests()
+	default:
+		plan.Notes = append(plan.Notes, fmt.Sprintf(
+			"модуль %s не объявил шаги без побочных эффектов, запросы не сформированы", data.Service))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка подготовки запросов: %w", err)
+	}
+	// Запросы получают токен только при отправке; в плане - как в curl.
+	for _, req := range plan.Requests {
+		if req.Headers == nil {
+			req.Headers = make(map[string]string)
+		}
+		req.Headers["Authorization"] = client.PlanAuthorization()
+	}
+	return plan, nil
+}
+
+func isScenarioPlanner(module ScenarioModule) bool {
+	_, ok := module.(ScenarioPlanner)
+	return ok
+}
+
+func stepsSideEffectFree(steps []ScenarioStep) bool {
+	for _, step := range steps {
+		if !step.SideEffectFree {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateScenario разбирает сценарий и проверяет его так же, как apply,
+// ничего не отправляя в RLM.
+func ValidateScenario(client *RLMClient, scenarioData []byte) (*ScenarioData, error) {
+	data, _, err := prepareScenarioModule(client, scenarioData, nil)
+	return data, err
+}
+
+// prepareScenarioModule разбирает сценарий, подставляет пользовательские
+// параметры, создаёт модуль сервиса и проверяет сценарий по схеме и Validate.
+func prepareScenarioModule(client *RLMClient, scenarioData []byte, customParams map[string]string) (*ScenarioData, ScenarioModule, error) {
+	if len(scenarioData) == 0 {
+		return nil, nil, fmt.Errorf("пустые данные сценария")
+	}
+	data, err := ParseScenarioData(scenarioData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка парсинга сценария: %w", err)
+	}
+	if data.Parameters == nil {
+		data.Parameters = make(map[string]interface{})
+	}
+	for key, val := range customParams {
+		data.Parameters[key] = val
+	}
+
+	creator, exists := scenarioModules[data.Service]
+	if !exists {
+		availableModules := make([]string, 0, len(scenarioModules))
+		for moduleName := range scenarioModules {
+			availableModules = append(availableModules, moduleName)
+		}
+		sort.Strings(availableModules)
+		return nil, nil, fmt.Errorf(
+			"модуль для сервиса '%s' не зарегистрирован. Доступные модули: %v",
+			data.Service,
+			availableModules,
+		)
+	}
+
+	module, err := creator(data, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка создания модуля: %w", err)
+	}
+	if err := ValidateScenarioData(data, module); err != nil {
+		return nil, nil, fmt.Errorf("ошибка валидации: %w", err)
+	}
+	return data, module, nil
+}
+
+// Curl возвращает эквивалентную команду curl.
+func (r *APIRequest) Curl() (string, error) {
+	body, err := json.Marshal(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("ошибка формирования JSON: %w", err)
+	}
+
+	lines := []string{"curl -X " + r.Method + " " + shellQuote(r.URL)}
+	headers := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		headers = append(headers, name)
+	}
+	sort.Strings(headers)
+	for _, name := range headers {
+		lines = append(lines, "-H "+shellQuote(name+": "+r.Headers[name]))
+	}
+	if r.Body != nil {
+		lines = append(lines, "-d "+shellQuote(string(body)))
+	}
+	return strings.Join(lines, " \\\n  "), nil
+}
+
+// MaskAuthorization скрывает токен, оставляя схему: "Token ***".
+func MaskAuthorization(value string) string {
+	if scheme, _, ok := strings.Cut(value, " "); ok {
+		return scheme + " ***"
+	}
+	return "***"
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,269 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Шаблоны сценариев. Сценарий (YAML или JSON) может ссылаться на переменные
+// окружения выполнения:
+//
+//	parameters:
+//	  port: {{ .env.port }}
+//	  svm_ip: {{ quote (required "svm_ip" .env.svm_ip) }}
+//	  max_connections: {{ default 100 .env.max_connections }}
+//	  ip_replics: {{ json .env.ip_replics }}
+//	items:
+//	  - table_id: {{ .table_id }}
+//
+// Переменные берутся из env/default.yaml и env/<окружение>.yaml рядом со
+// сценарием или в defaults.scenario_path, поверх них - --var key=value.
+// Имена таблиц по окружениям задаются секцией environments конфига:
+//
+//	environments:
+//	  default_table: psql
+//	  tables:
+//	    psql:
+//	      production: psqlseclusterstandalone
+//	      test: psqlseclustertest
+
+// ScenarioVars - данные для подстановки в шаблон сценария.
+type ScenarioVars struct {
+	// Environment - имя окружения (production, test, development).
+	Environment string
+	Vars        map[string]interface{}
+	// Extra - дополнительные значения верхнего уровня шаблона, например
+	// .steps в шагах workflow.
+	Extra map[string]interface{}
+}
+
+// HasScenarioTemplate сообщает, что в сценарии есть подстановки {{ }}.
+func HasScenarioTemplate(data []byte) bool {
+	return bytes.Contains(data, []byte("{{"))
+}
+
+// RenderScenario подставляет переменные в сценарий. Отсутствующую переменную
+// заменяет default или отклоняет required; подставленная напрямую, она -
+// ошибка, а не пустая строка.
+func RenderScenario(data []byte, vars ScenarioVars) ([]byte, error) {
+	if !HasScenarioTemplate(data) {
+		return data, nil
+	}
+
+	envConfig, err := LoadEnvironmentConfig()
+	if err != nil {
+		return nil, err
+	}
+	if vars.Vars == nil {
+		vars.Vars = make(map[string]interface{})
+	}
+
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			out, err := json.Marshal(v)
+			return string(out), err
+		},
+		"quote": func(v interface{}) string {
+			return strconv.Quote(fmt.Sprint(v))
+		},
+		"default": func(def, v interface{}) interface{} {
+			if v == nil || v == "" {
+				return def
+			}
+			return v
+		},
+		"required": func(name string, v interface{}) (interface{}, error) {
+			if v == nil || v == "" {
+				return nil, fmt.Errorf("не задана переменная %s", name)
+			}
+			return v, nil
+		},
+		"table": func(name string) (string, error) {
+			return envConfig.Table(name, vars.Environment)
+		},
+	}
+
+	tmpl, err := template.New("scenario").Option("missingkey=zero").Funcs(funcs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка шаблона сценария: %w", err)
+	}
+
+	values := map[string]interface{}{
+		"env":         vars.Vars,
+		"environment": vars.Environment,
+	}
+	for key, value := range vars.Extra {
+		values[key] = value
+	}
+	if envConfig.DefaultTable != "" && vars.Environment != "" {
+		if tableID, err := envConfig.Table(envConfig.DefaultTable, vars.Environment); err == nil {
+			values["table_id"] = tableID
+		}
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return nil, fmt.Errorf("ошибка подстановки в сценарий: %w", err)
+	}
+	// missingkey=zero нужен, чтобы default и required получили nil вместо
+	// ошибки выполнения; прямую подстановку отсутствующего ключа text/template
+	// выводит как <no value>.
+	if !bytes.Contains(data, []byte(noTemplateValue)) {
+		for i, line := range strings.Split(out.String(), "\n") {
+			if strings.Contains(line, noTemplateValue) {
+				return nil, fmt.Errorf("ошибка подстановки в сценарий: строка %d (%s): переменная не задана: задайте её в env-файле или --var либо используйте default",
+					i+1, strings.TrimSpace(line))
+			}
+		}
+	}
+	return out.Bytes(), nil
+}
+
+const noTemplateValue = "<no value>"
+
+// LoadEnvironmentConfig читает секцию environments из конфига.
+func LoadEnvironmentConfig() (EnvironmentConfig, error) {
+	var config EnvironmentConfig
+	if err := viper.UnmarshalKey("environments", &config); err != nil {
+		return config, fmt.Errorf("некорректная секция environments: %w", err)
+	}
+	return config, nil
+}
+
+// Table - имя таблицы name для окружения env.
+func (c EnvironmentConfig) Table(name, env string) (string, error) {
+	tables, ok := c.Tables[name]
+	if !ok {
+		return "", fmt.Errorf("таблица '%s' не описана в environments.tables", name)
+	}
+	tableID := tables.ForEnvironment(env)
+	if tableID == "" {
+		return "", fmt.Errorf("для таблицы '%s' не задано окружение '%s'", name, env)
+	}
+	return tableID, nil
+}
+
+func (t TableConfig) ForEnvironment(env string) string {
+	switch strings.ToLower(env) {
+	case "production", "prod":
+		return t.Production
+	case "test":
+		return t.Test
+	case "development", "dev":
+		return t.Development
+	}
+	return ""
+}
+
+// FindEnvironmentFiles - файлы переменных окружения env в порядке применения:
+// default, затем само окружение. env может быть путём к файлу. Ищется в
+// <каталог сценария>/env и <defaults.scenario_path>/env.
+func FindEnvironmentFiles(scenarioPath, env string) ([]string, error) {
+	if env == "" {
+		return nil, nil
+	}
+	if info, err := os.Stat(env); err == nil && !info.IsDir() {
+		return []string{env}, nil
+	}
+
+	var dirs []string
+	if scenarioPath != "" {
+		dirs = append(dirs, filepath.Join(filepath.Dir(scenarioPath), "env"))
+	}
+	if scenarioDir := viper.GetString("defaults.scenario_path"); scenarioDir != "" {
+		dirs = append(dirs, filepath.Join(scenarioDir, "env"))
+	}
+
+	for _, dir := range dirs {
+		file := findVarFile(dir, env)
+		if file == "" {
+			continue
+		}
+		if base := findVarFile(dir, "default"); base != "" && base != file {
+			return []string{base, file}, nil
+		}
+		return []string{file}, nil
+	}
+	return nil, fmt.Errorf("файл переменных окружения '%s' не найден в %s", env, strings.Join(dirs, ", "))
+}
+
+func findVarFile(dir, name string) string {
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		path := filepath.Join(dir, name+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadScenarioVars читает файлы переменных и объединяет их: вложенные
+// словари сливаются, остальные значения последнего файла заменяют прежние.
+func LoadScenarioVars(files []string) (map[string]interface{}, error) {
+	vars := make(map[string]interface{})
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения %s: %w", file, err)
+		}
+		var fileVars map[string]interface{}
+		if err := yaml.Unmarshal(data, &fileVars); err != nil {
+			return nil, fmt.Errorf("ошибка парсинга %s: %w", file, err)
+		}
+		mergeVars(vars, fileVars)
+	}
+	return vars, nil
+}
+
+func mergeVars(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcOK := value.(map[string]interface{})
+		dstMap, dstOK := dst[key].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeVars(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// SetScenarioVar разбирает --var key=value. Значение читается как YAML:
+// 5432 - число, true - bool, [a, b] - список, "5432" - строка. Ключ с точками
+// (db.port) задаёт вложенное значение.
+func SetScenarioVar(vars map[string]interface{}, assignment string) error {
+	key, raw, ok := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("ожидается key=value: %s", assignment)
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+	if value == nil && strings.TrimSpace(raw) == "" {
+		value = ""
+	}
+
+	parts := strings.Split(key, ".")
+	current := vars
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
@@ -0,0 +1,152 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRenderScenario(t *testing.T) {
+	viper.Set("environments", map[string]interface{}{
+		"default_table": "psql",
+		"tables": map[string]interface{}{
+			"psql": map[string]interface{}{"production": "psqlseclusterstandalone", "test": "psqlseclustertest"},
+		},
+	})
+	defer viper.Set("environments", nil)
+
+	tests := []struct {
+		name     string
+		template string
+		vars     ScenarioVars
+		want     string
+		err      string
+	}{
+		{
+			name:     "no template",
+			template: "port: 5432",
+			want:     "port: 5432",
+		},
+		{
+			name:     "variable",
+			template: "port: {{ .env.port }}",
+			vars:     ScenarioVars{Vars: map[string]interface{}{"port": 5433}},
+			want:     "port: 5433",
+		},
+		{
+			name:     "nested variable",
+			template: "port: {{ .env.db.port }}",
+			vars:     ScenarioVars{Vars: map[string]interface{}{"db": map[string]interface{}{"port": 5433}}},
+			want:     "port: 5433",
+		},
+		{
+			name:     "default for missing variable",
+			template: "port: {{ default 5432 .env.port }}",
+			want:     "port: 5432",
+		},
+		{
+			name:     "default for empty variable",
+			template: "port: {{ default 5432 .env.port }}",
+			vars:     ScenarioVars{Vars: map[string]interface{}{"port": ""}},
+			want:     "port: 5432",
+		},
+		{
+			name:     "default not used",
+			template: "port: {{ default 5432 .env.port }}",
+			vars:     ScenarioVars{Vars: map[string]interface{}{"port": 6432}},
+			want:     "port: 6432",
+		},
+		{
+			name:     "required missing",
+			template: "ip: {{ required \"svm_ip\" .env.svm_ip }}",
+			err:      "не задана переменная svm_ip",
+		},
+		{
+			name:     "missing variable without default",
+			template: "service: x\nport: {{ .env.port }}",
+			err:      "строка 2 (port: <no value>)",
+		},
+		{
+			name:     "json and quote",
+			template: "ips: {{ json .env.ips }}\nname: {{ quote .env.name }}",
+			vars:     ScenarioVars{Vars: map[string]interface{}{"ips": []interface{}{"10.0.0.2", "10.0.0.3"}, "name": "a b"}},
+			want:     "ips: [\"10.0.0.2\",\"10.0.0.3\"]\nname: \"a b\"",
+		},
+		{
+			name:     "table for environment",
+			template: "table_id: {{ .table_id }} / {{ table \"psql\" }} / {{ .environment }}",
+			vars:     ScenarioVars{Environment: "test"},
+			want:     "table_id: psqlseclustertest / psqlseclustertest / test",
+		},
+		{
+			name:     "unknown table",
+			template: "table_id: {{ table \"mongo\" }}",
+			vars:     ScenarioVars{Environment: "test"},
+			err:      "таблица 'mongo' не описана",
+		},
+		{
+			name:     "table_id without environment",
+			template: "table_id: {{ .table_id }}",
+			err:      "переменная не задана",
+		},
+		{
+			name:     "extra values",
+			template: "prev: {{ .steps.backup.status }}",
+			vars:     ScenarioVars{Extra: map[string]interface{}{"steps": map[string]interface{}{"backup": map[string]interface{}{"status": "success"}}}},
+			want:     "prev: success",
+		},
+		{
+			name:     "syntax error",
+			template: "port: {{ .env.port ",
+			err:      "ошибка шаблона сценария",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := RenderScenario([]byte(tt.template), tt.vars)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("RenderScenario = %q, %v; want error containing %q", out, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderScenario: %v", err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("RenderScenario = %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetScenarioVar(t *testing.T) {
+	tests := []struct {
+		assignment string
+		want       map[string]interface{}
+	}{
+		{"port=5433", map[string]interface{}{"port": 5433}},
+		{"port=\"5433\"", map[string]interface{}{"port": "5433"}},
+		{"enabled=true", map[string]interface{}{"enabled": true}},
+		{"ips=[10.0.0.2, 10.0.0.3]", map[string]interface{}{"ips": []interface{}{"10.0.0.2", "10.0.0.3"}}},
+		{"db.port=5433", map[string]interface{}{"db": map[string]interface{}{"port": 5433}}},
+		{"name=", map[string]interface{}{"name": ""}},
+	}
+	for _, tt := range tests {
+		vars := make(map[string]interface{})
+		if err := SetScenarioVar(vars, tt.assignment); err != nil {
+			t.Errorf("SetScenarioVar(%q): %v", tt.assignment, err)
+			continue
+		}
+		if !reflect.DeepEqual(vars, tt.want) {
+			t.Errorf("SetScenarioVar(%q) = %v, want %v", tt.assignment, vars, tt.want)
+		}
+	}
+	for _, bad := range []string{"port", "=5433"} {
+		if err := SetScenarioVar(map[string]interface{}{}, bad); err == nil {
+			t.Errorf("SetScenarioVar(%q): ожидалась ошибка", bad)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package core
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -12,23 +15,37 @@ import (
 type Snapshot struct {
 	ID        string    `json:"id"`
 	ParentID  *string   `json:"parent_id,omitempty"`
+	Tree      string    `json:"tree,omitempty"`
 	Patch     string    `json:"patch"`
 	Author    string    `json:"author"`
 	Timestamp time.Time `json:"timestamp"`
 	Message   string    `json:"message,omitempty"`
+	// Tasks - задачи RLM, изменившие сохранённое состояние: ID задачи -> CI.
+	Tasks map[string]string `json:"tasks,omitempty"`
+	// Restore - сценарий, возвращающий сохранённое состояние (ochan rollback).
+	Restore *SnapshotRestore `json:"restore,omitempty"`
 }
 
-func CreateSnapshot(parentID *string, db1Config, db2Config map[string]map[string]string, author, message string) (*Snapshot, error) {
-	diff := CompareConfigs(db1Config, db2Config, "source", "target")
-	patch, err := json.Marshal(diff)
+// CreateSnapshot фиксирует состояние config поверх parentConfig (состояния
+// родительского снапшота). ID вычисляется как SHA-256 от родителя и хеша
+// содержимого, поэтому один и тот же переход всегда получает один ID.
+// Patch хранит переход parentConfig -> config как JSON Patch (RFC 6902).
+func CreateSnapshot(parentID *string, parentConfig, config map[string]map[string]string, author, message string) (*Snapshot, error) {
+	patch, err := MarshalPatch(DiffPatch(parentConfig, config))
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal diff: %v", err)
+		return nil, err
+	}
+
+	tree, err := TreeHash(config)
+	if err != nil {
+		return nil, err
 	}
 
 	return &Snapshot{
-		ID:        generateSnapshotID(),
+		ID:        generateSnapshotID(parentID, tree),
 		ParentID:  parentID,
-		Patch:     string(patch),
+		Tree:      tree,
+		Patch:     patch,
 		Author:    author,
 		Timestamp: time.Now(),
 		Message:   message,
@@ -71,35 +88,390 @@ func LoadSnapshot(snapshotID, snapshotsDir string) (*Snapshot, error) {
 	return &snapshot, nil
 }
 
+// ApplySnapshot применяет патч снапшота к targetConfig, проверяя предусловия.
+// targetConfig не изменяется.
 func ApplySnapshot(targetConfig map[string]map[string]string, snapshot *Snapshot) (map[string]map[string]string, error) {
+	ops, err := ParseSnapshotPatch(snapshot.Patch)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyPatch(targetConfig, ops)
+}
+
+// RevertSnapshot откатывает ранее применённый снапшот через обратный патч.
+func RevertSnapshot(targetConfig map[string]map[string]string, snapshot *Snapshot) (map[string]map[string]string, error) {
+	inverse, err := InverseSnapshotPatch(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyPatch(targetConfig, inverse)
+}
 
-	var diff map[string]map[string]interface{}
-	if err := json.Unmarshal([]byte(snapshot.Patch), &diff); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal patch: %v", err)
+func InverseSnapshotPatch(snapshot *Snapshot) ([]PatchOp, error) {
+	ops, err := ParseSnapshotPatch(snapshot.Patch)
+	if err != nil {
+		return nil, err
 	}
+	return InvertPatch(ops)
+}
 
-	for param, data := range diff {
-		if sourceVal, ok := data["source"]; ok && sourceVal != "N/A" {
+func generateSnapshotID(parentID *string, tree string) string {
+	parent := ""
+	if parentID != nil {
+		parent = *parentID
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("parent %s\ntree %s\n", parent, tree)))
+	return hex.EncodeToString(sum[:])
+}
 
-			parts := strings.SplitN(param, ".", 2)
-			if len(parts) != 2 {
-				continue
-			}
+// TreeHash - SHA-256 канонического JSON конфига (encoding/json сортирует ключи).
+func TreeHash(config map[string]map[string]string) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
 
-			section := parts[0]
-			key := parts[1]
+func GetSnapshotsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+	}
+	return filepath.Join(home, ".octochan", "snapshots"), nil
+}
+
+// SnapshotStore хранит историю снапшотов как DAG: файлы snapshot_<id>.json
+// ссылаются на родителя, полные состояния конфигов лежат в objects/<hash>.json,
+// а HEAD указывает на текущий снапшот.
+type SnapshotStore struct {
+	dir string
+}
+
+func NewSnapshotStore(dir string) (*SnapshotStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshots directory: %v", err)
+	}
+	return &SnapshotStore{dir: dir}, nil
+}
+
+func DefaultSnapshotStore() (*SnapshotStore, error) {
+	dir, err := GetSnapshotsDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewSnapshotStore(dir)
+}
+
+func (s *SnapshotStore) Dir() string {
+	return s.dir
+}
+
+func (s *SnapshotStore) SaveTree(config map[string]map[string]string) (string, error) {
+	tree, err := TreeHash(config)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, "objects", tree+".json")
+	if FileExists(path) {
+		return tree, nil
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write tree object: %v", err)
+	}
+	return tree, nil
+}
+
+func (s *SnapshotStore) LoadTree(tree string) (map[string]map[string]string, error) {
+	config := make(map[string]map[string]string)
+	if tree == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, "objects", tree+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree object %s: %v", shortID(tree), err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to decode tree object %s: %v", shortID(tree), err)
+	}
+	return config, nil
+}
+
+// Commit сохраняет config как потомка parentID. Если такой переход уже
+// записан, возвращается существующий снапшот.
+func (s *SnapshotStore) Commit(parentID *string, config map[string]map[string]string, author, message string) (*Snapshot, error) {
+	parentConfig := make(map[string]map[string]string)
+	if parentID != nil {
+		parent, err := s.Load(*parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parentConfig, err = s.LoadTree(parent.Tree); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := CreateSnapshot(parentID, parentConfig, config, author, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := LoadSnapshot(snapshot.ID, s.dir); err == nil {
+		return existing, nil
+	}
+
+	if _, err := s.SaveTree(config); err != nil {
+		return nil, err
+	}
+	if err := SaveSnapshot(snapshot, s.dir); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// RecordDiff записывает переход base -> config: base привязывается к
+// существующему снапшоту с тем же содержимым (или становится новым корнем),
+// а config - его потомком. HEAD переводится на новый снапшот.
+func (s *SnapshotStore) RecordDiff(base, config map[string]map[string]string, author, message string) (*Snapshot, error) {
+	baseTree, err := TreeHash(base)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := s.FindByTree(baseTree)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		if parent, err = s.Commit(nil, base, author, "base: "+message); err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot, err := s.Commit(&parent.ID, config, author, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetHead(snapshot.ID); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Load загружает снапшот по полному ID или однозначному префиксу.
+func (s *SnapshotStore) Load(id string) (*Snapshot, error) {
+	if snapshot, err := LoadSnapshot(id, s.dir); err == nil {
+		return snapshot, nil
+	}
 
-			if _, exists := targetConfig[section]; !exists {
-				targetConfig[section] = make(map[string]string)
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Snapshot
+	for _, snapshot := range snapshots {
+		if strings.HasPrefix(snapshot.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("префикс %s неоднозначен", id)
 			}
+			found = snapshot
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("снапшот %s не найден", id)
+	}
+	return found, nil
+}
+
+// List возвращает все снапшоты, отсортированные от новых к старым.
+func (s *SnapshotStore) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots directory: %v", err)
+	}
+
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "snapshot_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, "snapshot_"), ".json")
+		snapshot, err := LoadSnapshot(id, s.dir)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Timestamp.After(snapshots[j].Timestamp)
+	})
+	return snapshots, nil
+}
+
+// Save перезаписывает снапшот, например после привязки задач.
+func (s *SnapshotStore) Save(snapshot *Snapshot) error {
+	return SaveSnapshot(snapshot, s.dir)
+}
+
+// AttachTask привязывает задачу RLM, запущенную для target, к снапшоту.
+func (s *SnapshotStore) AttachTask(id, taskID, target string) error {
+	snapshot, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+	if snapshot.Tasks == nil {
+		snapshot.Tasks = make(map[string]string)
+	}
+	snapshot.Tasks[taskID] = target
+	return s.Save(snapshot)
+}
+
+// FindByTask ищет самый новый снапшот, к которому привязана задача.
+func (s *SnapshotStore) FindByTask(taskID string) (*Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if _, ok := snapshot.Tasks[taskID]; ok {
+			return snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *SnapshotStore) FindByTree(tree string) (*Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Tree == tree {
+			return snapshot, nil
+		}
+	}
+	return nil, nil
+}
+
+// Log возвращает цепочку снапшотов от id до корня.
+func (s *SnapshotStore) Log(id string) ([]*Snapshot, error) {
+	var chain []*Snapshot
+	seen := make(map[string]bool)
+
+	for id != "" {
+		snapshot, err := s.Load(id)
+		if err != nil {
+			return chain, err
+		}
+		if seen[snapshot.ID] {
+			return chain, fmt.Errorf("обнаружен цикл в истории снапшотов на %s", shortID(snapshot.ID))
+		}
+		seen[snapshot.ID] = true
+		chain = append(chain, snapshot)
+
+		id = ""
+		if snapshot.ParentID != nil {
+			id = *snapshot.ParentID
+		}
+	}
+	return chain, nil
+}
+
+func (s *SnapshotStore) Head() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, "HEAD"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (s *SnapshotStore) SetHead(id string) error {
+	return os.WriteFile(filepath.Join(s.dir, "HEAD"), []byte(id+"\n"), 0644)
+}
+
+// Checkout восстанавливает полное состояние конфига на момент снапшота.
+func (s *SnapshotStore) Checkout(id string) (*Snapshot, map[string]map[string]string, error) {
+	snapshot, err := s.Load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot.Tree == "" {
+		return nil, nil, fmt.Errorf("снапшот %s создан старой версией и не содержит состояния конфига", shortID(snapshot.ID))
+	}
+	config, err := s.LoadTree(snapshot.Tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, config, nil
+}
 
-			targetConfig[section][key] = fmt.Sprintf("%v", sourceVal)
+// Revert создаёт поверх HEAD снапшот, отменяющий изменения id. Отмена - это
+// трёхстороннее слияние: base = состояние id, ours = HEAD, theirs = родитель id.
+func (s *SnapshotStore) Revert(id, author, prefer string) (*Snapshot, *MergeResult, error) {
+	target, targetConfig, err := s.Checkout(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parentConfig := make(map[string]map[string]string)
+	if target.ParentID != nil {
+		if _, parentConfig, err = s.Checkout(*target.ParentID); err != nil {
+			return nil, nil, err
 		}
 	}
 
-	return targetConfig, nil
+	headID, err := s.Head()
+	if err != nil {
+		return nil, nil, err
+	}
+	if headID == "" {
+		headID = target.ID
+	}
+	head, headConfig, err := s.Checkout(headID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := MergeConfigs(targetConfig, headConfig, parentConfig, prefer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(result.UnresolvedConflicts()) > 0 {
+		return nil, result, fmt.Errorf("отмена %s конфликтует с изменениями после него", shortID(target.ID))
+	}
+
+	message := fmt.Sprintf("Revert %s", shortID(target.ID))
+	if target.Message != "" {
+		message += ": " + target.Message
+	}
+
+	snapshot, err := s.Commit(&head.ID, result.Merged, author, message)
+	if err != nil {
+		return nil, result, err
+	}
+	if err := s.SetHead(snapshot.ID); err != nil {
+		return nil, result, err
+	}
+	return snapshot, result, nil
 }
 
-func generateSnapshotID() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
 }
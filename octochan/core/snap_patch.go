@@ -0,0 +1,300 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+	PatchOpTest    = "test"
+)
+
+// PatchOp - операция JSON Patch (RFC 6902) над конфигом. Путь имеет вид
+// /<section>/<key>, для параметров без секции - //<key>. Перед replace и
+// remove всегда идёт test с ожидаемым старым значением: это и предусловие
+// при применении, и источник данных для обратного патча.
+type PatchOp struct {
+	Op    string  `json:"op"`
+	Path  string  `json:"path"`
+	Value *string `json:"value,omitempty"`
+}
+
+// PatchConflict описывает нарушенное предусловие при применении патча.
+type PatchConflict struct {
+	Path     string
+	Expected *string
+	Actual   *string
+}
+
+type PatchError struct {
+	Conflicts []PatchConflict
+}
+
+func (e *PatchError) Error() string {
+	var lines []string
+	for _, c := range e.Conflicts {
+		lines = append(lines, fmt.Sprintf("%s: ожидалось %s, найдено %s", c.Path, patchValueString(c.Expected), patchValueString(c.Actual)))
+	}
+	return "предусловия патча не выполнены:\n  " + strings.Join(lines, "\n  ")
+}
+
+// DiffPatch строит патч, переводящий from в to. Значения сравниваются как
+// строки без нормализации, чтобы применение патча давало ровно состояние to.
+func DiffPatch(from, to map[string]map[string]string) []PatchOp {
+	paths := make(map[string][2]string)
+	for section, params := range from {
+		for key := range params {
+			paths[PatchPath(section, key)] = [2]string{section, key}
+		}
+	}
+	for section, params := range to {
+		for key := range params {
+			paths[PatchPath(section, key)] = [2]string{section, key}
+		}
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	var ops []PatchOp
+	for _, path := range sorted {
+		section, key := paths[path][0], paths[path][1]
+		oldVal := lookupMergeValue(from, section, key)
+		newVal := lookupMergeValue(to, section, key)
+
+		switch {
+		case !oldVal.Exists && newVal.Exists:
+			ops = append(ops, PatchOp{Op: PatchOpAdd, Path: path, Value: patchString(newVal.Value)})
+		case oldVal.Exists && !newVal.Exists:
+			ops = append(ops,
+				PatchOp{Op: PatchOpTest, Path: path, Value: patchString(oldVal.Value)},
+				PatchOp{Op: PatchOpRemove, Path: path})
+		case oldVal.Value != newVal.Value:
+			ops = append(ops,
+				PatchOp{Op: PatchOpTest, Path: path, Value: patchString(oldVal.Value)},
+				PatchOp{Op: PatchOpReplace, Path: path, Value: patchString(newVal.Value)})
+		}
+	}
+	return ops
+}
+
+// ApplyPatch применяет патч к копии config. Все предусловия проверяются до
+// изменения: add требует отсутствия параметра (или того же значения), test -
+// совпадения с учётом единиц измерения. При нарушении возвращается *PatchError.
+func ApplyPatch(config map[string]map[string]string, ops []PatchOp) (map[string]map[string]string, error) {
+	result := copyConfig(config)
+	var conflicts []PatchConflict
+
+	for i, op := range ops {
+		section, key, err := ParsePatchPath(op.Path)
+		if err != nil {
+			return nil, fmt.Errorf("операция %d: %v", i, err)
+		}
+		current := lookupMergeValue(result, section, key)
+
+		switch op.Op {
+		case PatchOpTest:
+			if op.Value == nil {
+				return nil, fmt.Errorf("операция %d: test без value", i)
+			}
+			if !current.Exists || !sameMergeValue(key, current, MergeValue{Value: *op.Value, Exists: true}) {
+				conflicts = append(conflicts, PatchConflict{Path: op.Path, Expected: op.Value, Actual: mergeValuePtr(current)})
+			}
+		case PatchOpAdd:
+			if op.Value == nil {
+				return nil, fmt.Errorf("операция %d: add без value", i)
+			}
+			if current.Exists && !sameMergeValue(key, current, MergeValue{Value: *op.Value, Exists: true}) {
+				conflicts = append(conflicts, PatchConflict{Path: op.Path, Actual: mergeValuePtr(current)})
+			}
+			setMergeValue(result, section, key, MergeValue{Value: *op.Value, Exists: true})
+		case PatchOpReplace:
+			if op.Value == nil {
+				return nil, fmt.Errorf("операция %d: replace без value", i)
+			}
+			if !current.Exists {
+				conflicts = append(conflicts, PatchConflict{Path: op.Path, Expected: patchString("<любое значение>")})
+			}
+			setMergeValue(result, section, key, MergeValue{Value: *op.Value, Exists: true})
+		case PatchOpRemove:
+			if !current.Exists {
+				conflicts = append(conflicts, PatchConflict{Path: op.Path, Expected: patchString("<любое значение>")})
+			}
+			setMergeValue(result, section, key, MergeValue{})
+		default:
+			return nil, fmt.Errorf("операция %d: неподдерживаемая операция '%s'", i, op.Op)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, &PatchError{Conflicts: conflicts}
+	}
+	return result, nil
+}
+
+// InvertPatch строит обратный патч. Старые значения берутся из test-операций,
+// поэтому replace и remove без предшествующего test инвертировать нельзя.
+func InvertPatch(ops []PatchOp) ([]PatchOp, error) {
+	var inverse []PatchOp
+
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i]
+		var old *string
+		if op.Op == PatchOpReplace || op.Op == PatchOpRemove {
+			if i == 0 || ops[i-1].Op != PatchOpTest || ops[i-1].Path != op.Path {
+				return nil, fmt.Errorf("операция %s %s не содержит предыдущего значения (test)", op.Op, op.Path)
+			}
+			old = ops[i-1].Value
+			i--
+		}
+
+		switch op.Op {
+		case PatchOpAdd:
+			inverse = append(inverse,
+				PatchOp{Op: PatchOpTest, Path: op.Path, Value: op.Value},
+				PatchOp{Op: PatchOpRemove, Path: op.Path})
+		case PatchOpReplace:
+			inverse = append(inverse,
+				PatchOp{Op: PatchOpTest, Path: op.Path, Value: op.Value},
+				PatchOp{Op: PatchOpReplace, Path: op.Path, Value: old})
+		case PatchOpRemove:
+			inverse = append(inverse, PatchOp{Op: PatchOpAdd, Path: op.Path, Value: old})
+		case PatchOpTest:
+			inverse = append(inverse, op)
+		default:
+			return nil, fmt.Errorf("неподдерживаемая операция '%s'", op.Op)
+		}
+	}
+	return inverse, nil
+}
+
+// validatePatchOps проверяет операции, прочитанные из JSON: путь, тип
+// операции и наличие value у test, add и replace.
+func validatePatchOps(ops []PatchOp) error {
+	for i, op := range ops {
+		if _, _, err := ParsePatchPath(op.Path); err != nil {
+			return fmt.Errorf("операция %d: %v", i, err)
+		}
+		switch op.Op {
+		case PatchOpTest, PatchOpAdd, PatchOpReplace:
+			if op.Value == nil {
+				return fmt.Errorf("операция %d: %s без value", i, op.Op)
+			}
+		case PatchOpRemove:
+		default:
+			return fmt.Errorf("операция %d: неподдерживаемая операция '%s'", i, op.Op)
+		}
+	}
+	return nil
+}
+
+// ParseSnapshotPatch читает патч снапшота. Снапшоты старого формата (карта
+// param -> {source, target, status}) конвертируются в операции на лету.
+func ParseSnapshotPatch(patch string) ([]PatchOp, error) {
+	trimmed := strings.TrimSpace(patch)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(trimmed, "{") {
+		var ops []PatchOp
+		if err := json.Unmarshal([]byte(trimmed), &ops); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal patch: %v", err)
+		}
+		if err := validatePatchOps(ops); err != nil {
+			return nil, err
+		}
+		return ops, nil
+	}
+
+	var diff map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(trimmed), &diff); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal patch: %v", err)
+	}
+
+	params := make([]string, 0, len(diff))
+	for param := range diff {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+
+	var ops []PatchOp
+	for _, param := range params {
+		data := diff[param]
+		section, key := splitParamPath(param)
+		path := PatchPath(section, key)
+		source := patchString(getValueOrNA(data["source"]))
+		target := patchString(getValueOrNA(data["target"]))
+
+		switch data["status"] {
+		case "Only in source":
+			ops = append(ops, PatchOp{Op: PatchOpTest, Path: path, Value: source}, PatchOp{Op: PatchOpRemove, Path: path})
+		case "Only in target":
+			ops = append(ops, PatchOp{Op: PatchOpAdd, Path: path, Value: target})
+		default:
+			ops = append(ops, PatchOp{Op: PatchOpTest, Path: path, Value: source}, PatchOp{Op: PatchOpReplace, Path: path, Value: target})
+		}
+	}
+	return ops, nil
+}
+
+func MarshalPatch(ops []PatchOp) (string, error) {
+	if ops == nil {
+		ops = []PatchOp{}
+	}
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal patch: %v", err)
+	}
+	return string(data), nil
+}
+
+// PatchPath кодирует секцию и ключ в JSON Pointer (RFC 6901).
+func PatchPath(section, key string) string {
+	return "/" + escapePointer(section) + "/" + escapePointer(key)
+}
+
+func ParsePatchPath(path string) (string, string, error) {
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("неверный путь '%s'", path)
+	}
+	parts := strings.Split(path[1:], "/")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("путь '%s' должен иметь вид /<section>/<key>", path)
+	}
+	return unescapePointer(parts[0]), unescapePointer(parts[1]), nil
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+func patchString(s string) *string {
+	return &s
+}
+
+func mergeValuePtr(v MergeValue) *string {
+	if !v.Exists {
+		return nil
+	}
+	return patchString(v.Value)
+}
+
+func patchValueString(v *string) string {
+	if v == nil {
+		return "N/A"
+	}
+	return *v
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiffPatchRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to map[string]map[string]string
+		ops      []string
+	}{
+		{
+			name: "no changes",
+			from: map[string]map[string]string{"": {"work_mem": "4MB"}},
+			to:   map[string]map[string]string{"": {"work_mem": "4MB"}},
+		},
+		{
+			name: "add, replace and remove",
+			from: map[string]map[string]string{"": {"work_mem": "4MB", "fsync": "on"}},
+			to:   map[string]map[string]string{"": {"work_mem": "8MB", "max_connections": "100"}},
+			ops:  []string{"test", "remove", "add", "test", "replace"},
+		},
+		{
+			name: "sections",
+			from: map[string]map[string]string{"pgbouncer": {"pool_mode": "session"}},
+			to:   map[string]map[string]string{"pgbouncer": {"pool_mode": "transaction"}, "databases": {"db": "host=x"}},
+			ops:  []string{"add", "test", "replace"},
+		},
+		{
+			name: "unit spelling is a change",
+			from: map[string]map[string]string{"": {"work_mem": "32MB"}},
+			to:   map[string]map[string]string{"": {"work_mem": "32768kB"}},
+			ops:  []string{"test", "replace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := DiffPatch(tt.from, tt.to)
+			var kinds []string
+			for _, op := range ops {
+				kinds = append(kinds, op.Op)
+			}
+			if !reflect.DeepEqual(kinds, tt.ops) {
+				t.Fatalf("DiffPatch ops = %v, want %v", kinds, tt.ops)
+			}
+
+			applied, err := ApplyPatch(tt.from, ops)
+			if err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			if !reflect.DeepEqual(applied, tt.to) {
+				t.Errorf("ApplyPatch = %v, want %v", applied, tt.to)
+			}
+
+			inverse, err := InvertPatch(ops)
+			if err != nil {
+				t.Fatalf("InvertPatch: %v", err)
+			}
+			reverted, err := ApplyPatch(applied, inverse)
+			if err != nil {
+				t.Fatalf("ApplyPatch(inverse): %v", err)
+			}
+			if !reflect.DeepEqual(reverted, tt.from) {
+				t.Errorf("inverse patch = %v, want %v", reverted, tt.from)
+			}
+		})
+	}
+}
+
+func TestApplyPatchPreconditions(t *testing.T) {
+	config := map[string]map[string]string{"": {"work_mem": "4MB"}}
+	tests := []struct {
+		name     string
+		ops      []PatchOp
+		conflict bool
+	}{
+		{"test matches", []PatchOp{
+			{Op: PatchOpTest, Path: "//work_mem", Value: patchString("4MB")},
+			{Op: PatchOpReplace, Path: "//work_mem", Value: patchString("8MB")},
+		}, false},
+		{"test matches in other unit", []PatchOp{
+			{Op: PatchOpTest, Path: "//work_mem", Value: patchString("4096kB")},
+		}, false},
+		{"test differs", []PatchOp{
+			{Op: PatchOpTest, Path: "//work_mem", Value: patchString("16MB")},
+			{Op: PatchOpReplace, Path: "//work_mem", Value: patchString("8MB")},
+		}, true},
+		{"add existing with other value", []PatchOp{
+			{Op: PatchOpAdd, Path: "//work_mem", Value: patchString("8MB")},
+		}, true},
+		{"add existing with same value", []PatchOp{
+			{Op: PatchOpAdd, Path: "//work_mem", Value: patchString("4MB")},
+		}, false},
+		{"remove missing", []PatchOp{
+			{Op: PatchOpRemove, Path: "//fsync"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyPatch(config, tt.ops)
+			var patchErr *PatchError
+			if got := errors.As(err, &patchErr); got != tt.conflict {
+				t.Errorf("ApplyPatch conflict = %v (err %v), want %v", got, err, tt.conflict)
+			}
+		})
+	}
+	if config[""]["work_mem"] != "4MB" {
+		t.Errorf("ApplyPatch modified its input: %v", config)
+	}
+}
+
+func TestPatchPath(t *testing.T) {
+	tests := []struct {
+		section, key, path string
+	}{
+		{"", "work_mem", "//work_mem"},
+		{"pgbouncer", "pool_mode", "/pgbouncer/pool_mode"},
+		{"a/b", "c~d", "/a~1b/c~0d"},
+	}
+	for _, tt := range tests {
+		if got := PatchPath(tt.section, tt.key); got != tt.path {
+			t.Errorf("PatchPath(%q, %q) = %q, want %q", tt.section, tt.key, got, tt.path)
+		}
+		section, key, err := ParsePatchPath(tt.path)
+		if err != nil || section != tt.section || key != tt.key {
+			t.Errorf("ParsePatchPath(%q) = %q, %q, %v", tt.path, section, key, err)
+		}
+	}
+	for _, bad := range []string{"work_mem", "/work_mem", "/a/b/c", "/a/"} {
+		if _, _, err := ParsePatchPath(bad); err == nil {
+			t.Errorf("ParsePatchPath(%q): ожидалась ошибка", bad)
+		}
+	}
+}
+
+func TestParseSnapshotPatchLegacy(t *testing.T) {
+	legacy := `{
+		"pgbouncer.pool_mode": {"source": "session", "target": "transaction", "status": "Different"},
+		"work_mem": {"source": "4MB", "status": "Only in source"},
+		"fsync": {"target": "on", "status": "Only in target"}
+	}`
+	ops, err := ParseSnapshotPatch(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PatchOp{
+		{Op: PatchOpAdd, Path: "//fsync", Value: patchString("on")},
+		{Op: PatchOpTest, Path: "/pgbouncer/pool_mode", Value: patchString("session")},
+		{Op: PatchOpReplace, Path: "/pgbouncer/pool_mode", Value: patchString("transaction")},
+		{Op: PatchOpTest, Path: "//work_mem", Value: patchString("4MB")},
+		{Op: PatchOpRemove, Path: "//work_mem"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("ParseSnapshotPatch = %+v, want %+v", ops, want)
+	}
+}
+
+func TestParseSnapshotPatchValidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		ok    bool
+	}{
+		{"valid", `[{"op": "test", "path": "//work_mem", "value": "4MB"}, {"op": "remove", "path": "//work_mem"}]`, true},
+		{"add without value", `[{"op": "add", "path": "//work_mem"}]`, false},
+		{"replace without value", `[{"op": "replace", "path": "//work_mem"}]`, false},
+		{"test without value", `[{"op": "test", "path": "//work_mem"}]`, false},
+		{"unknown op", `[{"op": "move", "path": "//work_mem", "value": "4MB"}]`, false},
+		{"bad path", `[{"op": "remove", "path": "work_mem"}]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSnapshotPatch(tt.patch)
+			if (err == nil) != tt.ok {
+				t.Errorf("ParseSnapshotPatch(%s) error = %v, want ok %v", tt.patch, err, tt.ok)
+			}
+		})
+	}
+}
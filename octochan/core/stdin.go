@@ -0,0 +1,53 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"sync"
+)
+
+// Ответы оператора (токен, парольная фраза, подтверждение раскатки) читаются
+// одним буферизованным читателем stdin: у отдельных bufio.Reader первый
+// забирает в буфер строки, предназначенные второму.
+var (
+	stdinMu      sync.Mutex
+	stdinReader  *bufio.Reader
+	stdinPending chan stdinLine
+)
+
+type stdinLine struct {
+	text string
+	err  error
+}
+
+// ReadStdinLine читает строку stdin вместе с '\n'. Ожидание прерывается
+// отменой ctx; прочитанная после этого строка достаётся следующему вызову.
+func ReadStdinLine(ctx context.Context) (string, error) {
+	stdinMu.Lock()
+	if stdinReader == nil {
+		stdinReader = bufio.NewReader(os.Stdin)
+	}
+	pending := stdinPending
+	if pending == nil {
+		pending = make(chan stdinLine, 1)
+		stdinPending = pending
+		go func() {
+			text, err := stdinReader.ReadString('\n')
+			pending <- stdinLine{text: text, err: err}
+		}()
+	}
+	stdinMu.Unlock()
+
+	select {
+	case line := <-pending:
+		stdinMu.Lock()
+		if stdinPending == pending {
+			stdinPending = nil
+		}
+		stdinMu.Unlock()
+		return line.text, line.err
+	case <-ctx.Done():
+		return "", context.Cause(ctx)
+	}
+}
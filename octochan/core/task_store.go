@@ -0,0 +1,338 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskRecord - задача RLM, созданная через ochan. Хранится локально, чтобы
+// статус можно было посмотреть и отслеживать в следующих сессиях.
+type TaskRecord struct {
+	ID           string                   `json:"id"`
+	RLM          string                   `json:"rlm,omitempty"`
+	Service      string                   `json:"service"`
+	ScenarioHash string                   `json:"scenario_hash"`
+	Targets      []string                 `json:"targets"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+	Status       string                   `json:"status"`
+	Events       []map[string]interface{} `json:"events,omitempty"`
+	Request      map[string]interface{}   `json:"request,omitempty"`
+}
+
+// Key - ключ задачи в реестре: ID для основного экземпляра RLM и
+// "ID@экземпляр" для остальных, чтобы номера задач разных RLM не совпадали.
+func (rec *TaskRecord) Key() string {
+	return TaskKey(rec.RLM, rec.ID)
+}
+
+func TaskKey(rlm, taskID string) string {
+	if rlm == "" || rlm == DefaultRLMInstance {
+		return taskID
+	}
+	return taskID + "@" + rlm
+}
+
+// ParseTaskKey разбирает ключ реестра на ID задачи и экземпляр RLM.
+func ParseTaskKey(key string) (taskID, rlm string) {
+	taskID, rlm, _ = strings.Cut(key, "@")
+	if rlm == "" {
+		rlm = DefaultRLMInstance
+	}
+	return taskID, rlm
+}
+
+// TaskFilter - условия tasks list. Пустые поля не фильтруют.
+type TaskFilter struct {
+	Service string
+	Status  string
+	Target  string
+	RLM     string
+	Since   time.Time
+	Active  bool
+}
+
+func (f TaskFilter) Match(rec *TaskRecord) bool {
+	if f.Service != "" && rec.Service != f.Service {
+		return false
+	}
+	if f.RLM != "" && TaskKey(f.RLM, "") != TaskKey(rec.RLM, "") {
+		return false
+	}
+	if f.Status != "" && !strings.EqualFold(rec.Status, f.Status) {
+		return false
+	}
+	if f.Active && IsTerminalTaskStatus(rec.Status) {
+		return false
+	}
+	if !f.Since.IsZero() && rec.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if f.Target != "" {
+		for _, target := range rec.Targets {
+			if strings.EqualFold(target, f.Target) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+var terminalTaskStatuses = map[string]bool{
+	"completed": true,
+	"success":   true,
+	"finished":  true,
+	"failed":    true,
+	"error":     true,
+	"canceled":  true,
+	"cancelled": true,
+}
+
+// IsTerminalTaskStatus сообщает, что задача больше не изменит статус.
+func IsTerminalTaskStatus(status string) bool {
+	return terminalTaskStatuses[strings.ToLower(status)]
+}
+
+// ScenarioHash - SHA-256 исходного файла сценария.
+func ScenarioHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestTargets извлекает CI из тела запроса: items[].invsvm_ci_svm,
+// params.svm_ci и params.hosts[].svm_ci.
+func RequestTargets(body map[string]interface{}) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(value interface{}) {
+		if ci, ok := value.(string); ok && ci != "" && !seen[ci] {
+			seen[ci] = true
+			targets = append(targets, ci)
+		}
+	}
+
+	for _, item := range toInterfaceSlice(body["items"]) {
+		if fields, ok := item.(map[string]interface{}); ok {
+			add(fields["invsvm_ci_svm"])
+		}
+	}
+	if params, ok := body["params"].(map[string]interface{}); ok {
+		add(params["svm_ci"])
+		for _, host := range toInterfaceSlice(params["hosts"]) {
+			if fields, ok := host.(map[string]interface{}); ok {
+				add(fields["svm_ci"])
+			}
+		}
+	}
+	return targets
+}
+
+// toInterfaceSlice приводит списки из модулей ([]map[...]...) и из JSON
+// ([]interface{}) к одному виду.
+func toInterfaceSlice(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []map[string]interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return items
+	case []map[string]string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			fields := make(map[string]interface{}, len(item))
+			for k, val := range item {
+				fields[k] = val
+			}
+			items[i] = fields
+		}
+		return items
+	}
+	return nil
+}
+
+func GetTasksDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+	}
+	return filepath.Join(home, ".octochan", "tasks"), nil
+}
+
+// TaskStore хранит задачи в файлах task_<ключ>.json.
+type TaskStore struct {
+	dir string
+}
+
+func NewTaskStore(dir string) (*TaskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию задач: %w", err)
+	}
+	return &TaskStore{dir: dir}, nil
+}
+
+func DefaultTaskStore() (*TaskStore, error) {
+	dir, err := GetTasksDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewTaskStore(dir)
+}
+
+func (s *TaskStore) path(key string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("task_%s.json", key))
+}
+
+// Save записывает задачу через временный файл, чтобы параллельный
+// мониторинг не оставил файл наполовину записанным.
+func (s *TaskStore) Save(rec *TaskRecord) error {
+	if rec.ID == "" {
+		return fmt.Errorf("пустой ID задачи")
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи %s: %w", rec.ID, err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "task_*.tmp")
+	if err != nil {
+		return fmt.Errorf("ошибка записи задачи %s: %w", rec.ID, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи задачи %s: %w", rec.ID, err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.path(rec.Key())); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи задачи %s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+func (s *TaskStore) Load(key string) (*TaskRecord, error) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("задача %s не найдена в локальном реестре", key)
+		}
+		return nil, fmt.Errorf("ошибка чтения задачи %s: %w", key, err)
+	}
+	var rec TaskRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("ошибка разбора задачи %s: %w", key, err)
+	}
+	return &rec, nil
+}
+
+// List возвращает задачи, подходящие под фильтр, от новых к старым.
+func (s *TaskStore) List(filter TaskFilter) ([]*TaskRecord, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения директории задач: %w", err)
+	}
+
+	var records []*TaskRecord
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "task_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		rec, err := s.Load(strings.TrimSuffix(strings.TrimPrefix(name, "task_"), ".json"))
+		if err != nil {
+			continue
+		}
+		if filter.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+// Update загружает задачу, применяет fn и сохраняет её с новым UpdatedAt.
+func (s *TaskStore) Update(key string, fn func(rec *TaskRecord)) (*TaskRecord, error) {
+	rec, err := s.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	fn(rec)
+	rec.UpdatedAt = time.Now()
+	return rec, s.Save(rec)
+}
+
+// UpdateFromAPI переносит в запись статус и события из ответа RLM.
+func (s *TaskStore) UpdateFromAPI(key string, status map[string]interface{}) (*TaskRecord, error) {
+	return s.Update(key, func(rec *TaskRecord) {
+		if value, ok := status["status"].(string); ok {
+			rec.Status = value
+		}
+		switch events := status["events"].(type) {
+		case []map[string]interface{}:
+			rec.Events = events
+		case []interface{}:
+			rec.Events = nil
+			for _, event := range events {
+				if fields, ok := event.(map[string]interface{}); ok {
+					rec.Events = append(rec.Events, fields)
+				}
+			}
+		}
+	})
+}
+
+// recordCreatedTask сохраняет только что созданную задачу. Ошибка реестра
+// не должна прерывать применение сценария, поэтому она только логируется.
+func recordCreatedTask(client *RLMClient, taskID, scenarioHash string, req *APIRequest) {
+	store, err := DefaultTaskStore()
+	if err != nil {
+		fmt.Printf("⚠️ Задача %s не сохранена в реестре: %v\n", taskID, err)
+		return
+	}
+
+	service, _ := req.Body["service"].(string)
+	now := time.Now()
+	rec := &TaskRecord{
+		ID:           taskID,
+		RLM:          client.Name(),
+		Service:      service,
+		ScenarioHash: scenarioHash,
+		Targets:      RequestTargets(req.Body),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Status:       "created",
+		Request:      req.Body,
+	}
+	if err := store.Save(rec); err != nil {
+		fmt.Printf("⚠️ Задача %s не сохранена в реестре: %v\n", taskID, err)
+	}
+}
+
+// recordTaskStatus обновляет статус задачи в реестре, если она там есть.
+func recordTaskStatus(client *RLMClient, taskID string, status map[string]interface{}) {
+	store, err := DefaultTaskStore()
+	if err != nil {
+		return
+	}
+	key := TaskKey(client.Name(), taskID)
+	if _, err := store.UpdateFromAPI(key, status); err != nil && FileExists(store.path(key)) {
+		fmt.Printf("⚠️ Не удалось обновить задачу %s в реестре: %v\n", taskID, err)
+	}
+}
+
+var ErrCancelUnsupported = errors.New("RLM не поддерживает отмену задачи")
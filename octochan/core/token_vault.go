@@ -0,0 +1,526 @@
+package core
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Хранилище токенов ~/.octochan/vault.json. Каждый токен зашифрован
+// AES-256-GCM ключом, полученным из парольной фразы через PBKDF2-HMAC-SHA256.
+// Метаданные (когда сохранён, когда истекает, когда использован, когда RLM
+// ответил 401) хранятся открыто, чтобы auth status работал без пароля.
+//
+// Парольная фраза берётся из OCHAN_VAULT_PASSPHRASE, иначе запрашивается
+// в терминале один раз за процесс.
+
+const (
+	VaultPassphraseEnv = "OCHAN_VAULT_PASSPHRASE"
+
+	vaultVersion    = 1
+	vaultKDFName    = "pbkdf2-hmac-sha256"
+	vaultIterations = 600000
+	vaultSaltSize   = 16
+	vaultKeySize    = 32
+
+	// vaultTouchInterval - не чаще этого last_used перезаписывается на диск.
+	vaultTouchInterval = time.Minute
+)
+
+var (
+	ErrVaultWrongPassphrase = errors.New("неверная парольная фраза хранилища токенов")
+	ErrVaultLocked          = errors.New("хранилище токенов не разблокировано")
+)
+
+type VaultKDF struct {
+	Name       string `json:"name"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+}
+
+// VaultEntry - токен одного экземпляра RLM.
+type VaultEntry struct {
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	SavedAt    time.Time `json:"saved_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsed   time.Time `json:"last_used"`
+	RejectedAt time.Time `json:"rejected_at"`
+}
+
+// Rejected - RLM ответил 401 на токен после его сохранения.
+func (e *VaultEntry) Rejected() bool {
+	return !e.RejectedAt.IsZero() && e.RejectedAt.After(e.SavedAt)
+}
+
+// State - состояние токена для auth status.
+func (e *VaultEntry) State(now time.Time) string {
+	switch {
+	case e.Rejected():
+		return "отклонён RLM (401)"
+	case !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt):
+		return "истёк"
+	default:
+		return "действителен"
+	}
+}
+
+type TokenVault struct {
+	Version int                    `json:"version"`
+	KDF     VaultKDF               `json:"kdf"`
+	Entries map[string]*VaultEntry `json:"entries"`
+
+	path string
+	key  []byte
+}
+
+func GetVaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+	}
+	return filepath.Join(home, ".octochan", "vault.json"), nil
+}
+
+// LoadTokenVault читает хранилище; если файла нет, возвращает пустое.
+func LoadTokenVault() (*TokenVault, error) {
+	path, err := GetVaultPath()
+	if err != nil {
+		return nil, err
+	}
+	vault := &TokenVault{Version: vaultVersion, Entries: make(map[string]*VaultEntry), path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return vault, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения хранилища токенов: %w", err)
+	}
+	if err := json.Unmarshal(data, vault); err != nil {
+		return nil, fmt.Errorf("хранилище токенов %s повреждено: %w", path, err)
+	}
+	if vault.Version != vaultVersion || vault.KDF.Name != vaultKDFName {
+		return nil, fmt.Errorf("неподдерживаемый формат хранилища токенов: версия %d, %s", vault.Version, vault.KDF.Name)
+	}
+	if vault.Entries == nil {
+		vault.Entries = make(map[string]*VaultEntry)
+	}
+	return vault, nil
+}
+
+func (v *TokenVault) Path() string {
+	return v.path
+}
+
+func (v *TokenVault) Empty() bool {
+	return len(v.Entries) == 0
+}
+
+// Unlock выводит ключ из парольной фразы и проверяет его на одной из записей.
+// У пустого хранилища соль создаётся заново.
+func (v *TokenVault) Unlock(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("пустая парольная фраза")
+	}
+	if v.Empty() {
+		salt := make([]byte, vaultSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return fmt.Errorf("ошибка генерации соли: %w", err)
+		}
+		v.KDF = VaultKDF{Name: vaultKDFName, Iterations: vaultIterations, Salt: salt}
+	}
+
+	key := cachedVaultKey(v.KDF, passphrase)
+	for name, entry := range v.Entries {
+		if _, err := openVaultEntry(key, name, entry); err != nil {
+			return ErrVaultWrongPassphrase
+		}
+		break
+	}
+	v.key = key
+	return nil
+}
+
+// Put шифрует и сохраняет токен экземпляра. Нулевой expiresAt - срок неизвестен.
+func (v *TokenVault) Put(name, token string, expiresAt time.Time) error {
+	if v.key == nil {
+		return ErrVaultLocked
+	}
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+
+	v.Entries[name] = &VaultEntry{
+		Nonce: nonce,
+		// Имя экземпляра - дополнительные данные GCM: запись нельзя
+		// подставить другому экземпляру.
+		Ciphertext: gcm.Seal(nil, nonce, []byte(token), []byte(name)),
+		SavedAt:    time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	vaultMu.Lock()
+	delete(vaultTokens, name)
+	vaultMu.Unlock()
+	return nil
+}
+
+// Token расшифровывает токен экземпляра. Для отсутствующей записи - "", nil.
+func (v *TokenVault) Token(name string) (string, error) {
+	entry, ok := v.Entries[name]
+	if !ok {
+		return "", nil
+	}
+	if v.key == nil {
+		return "", ErrVaultLocked
+	}
+	token, err := openVaultEntry(v.key, name, entry)
+	if err != nil {
+		return "", ErrVaultWrongPassphrase
+	}
+	return string(token), nil
+}
+
+func (v *TokenVault) Remove(name string) bool {
+	if _, ok := v.Entries[name]; !ok {
+		return false
+	}
+	delete(v.Entries, name)
+	return true
+}
+
+// Save атомарно записывает хранилище с правами 0600. Пустое хранилище
+// удаляется с диска.
+func (v *TokenVault) Save() error {
+	if v.Empty() {
+		if err := os.Remove(v.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("ошибка удаления хранилища токенов: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации хранилища токенов: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return fmt.Errorf("ошибка записи хранилища токенов: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), "vault_*.tmp")
+	if err != nil {
+		return fmt.Errorf("ошибка записи хранилища токенов: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи хранилища токенов: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("ошибка записи хранилища токенов: %w", err)
+	}
+	return nil
+}
+
+func openVaultEntry(key []byte, name string, entry *VaultEntry) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, entry.Nonce, entry.Ciphertext, []byte(name))
+}
+
+// pbkdf2SHA256 - PBKDF2 (RFC 8018) с HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	key := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// Ключи и токены кешируются на время процесса, чтобы интерактивная сессия
+// спрашивала пароль и выполняла PBKDF2 один раз.
+var (
+	vaultMu         sync.Mutex
+	vaultKeys       = make(map[string][]byte)
+	vaultTokens     = make(map[string]string)
+	vaultPassphrase string
+)
+
+func cachedVaultKey(kdf VaultKDF, passphrase string) []byte {
+	id := base64.StdEncoding.EncodeToString(kdf.Salt) + ":" + passphrase
+	if key, ok := vaultKeys[id]; ok {
+		return key
+	}
+	key := pbkdf2SHA256([]byte(passphrase), kdf.Salt, kdf.Iterations, vaultKeySize)
+	vaultKeys[id] = key
+	return key
+}
+
+// ForgetVaultSecrets сбрасывает кеш ключей, токенов и парольной фразы.
+func ForgetVaultSecrets() {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	vaultKeys = make(map[string][]byte)
+	vaultTokens = make(map[string]string)
+	vaultPassphrase = ""
+}
+
+// VaultPassphrase - парольная фраза из OCHAN_VAULT_PASSPHRASE или терминала.
+// confirm просит ввести её дважды (при создании хранилища).
+func VaultPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(VaultPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	vaultMu.Lock()
+	cached := vaultPassphrase
+	vaultMu.Unlock()
+	if cached != "" {
+		return cached, nil
+	}
+
+	passphrase, err := readSecret("🔑 Парольная фраза хранилища токенов: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("пустая парольная фраза")
+	}
+	if confirm {
+		again, err := readSecret("🔑 Повторите парольную фразу: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("парольные фразы не совпадают")
+		}
+	}
+	vaultMu.Lock()
+	vaultPassphrase = passphrase
+	vaultMu.Unlock()
+	return passphrase, nil
+}
+
+// UnlockTokenVault читает хранилище и разблокирует его парольной фразой.
+func UnlockTokenVault() (*TokenVault, error) {
+	vault, err := LoadTokenVault()
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := VaultPassphrase(vault.Empty())
+	if err != nil {
+		return nil, err
+	}
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	if err := vault.Unlock(passphrase); err != nil {
+		if errors.Is(err, ErrVaultWrongPassphrase) {
+			vaultPassphrase = ""
+		}
+		return nil, err
+	}
+	return vault, nil
+}
+
+// VaultHasToken сообщает, что в хранилище есть токен экземпляра. Пароль
+// для этого не нужен.
+func VaultHasToken(name string) bool {
+	vault, err := LoadTokenVault()
+	if err != nil {
+		return false
+	}
+	_, ok := vault.Entries[name]
+	return ok
+}
+
+// VaultToken - токен экземпляра из хранилища. Если записи нет, пароль не
+// запрашивается и возвращается "".
+func VaultToken(name string) (string, error) {
+	vaultMu.Lock()
+	token, ok := vaultTokens[name]
+	vaultMu.Unlock()
+	if ok {
+		return token, nil
+	}
+
+	vault, err := LoadTokenVault()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := vault.Entries[name]; !ok {
+		return "", nil
+	}
+	if vault, err = UnlockTokenVault(); err != nil {
+		return "", fmt.Errorf("не удалось открыть хранилище токенов: %w", err)
+	}
+	if token, err = vault.Token(name); err != nil {
+		return "", err
+	}
+
+	vaultMu.Lock()
+	vaultTokens[name] = token
+	vaultMu.Unlock()
+	return token, nil
+}
+
+// updateVaultEntry меняет метаданные записи без парольной фразы.
+func updateVaultEntry(name string, fn func(entry *VaultEntry) bool) {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	vault, err := LoadTokenVault()
+	if err != nil {
+		return
+	}
+	entry, ok := vault.Entries[name]
+	if !ok || !fn(entry) {
+		return
+	}
+	if err := vault.Save(); err != nil {
+		fmt.Printf("⚠️ %v\n", err)
+	}
+}
+
+// markVaultTokenUsed запоминает успешный запрос к RLM с токеном экземпляра.
+func markVaultTokenUsed(name string) {
+	updateVaultEntry(name, func(entry *VaultEntry) bool {
+		now := time.Now()
+		if now.Sub(entry.LastUsed) < vaultTouchInterval && !entry.Rejected() {
+			return false
+		}
+		entry.LastUsed = now
+		entry.RejectedAt = time.Time{}
+		return true
+	})
+}
+
+// markVaultTokenRejected запоминает ответ 401: токен истёк или отозван.
+func markVaultTokenRejected(name string) {
+	updateVaultEntry(name, func(entry *VaultEntry) bool {
+		if entry.Rejected() {
+			return false
+		}
+		entry.RejectedAt = time.Now()
+		return true
+	})
+}
+
+// TokenExpiry - срок действия из поля exp, если токен - JWT. Для остальных
+// токенов срок неизвестен до первого ответа 401.
+func TokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.Exp), 0)
+}
+
+// LegacyEnvTokenPath - файл, куда прежние версии auth писали токен открытым
+// текстом (API_TOKEN=...).
+func LegacyEnvTokenPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить домашнюю директорию: %w", err)
+	}
+	return filepath.Join(home, ".octochan", ".env"), nil
+}
+
+// LegacyEnvToken читает токен из ~/.octochan/.env, если файл остался.
+func LegacyEnvToken() string {
+	path, err := LegacyEnvTokenPath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if token, ok := strings.CutPrefix(strings.TrimSpace(line), "API_TOKEN="); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// readSecret читает строку из терминала без эха. Если stdin не терминал,
+// строка читается как есть.
+func readSecret(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			stty("echo")
+			fmt.Println()
+		}()
+	}
+	line, err := ReadStdinLine(context.Background())
+	if err != nil && line == "" {
+		return "", fmt.Errorf("не удалось прочитать парольную фразу: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Тестовые векторы RFC 7914, раздел 11.
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+// testVault создаёт хранилище в чистом HOME с токенами default и test.
+func testVault(t *testing.T) *TokenVault {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(VaultPassphraseEnv, "correct horse")
+	ForgetVaultSecrets()
+	t.Cleanup(ForgetVaultSecrets)
+
+	vault, err := UnlockTokenVault()
+	if err != nil {
+		t.Fatalf("UnlockTokenVault: %v", err)
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := vault.Put("default", "token-default", expires); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := vault.Put("test", "token-test", time.Time{}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := vault.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return vault
+}
+
+func TestTokenVaultRoundTrip(t *testing.T) {
+	saved := testVault(t)
+
+	info, err := os.Stat(saved.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("права хранилища = %o, want 600", mode)
+	}
+
+	ForgetVaultSecrets()
+	vault, err := UnlockTokenVault()
+	if err != nil {
+		t.Fatalf("UnlockTokenVault: %v", err)
+	}
+	for name, want := range map[string]string{"default": "token-default", "test": "token-test", "missing": ""} {
+		got, err := vault.Token(name)
+		if err != nil || got != want {
+			t.Errorf("Token(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if !vault.Entries["default"].ExpiresAt.Equal(saved.Entries["default"].ExpiresAt) {
+		t.Errorf("ExpiresAt = %s, want %s", vault.Entries["default"].ExpiresAt, saved.Entries["default"].ExpiresAt)
+	}
+
+	ForgetVaultSecrets()
+	if got, err := VaultToken("test"); err != nil || got != "token-test" {
+		t.Errorf("VaultToken(test) = %q, %v", got, err)
+	}
+}
+
+func TestTokenVaultWrongPassphrase(t *testing.T) {
+	testVault(t)
+
+	t.Setenv(VaultPassphraseEnv, "wrong")
+	ForgetVaultSecrets()
+	if _, err := UnlockTokenVault(); !errors.Is(err, ErrVaultWrongPassphrase) {
+		t.Errorf("UnlockTokenVault с неверной фразой: %v, want ErrVaultWrongPassphrase", err)
+	}
+
+	locked, err := LoadTokenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locked.Token("default"); !errors.Is(err, ErrVaultLocked) {
+		t.Errorf("Token без Unlock: %v, want ErrVaultLocked", err)
+	}
+}
+
+func TestTokenVaultSwappedCiphertext(t *testing.T) {
+	testVault(t)
+	ForgetVaultSecrets()
+
+	vault, err := UnlockTokenVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Имя экземпляра входит в AAD: чужая запись не расшифруется.
+	vault.Entries["default"], vault.Entries["test"] = vault.Entries["test"], vault.Entries["default"]
+	for _, name := range []string{"default", "test"} {
+		if got, err := vault.Token(name); err == nil {
+			t.Errorf("Token(%q) после подмены записи = %q, ожидалась ошибка", name, got)
+		}
+	}
+}
+
+func TestTokenVaultSaveEmptyRemovesFile(t *testing.T) {
+	vault := testVault(t)
+
+	vault.Remove("default")
+	if err := vault.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(vault.Path()); err != nil {
+		t.Fatalf("хранилище с одной записью удалено: %v", err)
+	}
+
+	vault.Remove("test")
+	if err := vault.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(vault.Path()); !os.IsNotExist(err) {
+		t.Errorf("пустое хранилище осталось на диске: %v", err)
+	}
+	if loaded, err := LoadTokenVault(); err != nil || !loaded.Empty() {
+		t.Errorf("LoadTokenVault после удаления = %v, %v", loaded, err)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		token string
+		want  time.Time
+	}{
+		{"eyJhbGciOiJIUzI1NiJ9.eyJleHAiOjE4OTM0NTYwMDB9.c2ln", time.Unix(1893456000, 0)},
+		{"eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln", time.Time{}},
+		{"plain-token", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := TokenExpiry(tt.token); !got.Equal(tt.want) {
+			t.Errorf("TokenExpiry(%q) = %s, want %s", tt.token, got, tt.want)
+		}
+	}
+}
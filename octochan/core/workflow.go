@@ -0,0 +1,828 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow - цепочка сценариев разных сервисов:
+//
+//	name: tune-and-restart
+//	steps:
+//	  - name: before
+//	    service: postgresql_se_get_config_files
+//	    parameters: {port: 5432, config_list: [postgresql.conf], itemname: psql}
+//	    targets: [{svm_ci: CI01}]
+//	  - name: tune
+//	    scenario: tune.yaml
+//	  - name: restart
+//	    service: pangolin_restart
+//	    when: tune.succeeded && env.restart
+//	    parameters: {restart: "{{ .steps.tune.result.restart_mode }}"}
+//	    targets: [{svm_ci: CI01}]
+//	  - name: after
+//	    service: postgresql_se_get_config_files
+//	    when: always()
+//	    ...
+//	  - name: compare
+//	    diff: {from: before, to: after}
+//
+// Если ни у одного шага нет needs, шаги выполняются по порядку и каждый
+// зависит от предыдущего. Иначе шаги образуют граф: шаг запускается, когда
+// завершены все шаги из needs, независимые шаги выполняются параллельно.
+//
+// Результаты шагов доступны следующим шагам в шаблонах как
+// .steps.<шаг>.result.<поле>, а в условиях when как <шаг>.result.<поле>.
+// Кроме result у шага есть status, succeeded, failed, skipped, tasks и
+// results (результаты по целям).
+
+// Состояния шага workflow.
+const (
+	WorkflowStepPending   = "pending"
+	WorkflowStepSucceeded = "succeeded"
+	WorkflowStepFailed    = "failed"
+	WorkflowStepSkipped   = "skipped"
+)
+
+type Workflow struct {
+	Name  string          `yaml:"name"`
+	Steps []*WorkflowStep `yaml:"steps"`
+
+	path string
+}
+
+// WorkflowStep - шаг workflow. Сценарий шага задаётся файлом (scenario),
+// прямо в шаге (service, parameters, targets, items) или это сравнение
+// результатов двух предыдущих шагов (diff).
+type WorkflowStep struct {
+	Name     string `yaml:"name"`
+	Scenario string `yaml:"scenario"`
+
+	Service    string                   `yaml:"service"`
+	Parameters map[string]interface{}   `yaml:"parameters"`
+	Targets    interface{}              `yaml:"targets"`
+	Items      []map[string]interface{} `yaml:"items"`
+
+	Diff *WorkflowDiff `yaml:"diff"`
+
+	Needs []string `yaml:"needs"`
+	// When - условие запуска (см. EvalExpr). По умолчанию success(): все
+	// шаги из needs завершились успешно.
+	When string `yaml:"when"`
+	// Wait - ждать завершения задач шага, по умолчанию true. Без ожидания
+	// у шага нет результатов, только номера задач.
+	Wait            *bool         `yaml:"wait"`
+	Timeout         time.Duration `yaml:"timeout"`
+	TaskTimeout     time.Duration `yaml:"task_timeout"`
+	ContinueOnError bool          `yaml:"continue_on_error"`
+}
+
+// WorkflowDiff сравнивает результаты задач двух шагов по целям.
+type WorkflowDiff struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Output string `yaml:"output"`
+	Format string `yaml:"format"`
+}
+
+// WorkflowStepState - итог шага.
+type WorkflowStepState struct {
+	Name     string
+	Status   string
+	Reason   string
+	Outcomes []*TaskOutcome
+	Result   map[string]interface{}
+	Err      error
+	Started  time.Time
+	Finished time.Time
+
+	continueOnError bool
+}
+
+func (s *WorkflowStepState) Duration() time.Duration {
+	if s.Started.IsZero() || s.Finished.IsZero() {
+		return 0
+	}
+	return s.Finished.Sub(s.Started)
+}
+
+// ok - шаг не мешает запуску зависимых: успешен или упал с continue_on_error.
+func (s *WorkflowStepState) ok() bool {
+	return s.Status == WorkflowStepSucceeded || (s.Status == WorkflowStepFailed && s.continueOnError)
+}
+
+type WorkflowResult struct {
+	Steps []*WorkflowStepState
+}
+
+// Failed - шаги, упавшие без continue_on_error.
+func (r *WorkflowResult) Failed() []string {
+	var failed []string
+	for _, step := range r.Steps {
+		if step.Status == WorkflowStepFailed && !step.continueOnError {
+			failed = append(failed, step.Name)
+		}
+	}
+	return failed
+}
+
+var workflowStepName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Имена, занятые значениями выражений и шаблонов.
+var reservedStepNames = map[string]bool{"env": true, "environment": true, "steps": true, "table_id": true}
+
+// LoadWorkflow читает workflow и проверяет его структуру.
+func LoadWorkflow(path string) (*Workflow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения workflow: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	wf := &Workflow{path: path}
+	if err := decoder.Decode(wf); err != nil {
+		return nil, fmt.Errorf("ошибка парсинга workflow %s: %w", path, err)
+	}
+	if wf.Name == "" {
+		wf.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if errs := wf.check(); len(errs) > 0 {
+		return nil, fmt.Errorf("workflow %s, ошибок - %d:\n  - %s", wf.Name, len(errs), strings.Join(errs, "\n  - "))
+	}
+	return wf, nil
+}
+
+func (wf *Workflow) step(name string) *WorkflowStep {
+	for _, step := range wf.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+func (wf *Workflow) check() []string {
+	var errs []string
+	if len(wf.Steps) == 0 {
+		return []string{"steps: нет ни одного шага"}
+	}
+
+	seen := make(map[string]bool)
+	for i, step := range wf.Steps {
+		prefix := fmt.Sprintf("steps[%d]", i)
+		switch {
+		case step.Name == "":
+			errs = append(errs, prefix+": не задано имя шага (name)")
+		case !workflowStepName.MatchString(step.Name):
+			errs = append(errs, fmt.Sprintf("%s: имя %q может содержать только латиницу, цифры и _", prefix, step.Name))
+		case reservedStepNames[step.Name]:
+			errs = append(errs, fmt.Sprintf("%s: имя %q зарезервировано", prefix, step.Name))
+		case seen[step.Name]:
+			errs = append(errs, fmt.Sprintf("%s: шаг %s уже описан", prefix, step.Name))
+		}
+		seen[step.Name] = true
+		if step.Name != "" {
+			prefix = "шаг " + step.Name
+		}
+
+		kinds := 0
+		if step.Scenario != "" {
+			kinds++
+		}
+		if step.Service != "" {
+			kinds++
+			if _, ok := scenarioModules[step.Service]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: сервис %s не зарегистрирован", prefix, step.Service))
+			}
+		}
+		if step.Diff != nil {
+			kinds++
+		}
+		if kinds != 1 {
+			errs = append(errs, prefix+": укажите ровно одно из scenario, service или diff")
+		}
+		if step.Service == "" && (step.Parameters != nil || step.Targets != nil || step.Items != nil) {
+			errs = append(errs, prefix+": parameters, targets и items задаются вместе с service")
+		}
+
+		if step.When != "" {
+			if _, err := ParseExpr(step.When); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: некорректное условие when: %v", prefix, err))
+			}
+		}
+	}
+
+	for _, step := range wf.Steps {
+		for _, need := range step.Needs {
+			if need == step.Name {
+				errs = append(errs, fmt.Sprintf("шаг %s: зависит сам от себя", step.Name))
+			} else if wf.step(need) == nil {
+				errs = append(errs, fmt.Sprintf("шаг %s: needs ссылается на неизвестный шаг %s", step.Name, need))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if cycle := wf.findCycle(); cycle != nil {
+		return []string{"циклическая зависимость: " + strings.Join(cycle, " -> ")}
+	}
+
+	for _, step := range wf.Steps {
+		if step.Diff == nil {
+			continue
+		}
+		ancestors := wf.ancestors(step.Name)
+		for _, ref := range []string{step.Diff.From, step.Diff.To} {
+			if ref == "" {
+				errs = append(errs, fmt.Sprintf("шаг %s: для diff нужны from и to", step.Name))
+			} else if !ancestors[ref] {
+				errs = append(errs, fmt.Sprintf("шаг %s: diff ссылается на %s, который не выполняется до него (добавьте в needs)", step.Name, ref))
+			}
+		}
+	}
+	return errs
+}
+
+// Needs - шаги, от которых зависит шаг: needs или, если needs не задан ни у
+// одного шага, предыдущий шаг.
+func (wf *Workflow) Needs(name string) []string {
+	for _, step := range wf.Steps {
+		if len(step.Needs) > 0 {
+			return wf.step(name).Needs
+		}
+	}
+	for i, step := range wf.Steps {
+		if step.Name == name && i > 0 {
+			return []string{wf.Steps[i-1].Name}
+		}
+	}
+	return nil
+}
+
+func (wf *Workflow) ancestors(name string) map[string]bool {
+	result := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		for _, need := range wf.Needs(name) {
+			if !result[need] {
+				result[need] = true
+				visit(need)
+			}
+		}
+	}
+	visit(name)
+	return result
+}
+
+func (wf *Workflow) findCycle() []string {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, item := range path {
+				if item == name {
+					return append(append([]string(nil), path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, need := range wf.Needs(name) {
+			if cycle := visit(need); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, step := range wf.Steps {
+		if cycle := visit(step.Name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// Stages - шаги, сгруппированные по очереди запуска: шаги одной группы
+// могут выполняться параллельно.
+func (wf *Workflow) Stages() [][]string {
+	level := make(map[string]int)
+	var depth func(string) int
+	depth = func(name string) int {
+		if d, ok := level[name]; ok {
+			return d
+		}
+		d := 0
+		for _, need := range wf.Needs(name) {
+			d = max(d, depth(need)+1)
+		}
+		level[name] = d
+		return d
+	}
+
+	var stages [][]string
+	for _, step := range wf.Steps {
+		d := depth(step.Name)
+		for len(stages) <= d {
+			stages = append(stages, nil)
+		}
+		stages[d] = append(stages[d], step.Name)
+	}
+	return stages
+}
+
+// ValidateWorkflow проверяет сценарии шагов по схемам модулей. Шаги,
+// шаблоны которых ссылаются на результаты других шагов, проверяются только
+// при выполнении; их имена возвращаются в deferred.
+func ValidateWorkflow(client *RLMClient, wf *Workflow, vars ScenarioVars) (deferred []string, err error) {
+	var errs []string
+	for _, step := range wf.Steps {
+		if step.Diff != nil {
+			continue
+		}
+		if wf.usesStepResults(step) {
+			deferred = append(deferred, step.Name)
+			continue
+		}
+		data, renderErr := wf.scenarioData(step, vars)
+		if renderErr != nil {
+			errs = append(errs, fmt.Sprintf("шаг %s: %v", step.Name, renderErr))
+			continue
+		}
+		if _, err := ValidateScenario(client, data); err != nil {
+			errs = append(errs, fmt.Sprintf("шаг %s: %v", step.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return deferred, fmt.Errorf("workflow %s, ошибок - %d:\n  - %s", wf.Name, len(errs), strings.Join(errs, "\n  - "))
+	}
+	return deferred, nil
+}
+
+// RunWorkflow выполняет шаги workflow. Отмена ctx прекращает запуск новых
+// шагов; оставшиеся шаги помечаются пропущенными.
+func RunWorkflow(ctx context.Context, client *RLMClient, wf *Workflow, vars ScenarioVars, opts ExecOptions) *WorkflowResult {
+	states := make(map[string]*WorkflowStepState, len(wf.Steps))
+	result := &WorkflowResult{}
+	for _, step := range wf.Steps {
+		state := &WorkflowStepState{Name: step.Name, Status: WorkflowStepPending, continueOnError: step.ContinueOnError}
+		states[step.Name] = state
+		result.Steps = append(result.Steps, state)
+	}
+
+	type finished struct {
+		name  string
+		state WorkflowStepState
+	}
+	done := make(chan finished)
+	running := make(map[string]bool)
+
+	for {
+		for changed := true; changed; {
+			changed = false
+			for _, step := range wf.Steps {
+				state := states[step.Name]
+				if state.Status != WorkflowStepPending || running[step.Name] || !wf.needsFinished(step.Name, states) {
+					continue
+				}
+				changed = true
+
+				if ctx.Err() != nil {
+					state.Status, state.Reason = WorkflowStepSkipped, "выполнение прервано"
+					continue
+				}
+				run, err := wf.shouldRun(step, states, vars)
+				if err != nil {
+					state.Status, state.Err = WorkflowStepFailed, err
+					continue
+				}
+				if !run {
+					state.Status = WorkflowStepSkipped
+					state.Reason = "условие не выполнено"
+					if step.When != "" {
+						state.Reason += ": " + step.When
+					}
+					fmt.Printf("⏭ Шаг %s пропущен (%s)\n", step.Name, state.Reason)
+					continue
+				}
+
+				running[step.Name] = true
+				stepVars := withSteps(vars, workflowStepsValue(states))
+				go func(step *WorkflowStep) {
+					state := wf.runStep(ctx, client, step, stepVars, states, opts)
+					done <- finished{name: step.Name, state: state}
+				}(step)
+			}
+		}
+		if len(running) == 0 {
+			break
+		}
+		item := <-done
+		delete(running, item.name)
+		*states[item.name] = item.state
+	}
+	return result
+}
+
+func (wf *Workflow) needsFinished(name string, states map[string]*WorkflowStepState) bool {
+	for _, need := range wf.Needs(name) {
+		if states[need].Status == WorkflowStepPending {
+			return false
+		}
+	}
+	return true
+}
+
+// shouldRun вычисляет условие when шага. Функции success(), failure() и
+// always() относятся к шагам из needs.
+func (wf *Workflow) shouldRun(step *WorkflowStep, states map[string]*WorkflowStepState, vars ScenarioVars) (bool, error) {
+	needs := wf.Needs(step.Name)
+	success := true
+	failure := false
+	for _, need := range needs {
+		if !states[need].ok() {
+			success = false
+		}
+		if states[need].Status == WorkflowStepFailed {
+			failure = true
+		}
+	}
+	if step.When == "" {
+		return success, nil
+	}
+
+	values := workflowStepsValue(states)
+	env := &ExprEnv{
+		Resolve: func(name string) (ExprValue, bool) {
+			root, path, _ := strings.Cut(name, ".")
+			var value interface{}
+			switch root {
+			case "env":
+				value = vars.Vars
+			case "environment":
+				value = vars.Environment
+			default:
+				stepValue, ok := values[root]
+				if !ok {
+					return NullValue(), false
+				}
+				value = stepValue
+			}
+			if path != "" {
+				var ok bool
+				if value, ok = lookupPath(value, path); !ok {
+					return NullValue(), false
+				}
+			}
+			return exprValueOf(value), true
+		},
+		Funcs: map[string]ExprFunc{
+			"success": func(args []ExprValue) (ExprValue, error) { return BoolValue(success), nil },
+			"failure": func(args []ExprValue) (ExprValue, error) { return BoolValue(failure), nil },
+			"always":  func(args []ExprValue) (ExprValue, error) { return BoolValue(true), nil },
+		},
+	}
+	value, err := EvalExpr(step.When, env)
+	if err != nil {
+		return false, fmt.Errorf("ошибка условия when шага %s: %w", step.Name, err)
+	}
+	return value.Truthy(), nil
+}
+
+func (wf *Workflow) runStep(ctx context.Context, client *RLMClient, step *WorkflowStep, vars ScenarioVars, states map[string]*WorkflowStepState, opts ExecOptions) (state WorkflowStepState) {
+	state = WorkflowStepState{Name: step.Name, Started: time.Now(), continueOnError: step.ContinueOnError}
+	defer func() { state.Finished = time.Now() }()
+
+	if step.Diff != nil {
+		fmt.Printf("\n▶️ Шаг %s: сравнение %s и %s\n", step.Name, step.Diff.From, step.Diff.To)
+		state.Result, state.Err = diffWorkflowSteps(step.Diff, states[step.Diff.From], states[step.Diff.To])
+		state.Status = WorkflowStepSucceeded
+		if state.Err != nil {
+			state.Status = WorkflowStepFailed
+		}
+		return state
+	}
+
+	data, err := wf.scenarioData(step, vars)
+	if err != nil {
+		state.Status, state.Err = WorkflowStepFailed, err
+		return state
+	}
+
+	opts.Wait = step.Wait == nil || *step.Wait
+	if step.Timeout > 0 {
+		opts.Timeout = step.Timeout
+	}
+	if step.TaskTimeout > 0 {
+		opts.TaskTimeout = step.TaskTimeout
+	}
+
+	service := step.Service
+	if service == "" {
+		service = step.Scenario
+	}
+	fmt.Printf("\n▶️ Шаг %s: %s\n", step.Name, service)
+
+	execution, err := ExecuteModularScenarioContext(ctx, client, data, nil, opts)
+	if execution != nil {
+		state.Outcomes = execution.Outcomes
+	}
+	state.Err = err
+	state.Status = WorkflowStepSucceeded
+	switch {
+	case err != nil:
+		state.Status = WorkflowStepFailed
+	case opts.Wait && execution.Failed() > 0:
+		state.Status = WorkflowStepFailed
+		state.Err = fmt.Errorf("завершились с ошибкой: %d из %d задач", execution.Failed(), len(execution.Outcomes))
+	}
+
+	state.Result = make(map[string]interface{})
+	for _, outcome := range state.Outcomes {
+		mergeVars(state.Result, outcome.Result)
+	}
+	return state
+}
+
+// usesStepResults сообщает, что шаблоны шага ссылаются на .steps.
+func (wf *Workflow) usesStepResults(step *WorkflowStep) bool {
+	var source []byte
+	if step.Scenario != "" {
+		source, _ = os.ReadFile(wf.scenarioPath(step))
+	} else {
+		source, _ = json.Marshal([]interface{}{step.Parameters, step.Targets, step.Items})
+	}
+	return bytes.Contains(source, []byte(".steps"))
+}
+
+func (wf *Workflow) scenarioPath(step *WorkflowStep) string {
+	if filepath.IsAbs(step.Scenario) {
+		return step.Scenario
+	}
+	return filepath.Join(filepath.Dir(wf.path), step.Scenario)
+}
+
+// scenarioData - сценарий шага с подставленными переменными.
+func (wf *Workflow) scenarioData(step *WorkflowStep, vars ScenarioVars) ([]byte, error) {
+	if step.Scenario != "" {
+		data, err := os.ReadFile(wf.scenarioPath(step))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения сценария: %w", err)
+		}
+		return RenderScenario(data, vars)
+	}
+
+	scenario, err := renderWorkflowValue(map[string]interface{}{
+		"service":    step.Service,
+		"parameters": step.Parameters,
+		"targets":    step.Targets,
+		"items":      step.Items,
+	}, vars)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(scenario)
+}
+
+// renderWorkflowValue подставляет переменные во все строки значения. Строка,
+// целиком состоящая из одной подстановки, получает тип результата:
+// "{{ .env.port }}" -> 5432.
+func renderWorkflowValue(value interface{}, vars ScenarioVars) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !HasScenarioTemplate([]byte(v)) {
+			return v, nil
+		}
+		out, err := RenderScenario([]byte(v), vars)
+		if err != nil {
+			return nil, err
+		}
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") && strings.Count(trimmed, "{{") == 1 {
+			var typed interface{}
+			if err := yaml.Unmarshal(out, &typed); err == nil && typed != nil {
+				return typed, nil
+			}
+		}
+		return string(out), nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			rendered, err := renderWorkflowValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderWorkflowValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	case []map[string]interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			rendered, err := renderWorkflowValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+func withSteps(vars ScenarioVars, steps map[string]interface{}) ScenarioVars {
+	extra := make(map[string]interface{}, len(vars.Extra)+1)
+	for key, value := range vars.Extra {
+		extra[key] = value
+	}
+	extra["steps"] = steps
+	vars.Extra = extra
+	return vars
+}
+
+// workflowStepsValue - завершённые шаги в виде, доступном шаблонам и
+// условиям when.
+func workflowStepsValue(states map[string]*WorkflowStepState) map[string]interface{} {
+	steps := make(map[string]interface{}, len(states))
+	for name, state := range states {
+		if state.Status == WorkflowStepPending {
+			continue
+		}
+		tasks := make([]interface{}, 0, len(state.Outcomes))
+		results := make(map[string]interface{})
+		for _, outcome := range state.Outcomes {
+			if outcome.ID != "" {
+				tasks = append(tasks, outcome.ID)
+			}
+			results[outcomeTargetKey(outcome)] = outcome.Result
+		}
+		result := state.Result
+		if result == nil {
+			result = map[string]interface{}{}
+		}
+		steps[name] = map[string]interface{}{
+			"status":    state.Status,
+			"succeeded": state.Status == WorkflowStepSucceeded,
+			"failed":    state.Status == WorkflowStepFailed,
+			"skipped":   state.Status == WorkflowStepSkipped,
+			"tasks":     tasks,
+			"result":    result,
+			"results":   results,
+		}
+	}
+	return steps
+}
+
+func outcomeTargetKey(outcome *TaskOutcome) string {
+	if len(outcome.Targets) == 0 {
+		return outcome.ID
+	}
+	return strings.Join(outcome.Targets, ",")
+}
+
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func exprValueOf(value interface{}) ExprValue {
+	switch v := value.(type) {
+	case nil:
+		return NullValue()
+	case string:
+		return StringValue(v)
+	case bool:
+		return BoolValue(v)
+	case int:
+		return NumberValue(float64(v))
+	case int64:
+		return NumberValue(float64(v))
+	case float64:
+		return NumberValue(v)
+	case []interface{}:
+		items := make([]ExprValue, len(v))
+		for i, item := range v {
+			items[i] = exprValueOf(item)
+		}
+		return ListValue(items)
+	}
+	out, _ := json.Marshal(value)
+	return StringValue(string(out))
+}
+
+// diffWorkflowSteps сравнивает результаты задач двух шагов по целям и
+// выводит отчёт. Результат шага: changed и changes (число различий).
+func diffWorkflowSteps(diff *WorkflowDiff, from, to *WorkflowStepState) (map[string]interface{}, error) {
+	if from.Status != WorkflowStepSucceeded || to.Status != WorkflowStepSucceeded {
+		return nil, fmt.Errorf("сравнивать можно только успешные шаги: %s - %s, %s - %s",
+			from.Name, from.Status, to.Name, to.Status)
+	}
+
+	left, right := flattenStepResults(from), flattenStepResults(to)
+	keys := make(map[string]bool)
+	for key := range left {
+		keys[key] = true
+	}
+	for key := range right {
+		keys[key] = true
+	}
+
+	changes := make(map[string]map[string]interface{})
+	for key := range keys {
+		leftValue, leftOK := left[key]
+		rightValue, rightOK := right[key]
+		if leftOK && rightOK && leftValue == rightValue {
+			continue
+		}
+		status := "Modified"
+		if !rightOK {
+			status = fmt.Sprintf("Only in %s", from.Name)
+		} else if !leftOK {
+			status = fmt.Sprintf("Only in %s", to.Name)
+		}
+		changes[key] = map[string]interface{}{from.Name: leftValue, to.Name: rightValue, "status": status}
+	}
+
+	report := NewDiffReport(changes, from.Name, to.Name)
+	if len(changes) == 0 {
+		fmt.Println("✅ Различий нет")
+	} else if err := ExportDiff(os.Stdout, report, "text"); err != nil {
+		return nil, err
+	}
+	if diff.Output != "" {
+		if err := SaveDiffReport(report, diff.Output, diff.Format); err != nil {
+			return nil, err
+		}
+		fmt.Printf("Отчёт сохранён в %s\n", diff.Output)
+	}
+	return map[string]interface{}{"changed": len(changes) > 0, "changes": len(changes)}, nil
+}
+
+// flattenStepResults - результаты задач шага в виде <цель>.<поле> -> значение.
+func flattenStepResults(state *WorkflowStepState) map[string]string {
+	flat := make(map[string]string)
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(prefix+"."+key, v[key])
+			}
+		case string:
+			flat[prefix] = v
+		case []interface{}:
+			out, _ := json.Marshal(v)
+			flat[prefix] = string(out)
+		default:
+			flat[prefix] = fmt.Sprint(v)
+		}
+	}
+	for _, outcome := range state.Outcomes {
+		walk(outcomeTargetKey(outcome), outcome.Result)
+	}
+	return flat
+}
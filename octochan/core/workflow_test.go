@@ -0,0 +1,242 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeWorkflow(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wf.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadWorkflowErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		err      string
+	}{
+		{"no steps", "name: x\nsteps: []", "нет ни одного шага"},
+		{"unknown field", "steps:\n  - name: a\n    servce: mock_rlm_test", "field servce not found"},
+		{"missing name", "steps:\n  - service: mock_rlm_test", "не задано имя шага"},
+		{"bad name", "steps:\n  - name: a-b\n    service: mock_rlm_test", "может содержать только латиницу"},
+		{"reserved name", "steps:\n  - name: env\n    service: mock_rlm_test", "зарезервировано"},
+		{"duplicate name", "steps:\n  - name: a\n    service: mock_rlm_test\n  - name: a\n    service: mock_rlm_test", "уже описан"},
+		{"no kind", "steps:\n  - name: a", "ровно одно из scenario, service или diff"},
+		{"two kinds", "steps:\n  - name: a\n    service: mock_rlm_test\n    scenario: a.yaml", "ровно одно из scenario, service или diff"},
+		{"unknown service", "steps:\n  - name: a\n    service: nope", "сервис nope не зарегистрирован"},
+		{"parameters without service", "steps:\n  - name: a\n    scenario: a.yaml\n    parameters: {x: 1}", "задаются вместе с service"},
+		{"bad when", "steps:\n  - name: a\n    service: mock_rlm_test\n    when: 'a.succeeded &&'", "некорректное условие when"},
+		{"needs itself", "steps:\n  - name: a\n    service: mock_rlm_test\n    needs: [a]", "зависит сам от себя"},
+		{"needs unknown", "steps:\n  - name: a\n    service: mock_rlm_test\n    needs: [b]", "неизвестный шаг b"},
+		{
+			"cycle",
+			"steps:\n  - name: a\n    service: mock_rlm_test\n    needs: [c]\n  - name: b\n    service: mock_rlm_test\n    needs: [a]\n  - name: c\n    service: mock_rlm_test\n    needs: [b]",
+			"циклическая зависимость: a -> c -> b -> a",
+		},
+		{"diff without to", "steps:\n  - name: a\n    service: mock_rlm_test\n  - name: d\n    diff: {from: a}", "для diff нужны from и to"},
+		{
+			"diff of step not before it",
+			"steps:\n  - name: a\n    service: mock_rlm_test\n  - name: b\n    service: mock_rlm_test\n  - name: d\n    diff: {from: a, to: b}\n    needs: [a]\n  - name: e\n    service: mock_rlm_test\n    needs: [b]",
+			"diff ссылается на b, который не выполняется до него",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadWorkflow(writeWorkflow(t, tt.workflow))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("LoadWorkflow: %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWorkflowStagesAndNeeds(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+		stages   [][]string
+		needs    map[string][]string
+	}{
+		{
+			name:     "implicit sequence",
+			workflow: "steps:\n  - name: a\n    service: mock_rlm_test\n  - name: b\n    service: mock_rlm_test\n  - name: d\n    diff: {from: a, to: b}",
+			stages:   [][]string{{"a"}, {"b"}, {"d"}},
+			needs:    map[string][]string{"a": nil, "b": {"a"}, "d": {"b"}},
+		},
+		{
+			name: "graph",
+			workflow: `name: graph
+steps:
+  - name: a
+    service: mock_rlm_test
+  - name: b
+    service: mock_rlm_test
+    needs: [a]
+  - name: c
+    service: mock_rlm_test
+    needs: [a]
+  - name: d
+    diff: {from: b, to: c}
+    needs: [b, c]
+  - name: e
+    service: mock_rlm_test`,
+			stages: [][]string{{"a", "e"}, {"b", "c"}, {"d"}},
+			needs:  map[string][]string{"a": nil, "b": {"a"}, "d": {"b", "c"}, "e": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf, err := LoadWorkflow(writeWorkflow(t, tt.workflow))
+			if err != nil {
+				t.Fatalf("LoadWorkflow: %v", err)
+			}
+			if got := wf.Stages(); !reflect.DeepEqual(got, tt.stages) {
+				t.Errorf("Stages() = %v, want %v", got, tt.stages)
+			}
+			for step, want := range tt.needs {
+				if got := wf.Needs(step); !reflect.DeepEqual(got, want) {
+					t.Errorf("Needs(%s) = %v, want %v", step, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWorkflowAgainstMock(t *testing.T) {
+	_, _, client := startMockRLM(t, MockRLMConfig{
+		Default: MockServiceConfig{
+			Lifecycle: []string{"in_progress:1s", "success"},
+			Result:    map[string]interface{}{"next_service": "tuning"},
+		},
+		Services: map[string]MockServiceConfig{"broken": {FailRate: floatRate(1)}},
+	}, 100*time.Millisecond)
+
+	wf, err := LoadWorkflow(writeWorkflow(t, `name: mock
+steps:
+  - name: first
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+  - name: broken
+    service: mock_rlm_test
+    parameters: {rlm_service: broken}
+    targets: [{svm_ci: CI1}]
+    needs: [first]
+  - name: tolerated
+    service: mock_rlm_test
+    parameters: {rlm_service: broken}
+    targets: [{svm_ci: CI2}]
+    continue_on_error: true
+    needs: [first]
+  - name: after_tolerated
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI2}]
+    needs: [tolerated]
+  - name: after_broken
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+    needs: [broken]
+  - name: on_failure
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+    when: failure()
+    needs: [broken]
+  - name: cleanup
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+    when: always()
+    needs: [after_broken]
+  - name: flagged
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+    when: first.succeeded && env.flag
+    needs: [first]
+  - name: unflagged
+    service: mock_rlm_test
+    parameters: {rlm_service: tuning}
+    targets: [{svm_ci: CI1}]
+    when: not env.flag
+    needs: [first]
+  - name: templated
+    service: mock_rlm_test
+    parameters: {rlm_service: "{{ .steps.first.result.next_service }}"}
+    targets: [{svm_ci: CI1}]
+    needs: [first]
+  - name: compare
+    diff: {from: first, to: templated}
+    needs: [first, templated]
+`))
+	if err != nil {
+		t.Fatalf("LoadWorkflow: %v", err)
+	}
+
+	vars := ScenarioVars{Vars: map[string]interface{}{"flag": true}}
+	opts := ExecOptions{PollInterval: time.Millisecond, TaskTimeout: 10 * time.Second}
+	result := RunWorkflow(context.Background(), client, wf, vars, opts)
+
+	want := map[string]string{
+		"first":           WorkflowStepSucceeded,
+		"broken":          WorkflowStepFailed,
+		"tolerated":       WorkflowStepFailed,
+		"after_tolerated": WorkflowStepSucceeded,
+		"after_broken":    WorkflowStepSkipped,
+		"on_failure":      WorkflowStepSucceeded,
+		"cleanup":         WorkflowStepSucceeded,
+		"flagged":         WorkflowStepSucceeded,
+		"unflagged":       WorkflowStepSkipped,
+		"templated":       WorkflowStepSucceeded,
+		"compare":         WorkflowStepSucceeded,
+	}
+	got := make(map[string]string)
+	states := make(map[string]*WorkflowStepState)
+	for _, state := range result.Steps {
+		got[state.Name] = state.Status
+		states[state.Name] = state
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("статусы шагов = %v, want %v", got, want)
+	}
+	if failed := result.Failed(); !reflect.DeepEqual(failed, []string{"broken"}) {
+		t.Errorf("Failed() = %v, want [broken]", failed)
+	}
+	if states["broken"].Err == nil || len(states["broken"].Outcomes) != 1 {
+		t.Errorf("шаг broken: err %v, задач %d", states["broken"].Err, len(states["broken"].Outcomes))
+	}
+	if states["templated"].Outcomes[0].Service != "tuning" {
+		t.Errorf("шаблон .steps.first.result не подставлен: сервис %s", states["templated"].Outcomes[0].Service)
+	}
+	if changed := states["compare"].Result["changed"]; changed != false {
+		t.Errorf("compare: changed = %v, want false", changed)
+	}
+}
+
+func TestRunWorkflowCancelled(t *testing.T) {
+	wf, err := LoadWorkflow(writeWorkflow(t, "steps:\n  - name: a\n    service: mock_rlm_test\n  - name: b\n    service: mock_rlm_test\n    when: always()"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := RunWorkflow(ctx, nil, wf, ScenarioVars{}, ExecOptions{})
+	for _, state := range result.Steps {
+		if state.Status != WorkflowStepSkipped || state.Reason != "выполнение прервано" {
+			t.Errorf("шаг %s: %s (%s), want skipped после отмены", state.Name, state.Status, state.Reason)
+		}
+	}
+}
@@ -51,9 +51,9 @@ func loadModulesFromDir(dir string) {
 
 
 func init() {
-	core.RegisterScenarioModule("psqlse_tuningpgbouncer", NewPgBouncerTuningModule)
-	core.RegisterScenarioModule("psql_tuning_params_se", NewPsqlTuningParamsModule)
-	core.RegisterScenarioModule("postgresql_se_get_config_files", NewPostgresConfigFilesModule)
-	core.RegisterScenarioModule("pangolin_restart", NewPangolinRestartModule)
+	core.RegisterScenarioModule("psqlse_tuningpgbouncer", NewPgBouncerTuningModule, PgBouncerTuningSchema)
+	core.RegisterScenarioModule("psql_tuning_params_se", NewPsqlTuningParamsModule, PsqlTuningParamsSchema)
+	core.RegisterScenarioModule("postgresql_se_get_config_files", NewPostgresConfigFilesModule, PostgresConfigFilesSchema)
+	core.RegisterScenarioModule("pangolin_restart", NewPangolinRestartModule, PangolinRestartSchema)
 	AutoRegisterModules()
 }
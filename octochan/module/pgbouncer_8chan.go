@@ -4,16 +4,27 @@ import (
 	"fmt"
 	"octochan/core"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
 type PgBouncerTuningModule struct {
-	data *core.ScenarioData
+	data   *core.ScenarioData
+	client *core.RLMClient
+}
+
+// PgBouncerTuningSchema - параметры сценария psqlse_tuningpgbouncer. Параметры
+// вне схемы передаются в params запроса как есть.
+var PgBouncerTuningSchema = &core.ModuleSchema{
+	Description:     "настройка pgbouncer на серверах PostgreSQL SE",
+	TargetsRequired: true,
+	AllowExtra:      true,
+	Parameters: []*core.ParamSchema{
+		{Name: "role", Type: core.ParamString, Required: true, Description: "роль сервера", Enum: []string{"standalone", "replica"}},
+		{Name: "version", Type: core.ParamString, Required: true, Description: "версия ПО", Example: "1.21"},
+	},
 }
 
-func NewPgBouncerTuningModule(data *core.ScenarioData) (core.ScenarioModule, error) {
-	return &PgBouncerTuningModule{data: data}, nil
+func NewPgBouncerTuningModule(data *core.ScenarioData, client *core.RLMClient) (core.ScenarioModule, error) {
+	return &PgBouncerTuningModule{data: data, client: client}, nil
 }
 
 func (m *PgBouncerTuningModule) Validate() error {
@@ -27,26 +38,17 @@ func (m *PgBouncerTuningModule) Validate() error {
 		}
 	}
 
-	requiredParams := map[string]string{
-		"role":    "роль сервера (standalone/replica)",
-		"version": "версия ПО",
-	}
+	return nil
+}
 
-	for param, desc := range requiredParams {
-		if _, ok := m.data.Parameters[param]; !ok {
-			return fmt.Errorf("отсутствует обязательный параметр: %s (%s)", param, desc)
-		} else if val, ok := m.data.Parameters[param].(string); ok && val == "" {
-			return fmt.Errorf("параметр %s не может быть пустым", param)
-		}
+func (m *PgBouncerTuningModule) Steps() []core.ScenarioStep {
+	return []core.ScenarioStep{
+		{Name: "main", Description: "формирование запросов psqlse_tuningpgbouncer для каждого target", SideEffectFree: true},
 	}
-
-	return nil
 }
 
 func (m *PgBouncerTuningModule) GenerateRequests() ([]*core.APIRequest, error) {
 	var requests []*core.APIRequest
-	apiURL := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
 
 	basePayload := map[string]interface{}{
 		"service":  "psqlse_tuningpgbouncer",
@@ -79,16 +81,7 @@ func (m *PgBouncerTuningModule) GenerateRequests() ([]*core.APIRequest, error) {
 		}
 		payload["items"] = items
 
-		requests = append(requests, &core.APIRequest{
-			Method: "POST",
-			URL:    apiURL,
-			Headers: map[string]string{
-				"accept":        "application/json",
-				"Authorization": "Token " + token,
-				"Content-Type":  "application/json",
-			},
-			Body: payload,
-		})
+		requests = append(requests, m.client.NewRequest(payload))
 	}
 
 	return requests, nil
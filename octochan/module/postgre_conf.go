@@ -5,31 +5,29 @@ import (
 	"octochan/core"
 	"strings"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
 type PostgresConfigFilesModule struct {
-	data *core.ScenarioData
+	data   *core.ScenarioData
+	client *core.RLMClient
 }
 
-func NewPostgresConfigFilesModule(data *core.ScenarioData) (core.ScenarioModule, error) {
-	return &PostgresConfigFilesModule{data: data}, nil
+// PostgresConfigFilesSchema - параметры сценария postgresql_se_get_config_files.
+var PostgresConfigFilesSchema = &core.ModuleSchema{
+	Description:     "выгрузка файлов конфигурации PostgreSQL SE",
+	TargetsRequired: true,
+	Parameters: []*core.ParamSchema{
+		{Name: "port", Type: core.ParamInt, Required: true, Description: "порт PostgreSQL", Example: 5432},
+		{Name: "config_list", Type: core.ParamString, Required: true, Description: "файлы через запятую", Example: "postgresql.conf,pg_hba.conf"},
+		{Name: "itemname", Type: core.ParamString, Required: true, Description: "имя элемента в RLM", Example: "pgse"},
+	},
 }
 
-func (m *PostgresConfigFilesModule) Validate() error {
-	requiredParams := []string{
-		"port",
-		"config_list",
-		"itemname",
-	}
-
-	for _, param := range requiredParams {
-		if _, ok := m.data.Parameters[param]; !ok {
-			return fmt.Errorf("отсутствует обязательный параметр: %s", param)
-		}
-	}
+func NewPostgresConfigFilesModule(data *core.ScenarioData, client *core.RLMClient) (core.ScenarioModule, error) {
+	return &PostgresConfigFilesModule{data: data, client: client}, nil
+}
 
+func (m *PostgresConfigFilesModule) Validate() error {
 	if len(m.data.Targets) == 0 {
 		return fmt.Errorf("не указаны целевые серверы (targets)")
 	}
@@ -43,10 +41,14 @@ func (m *PostgresConfigFilesModule) Validate() error {
 	return nil
 }
 
+func (m *PostgresConfigFilesModule) Steps() []core.ScenarioStep {
+	return []core.ScenarioStep{
+		{Name: "main", Description: "формирование запросов postgresql_se_get_config_files для каждого target", SideEffectFree: true},
+	}
+}
+
 func (m *PostgresConfigFilesModule) GenerateRequests() ([]*core.APIRequest, error) {
 	var requests []*core.APIRequest
-	apiURL := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
 
 	// Базовый payload
 	basePayload := map[string]interface{}{
@@ -79,16 +81,7 @@ func (m *PostgresConfigFilesModule) GenerateRequests() ([]*core.APIRequest, erro
 		}
 		payload["items"] = items
 
-		requests = append(requests, &core.APIRequest{
-			Method: "POST",
-			URL:    apiURL,
-			Headers: map[string]string{
-				"accept":        "application/json",
-				"Authorization": "Token " + token,
-				"Content-Type":  "application/json",
-			},
-			Body: payload,
-		})
+		requests = append(requests, m.client.NewRequest(payload))
 	}
 
 	return requests, nil
@@ -0,0 +1,295 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"octochan/core"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupCurrentValues сохраняет текущие значения изменяемых параметров на
+// каждом CI в снапшот хранилища бэкапов: дерево снапшота - значения по CI
+// (незаданные явно - значения по умолчанию), Restore - сценарий
+// psql_tuning_params_se, который их возвращает. Задачи основного запроса
+// привязываются к снапшоту в TaskCreated.
+func (m *PsqlTuningParamsModule) backupCurrentValues(ctx context.Context) error {
+	names := m.changedParams()
+	if !m.getBoolParam("backup", true) || len(names) == 0 {
+		return nil
+	}
+
+	var cis []string
+	for _, target := range m.data.Targets {
+		cis = append(cis, target.GetCIs()...)
+	}
+	log.Printf("📸 Сохранение текущих значений %s для %d CI", strings.Join(names, ", "), len(cis))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		current  = make(map[string]map[string]string, len(cis))
+	)
+	for _, ci := range cis {
+		wg.Add(1)
+		go func(ci string) {
+			defer wg.Done()
+			values, err := m.currentValues(ctx, ci, names)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("CI %s: %w", ci, err)
+				}
+				return
+			}
+			current[ci] = values
+		}(ci)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	tree := make(map[string]map[string]string)
+	restore := &core.SnapshotRestore{Service: "psql_tuning_params_se", Parameters: make(map[string]map[string]interface{})}
+	for _, ci := range cis {
+		values := current[ci]
+		var defaults, unknown []string
+		for _, name := range names {
+			if _, ok := values[name]; ok {
+				continue
+			}
+			if value, ok := core.PgDefaultValue(name); ok {
+				values[name] = value
+				defaults = append(defaults, name)
+			} else {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			return fmt.Errorf("CI %s: %s не заданы явно, а значение по умолчанию неизвестно (задайте его в секции pg_defaults конфига)",
+				ci, strings.Join(unknown, ", "))
+		}
+		if len(defaults) > 0 {
+			fmt.Printf("ℹ️ CI %s: %s не заданы явно, для отката сохранены значения по умолчанию\n", ci, strings.Join(defaults, ", "))
+		}
+		params, err := m.restoreParams(ci, values)
+		if err != nil {
+			return err
+		}
+		tree[ci] = values
+		restore.Parameters[ci] = params
+	}
+
+	store, err := core.BackupSnapshotStore()
+	if err != nil {
+		return err
+	}
+	snapshot, err := store.CommitBackup(tree, restore, backupAuthor(),
+		fmt.Sprintf("backup psql_tuning_params_se: %s", strings.Join(cis, ", ")))
+	if err != nil {
+		return err
+	}
+
+	m.backupStore, m.backupID = store, snapshot.ID
+	fmt.Printf("📸 Текущие значения сохранены в снапшот %s (откат: ochan rollback %s)\n", snapshot.ID[:12], snapshot.ID[:12])
+	return nil
+}
+
+// TaskCreated привязывает задачу к снапшоту значений до изменения, чтобы
+// ochan rollback <task-id> откатил именно её CI.
+func (m *PsqlTuningParamsModule) TaskCreated(taskID string, req *core.APIRequest) {
+	if m.backupStore == nil {
+		return
+	}
+	targets := core.RequestTargets(req.Body)
+	if len(targets) == 0 {
+		return
+	}
+
+	m.backupMu.Lock()
+	defer m.backupMu.Unlock()
+	if err := m.backupStore.AttachTask(m.backupID, taskID, targets[0]); err != nil {
+		fmt.Printf("⚠️ Задача %s не привязана к снапшоту %s: %v\n", taskID, m.backupID[:12], err)
+	}
+}
+
+// changedParams - имена параметров postgresql.conf из сценария.
+func (m *PsqlTuningParamsModule) changedParams() []string {
+	var names []string
+	for _, param := range m.prepareDBParams() {
+		if param.Name != "" {
+			names = append(names, param.Name)
+		}
+	}
+	return names
+}
+
+// currentValues читает значения names на CI из backup_config или задачей
+// postgresql_se_get_config_files.
+func (m *PsqlTuningParamsModule) currentValues(ctx context.Context, svmCI string, names []string) (map[string]string, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	values := make(map[string]string)
+
+	if path := m.getStringParam("backup_config", ""); path != "" {
+		path = strings.ReplaceAll(path, "{svm_ci}", svmCI)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка чтения backup_config: %w", err)
+		}
+		collectConfigValues(string(content), wanted, values)
+		return values, nil
+	}
+
+	items, err := core.PrepareScenarioItems([]core.Target{{SVMCI: svmCI}})
+	if err != nil {
+		return nil, err
+	}
+	payload := map[string]interface{}{
+		"service":  "postgresql_se_get_config_files",
+		"start_at": "now",
+		"datetime": time.Now().Format(time.RFC3339),
+		"params": map[string]interface{}{
+			"hosts": []map[string]interface{}{{
+				"port":        m.getIntParam("port", 5432),
+				"itemname":    m.getStringParam("backup_itemname", "pgse"),
+				"config_list": []string{"postgresql.conf"},
+			}},
+		},
+		"items": items,
+	}
+
+	taskID, err := m.client.Submit(ctx, m.client.NewRequest(payload))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("⏳ CI %s: чтение postgresql.conf, задача %s", svmCI, taskID)
+
+	status, err := core.WaitForTaskStatus(ctx, m.client, taskID, core.DefaultExecOptions())
+	if err != nil {
+		return nil, fmt.Errorf("задача %s: %w", taskID, err)
+	}
+	if taskStatus, _ := status["status"].(string); !core.IsSuccessfulTaskStatus(taskStatus) {
+		return nil, fmt.Errorf("задача %s завершилась со статусом %s", taskID, taskStatus)
+	}
+	collectConfigValues(core.TaskResultFields(status), wanted, values)
+	return values, nil
+}
+
+// collectConfigValues ищет значения wanted в результате сервиса, не завися
+// от его формы: словари name: value, строки pg_settings {name, setting,
+// unit} и содержимое postgresql.conf в строках.
+func collectConfigValues(value interface{}, wanted map[string]bool, values map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if name := getString(v["name"]); wanted[name] && v["setting"] != nil {
+			values[name] = core.FormatPgSetting(configValueString(v["setting"]), getString(v["unit"]))
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			switch field := v[key].(type) {
+			case string, int, float64, bool:
+				if wanted[key] {
+					values[key] = configValueString(field)
+					continue
+				}
+			}
+			collectConfigValues(v[key], wanted, values)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectConfigValues(item, wanted, values)
+		}
+	case string:
+		if !strings.Contains(v, "=") {
+			return
+		}
+		config, err := core.ParseConfig(v)
+		if err != nil {
+			return
+		}
+		for _, section := range config {
+			for key, setting := range section {
+				if wanted[key] {
+					values[key] = setting
+				}
+			}
+		}
+	}
+}
+
+// configValueString выводит значение из JSON результата: числа - без
+// экспоненты (524288, а не 5.24288e+05).
+func configValueString(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return getString(value)
+}
+
+// restoreParams - параметры сценария psql_tuning_params_se, возвращающего
+// values на CI. IP реплики фиксируется, так как откат может затронуть не
+// все CI исходного target.
+func (m *PsqlTuningParamsModule) restoreParams(svmCI string, values map[string]string) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(m.data.Parameters))
+	for key, value := range m.data.Parameters {
+		if key != "parameters" && key != "backup_config" {
+			params[key] = value
+		}
+	}
+	ip, err := m.replicaIP(svmCI)
+	if err != nil {
+		return nil, err
+	}
+	params["ip_replics"] = ip
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var list []interface{}
+	for _, name := range names {
+		setting, unit := splitPgSetting(values[name])
+		list = append(list, map[string]interface{}{"name": name, "setting": setting, "unit": unit})
+	}
+	params["parameters"] = list
+	return params, nil
+}
+
+var pgSettingRe = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)\s*([a-zA-Z]+)$`)
+
+// splitPgSetting делит значение вида 8GB на setting и unit сценария.
+func splitPgSetting(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	if matches := pgSettingRe.FindStringSubmatch(value); matches != nil {
+		return matches[1], matches[2]
+	}
+	return value, ""
+}
+
+func backupAuthor() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return "system"
+}
@@ -0,0 +1,80 @@
+package module
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCollectConfigValues(t *testing.T) {
+	wanted := map[string]bool{"shared_buffers": true, "effective_cache_size": true, "max_connections": true, "archive_timeout": true}
+	tests := []struct {
+		name   string
+		result string
+		want   map[string]string
+	}{
+		{
+			name: "pg_settings rows",
+			result: `{"settings": [
+				{"name": "shared_buffers", "setting": "16384", "unit": "8kB"},
+				{"name": "effective_cache_size", "setting": 524288, "unit": "8kB"},
+				{"name": "max_connections", "setting": 100, "unit": null},
+				{"name": "archive_timeout", "setting": "300", "unit": "s"},
+				{"name": "work_mem", "setting": "4096", "unit": "kB"}
+			]}`,
+			want: map[string]string{"shared_buffers": "128MB", "effective_cache_size": "4GB", "max_connections": "100", "archive_timeout": "5min"},
+		},
+		{
+			name:   "pg_settings special values",
+			result: `[{"name": "shared_buffers", "setting": "0", "unit": "8kB"}, {"name": "archive_timeout", "setting": "-1", "unit": "s"}]`,
+			want:   map[string]string{"shared_buffers": "0", "archive_timeout": "-1"},
+		},
+		{
+			name:   "name: value map",
+			result: `{"config": {"shared_buffers": "8GB", "max_connections": 500, "effective_cache_size": 1.5e6, "fsync": "on"}}`,
+			want:   map[string]string{"shared_buffers": "8GB", "max_connections": "500", "effective_cache_size": "1500000"},
+		},
+		{
+			name:   "postgresql.conf content",
+			result: `{"files": [{"name": "postgresql.conf", "content": "shared_buffers = '4GB'\nmax_connections = 300 # comment\nwork_mem = 4MB\n"}]}`,
+			want:   map[string]string{"shared_buffers": "4GB", "max_connections": "300"},
+		},
+		{
+			name:   "nothing found",
+			result: `{"status": "success", "message": "no config"}`,
+			want:   map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result interface{}
+			if err := json.Unmarshal([]byte(tt.result), &result); err != nil {
+				t.Fatal(err)
+			}
+			values := make(map[string]string)
+			collectConfigValues(result, wanted, values)
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("collectConfigValues = %v, want %v", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPgSetting(t *testing.T) {
+	tests := []struct {
+		value, setting, unit string
+	}{
+		{"128MB", "128", "MB"},
+		{"5min", "5", "min"},
+		{"0.9", "0.9", ""},
+		{"-1", "-1", ""},
+		{"on", "on", ""},
+		{" 4 GB ", "4", "GB"},
+	}
+	for _, tt := range tests {
+		setting, unit := splitPgSetting(tt.value)
+		if setting != tt.setting || unit != tt.unit {
+			t.Errorf("splitPgSetting(%q) = %q, %q; want %q, %q", tt.value, setting, unit, tt.setting, tt.unit)
+		}
+	}
+}
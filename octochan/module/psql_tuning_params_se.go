@@ -1,10 +1,9 @@
 package module
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"octochan/core"
@@ -12,8 +11,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
 type IntelItem struct {
@@ -62,9 +59,15 @@ type MainPayload struct {
 
 type PsqlTuningParamsModule struct {
 	data          *core.ScenarioData
+	client        *core.RLMClient
 	intelTaskMap  map[string]int
 	useTableRowID bool
 	lastStatuses  map[int]string
+
+	// Снапшот значений до изменения, к которому привязываются задачи.
+	backupMu    sync.Mutex
+	backupStore *core.SnapshotStore
+	backupID    string
 }
 
 type IntelTaskResult struct {
@@ -74,9 +77,41 @@ type IntelTaskResult struct {
 	CompletedAt string `json:"completed_at"`
 }
 
-func NewPsqlTuningParamsModule(data *core.ScenarioData) (core.ScenarioModule, error) {
+// PsqlTuningParamsSchema - параметры сценария psql_tuning_params_se.
+var PsqlTuningParamsSchema = &core.ModuleSchema{
+	Description:     "настройка параметров PostgreSQL SE: разведка по каждому CI, затем применение параметров",
+	TargetsRequired: true,
+	Parameters: []*core.ParamSchema{
+		{Name: "role", Type: core.ParamString, Required: true, Description: "роль сервера в кластере", Example: "standalone"},
+		{Name: "port", Type: core.ParamInt, Required: true, Description: "порт PostgreSQL", Example: 5432},
+		{Name: "svm_ip", Type: core.ParamString, Required: true, Description: "IP сервера", Example: "10.0.0.1"},
+		{Name: "ip_replics", Type: core.ParamString, Required: true, Description: "IP реплик через запятую, по порядку CI в targets", Example: "10.0.0.2,10.0.0.3"},
+		{Name: "hugepages", Type: core.ParamBool, Required: true, Description: "использовать huge pages", Example: true},
+		{Name: "restart", Type: core.ParamBool, Default: false, Description: "перезапустить PostgreSQL после применения"},
+		{Name: "skip_sm_conflicts", Type: core.ParamBool, Default: true, Description: "пропускать конфликты с SM"},
+		{Name: "backup", Type: core.ParamBool, Default: true, Description: "сохранить текущие значения параметров в снапшот для ochan rollback"},
+		{Name: "backup_config", Type: core.ParamString, Default: "", Description: "взять текущие значения из файла postgresql.conf вместо postgresql_se_get_config_files ({svm_ci} заменяется на CI)", Example: "confs/{svm_ci}.conf"},
+		{Name: "backup_itemname", Type: core.ParamString, Default: "pgse", Description: "itemname для postgresql_se_get_config_files при сохранении значений"},
+		{
+			Name:        "parameters",
+			Type:        core.ParamList,
+			Description: "параметры postgresql.conf",
+			Items: &core.ParamSchema{
+				Type: core.ParamObject,
+				Fields: []*core.ParamSchema{
+					{Name: "name", Type: core.ParamString, Required: true, Description: "имя параметра", Example: "shared_buffers"},
+					{Name: "setting", Type: core.ParamString, Required: true, Description: "значение без единиц", Example: "16"},
+					{Name: "unit", Type: core.ParamString, Default: "", Description: "единицы: kB, MB, GB, ms, s", Example: "GB"},
+				},
+			},
+		},
+	},
+}
+
+func NewPsqlTuningParamsModule(data *core.ScenarioData, client *core.RLMClient) (core.ScenarioModule, error) {
 	return &PsqlTuningParamsModule{
 		data:          data,
+		client:        client,
 		intelTaskMap:  make(map[string]int),
 		useTableRowID: false,
 		lastStatuses:  make(map[int]string),
@@ -94,32 +129,20 @@ func (m *PsqlTuningParamsModule) Validate() error {
 		}
 	}
 
-	requiredParams := []string{"role", "port", "svm_ip", "hugepages"}
-	for _, param := range requiredParams {
-		if val, ok := m.data.Parameters[param]; !ok || val == "" {
-			return fmt.Errorf("отсутствует обязательный параметр: %s", param)
-		}
-	}
-
-	if tuningParams, ok := m.data.Parameters["parameters"]; ok {
-		if paramList, ok := tuningParams.([]interface{}); ok {
-			for i, p := range paramList {
-				if param, ok := p.(map[string]interface{}); ok {
-					if param["name"] == "" || param["setting"] == "" {
-						return fmt.Errorf("неполный параметр настройки #%d: требуется name и setting", i+1)
-					}
-				} else {
-					return fmt.Errorf("неверный формат параметра настройки #%d", i+1)
-				}
-			}
-		}
-	}
-
+	// Обязательные параметры и формат parameters проверяет PsqlTuningParamsSchema.
 	return nil
 }
 
 func (m *PsqlTuningParamsModule) GenerateRequests() ([]*core.APIRequest, error) {
-	var requests []*core.APIRequest
+	return m.GenerateRequestsContext(context.Background())
+}
+
+// GenerateRequestsContext позволяет прервать ожидание разведки по Ctrl+C
+// или общему таймауту apply.
+func (m *PsqlTuningParamsModule) GenerateRequestsContext(ctx context.Context) ([]*core.APIRequest, error) {
+	if err := m.backupCurrentValues(ctx); err != nil {
+		return nil, fmt.Errorf("не удалось сохранить текущие значения параметров (отключить: backup: false): %w", err)
+	}
 
 	intelTaskMap, intelTasks, err := m.startIntelForAllTargets()
 	if err != nil {
@@ -133,38 +156,73 @@ func (m *PsqlTuningParamsModule) GenerateRequests() ([]*core.APIRequest, error)
 	}
 
 	log.Printf("⏳ Ожидаем завершения %d задач разведки...", len(intelTasks))
-	results, err := m.MonitorIntelTasks(intelTasks)
+	results, err := m.MonitorIntelTasks(ctx, intelTasks)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка мониторинга задач разведки: %w", err)
 	}
 
 	log.Printf("✅ Все задачи разведки завершены успешно")
 
+	requests, err := m.buildMainRequests(func(svmCI string) (int, string, error) {
+		taskID, exists := intelTaskMap[svmCI]
+		if !exists {
+			return 0, "", fmt.Errorf("не найден taskID для CI %s", svmCI)
+		}
+		intelResult, exists := results[taskID]
+		if !exists {
+			return 0, "", fmt.Errorf("не найден результат разведки для taskID %d", taskID)
+		}
+		return taskID, intelResult.TableID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, req := range requests {
+		jsonData, _ := json.MarshalIndent(req.Body, "", "  ")
+		log.Printf("🔍 Запрос #%d:\n%s", i+1, string(jsonData))
+	}
+
+	log.Printf("✅ Создано %d основных запросов", len(requests))
+	return requests, nil
+}
+
+// Steps: разведка запускает задачи psql_tuning_params_se_sys в RLM, поэтому
+// в dry-run вместо GenerateRequests используется PlanRequests.
+func (m *PsqlTuningParamsModule) Steps() []core.ScenarioStep {
+	return []core.ScenarioStep{
+		{Name: "backup", Description: "сохранение текущих значений параметров в снапшот (postgresql_se_get_config_files или backup_config)"},
+		{Name: "intel", Description: "запуск задач разведки psql_tuning_params_se_sys для каждого CI"},
+		{Name: "wait-intel", Description: "опрос RLM до завершения разведки"},
+		{Name: "main", Description: "формирование запросов psql_tuning_params_se с task_id разведки", SideEffectFree: true},
+	}
+}
+
+// PlanRequests строит основные запросы без разведки: task_id в них равен 0
+// и будет заменён номером задачи разведки при реальном запуске.
+func (m *PsqlTuningParamsModule) PlanRequests() ([]*core.APIRequest, error) {
+	return m.buildMainRequests(func(string) (int, string, error) {
+		return 0, "", nil
+	})
+}
+
+// buildMainRequests формирует основной запрос для каждого CI. intelFor
+// возвращает task_id и table_id разведки для CI.
+func (m *PsqlTuningParamsModule) buildMainRequests(intelFor func(svmCI string) (int, string, error)) ([]*core.APIRequest, error) {
+	var requests []*core.APIRequest
 	for _, target := range m.data.Targets {
 		for _, svmCI := range target.GetCIs() {
-			taskID, exists := intelTaskMap[svmCI]
-			if !exists {
-				return nil, fmt.Errorf("не найден taskID для CI %s", svmCI)
-			}
-
-			intelResult, exists := results[taskID]
-			if !exists {
-				return nil, fmt.Errorf("не найден результат разведки для taskID %d", taskID)
+			taskID, intelTableID, err := intelFor(svmCI)
+			if err != nil {
+				return nil, err
 			}
 
-			req, err := m.tryCreateMainRequest(svmCI, taskID, intelResult.TableID)
+			req, err := m.tryCreateMainRequest(svmCI, taskID, intelTableID)
 			if err != nil {
 				return nil, fmt.Errorf("ошибка создания основного запроса для CI %s: %w", svmCI, err)
 			}
 			requests = append(requests, req)
 		}
 	}
-	for i, req := range requests {
-		jsonData, _ := json.MarshalIndent(req.Body, "", "  ")
-		log.Printf("🔍 Запрос #%d:\n%s", i+1, string(jsonData))
-	}
-
-	log.Printf("✅ Создано %d основных запросов", len(requests))
 	return requests, nil
 }
 
@@ -299,9 +357,6 @@ func (m *PsqlTuningParamsModule) sendIntelRequest(svmCI string) (int, error) {
 }
 
 func (m *PsqlTuningParamsModule) trySendIntelRequest(svmCI, tableID string, useTableRowID bool) (int, error) {
-	apiURL := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
-
 	intelPayload := map[string]interface{}{
 		"service":  "psql_tuning_params_se_sys",
 		"start_at": "now",
@@ -318,72 +373,23 @@ func (m *PsqlTuningParamsModule) trySendIntelRequest(svmCI, tableID string, useT
 		m.useTableRowID = true
 	}
 
-	jsonData, err := json.Marshal(intelPayload)
-	if err != nil {
-		return 0, fmt.Errorf("ошибка маршалинга JSON: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	id, err := m.client.Submit(context.Background(), m.client.NewRequest(intelPayload))
 	if err != nil {
-		return 0, fmt.Errorf("ошибка создания запроса: %w", err)
+		return 0, err
 	}
-
-	req.Header.Set("Authorization", "Token "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	taskID, err := strconv.Atoi(id)
 	if err != nil {
-		return 0, fmt.Errorf("ошибка HTTP запроса: %w", err)
+		return 0, fmt.Errorf("неожиданный ID задачи разведки: %s", id)
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	var result struct {
-		ID int `json:"id"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, fmt.Errorf("ошибка парсинга ответа: %w", err)
-	}
-
-	log.Printf("✅ Задача разведки создана для CI %s с table_id %s: %极", svmCI, tableID, result.ID)
-	return result.ID, nil
+	log.Printf("✅ Задача разведки создана для CI %s с table_id %s: %d", svmCI, tableID, taskID)
+	return taskID, nil
 }
 
 func (m *PsqlTuningParamsModule) createMainRequest(svmCI string, taskID int, tableID string) (*core.APIRequest, error) {
-	url := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
-
-	ipReplicsStr, ok := m.data.Parameters["ip_replics"].(string)
-	if !ok {
-		return nil, fmt.Errorf("ip_replics должен быть строкой")
-	}
-
-	ipReplics := strings.Split(ipReplicsStr, ",")
-	var targetIP string
-	for _, target := range m.data.Targets {
-		for j, ci := range target.GetCIs() {
-			if ci == svmCI && j < len(ipReplics) {
-				targetIP = strings.TrimSpace(ipReplics[j])
-				break
-			}
-		}
-		if targetIP != "" {
-			break
-		}
-	}
-
-	if targetIP == "" {
-		if len(ipReplics) > 0 {
-			targetIP = strings.TrimSpace(ipReplics[0])
-		} else {
-			return nil, fmt.Errorf("не найден IP для CI %s", svmCI)
-		}
+	targetIP, err := m.replicaIP(svmCI)
+	if err != nil {
+		return nil, err
 	}
 
 	params := MainParams{
@@ -424,16 +430,39 @@ func (m *PsqlTuningParamsModule) createMainRequest(svmCI string, taskID int, tab
 		return nil, fmt.Errorf("ошибка преобразования в map: %w", err)
 	}
 
-	return &core.APIRequest{
-		Method: "POST",
-		URL:    url,
-		Headers: map[string]string{
-			"Authorization": "Token " + token,
-			"Content-Type":  "application/json",
-			"Accept":        "application/json",
-		},
-		Body: bodyMap,
-	}, nil
+	return m.client.NewRequest(bodyMap), nil
+}
+
+// replicaIP - IP из ip_replics для CI: по позиции CI в своём target,
+// иначе первый.
+func (m *PsqlTuningParamsModule) replicaIP(svmCI string) (string, error) {
+	ipReplicsStr, ok := m.data.Parameters["ip_replics"].(string)
+	if !ok {
+		return "", fmt.Errorf("ip_replics должен быть строкой")
+	}
+
+	ipReplics := strings.Split(ipReplicsStr, ",")
+	var targetIP string
+	for _, target := range m.data.Targets {
+		for j, ci := range target.GetCIs() {
+			if ci == svmCI && j < len(ipReplics) {
+				targetIP = strings.TrimSpace(ipReplics[j])
+				break
+			}
+		}
+		if targetIP != "" {
+			break
+		}
+	}
+
+	if targetIP == "" {
+		if len(ipReplics) > 0 {
+			targetIP = strings.TrimSpace(ipReplics[0])
+		} else {
+			return "", fmt.Errorf("не найден IP для CI %s", svmCI)
+		}
+	}
+	return targetIP, nil
 }
 
 func (m *PsqlTuningParamsModule) prepareDBParams() []DBParam {
@@ -511,7 +540,7 @@ func (m *PsqlTuningParamsModule) getIntParam(key string, defaultValue int) int {
 	return defaultValue
 }
 
-func (m *PsqlTuningParamsModule) MonitorIntelTasks(taskIDs []int) (map[int]*IntelTaskResult, error) {
+func (m *PsqlTuningParamsModule) MonitorIntelTasks(ctx context.Context, taskIDs []int) (map[int]*IntelTaskResult, error) {
 	results := make(map[int]*IntelTaskResult)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
@@ -522,9 +551,9 @@ func (m *PsqlTuningParamsModule) MonitorIntelTasks(taskIDs []int) (map[int]*Inte
 		go func(id int) {
 			defer wg.Done()
 
-			result, err := m.waitForIntelTaskCompletion(id)
+			result, err := m.waitForIntelTaskCompletion(ctx, id)
 			if err != nil {
-				errorChan <- fmt.Errorf("ошибка ожидания задачи %极: %w", id, err)
+				errorChan <- fmt.Errorf("ошибка ожидания задачи %d: %w", id, err)
 				return
 			}
 
@@ -544,11 +573,7 @@ func (m *PsqlTuningParamsModule) MonitorIntelTasks(taskIDs []int) (map[int]*Inte
 	return results, nil
 }
 
-func (m *PsqlTuningParamsModule) waitForIntelTaskCompletion(taskID int) (*IntelTaskResult, error) {
-	baseURL := strings.TrimSuffix(viper.GetString("defaults.api_url"), ".json")
-	statusURL := fmt.Sprintf("%s/%d/", baseURL, taskID)
-	token := viper.GetString("defaults.api_token")
-
+func (m *PsqlTuningParamsModule) waitForIntelTaskCompletion(ctx context.Context, taskID int) (*IntelTaskResult, error) {
 	timeout := time.After(5 * time.Minute)
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
@@ -557,10 +582,12 @@ func (m *PsqlTuningParamsModule) waitForIntelTaskCompletion(taskID int) (*IntelT
 
 	for {
 		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("ожидание задачи %d прервано: %w", taskID, context.Cause(ctx))
 		case <-timeout:
 			return nil, fmt.Errorf("превышено время ожидания задачи %d", taskID)
 		case <-ticker.C:
-			status, err := m.getTaskStatus(statusURL, token, taskID)
+			status, err := m.getTaskStatus(ctx, taskID)
 			if err != nil {
 				log.Printf("⚠️ Временная ошибка получения статуса задачи %d: %v", taskID, err)
 				continue
@@ -587,36 +614,13 @@ func (m *PsqlTuningParamsModule) waitForIntelTaskCompletion(taskID int) (*IntelT
 	}
 }
 
-func (m *PsqlTuningParamsModule) getTaskStatus(url, token string, taskID int) (*IntelTaskResult, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка создания запроса статуса: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Token "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка запроса статуса: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusNotFound {
+func (m *PsqlTuningParamsModule) getTaskStatus(ctx context.Context, taskID int) (*IntelTaskResult, error) {
+	result, err := m.client.TaskStatus(ctx, strconv.Itoa(taskID))
+	if apiErr, ok := err.(*core.APIError); ok && apiErr.StatusCode == http.StatusNotFound {
 		return nil, fmt.Errorf("разведочная задача не найдена")
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ошибка API (код %d): %s", resp.StatusCode, string(body))
-	}
-
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("ошибка парсинга ответа: %w", err)
+	if err != nil {
+		return nil, err
 	}
 
 	intelResult := &IntelTaskResult{
@@ -7,8 +7,6 @@ import (
 	"octochan/core"
 	"strings"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
 type PangolinRestartItem struct {
@@ -44,12 +42,25 @@ type PangolinRestartPayload struct {
 }
 
 type PangolinRestartModule struct {
-	data *core.ScenarioData
+	data   *core.ScenarioData
+	client *core.RLMClient
+}
+
+// PangolinRestartSchema - параметры сценария pangolin_restart. Вместо targets
+// можно передать items с полями инвентаря RLM.
+var PangolinRestartSchema = &core.ModuleSchema{
+	Description: "перезапуск Pangolin по targets или items",
+	Parameters: []*core.ParamSchema{
+		{Name: "restart", Type: core.ParamString, Required: true, Description: "режим перезапуска", Example: "true"},
+		{Name: "skip_sm_conflicts", Type: core.ParamBool, Required: true, Description: "пропускать конфликты с SM", Example: false},
+		{Name: "confirm", Type: core.ParamBool, Required: true, Description: "подтверждение перезапуска", Example: true},
+	},
 }
 
-func NewPangolinRestartModule(data *core.ScenarioData) (core.ScenarioModule, error) {
+func NewPangolinRestartModule(data *core.ScenarioData, client *core.RLMClient) (core.ScenarioModule, error) {
 	return &PangolinRestartModule{
-		data: data,
+		data:   data,
+		client: client,
 	}, nil
 }
 
@@ -94,17 +105,16 @@ func (m *PangolinRestartModule) Validate() error {
 		}
 	}
 
-	// Проверяем обязательные параметры
-	requiredParams := []string{"restart", "skip_sm_conflicts", "confirm"}
-	for _, param := range requiredParams {
-		if _, ok := m.data.Parameters[param]; !ok {
-			return fmt.Errorf("отсутствует обязательный параметр: %s", param)
-		}
-	}
-
+	// Обязательные параметры проверяет PangolinRestartSchema.
 	return nil
 }
 
+func (m *PangolinRestartModule) Steps() []core.ScenarioStep {
+	return []core.ScenarioStep{
+		{Name: "main", Description: "формирование запросов pangolin_restart из items и targets", SideEffectFree: true},
+	}
+}
+
 func (m *PangolinRestartModule) GenerateRequests() ([]*core.APIRequest, error) {
 	var requests []*core.APIRequest
 
@@ -133,9 +143,6 @@ func (m *PangolinRestartModule) GenerateRequests() ([]*core.APIRequest, error) {
 }
 
 func (m *PangolinRestartModule) createRequestFromItems() (*core.APIRequest, error) {
-	url := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
-
 	// Подготавливаем параметры
 	params := PangolinRestartParams{
 		Restart:         m.getStringParam("restart", ""),
@@ -171,12 +178,10 @@ func (m *PangolinRestartModule) createRequestFromItems() (*core.APIRequest, erro
 		items = append(items, item)
 	}
 
-	return m.createAPIRequest(url, token, params, items)
+	return m.createAPIRequest(params, items)
 }
 
 func (m *PangolinRestartModule) createRequestFromTarget(target core.Target) (*core.APIRequest, error) {
-	url := viper.GetString("defaults.api_url")
-	token := viper.GetString("defaults.api_token")
 	params := PangolinRestartParams{
 		Restart:         m.getStringParam("restart", ""),
 		SkipSMConflicts: m.getBoolParam("skip_sm_conflicts", false),
@@ -200,10 +205,10 @@ func (m *PangolinRestartModule) createRequestFromTarget(target core.Target) (*co
 		items = append(items, item)
 	}
 
-	return m.createAPIRequest(url, token, params, items)
+	return m.createAPIRequest(params, items)
 }
 
-func (m *PangolinRestartModule) createAPIRequest(url, token string, params PangolinRestartParams, items []PangolinRestartItem) (*core.APIRequest, error) {
+func (m *PangolinRestartModule) createAPIRequest(params PangolinRestartParams, items []PangolinRestartItem) (*core.APIRequest, error) {
 
 	payload := PangolinRestartPayload{
 		Service:  "pangolin_restart",
@@ -225,16 +230,7 @@ func (m *PangolinRestartModule) createAPIRequest(url, token string, params Pango
 		return nil, fmt.Errorf("ошибка преобразования в map: %w", err)
 	}
 
-	return &core.APIRequest{
-		Method: "POST",
-		URL:    url,
-		Headers: map[string]string{
-			"Authorization": "Token " + token,
-			"Content-Type":  "application/json",
-			"Accept":        "application/json",
-		},
-		Body: bodyMap,
-	}, nil
+	return m.client.NewRequest(bodyMap), nil
 }
 
 func (m *PangolinRestartModule) getStringParam(key string, defaultValue string) string {